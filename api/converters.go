@@ -28,19 +28,32 @@
 package api
 
 import (
+	"math"
+	"net/http"
 	"time"
 
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/config"
 	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
 	"github.com/rs/zerolog"
 )
 
-func domainMetricFromPutMetric(src putMetricRequest, logger zerolog.Logger) (domain.PendingMetric, error) {
+// errInvalidTimestamp is returned if a metric's timestamp is outside of the
+// configured limits.
+var errInvalidTimestamp = domain.ErrInvalidTimestamp
+
+func domainMetricFromPutMetric(src putMetricRequest, timestamps config.Timestamps, logger zerolog.Logger) (domain.PendingMetric, error) {
 	var err error
 	var dst domain.PendingMetric
 	dst.Name = src.Name
 	dst.Units = src.Units
-	dst.Reported = time.Now()
-	dst.TTL = time.Duration(src.TTL) * time.Second
+	dst.Labels = labelsOrNil(src.Labels)
+	dst.Reported, err = reportedTime(src.Timestamp, time.Now(), timestamps)
+	if err != nil {
+		return domain.PendingMetric{}, err
+	}
+	if !src.Persistent && src.TTL != nil {
+		dst.TTL = time.Duration(*src.TTL) * time.Second
+	}
 
 	dst.Type, err = domain.ParseMetricType(src.Type)
 	if err != nil {
@@ -58,3 +71,60 @@ func domainMetricFromPutMetric(src putMetricRequest, logger zerolog.Logger) (dom
 	}
 	return dst, nil
 }
+
+// reportedTime returns the time that a metric with the given optional
+// timestamp was reported.  If no timestamp is given, now is returned.
+//
+// Timestamps more than the configured max skew in the future or more than the
+// configured max age in the past result in an errInvalidTimestamp error.
+// Timestamps in the future by no more than the max skew are treated as now.
+// Recording values in the future would cause the historic repository to
+// reject the values reported until then.
+func reportedTime(timestamp *int64, now time.Time, timestamps config.Timestamps) (time.Time, error) {
+	if timestamp == nil {
+		return now, nil
+	}
+	return checkReportedTime(time.Unix(*timestamp, 0), now, timestamps)
+}
+
+// checkReportedTime checks the time that a metric was reported, as given by
+// one of the metric ingestion protocols, against the configured limits in
+// the same way as reportedTime.
+func checkReportedTime(reported time.Time, now time.Time, timestamps config.Timestamps) (time.Time, error) {
+	return domain.CheckReportedTime(reported, now, timestamps.MaxSkew, timestamps.MaxAge)
+}
+
+// timestampErrorObject returns an ErrorObject for the given timestamp error.
+func timestampErrorObject(err error) *ErrorObject {
+	return &ErrorObject{
+		Status: http.StatusUnprocessableEntity,
+		Title:  "timestamp",
+		Detail: err.Error(),
+		Source: "timestamp",
+	}
+}
+
+// inferMetricType infers the metric type for the given value, as decoded by
+// one of the metric ingestion protocols, and returns it along with the value
+// to report for it.
+//
+// The type follows the value's wire type.  Integers are reported as int64,
+// or as uint64 if they are too large for an int64.  Floats are reported as
+// doubles, booleans as bools and strings as strings.
+func inferMetricType(value any) (domain.MetricType, any) {
+	switch v := value.(type) {
+	case int64:
+		return domain.MetricTypeInt64, v
+	case uint64:
+		if v <= math.MaxInt64 {
+			return domain.MetricTypeInt64, v
+		}
+		return domain.MetricTypeUint64, v
+	case bool:
+		return domain.MetricTypeBool, v
+	case string:
+		return domain.MetricTypeString, v
+	default:
+		return domain.MetricTypeDouble, v
+	}
+}
@@ -0,0 +1,119 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/config"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_reportedTime(t *testing.T) {
+	now := time.Unix(1696431225, 0)
+	timestamps := config.Timestamps{MaxSkew: time.Minute, MaxAge: time.Hour}
+	unix := func(t time.Time) *int64 {
+		ts := t.Unix()
+		return &ts
+	}
+
+	tests := []struct {
+		name        string
+		timestamp   *int64
+		expected    time.Time
+		expectedErr error
+	}{
+		{
+			name:     "no timestamp is now",
+			expected: now,
+		},
+		{
+			name:      "timestamp in the past",
+			timestamp: unix(now.Add(-10 * time.Minute)),
+			expected:  now.Add(-10 * time.Minute),
+		},
+		{
+			name:      "timestamp in the future within max skew is now",
+			timestamp: unix(now.Add(30 * time.Second)),
+			expected:  now,
+		},
+		{
+			name:        "timestamp in the future beyond max skew",
+			timestamp:   unix(now.Add(2 * time.Minute)),
+			expectedErr: errInvalidTimestamp,
+		},
+		{
+			name:        "timestamp older than max age",
+			timestamp:   unix(now.Add(-2 * time.Hour)),
+			expectedErr: errInvalidTimestamp,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Action
+			reported, err := reportedTime(tt.timestamp, now, timestamps)
+
+			// Assertions
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, reported)
+		})
+	}
+}
+
+func Test_inferMetricType(t *testing.T) {
+	tests := []struct {
+		name         string
+		value        any
+		expectedType domain.MetricType
+	}{
+		{name: "small integer", value: int64(12), expectedType: domain.MetricTypeInt64},
+		{name: "negative integer", value: int64(-12), expectedType: domain.MetricTypeInt64},
+		{name: "unsigned integer", value: uint64(12), expectedType: domain.MetricTypeInt64},
+		{name: "unsigned integer too large for int64", value: uint64(math.MaxInt64) + 1, expectedType: domain.MetricTypeUint64},
+		{name: "float", value: 92.5, expectedType: domain.MetricTypeDouble},
+		{name: "boolean", value: true, expectedType: domain.MetricTypeBool},
+		{name: "string", value: "running", expectedType: domain.MetricTypeString},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metricType, value := inferMetricType(tt.value)
+			assert.Equal(t, tt.expectedType, metricType)
+			_, err := domain.ParseMetricVal(value, metricType)
+			assert.NoError(t, err)
+		})
+	}
+}
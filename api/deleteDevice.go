@@ -0,0 +1,52 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+)
+
+// deleteDevice decommissions the given device.  The device and its metrics
+// are removed from the pending and current repositories and its historic
+// metrics are deleted or archived.
+func (s *Server) deleteDevice(rw http.ResponseWriter, r *http.Request) {
+	hostId := domain.HostId(chi.URLParam(r, "deviceId"))
+	err := s.app.DecommissionHost(hostId)
+	if errors.Is(err, domain.ErrUnknownHost) {
+		NotFound(rw, r, err)
+		return
+	} else if err != nil {
+		InternalError(rw, r, err)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,116 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/inmem"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+var adminClaims = map[string]interface{}{"admin": true}
+
+func Test_DeleteDevice(t *testing.T) {
+	// Setup
+	pendingRepo := inmem.NewPendingRepository(log.Logger)
+	currentRepo := inmem.NewCurrentRepository(log.Logger)
+	assert.NoError(t, currentRepo.Begin())
+	for _, id := range []domain.HostId{"1", "2"} {
+		dsm, _ := testDSMRepo.GetDSM(id)
+		host := &domain.CurrentHost{Id: id, DSM: dsm, Metrics: map[domain.MetricName]domain.CurrentMetric{}}
+		currentRepo.AddMetric(host, &domain.CurrentMetric{
+			Name: "power.level", Datatype: "uint32", Units: "W", Value: string(id) + "0", Timestamp: time.Now(),
+		})
+		currentRepo.AddHost(host)
+	}
+	assert.NoError(t, currentRepo.Commit())
+	app := domain.NewApp(pendingRepo, testDSMRepo, testDSMUpdater, currentRepo, nil, nil)
+	server := NewServer(log.Logger, app, testAPIConfig)
+	doc := `{"type": "uint32", "name": "power.level", "value": 10, "units": "W", "slope": "both", "ttl": 60}`
+	rr := httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, authorizedRequest(t, "PUT", "/1/metrics", bytes.NewBufferString(doc)))
+	assert.Equal(t, http.StatusOK, rr.Code, "unexpected failure putting metric")
+
+	// Action
+	rr = httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, scopedRequest(t, "DELETE", "/devices/1", "", adminClaims))
+
+	// Assertions
+	assert.Equal(t, http.StatusNoContent, rr.Code, "expected status code 204")
+	_, ok := pendingRepo.GetHost("1")
+	assert.False(t, ok, "expected host to be removed from pending repository")
+	_, err := currentRepo.GetMetricsForHost("1")
+	assert.ErrorIs(t, err, domain.ErrHostNotFound)
+	hosts, err := currentRepo.HostsWithMetric("power.level")
+	assert.NoError(t, err)
+	if assert.Len(t, hosts, 1) {
+		assert.Equal(t, domain.HostId("2"), hosts[0].Id)
+	}
+	metrics, err := currentRepo.GetUniqueMetrics()
+	assert.NoError(t, err)
+	if assert.Len(t, metrics, 1) {
+		assert.Equal(t, uint64(20), metrics[0].Min, "expected min to be recalculated")
+	}
+}
+
+func Test_DeleteUnknownDevice(t *testing.T) {
+	server := NewServer(log.Logger, newTestApp(nil, nil), testAPIConfig)
+	rr := httptest.NewRecorder()
+
+	server.Router.ServeHTTP(rr, scopedRequest(t, "DELETE", "/devices/NOPE", "", adminClaims))
+
+	assert.Equal(t, http.StatusNotFound, rr.Code, "expected status code 404")
+}
+
+func Test_DeleteDeviceRequiresAdminToken(t *testing.T) {
+	// Setup
+	pendingRepo := inmem.NewPendingRepository(log.Logger)
+	app := domain.NewApp(pendingRepo, testDSMRepo, testDSMUpdater, nil, nil, nil)
+	server := NewServer(log.Logger, app, testAPIConfig)
+	doc := `{"type": "uint32", "name": "power.level", "value": 10, "units": "W", "slope": "both", "ttl": 60}`
+	rr := httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, authorizedRequest(t, "PUT", "/1/metrics", bytes.NewBufferString(doc)))
+	assert.Equal(t, http.StatusOK, rr.Code, "unexpected failure putting metric")
+
+	// Action
+	rr = httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, authorizedRequest(t, "DELETE", "/devices/1", nil))
+
+	// Assertions
+	assert.Equal(t, http.StatusForbidden, rr.Code, "expected status code 403")
+	assertContentType(t, rr, "application/json")
+	_, ok := pendingRepo.GetHost("1")
+	assert.True(t, ok, "expected host not to be removed")
+}
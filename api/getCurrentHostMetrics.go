@@ -48,16 +48,26 @@ import (
 //	  },
 //	  ...
 //	]
+//
+// A metric reported with labels has an entry for each of its series.  The
+// entry's id is the series key and it includes the series' labels.  Only
+// series with labels matching the `label` query parameters are included.
 func (s *Server) getCurrentHostMetrics(rw http.ResponseWriter, r *http.Request) {
 	type metricResponse struct {
-		Id     string `json:"id"`
-		Name   string `json:"name"`
-		Nature string `json:"nature"`
-		Units  string `json:"units"`
-		Value  any    `json:"value"`
+		Id     string        `json:"id"`
+		Name   string        `json:"name"`
+		Labels domain.Labels `json:"labels,omitempty"`
+		Nature string        `json:"nature"`
+		Units  string        `json:"units"`
+		Value  any           `json:"value"`
 	}
 	body := []metricResponse{}
 	hostId := domain.HostId(chi.URLParam(r, "deviceId"))
+	labels, err := parseLabelFilter(r)
+	if err != nil {
+		BadRequest(rw, r, err, "")
+		return
+	}
 	metrics, err := s.app.CurrentRepo.GetMetricsForHost(hostId)
 	if err != nil {
 		if errors.Is(err, domain.ErrWaitingOnProcessingRun) {
@@ -70,14 +80,18 @@ func (s *Server) getCurrentHostMetrics(rw http.ResponseWriter, r *http.Request)
 		return
 	}
 	for _, metric := range metrics {
+		if !metric.Labels.Matches(labels) {
+			continue
+		}
 		castValue, err := castMetricValue(*metric)
 		if err != nil {
 			s.logger.Debug().Err(err).Str("type", metric.Datatype).Str("value", metric.Value).Msg("error casting metric value")
 			castValue = metric.Value
 		}
 		mr := metricResponse{
-			Id:     metric.Name,
+			Id:     string(metric.SeriesKey()),
 			Name:   metric.Name,
+			Labels: labelsOrNil(metric.Labels),
 			Nature: metric.Nature,
 			Units:  metric.Units,
 			Value:  castValue,
@@ -0,0 +1,93 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/inmem"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func commitTestHost(t *testing.T, currentRepo *inmem.CurrentRepository) {
+	t.Helper()
+	assert.NoError(t, currentRepo.Begin())
+	dsm, _ := testDSMRepo.GetDSM("1")
+	host := &domain.CurrentHost{Id: "1", DSM: dsm, Metrics: map[domain.MetricName]domain.CurrentMetric{}}
+	currentRepo.AddMetric(host, &domain.CurrentMetric{
+		Name: "power.level", Datatype: "uint32", Units: "W", Value: "10", Slope: domain.MetricSlopeBoth, Timestamp: time.Now(),
+	})
+	currentRepo.AddHost(host)
+	assert.NoError(t, currentRepo.Commit())
+}
+
+func Test_getCurrentHostMetricsFromRestoredRepository(t *testing.T) {
+	// Setup
+	path := filepath.Join(t.TempDir(), "current.json")
+	previousRepo, err := inmem.NewPersistentCurrentRepository(log.Logger, path)
+	assert.NoError(t, err)
+	commitTestHost(t, previousRepo)
+	currentRepo, err := inmem.NewPersistentCurrentRepository(log.Logger, path)
+	assert.NoError(t, err)
+	committed, _ := currentRepo.RestoredAt()
+	server := NewServer(log.Logger, newTestApp(currentRepo, nil), testAPIConfig)
+	req, err := http.NewRequest("GET", "/devices/1/metrics/current", nil)
+	assert.NoError(t, err, "unexpected failure building http request")
+	rr := httptest.NewRecorder()
+
+	// Action
+	server.Router.ServeHTTP(rr, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rr.Code, "expected status code 200")
+	assert.Equal(t, committed.UTC().Format(time.RFC3339), rr.Header().Get(restoredHeader))
+	assert.Contains(t, rr.Body.String(), "power.level")
+}
+
+func Test_getCurrentHostMetricsFromProcessingRun(t *testing.T) {
+	// Setup
+	currentRepo := inmem.NewCurrentRepository(log.Logger)
+	commitTestHost(t, currentRepo)
+	server := NewServer(log.Logger, newTestApp(currentRepo, nil), testAPIConfig)
+	req, err := http.NewRequest("GET", "/devices/1/metrics/current", nil)
+	assert.NoError(t, err, "unexpected failure building http request")
+	rr := httptest.NewRecorder()
+
+	// Action
+	server.Router.ServeHTTP(rr, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rr.Code, "expected status code 200")
+	assert.Empty(t, rr.Header().Get(restoredHeader), "unexpected restored header")
+}
@@ -45,10 +45,20 @@ import (
 //	  },
 //	  ...
 //	]
+//
+// A metric reported with labels is listed once and includes the labels of
+// each of its series.
+//
+//	{
+//	  "id": "net.bytes",
+//	  "name": "net.bytes",
+//	  "labels": [{"iface": "eth0"}, {"iface": "eth1"}]
+//	}
 func (s *Server) getHistoricHostMetricNames(rw http.ResponseWriter, r *http.Request) {
 	type historicMetricName struct {
-		Id   string `json:"id"`
-		Name string `json:"name"`
+		Id     string          `json:"id"`
+		Name   string          `json:"name"`
+		Labels []domain.Labels `json:"labels,omitempty"`
 	}
 	hostId := domain.HostId(chi.URLParam(r, "deviceId"))
 	metricNames, err := s.app.HistoricRepo.ListHostMetricNames(hostId)
@@ -61,12 +71,18 @@ func (s *Server) getHistoricHostMetricNames(rw http.ResponseWriter, r *http.Requ
 		return
 	}
 	body := []historicMetricName{}
-	for _, metricName := range metricNames {
-		um := historicMetricName{
-			Id:   metricName,
-			Name: metricName,
+	indexes := map[string]int{}
+	for _, seriesKey := range metricNames {
+		name, labels := domain.ParseSeriesKey(domain.MetricName(seriesKey))
+		i, ok := indexes[name]
+		if !ok {
+			i = len(body)
+			indexes[name] = i
+			body = append(body, historicMetricName{Id: name, Name: name})
+		}
+		if len(labels) > 0 {
+			body[i].Labels = append(body[i].Labels, labels)
 		}
-		body = append(body, um)
 	}
 	renderJSON(body, http.StatusOK, rw)
 }
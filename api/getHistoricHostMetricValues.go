@@ -92,6 +92,9 @@ func (s *Server) getHistoricHostMetricValuesLastX(rw http.ResponseWriter, r *htt
 	s.fetchAndRenderHostMetrics(rw, r, hostId, metricName, duration)
 }
 
+// fetchAndRenderHostMetrics renders the historic values of the metric for the
+// host.  Only series with labels matching the `label` query parameters are
+// included.  If more than one series is included, their values are summed.
 func (s *Server) fetchAndRenderHostMetrics(
 	rw http.ResponseWriter,
 	r *http.Request,
@@ -99,7 +102,12 @@ func (s *Server) fetchAndRenderHostMetrics(
 	metricName domain.MetricName,
 	duration domain.HistoricMetricDuration,
 ) {
-	host, err := s.app.HistoricRepo.GetValuesForHostAndMetric(hostId, metricName, duration)
+	labels, err := parseLabelFilter(r)
+	if err != nil {
+		BadRequest(rw, r, err, "")
+		return
+	}
+	host, err := s.app.HistoricRepo.GetValuesForHostAndMetric(hostId, metricName, labels, duration)
 	if err != nil {
 		if errors.Is(err, domain.ErrHostNotFound) {
 			NotFound(rw, r, err)
@@ -111,11 +119,13 @@ func (s *Server) fetchAndRenderHostMetrics(
 		return
 	}
 	body := []historicValueResponse{}
-	metrics, ok := host.Metrics[metricName]
-	if !ok {
+	// The values of all matching series are summed.
+	series := groupHistoricSeries(host.Metrics, []string{})
+	if len(series) == 0 {
 		NotFound(rw, r, domain.ErrMetricNotFound)
+		return
 	}
-	for _, metric := range metrics {
+	for _, metric := range series[0].values {
 		body = append(body, historicValueResponseFromHistoricMetric(metric))
 	}
 	renderJSON(body, http.StatusOK, rw)
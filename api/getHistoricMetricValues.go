@@ -38,12 +38,22 @@ import (
 
 type historicHostResponse struct {
 	Id     string                  `json:"id"`
+	Labels domain.Labels           `json:"labels,omitempty"`
 	Values []historicValueResponse `json:"values"`
 }
 
 type historicValueResponse struct {
 	Timestamp int64 `json:"timestamp"`
 	Value     any   `json:"value"`
+	// The historic values of a distribution metric.  Value is the mean of
+	// its observations.
+	Distribution *historicDistributionResponse `json:"distribution,omitempty"`
+}
+
+type historicDistributionResponse struct {
+	Count     any            `json:"count"`
+	Sum       any            `json:"sum"`
+	Quantiles map[string]any `json:"quantiles"`
 }
 
 // getHistoricMetricValues returns a JSON list of historic metric values
@@ -63,6 +73,10 @@ type historicValueResponse struct {
 //	  },
 //	  ...
 //	]
+//
+// If the metric has been reported with labels, an entry is given for each
+// series of the metric and includes its labels.  The series can be filtered
+// and grouped by label, see fetchAndRenderMetrics.
 func (s *Server) getHistoricMetricValues(rw http.ResponseWriter, r *http.Request) {
 	metricName := domain.MetricName(chi.URLParam(r, "metricName"))
 	startTime, err := parseTime(chi.URLParam(r, "startTime"))
@@ -111,44 +125,79 @@ func (s *Server) getHistoricMetricValuesLastX(rw http.ResponseWriter, r *http.Re
 	s.fetchAndRenderMetrics(rw, r, metricName, duration)
 }
 
+// fetchAndRenderMetrics renders the historic values of the metric for all
+// hosts.
+//
+// Only series with labels matching the `label` query parameters are included.
+// If the `group_by` query parameter is given, the series for each host are
+// grouped by the given labels and the values of each group summed.
 func (s *Server) fetchAndRenderMetrics(
 	rw http.ResponseWriter,
 	r *http.Request,
 	metricName domain.MetricName,
 	duration domain.HistoricMetricDuration,
 ) {
-	hosts, err := s.app.HistoricRepo.GetValuesForMetric(metricName, duration)
+	labels, err := parseLabelFilter(r)
+	if err != nil {
+		BadRequest(rw, r, err, "")
+		return
+	}
+	groupBy, err := parseGroupBy(r)
+	if err != nil {
+		BadRequest(rw, r, err, "")
+		return
+	}
+	hosts, err := s.app.HistoricRepo.GetValuesForMetric(metricName, labels, duration)
 	if err != nil {
 		InternalError(rw, r, err)
 		return
 	}
 	body := []historicHostResponse{}
 	for _, host := range hosts {
-		body = append(body, historicHostResponseFromHistoricHost(host))
+		body = append(body, historicHostResponsesFromHistoricHost(host, groupBy)...)
 	}
 	renderJSON(body, http.StatusOK, rw)
 }
 
-func historicHostResponseFromHistoricHost(src *domain.HistoricHost) historicHostResponse {
-	var dst historicHostResponse
-	dst.Id = src.Id.String()
-	dst.Values = make([]historicValueResponse, 0, len(src.Metrics))
-
-	for _, metrics := range src.Metrics {
-		for _, metric := range metrics {
+func historicHostResponsesFromHistoricHost(src *domain.HistoricHost, groupBy []string) []historicHostResponse {
+	series := groupHistoricSeries(src.Metrics, groupBy)
+	responses := make([]historicHostResponse, 0, len(series))
+	for _, s := range series {
+		dst := historicHostResponse{
+			Id:     src.Id.String(),
+			Labels: labelsOrNil(s.labels),
+			Values: make([]historicValueResponse, 0, len(s.values)),
+		}
+		for _, metric := range s.values {
 			dst.Values = append(dst.Values, historicValueResponseFromHistoricMetric(metric))
 		}
+		responses = append(responses, dst)
 	}
-	return dst
+	return responses
 }
 
 func historicValueResponseFromHistoricMetric(src *domain.HistoricMetric) historicValueResponse {
 	var dst historicValueResponse
 	dst.Timestamp = src.Timestamp
-	if math.IsNaN(src.Value) {
-		dst.Value = nil
-	} else {
-		dst.Value = src.Value
+	dst.Value = nilIfNaN(src.Value)
+	if src.Distribution != nil {
+		dst.Distribution = &historicDistributionResponse{
+			Count:     nilIfNaN(src.Distribution.Count),
+			Sum:       nilIfNaN(src.Distribution.Sum),
+			Quantiles: make(map[string]any, len(src.Distribution.Quantiles)),
+		}
+		for name, value := range src.Distribution.Quantiles {
+			dst.Distribution.Quantiles[name] = nilIfNaN(value)
+		}
 	}
 	return dst
 }
+
+// nilIfNaN returns nil if the given value is NaN, which cannot be encoded as
+// JSON, and otherwise the value.
+func nilIfNaN(value float64) any {
+	if math.IsNaN(value) {
+		return nil
+	}
+	return value
+}
@@ -0,0 +1,70 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubHistoricRepo is a historic repository returning the given hosts'
+// values for every metric.
+type stubHistoricRepo struct {
+	domain.HistoricRepository
+	hosts []*domain.HistoricHost
+}
+
+func (r stubHistoricRepo) GetValuesForMetric(domain.MetricName, domain.Labels, domain.HistoricMetricDuration) ([]*domain.HistoricHost, error) {
+	return r.hosts, nil
+}
+
+func Test_getHistoricMetricValuesSetsSignificantDigits(t *testing.T) {
+	// Setup
+	historicRepo := stubHistoricRepo{hosts: []*domain.HistoricHost{{
+		Id: "1",
+		Metrics: map[domain.MetricName][]*domain.HistoricMetric{
+			"bytes.total": {{Timestamp: 1696431225, Value: 1234567890100}},
+		},
+	}}}
+	server := NewServer(log.Logger, newTestApp(nil, historicRepo), testAPIConfig)
+	req := authorizedRequest(t, "GET", "/metrics/bytes.total/historic/last/hour", nil)
+	rr := httptest.NewRecorder()
+
+	// Action
+	server.Router.ServeHTTP(rr, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, "11", rr.Header().Get(significantDigitsHeader))
+	assert.JSONEq(t, `[{"id": "1", "values": [{"timestamp": 1696431225, "value": 1234567890100}]}]`, rr.Body.String())
+}
@@ -0,0 +1,163 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"golang.org/x/exp/slices"
+)
+
+type stateChangeResponse struct {
+	State     string `json:"state"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+type historicStatesResponse struct {
+	Labels domain.Labels         `json:"labels,omitempty"`
+	States []stateChangeResponse `json:"states"`
+}
+
+type stateAtResponse struct {
+	Labels    domain.Labels `json:"labels,omitempty"`
+	State     *string       `json:"state"`
+	Timestamp *int64        `json:"timestamp"`
+}
+
+// getHistoricHostMetricStates returns a JSON list of the state changes of a
+// bool or enum metric for the given host between the given start and end
+// times.  There is an entry for each series of the metric.  The first state
+// of each series is the state in effect at the start time.
+//
+//	[
+//	  {
+//	    "states": [
+//	      {"state": "on", "timestamp": 1696431000},
+//	      {"state": "off", "timestamp": 1696431225}
+//	    ]
+//	  },
+//	  ...
+//	]
+func (s *Server) getHistoricHostMetricStates(rw http.ResponseWriter, r *http.Request) {
+	startTime, err := parseTime(chi.URLParam(r, "startTime"))
+	if err != nil {
+		BadRequest(rw, r, err, "")
+		return
+	}
+	endTime, err := parseTime(chi.URLParam(r, "endTime"))
+	if err != nil {
+		BadRequest(rw, r, err, "")
+		return
+	}
+	host, ok := s.fetchHostMetricStates(rw, r, startTime, endTime)
+	if !ok {
+		return
+	}
+	body := []historicStatesResponse{}
+	for _, seriesKey := range sortedSeriesKeys(host.Metrics) {
+		_, labels := domain.ParseSeriesKey(seriesKey)
+		series := historicStatesResponse{Labels: labelsOrNil(labels), States: []stateChangeResponse{}}
+		for _, change := range host.Metrics[seriesKey] {
+			series.States = append(series.States, stateChangeResponse{State: change.State, Timestamp: change.Timestamp})
+		}
+		body = append(body, series)
+	}
+	renderJSON(body, http.StatusOK, rw)
+}
+
+// getHostMetricStateAt returns a JSON list of the state of a bool or enum
+// metric for the given host at the given time.  There is an entry for each
+// series of the metric.  The timestamp is the time the state was entered.  If
+// no state had been recorded by the given time, the state and timestamp are
+// null.
+//
+//	[
+//	  {"state": "on", "timestamp": 1696431000},
+//	  ...
+//	]
+func (s *Server) getHostMetricStateAt(rw http.ResponseWriter, r *http.Request) {
+	at, err := parseTime(chi.URLParam(r, "time"))
+	if err != nil {
+		BadRequest(rw, r, err, "")
+		return
+	}
+	host, ok := s.fetchHostMetricStates(rw, r, at, at)
+	if !ok {
+		return
+	}
+	body := []stateAtResponse{}
+	for _, seriesKey := range sortedSeriesKeys(host.Metrics) {
+		_, labels := domain.ParseSeriesKey(seriesKey)
+		series := stateAtResponse{Labels: labelsOrNil(labels)}
+		if changes := host.Metrics[seriesKey]; len(changes) > 0 {
+			series.State = &changes[0].State
+			series.Timestamp = &changes[0].Timestamp
+		}
+		body = append(body, series)
+	}
+	renderJSON(body, http.StatusOK, rw)
+}
+
+// fetchHostMetricStates returns the state changes of the metric for the host
+// in the request between the given times.  Only series with labels matching
+// the `label` query parameters are included.  If the states cannot be
+// fetched, an error response is rendered and false returned.
+func (s *Server) fetchHostMetricStates(rw http.ResponseWriter, r *http.Request, start, end time.Time) (*domain.HistoricHostStates, bool) {
+	hostId := domain.HostId(chi.URLParam(r, "deviceId"))
+	metricName := domain.MetricName(chi.URLParam(r, "metricName"))
+	labels, err := parseLabelFilter(r)
+	if err != nil {
+		BadRequest(rw, r, err, "")
+		return nil, false
+	}
+	host, err := s.app.HistoricRepo.GetStatesForHostAndMetric(hostId, metricName, labels, start, end)
+	if err != nil {
+		if errors.Is(err, domain.ErrHostNotFound) {
+			NotFound(rw, r, err)
+		} else if errors.Is(err, domain.ErrMetricNotFound) {
+			NotFound(rw, r, err)
+		} else {
+			InternalError(rw, r, err)
+		}
+		return nil, false
+	}
+	return host, true
+}
+
+func sortedSeriesKeys(metrics map[domain.MetricName][]*domain.StateChange) []domain.MetricName {
+	seriesKeys := make([]domain.MetricName, 0, len(metrics))
+	for seriesKey := range metrics {
+		seriesKeys = append(seriesKeys, seriesKey)
+	}
+	slices.Sort(seriesKeys)
+	return seriesKeys
+}
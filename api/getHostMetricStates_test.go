@@ -0,0 +1,170 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/config"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/rrd"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_PutEnumMetric(t *testing.T) {
+	// Setup
+	app := newTestApp(nil, nil)
+	err := app.DefinitionRepo.Put(domain.MetricDefinition{Name: "power.state", Type: "enum", States: []string{"on", "off", "unknown"}})
+	assert.NoError(t, err)
+	server := NewServer(log.Logger, app, testAPIConfig)
+
+	tests := []struct {
+		name         string
+		doc          string
+		expectedCode int
+		expectedJSON string
+	}{
+		{
+			name:         "one of the defined states",
+			doc:          `{"type": "enum", "name": "power.state", "value": "off", "slope": "both", "ttl": 60}`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "not one of the defined states",
+			doc:          `{"type": "enum", "name": "power.state", "value": "dimmed", "slope": "both", "ttl": 60}`,
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedJSON: `{
+			  "status": 422,
+			  "errors": [
+			    {"status": 422, "title": "definition", "detail": "value must be one of [on off unknown] (metric definition power.state)", "source": "value"}
+			  ]
+			}`,
+		},
+		{
+			name:         "enum without a definition",
+			doc:          `{"type": "enum", "name": "fan.state", "value": "spinning", "slope": "both", "ttl": 60}`,
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedJSON: `{
+			  "status": 422,
+			  "errors": [
+			    {"status": 422, "title": "definition", "detail": "enum metrics require a metric definition with states: fan.state"}
+			  ]
+			}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := authorizedRequest(t, "PUT", "/1/metrics", bytes.NewBufferString(tt.doc))
+			rr := httptest.NewRecorder()
+
+			// Action
+			server.Router.ServeHTTP(rr, req)
+
+			// Assertions
+			assert.Equal(t, tt.expectedCode, rr.Code, "unexpected status code")
+			if tt.expectedJSON != "" {
+				assert.JSONEq(t, tt.expectedJSON, rr.Body.String(), "unexpected body")
+			}
+		})
+	}
+}
+
+func Test_GetHostMetricStates(t *testing.T) {
+	// Setup
+	historicRepo := rrd.NewHistoricRepo(log.Logger, config.RRD{Directory: t.TempDir()}, testDSMRepo)
+	dsm, _ := testDSMRepo.GetDSM("1")
+	host := &domain.CurrentHost{Id: "1", DSM: dsm}
+	for _, change := range []struct {
+		state     string
+		timestamp int64
+	}{{"on", 1696431000}, {"off", 1696431030}, {"on", 1696431060}} {
+		metric := &domain.CurrentMetric{Name: "power.state", Datatype: "enum", Value: change.state, Timestamp: time.Unix(change.timestamp, 0)}
+		assert.NoError(t, historicRepo.UpdateState(host, metric))
+	}
+	server := NewServer(log.Logger, newTestApp(nil, historicRepo), testAPIConfig)
+
+	tests := []struct {
+		name         string
+		url          string
+		expectedCode int
+		expectedJSON string
+	}{
+		{
+			name:         "state changes between times",
+			url:          "/devices/1/metrics/power.state/states/1696431045/1696432000",
+			expectedCode: http.StatusOK,
+			expectedJSON: `[{"states": [{"state": "off", "timestamp": 1696431030}, {"state": "on", "timestamp": 1696431060}]}]`,
+		},
+		{
+			name:         "state at a time",
+			url:          "/devices/1/metrics/power.state/states/at/1696431045",
+			expectedCode: http.StatusOK,
+			expectedJSON: `[{"state": "off", "timestamp": 1696431030}]`,
+		},
+		{
+			name:         "state before the first change",
+			url:          "/devices/1/metrics/power.state/states/at/1696430000",
+			expectedCode: http.StatusOK,
+			expectedJSON: `[{"state": null, "timestamp": null}]`,
+		},
+		{
+			name:         "unknown metric",
+			url:          "/devices/1/metrics/fan.state/states/at/1696431045",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "invalid time",
+			url:          "/devices/1/metrics/power.state/states/at/yesterday",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tt.url, nil)
+			assert.NoError(t, err, "unexpected failure building http request")
+			rr := httptest.NewRecorder()
+
+			// Action
+			server.Router.ServeHTTP(rr, req)
+
+			// Assertions
+			assert.Equal(t, tt.expectedCode, rr.Code, "unexpected status code")
+			if tt.expectedJSON != "" {
+				assertContentType(t, rr, "application/json")
+				assert.JSONEq(t, tt.expectedJSON, rr.Body.String(), "unexpected body")
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+)
+
+type metricConflict struct {
+	Name      string                `json:"name"`
+	Datatypes []metricConflictValue `json:"datatypes"`
+	Units     []metricConflictValue `json:"units"`
+}
+
+type metricConflictValue struct {
+	Value     string          `json:"value"`
+	DeviceIds []domain.HostId `json:"device_ids"`
+}
+
+// getMetricConflicts returns a JSON list of the metrics that were reported
+// with conflicting datatypes or units in the last processing run.  For each
+// datatype and units the metric was reported with, the devices reporting it
+// are listed.  The format of the JSON is as follows:
+//
+//	[
+//	  {
+//	    "name": "power.level",
+//	    "datatypes": [
+//	      {"value": "float", "device_ids": ["3"]},
+//	      {"value": "uint32", "device_ids": ["1", "2"]}
+//	    ],
+//	    "units": [
+//	      {"value": "W", "device_ids": ["1", "2", "3"]}
+//	    ]
+//	  },
+//	  ...
+//	]
+func (s *Server) getMetricConflicts(rw http.ResponseWriter, r *http.Request) {
+	conflicts, err := s.app.CurrentRepo.GetMetricConflicts()
+	if err != nil {
+		if errors.Is(err, domain.ErrWaitingOnProcessingRun) {
+			ServiceUnavailable(rw, r, err)
+		} else {
+			InternalError(rw, r, err)
+		}
+		return
+	}
+	body := []metricConflict{}
+	for _, conflict := range conflicts {
+		body = append(body, metricConflict{
+			Name:      conflict.Name,
+			Datatypes: metricConflictValues(conflict.Datatypes),
+			Units:     metricConflictValues(conflict.Units),
+		})
+	}
+	renderJSON(body, http.StatusOK, rw)
+}
+
+func metricConflictValues(hostsByValue map[string][]domain.HostId) []metricConflictValue {
+	values := make([]metricConflictValue, 0, len(hostsByValue))
+	for value, hostIds := range hostsByValue {
+		values = append(values, metricConflictValue{Value: value, DeviceIds: hostIds})
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].Value < values[j].Value
+	})
+	return values
+}
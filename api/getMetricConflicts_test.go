@@ -0,0 +1,102 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/inmem"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_getMetricConflicts(t *testing.T) {
+	// Setup
+	currentRepo := inmem.NewCurrentRepository(log.Logger)
+	assert.NoError(t, currentRepo.Begin())
+	reported := []struct {
+		id       domain.HostId
+		datatype string
+		units    string
+	}{
+		{id: "1", datatype: "uint32", units: "W"},
+		{id: "2", datatype: "uint32", units: "W"},
+		{id: "3", datatype: "float", units: "W"},
+	}
+	for _, rep := range reported {
+		dsm, _ := testDSMRepo.GetDSM(rep.id)
+		host := &domain.CurrentHost{Id: rep.id, DSM: dsm, Metrics: map[domain.MetricName]domain.CurrentMetric{}}
+		currentRepo.AddMetric(host, &domain.CurrentMetric{
+			Name: "power.level", Datatype: rep.datatype, Units: rep.units, Value: "10", Timestamp: time.Now(),
+		})
+		currentRepo.AddMetric(host, &domain.CurrentMetric{
+			Name: "caffeine.level", Datatype: "uint32", Units: "mugs", Value: "1", Timestamp: time.Now(),
+		})
+		currentRepo.AddHost(host)
+	}
+	assert.NoError(t, currentRepo.Commit())
+	server := NewServer(log.Logger, newTestApp(currentRepo, nil), testAPIConfig)
+	req, err := http.NewRequest("GET", "/metrics/conflicts", nil)
+	assert.NoError(t, err, "unexpected failure building http request")
+	rr := httptest.NewRecorder()
+
+	// Action
+	server.Router.ServeHTTP(rr, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rr.Code, "expected status code 200")
+	expectedJSON := `[
+	  {
+	    "name": "power.level",
+	    "datatypes": [
+	      {"value": "float", "device_ids": ["3"]},
+	      {"value": "uint32", "device_ids": ["1", "2"]}
+	    ],
+	    "units": [
+	      {"value": "W", "device_ids": ["1", "2", "3"]}
+	    ]
+	  }
+	]`
+	assert.JSONEq(t, expectedJSON, rr.Body.String(), "unexpected body")
+}
+
+func Test_getMetricConflictsBeforeProcessingRun(t *testing.T) {
+	currentRepo := inmem.NewCurrentRepository(log.Logger)
+	server := NewServer(log.Logger, newTestApp(currentRepo, nil), testAPIConfig)
+	req, err := http.NewRequest("GET", "/metrics/conflicts", nil)
+	assert.NoError(t, err, "unexpected failure building http request")
+	rr := httptest.NewRecorder()
+
+	server.Router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code, "expected status code 503")
+}
@@ -38,8 +38,9 @@ import (
 )
 
 type metricValue struct {
-	Id    string `json:"id"`
-	Value any    `json:"value"`
+	Id     string        `json:"id"`
+	Labels domain.Labels `json:"labels,omitempty"`
+	Value  any           `json:"value"`
 }
 
 // getMetricValues returns a JSON list of current values for metric.
@@ -51,8 +52,24 @@ type metricValue struct {
 //	  },
 //	  ...
 //	]
+//
+// If the metric has been reported with labels, an entry is given for each
+// series of the metric and includes its labels.  Only series with labels
+// matching the `label` query parameters are included.  If the `group_by`
+// query parameter is given, the series for each host are grouped by the given
+// labels and the values of each group summed.
 func (s *Server) getMetricValues(rw http.ResponseWriter, r *http.Request) {
 	metricName := domain.MetricName(chi.URLParam(r, "metricName"))
+	labels, err := parseLabelFilter(r)
+	if err != nil {
+		BadRequest(rw, r, err, "")
+		return
+	}
+	groupBy, err := parseGroupBy(r)
+	if err != nil {
+		BadRequest(rw, r, err, "")
+		return
+	}
 	hosts, err := s.app.CurrentRepo.HostsWithMetric(metricName)
 	if err != nil {
 		if errors.Is(err, domain.ErrWaitingOnProcessingRun) {
@@ -66,54 +83,72 @@ func (s *Server) getMetricValues(rw http.ResponseWriter, r *http.Request) {
 	}
 	body := []metricValue{}
 	for _, host := range hosts {
-		metric, ok := host.Metrics[metricName]
-		if !ok {
-			s.logger.Warn().
-				Stringer("host", host.Id).
-				Str("metric", string(metricName)).
-				Msg("metric not found for host")
+		metrics := make([]domain.CurrentMetric, 0)
+		for _, metric := range host.Metrics {
+			if metric.Name == string(metricName) && metric.Labels.Matches(labels) {
+				metrics = append(metrics, metric)
+			}
+		}
+		if len(metrics) == 0 {
 			continue
 		}
-		castValue, err := castMetricValue(metric)
+		series, err := groupCurrentMetrics(metrics, groupBy)
 		if err != nil {
-			s.logger.Debug().
-				Err(err).
-				Str("type", metric.Datatype).
-				Str("value", metric.Value).
-				Msg("error casting metric value")
-			castValue = metric.Value
+			BadRequest(rw, r, err, "")
+			return
 		}
-		mv := metricValue{
-			Id:    host.Id.String(),
-			Value: castValue,
+		for _, s := range series {
+			mv := metricValue{
+				Id:     host.Id.String(),
+				Labels: labelsOrNil(s.labels),
+				Value:  s.value,
+			}
+			body = append(body, mv)
 		}
-		body = append(body, mv)
 	}
 	renderJSON(body, http.StatusOK, rw)
 }
 
 func castMetricValue(metric domain.CurrentMetric) (any, error) {
 	switch metric.Datatype {
-	case "int8", "int16", "int32":
+	case "int8", "int16", "int32", "int64":
 		i, err := strconv.ParseInt(metric.Value, 10, 64)
 		if err != nil {
 			return nil, err
 		}
 		return i, nil
-	case "uint8", "uint16", "uint32":
+	case "uint8", "uint16", "uint32", "uint64":
 		i, err := strconv.ParseUint(metric.Value, 10, 64)
 		if err != nil {
 			return nil, err
 		}
 		return i, nil
-	case "string":
+	case "string", "enum":
 		return metric.Value, nil
+	case "bool":
+		b, err := strconv.ParseBool(metric.Value)
+		if err != nil {
+			return nil, err
+		}
+		return b, nil
+	case "timestamp":
+		i, err := strconv.ParseInt(metric.Value, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return i, nil
 	case "float", "double":
 		i, err := strconv.ParseFloat(metric.Value, 64)
 		if err != nil {
 			return nil, err
 		}
 		return i, nil
+	case "distribution":
+		d, err := domain.DecodeDistribution(metric.Value)
+		if err != nil {
+			return nil, err
+		}
+		return d, nil
 	default:
 		return nil, fmt.Errorf("unexpected metric type %s", metric.Datatype)
 	}
@@ -0,0 +1,256 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"golang.org/x/exp/slices"
+)
+
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var invalidPrometheusNameChars = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// prometheusSample is a single sample of a prometheus metric family.
+type prometheusSample struct {
+	// The suffix appended to the family's name for the sample, e.g., `_sum`.
+	suffix string
+	labels [][2]string
+	value  string
+}
+
+// prometheusFamily is a prometheus metric family and its samples.
+type prometheusFamily struct {
+	typ     string
+	samples []prometheusSample
+}
+
+// prometheusSeries is the Prometheus family name, type and samples for a
+// single series of a metric.
+type prometheusSeries struct {
+	name string
+	typ  string
+	// source identifies the metric name that the family name was derived
+	// from.  Different sources can result in the same family name.
+	source  string
+	samples []prometheusSample
+}
+
+// getPrometheusMetrics renders all current metrics for all hosts in the
+// Prometheus text exposition format.
+//
+//	# TYPE power_level gauge
+//	power_level{device_id="1",grid="unspecified",cluster="unspecified",host="comp10",units="W"} 12
+//	...
+//	# TYPE os_name_info gauge
+//	os_name_info{device_id="1",grid="unspecified",cluster="unspecified",host="comp10",value="linux"} 1
+//
+// Metric names are converted to valid Prometheus metric names by replacing
+// any invalid characters with an underscore.  If different metric names
+// result in the same family name, only the series of the metric name that
+// sorts first are exposed.  A metric's units, if any, are exposed as the
+// `units` label.  Numeric and timestamp metrics are exposed with their value
+// as the sample and bool metrics with a sample of 1 or 0.  String and enum
+// metrics are exposed as an `_info` metric with the value as a label and a
+// sample of 1.  Distribution metrics are exposed as a summary, with a sample
+// for each quantile and `_sum` and `_count` samples.  A metric's labels are
+// exposed as additional labels.
+func (s *Server) getPrometheusMetrics(rw http.ResponseWriter, r *http.Request) {
+	hosts, err := s.app.CurrentRepo.GetHosts()
+	if err != nil {
+		if errors.Is(err, domain.ErrWaitingOnProcessingRun) {
+			ServiceUnavailable(rw, r, err)
+		} else {
+			InternalError(rw, r, err)
+		}
+		return
+	}
+	slices.SortFunc(hosts, func(a, b *domain.CurrentHost) int {
+		return strings.Compare(a.Id.String(), b.Id.String())
+	})
+
+	allSeries := make([]prometheusSeries, 0)
+	sources := map[string]string{}
+	for _, host := range hosts {
+		seriesKeys := make([]domain.MetricName, 0, len(host.Metrics))
+		for seriesKey := range host.Metrics {
+			seriesKeys = append(seriesKeys, seriesKey)
+		}
+		slices.Sort(seriesKeys)
+		for _, seriesKey := range seriesKeys {
+			series := prometheusSeriesFromMetric(host, host.Metrics[seriesKey])
+			if source, ok := sources[series.name]; !ok || series.source < source {
+				sources[series.name] = series.source
+			}
+			allSeries = append(allSeries, series)
+		}
+	}
+	families := map[string]*prometheusFamily{}
+	for _, series := range allSeries {
+		if series.source != sources[series.name] {
+			s.logger.Debug().Str("family", series.name).Msg("skipping series with clashing Prometheus name")
+			continue
+		}
+		family, ok := families[series.name]
+		if !ok {
+			family = &prometheusFamily{typ: series.typ}
+			families[series.name] = family
+		} else if family.typ != series.typ {
+			s.logger.Debug().Str("family", series.name).Msg("skipping series with clashing Prometheus type")
+			continue
+		}
+		family.samples = append(family.samples, series.samples...)
+	}
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	buf := &bytes.Buffer{}
+	for _, name := range names {
+		fmt.Fprintf(buf, "# TYPE %s %s\n", name, families[name].typ)
+		for _, sample := range families[name].samples {
+			writePrometheusSample(buf, name, sample)
+		}
+	}
+	rw.Header().Set("Content-Type", prometheusContentType)
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(buf.Bytes()) //nolint:errcheck
+}
+
+// prometheusSeriesFromMetric returns the name and type of the Prometheus
+// metric family for the given metric and its samples.
+func prometheusSeriesFromMetric(host *domain.CurrentHost, metric domain.CurrentMetric) prometheusSeries {
+	name := prometheusMetricName(metric.Name)
+	series := prometheusSeries{name: name, typ: "gauge", source: metric.Name}
+	sample := prometheusSample{
+		labels: [][2]string{
+			{"device_id", host.Id.String()},
+			{"grid", host.DSM.GridName},
+			{"cluster", host.DSM.ClusterName},
+			{"host", host.DSM.HostName},
+		},
+		value: metric.Value,
+	}
+	if metric.Units != "" {
+		sample.labels = append(sample.labels, [2]string{"units", metric.Units})
+	}
+	for _, labelName := range metric.Labels.Names() {
+		sample.labels = append(sample.labels, [2]string{prometheusLabelName(labelName), metric.Labels[labelName]})
+	}
+	switch metric.Datatype {
+	case domain.MetricTypeString.String(), domain.MetricTypeEnum.String():
+		series.name = name + "_info"
+		sample.labels = append(sample.labels, [2]string{"value", metric.Value})
+		sample.value = "1"
+	case domain.MetricTypeBool.String():
+		sample.value = "0"
+		if metric.Value == "true" {
+			sample.value = "1"
+		}
+	case domain.MetricTypeDistribution.String():
+		series.typ = "summary"
+		series.samples = prometheusDistributionSamples(sample, metric)
+		return series
+	}
+	series.samples = []prometheusSample{sample}
+	return series
+}
+
+// prometheusDistributionSamples returns the samples of a Prometheus summary
+// for the given distribution metric.  base is the sample with the labels of
+// the metric.
+func prometheusDistributionSamples(base prometheusSample, metric domain.CurrentMetric) []prometheusSample {
+	d, err := domain.DecodeDistribution(metric.Value)
+	if err != nil {
+		return nil
+	}
+	samples := make([]prometheusSample, 0, len(domain.DistributionQuantiles)+2)
+	for _, q := range domain.DistributionQuantiles {
+		value, ok := d.Quantiles[q.Name]
+		if !ok {
+			continue
+		}
+		labels := append(slices.Clone(base.labels), [2]string{"quantile", strconv.FormatFloat(q.Quantile, 'f', -1, 64)})
+		samples = append(samples, prometheusSample{labels: labels, value: strconv.FormatFloat(value, 'f', -1, 64)})
+	}
+	samples = append(samples,
+		prometheusSample{suffix: "_sum", labels: base.labels, value: strconv.FormatFloat(d.Sum, 'f', -1, 64)},
+		prometheusSample{suffix: "_count", labels: base.labels, value: strconv.FormatUint(d.Count, 10)},
+	)
+	return samples
+}
+
+// prometheusLabelName returns the Prometheus label name for the given metric
+// label name.  Label names that clash with the labels added for every sample
+// are prefixed with `exported_`, as Prometheus does when scraping.
+func prometheusLabelName(name string) string {
+	switch name {
+	case "device_id", "grid", "cluster", "host", "units", "value", "quantile":
+		return "exported_" + name
+	default:
+		return name
+	}
+}
+
+// prometheusMetricName converts the given metric name to a valid Prometheus
+// metric name.
+func prometheusMetricName(name string) string {
+	name = invalidPrometheusNameChars.ReplaceAllString(name, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+func writePrometheusSample(buf *bytes.Buffer, name string, sample prometheusSample) {
+	buf.WriteString(name)
+	buf.WriteString(sample.suffix)
+	buf.WriteByte('{')
+	for i, label := range sample.labels {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(buf, `%s="%s"`, label[0], prometheusLabelEscaper.Replace(label[1]))
+	}
+	buf.WriteByte('}')
+	buf.WriteByte(' ')
+	buf.WriteString(sample.value)
+	buf.WriteByte('\n')
+}
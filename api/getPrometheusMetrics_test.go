@@ -0,0 +1,161 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/inmem"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_getPrometheusMetrics(t *testing.T) {
+	// Setup
+	currentRepo := inmem.NewCurrentRepository(log.Logger)
+	assert.NoError(t, currentRepo.Begin())
+	for _, id := range []domain.HostId{"2", "1"} {
+		dsm, _ := testDSMRepo.GetDSM(id)
+		host := &domain.CurrentHost{Id: id, DSM: dsm, Metrics: map[domain.MetricName]domain.CurrentMetric{}}
+		currentRepo.AddMetric(host, &domain.CurrentMetric{
+			Name: "power.level", Datatype: "uint32", Units: "W", Value: string(id) + "0", Timestamp: time.Now(),
+		})
+		currentRepo.AddMetric(host, &domain.CurrentMetric{
+			Name: "os.name", Datatype: "string", Value: `linux "6.1"`, Timestamp: time.Now(),
+		})
+		currentRepo.AddHost(host)
+	}
+	assert.NoError(t, currentRepo.Commit())
+	server := NewServer(log.Logger, newTestApp(currentRepo, nil), testAPIConfig)
+	req, err := http.NewRequest("GET", "/metrics/current/prometheus", nil)
+	assert.NoError(t, err, "unexpected failure building http request")
+	rr := httptest.NewRecorder()
+
+	// Action
+	server.Router.ServeHTTP(rr, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rr.Code, "expected status code 200")
+	assertContentType(t, rr, "text/plain; version=0.0.4")
+	expected := `# TYPE os_name_info gauge
+os_name_info{device_id="1",grid="unspecified",cluster="unspecified",host="device:1",value="linux \"6.1\""} 1
+os_name_info{device_id="2",grid="unspecified",cluster="unspecified",host="device:2",value="linux \"6.1\""} 1
+# TYPE power_level gauge
+power_level{device_id="1",grid="unspecified",cluster="unspecified",host="device:1",units="W"} 10
+power_level{device_id="2",grid="unspecified",cluster="unspecified",host="device:2",units="W"} 20
+`
+	assert.Equal(t, expected, rr.Body.String(), "unexpected body")
+}
+
+func Test_getPrometheusMetricsBeforeProcessingRun(t *testing.T) {
+	currentRepo := inmem.NewCurrentRepository(log.Logger)
+	server := NewServer(log.Logger, newTestApp(currentRepo, nil), testAPIConfig)
+	req, err := http.NewRequest("GET", "/metrics/current/prometheus", nil)
+	assert.NoError(t, err, "unexpected failure building http request")
+	rr := httptest.NewRecorder()
+
+	server.Router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code, "expected status code 503")
+}
+
+func Test_getPrometheusMetricsExportsDistributionsAsSummaries(t *testing.T) {
+	// Setup
+	d, err := domain.ParseDistribution(map[string]any{"samples": []any{1, 2, 3, 4, 5}})
+	assert.NoError(t, err)
+	currentRepo := inmem.NewCurrentRepository(log.Logger)
+	assert.NoError(t, currentRepo.Begin())
+	dsm, _ := testDSMRepo.GetDSM("1")
+	host := &domain.CurrentHost{Id: "1", DSM: dsm, Metrics: map[domain.MetricName]domain.CurrentMetric{}}
+	currentRepo.AddMetric(host, &domain.CurrentMetric{
+		Name: "job.latency", Datatype: "distribution", Units: "ms", Value: d.String(), Timestamp: time.Now(),
+	})
+	currentRepo.AddHost(host)
+	assert.NoError(t, currentRepo.Commit())
+	server := NewServer(log.Logger, newTestApp(currentRepo, nil), testAPIConfig)
+	req, err := http.NewRequest("GET", "/metrics/current/prometheus", nil)
+	assert.NoError(t, err, "unexpected failure building http request")
+	rr := httptest.NewRecorder()
+
+	// Action
+	server.Router.ServeHTTP(rr, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rr.Code, "expected status code 200")
+	expected := `# TYPE job_latency summary
+job_latency{device_id="1",grid="unspecified",cluster="unspecified",host="device:1",units="ms",quantile="0.5"} 3
+job_latency{device_id="1",grid="unspecified",cluster="unspecified",host="device:1",units="ms",quantile="0.9"} 4.6
+job_latency{device_id="1",grid="unspecified",cluster="unspecified",host="device:1",units="ms",quantile="0.99"} 4.96
+job_latency_sum{device_id="1",grid="unspecified",cluster="unspecified",host="device:1",units="ms"} 15
+job_latency_count{device_id="1",grid="unspecified",cluster="unspecified",host="device:1",units="ms"} 5
+`
+	assert.Equal(t, expected, rr.Body.String(), "unexpected body")
+}
+
+func Test_getPrometheusMetricsSkipsClashingNames(t *testing.T) {
+	// Setup
+	currentRepo := inmem.NewCurrentRepository(log.Logger)
+	assert.NoError(t, currentRepo.Begin())
+	dsm, _ := testDSMRepo.GetDSM("1")
+	host := &domain.CurrentHost{Id: "1", DSM: dsm, Metrics: map[domain.MetricName]domain.CurrentMetric{}}
+	for _, metric := range []domain.CurrentMetric{
+		{Name: "power_level", Datatype: "uint32", Units: "W", Value: "10", Timestamp: time.Now()},
+		{Name: "power.level", Datatype: "uint32", Units: "W", Value: "20", Timestamp: time.Now()},
+		{Name: "power.level.W", Datatype: "uint32", Value: "30", Timestamp: time.Now()},
+		{Name: "temperature", Datatype: "float", Units: "C", Value: "40", Timestamp: time.Now()},
+		{Name: "temperature", Datatype: "float", Units: "F", Value: "104", Labels: domain.Labels{"scale": "f"}, Timestamp: time.Now()},
+	} {
+		metric := metric
+		currentRepo.AddMetric(host, &metric)
+	}
+	currentRepo.AddHost(host)
+	assert.NoError(t, currentRepo.Commit())
+	server := NewServer(log.Logger, newTestApp(currentRepo, nil), testAPIConfig)
+	req, err := http.NewRequest("GET", "/metrics/current/prometheus", nil)
+	assert.NoError(t, err, "unexpected failure building http request")
+	rr := httptest.NewRecorder()
+
+	// Action
+	server.Router.ServeHTTP(rr, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rr.Code, "expected status code 200")
+	expected := `# TYPE power_level gauge
+power_level{device_id="1",grid="unspecified",cluster="unspecified",host="device:1",units="W"} 20
+# TYPE power_level_W gauge
+power_level_W{device_id="1",grid="unspecified",cluster="unspecified",host="device:1"} 30
+# TYPE temperature gauge
+temperature{device_id="1",grid="unspecified",cluster="unspecified",host="device:1",units="C"} 40
+temperature{device_id="1",grid="unspecified",cluster="unspecified",host="device:1",units="F",scale="f"} 104
+`
+	assert.Equal(t, expected, rr.Body.String(), "unexpected body")
+}
@@ -35,12 +35,13 @@ import (
 )
 
 type uniqueMetric struct {
-	Id     string `json:"id"`
-	Max    any    `json:"max"`
-	Min    any    `json:"min"`
-	Name   string `json:"name"`
-	Nature string `json:"nature"`
-	Units  string `json:"units"`
+	Id          string `json:"id"`
+	Max         any    `json:"max"`
+	Min         any    `json:"min"`
+	Name        string `json:"name"`
+	Nature      string `json:"nature"`
+	Units       string `json:"units"`
+	Description string `json:"description,omitempty"`
 }
 
 // getUniqueMetrics returns a JSON list of unique metrics.  The uniqueness of
@@ -53,10 +54,13 @@ type uniqueMetric struct {
 //	    "units": "",
 //	    "nature": "volatile",
 //	    "min": 32,
-//	    "max": 64
+//	    "max": 64,
+//	    "description": "Caffeine capacity of the device"
 //	  },
 //	  ...
 //	]
+//
+// The description is taken from the metric's definition, if it has one.
 func (s *Server) getUniqueMetrics(rw http.ResponseWriter, r *http.Request) {
 	metrics, err := s.app.CurrentRepo.GetUniqueMetrics()
 	if err != nil {
@@ -77,6 +81,11 @@ func (s *Server) getUniqueMetrics(rw http.ResponseWriter, r *http.Request) {
 			Min:    metric.Min,
 			Max:    metric.Max,
 		}
+		if s.app.DefinitionRepo != nil {
+			if definition, ok := s.app.DefinitionRepo.Match(metric.Name); ok {
+				um.Description = definition.Description
+			}
+		}
 		body = append(body, um)
 	}
 	renderJSON(body, http.StatusOK, rw)
@@ -30,6 +30,7 @@ package api
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/rs/zerolog/hlog"
 )
@@ -82,6 +83,20 @@ func NotFound(rw http.ResponseWriter, r *http.Request, err error) {
 	respondWithError(rw, r, err, http.StatusNotFound, title, "")
 }
 
+// TooManyRequests responds with a too many requests error.  The Retry-After
+// header is set to the given delay.
+func TooManyRequests(rw http.ResponseWriter, r *http.Request, err error, retryAfter time.Duration) {
+	title := http.StatusText(http.StatusTooManyRequests)
+	rw.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+	respondWithError(rw, r, err, http.StatusTooManyRequests, title, "")
+}
+
+// RequestEntityTooLarge responds with a request entity too large error.
+func RequestEntityTooLarge(rw http.ResponseWriter, r *http.Request, err error) {
+	title := http.StatusText(http.StatusRequestEntityTooLarge)
+	respondWithError(rw, r, err, http.StatusRequestEntityTooLarge, title, "")
+}
+
 func respondWithError(rw http.ResponseWriter, r *http.Request, err error, status int, title, logMsg string) {
 	resp := ErrorsPayload{
 		Errors: []*ErrorObject{{Title: title, Detail: err.Error()}},
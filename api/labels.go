@@ -0,0 +1,269 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+)
+
+// parseLabelFilter returns the labels given in the request's `label` query
+// parameters.  Each parameter has the format `<name>=<value>`, e.g.,
+// `?label=iface=eth0&label=direction=rx`.
+func parseLabelFilter(r *http.Request) (domain.Labels, error) {
+	params := r.URL.Query()["label"]
+	if len(params) == 0 {
+		return nil, nil
+	}
+	labels := make(domain.Labels, len(params))
+	for _, param := range params {
+		name, value, found := strings.Cut(param, "=")
+		if !found {
+			return nil, fmt.Errorf("%w: label filter %q should have the format <name>=<value>", domain.ErrInvalidLabels, param)
+		}
+		labels[name] = value
+	}
+	if err := labels.Validate(); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// parseGroupBy returns the label names given in the request's `group_by`
+// query parameter.  Label names are separated by commas, e.g.,
+// `?group_by=iface,direction`.
+func parseGroupBy(r *http.Request) ([]string, error) {
+	param := r.URL.Query().Get("group_by")
+	if param == "" {
+		return nil, nil
+	}
+	names := strings.Split(param, ",")
+	for _, name := range names {
+		if !domain.IsValidLabelName(name) {
+			return nil, fmt.Errorf("%w: %q is not a valid label name", domain.ErrInvalidLabels, name)
+		}
+	}
+	return names, nil
+}
+
+var invalidLabelNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// labelsFromTags returns the given tags, or attributes, of one of the metric
+// ingestion protocols as labels, omitting the named tags.  Characters that
+// are not valid in a label name are replaced with `_`.  If several tags would
+// have the same label name, the first in sorted order is kept.
+func labelsFromTags(tags map[string]string, omit ...string) domain.Labels {
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		if !slices.Contains(omit, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	labels := domain.Labels{}
+	for _, name := range names {
+		labelName := invalidLabelNameChars.ReplaceAllLiteralString(name, "_")
+		if labelName == "" {
+			continue
+		}
+		if labelName[0] >= '0' && labelName[0] <= '9' {
+			labelName = "_" + labelName
+		}
+		if _, ok := labels[labelName]; !ok {
+			labels[labelName] = tags[name]
+		}
+	}
+	return labelsOrNil(labels)
+}
+
+// labelsOrNil returns nil if labels is empty, so that it is omitted from JSON
+// responses.
+func labelsOrNil(labels domain.Labels) domain.Labels {
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
+}
+
+// historicSeries is the historic values for a single series of a metric, or
+// for a group of series when grouping by label.
+type historicSeries struct {
+	labels domain.Labels
+	values []*domain.HistoricMetric
+}
+
+// groupHistoricSeries groups the given historic series by the values of the
+// given label names.  The values of the series in each group are summed.  If
+// groupBy is nil, each series is returned in its own group with its own
+// labels.  If groupBy is empty, all series are summed into a single group.
+// The groups are sorted by their labels.
+func groupHistoricSeries(metrics map[domain.MetricName][]*domain.HistoricMetric, groupBy []string) []historicSeries {
+	groups := map[string]*historicSeries{}
+	for seriesKey, values := range metrics {
+		_, labels := domain.ParseSeriesKey(seriesKey)
+		if groupBy != nil {
+			labels = labels.Subset(groupBy)
+		}
+		key := labels.String()
+		group, ok := groups[key]
+		if !ok {
+			groups[key] = &historicSeries{labels: labels, values: values}
+			continue
+		}
+		group.values = sumHistoricMetrics(group.values, values)
+	}
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	series := make([]historicSeries, 0, len(keys))
+	for _, key := range keys {
+		series = append(series, *groups[key])
+	}
+	return series
+}
+
+// sumHistoricMetrics returns the sum of the given historic values at each
+// timestamp.  The values of all series of a metric share the same timestamps
+// as they are fetched with the same resolution.  Missing values are ignored
+// unless all values for a timestamp are missing.
+//
+// The counts and sums of distribution metrics are summed and the value is the
+// mean of the combined observations.  Quantiles cannot be combined and are
+// unknown.
+func sumHistoricMetrics(a, b []*domain.HistoricMetric) []*domain.HistoricMetric {
+	sums := make([]*domain.HistoricMetric, 0, len(a))
+	others := make(map[int64]*domain.HistoricMetric, len(b))
+	for _, metric := range b {
+		others[metric.Timestamp] = metric
+	}
+	for _, metric := range a {
+		other := others[metric.Timestamp]
+		if metric.Distribution != nil && other != nil && other.Distribution != nil {
+			sums = append(sums, sumHistoricDistributions(metric, other))
+			continue
+		}
+		sum := &domain.HistoricMetric{Timestamp: metric.Timestamp, Value: metric.Value}
+		if other != nil {
+			sum.Value = sumIgnoringNaN(sum.Value, other.Value)
+		}
+		sums = append(sums, sum)
+	}
+	return sums
+}
+
+func sumHistoricDistributions(a, b *domain.HistoricMetric) *domain.HistoricMetric {
+	d := &domain.HistoricDistribution{
+		Count:     sumIgnoringNaN(a.Distribution.Count, b.Distribution.Count),
+		Sum:       sumIgnoringNaN(a.Distribution.Sum, b.Distribution.Sum),
+		Quantiles: make(map[string]float64, len(domain.DistributionQuantiles)),
+	}
+	for _, q := range domain.DistributionQuantiles {
+		d.Quantiles[q.Name] = math.NaN()
+	}
+	sum := &domain.HistoricMetric{Timestamp: a.Timestamp, Value: math.NaN(), Distribution: d}
+	if d.Count > 0 {
+		sum.Value = d.Sum / d.Count
+	}
+	return sum
+}
+
+// sumIgnoringNaN returns the sum of a and b, ignoring either if it is NaN.
+func sumIgnoringNaN(a, b float64) float64 {
+	if math.IsNaN(a) {
+		return b
+	} else if math.IsNaN(b) {
+		return a
+	}
+	return a + b
+}
+
+// currentSeries is the current value of a single series of a metric, or of a
+// group of series when grouping by label.
+type currentSeries struct {
+	labels domain.Labels
+	value  any
+}
+
+// groupCurrentMetrics groups the given metrics by the values of the given
+// label names.  The values of the metrics in each group are summed, which
+// requires the metrics to be numeric.  If groupBy is nil, each metric is
+// returned in its own group with its own labels.  The groups are sorted by
+// their labels.
+func groupCurrentMetrics(metrics []domain.CurrentMetric, groupBy []string) ([]currentSeries, error) {
+	groups := map[string]*currentSeries{}
+	for _, metric := range metrics {
+		if groupBy == nil {
+			value, err := castMetricValue(metric)
+			if err != nil {
+				value = metric.Value
+			}
+			groups[metric.Labels.String()] = &currentSeries{labels: metric.Labels, value: value}
+			continue
+		}
+		value, err := metricValueAsFloat(metric)
+		if err != nil {
+			return nil, err
+		}
+		labels := metric.Labels.Subset(groupBy)
+		key := labels.String()
+		if group, ok := groups[key]; ok {
+			group.value = group.value.(float64) + value
+		} else {
+			groups[key] = &currentSeries{labels: labels, value: value}
+		}
+	}
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	series := make([]currentSeries, 0, len(keys))
+	for _, key := range keys {
+		series = append(series, *groups[key])
+	}
+	return series, nil
+}
+
+// metricValueAsFloat returns the value of the given numeric metric as a
+// float64.
+func metricValueAsFloat(metric domain.CurrentMetric) (float64, error) {
+	if !slices.Contains(domain.NumericMetricTypes, metric.Datatype) {
+		return 0, fmt.Errorf("cannot group %s metric %s", metric.Datatype, metric.Name)
+	}
+	return strconv.ParseFloat(metric.Value, 64)
+}
@@ -0,0 +1,297 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/inmem"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_PutMetricWithLabels(t *testing.T) {
+	// Setup
+	pendingRepo := inmem.NewPendingRepository(log.Logger)
+	app := domain.NewApp(pendingRepo, testDSMRepo, testDSMUpdater, nil, nil, nil)
+	server := NewServer(log.Logger, app, testAPIConfig)
+	docs := []string{
+		`{"type": "uint32", "name": "net.bytes", "value": 1, "slope": "both", "ttl": 60, "labels": {"iface": "eth0"}}`,
+		`{"type": "uint32", "name": "net.bytes", "value": 2, "slope": "both", "ttl": 60, "labels": {"iface": "eth1"}}`,
+		`{"type": "uint32", "name": "net.bytes", "value": 3, "slope": "both", "ttl": 60}`,
+	}
+
+	// Action
+	for _, doc := range docs {
+		req := authorizedRequest(t, "PUT", "/1/metrics", bytes.NewBufferString(doc))
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code, "expected status code 200")
+	}
+
+	// Assertions
+	host, _ := pendingRepo.GetHost("1")
+	assert.Len(t, host.Metrics, 3, "expected a series for each label set")
+	assert.Equal(t, "1", host.Metrics["net.bytes;iface=eth0"].Value)
+	assert.Equal(t, domain.Labels{"iface": "eth0"}, host.Metrics["net.bytes;iface=eth0"].Labels)
+	assert.Equal(t, "2", host.Metrics["net.bytes;iface=eth1"].Value)
+	assert.Equal(t, "3", host.Metrics["net.bytes"].Value)
+	assert.Nil(t, host.Metrics["net.bytes"].Labels)
+}
+
+func Test_PutMetricWithInvalidLabelName(t *testing.T) {
+	// Setup
+	server := NewServer(log.Logger, newTestApp(nil, nil), testAPIConfig)
+	doc := `{"type": "uint32", "name": "net.bytes", "value": 1, "slope": "both", "ttl": 60, "labels": {"not-valid": "eth0"}}`
+	req := authorizedRequest(t, "PUT", "/1/metrics", bytes.NewBufferString(doc))
+	rr := httptest.NewRecorder()
+
+	// Action
+	server.Router.ServeHTTP(rr, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code, "expected status code 422")
+	assert.Contains(t, rr.Body.String(), "is not a valid label name")
+}
+
+func Test_getMetricValuesWithLabels(t *testing.T) {
+	// Setup
+	currentRepo := inmem.NewCurrentRepository(log.Logger)
+	assert.NoError(t, currentRepo.Begin())
+	dsm, _ := testDSMRepo.GetDSM("1")
+	host := &domain.CurrentHost{Id: "1", DSM: dsm, Metrics: map[domain.MetricName]domain.CurrentMetric{}}
+	for _, m := range []struct {
+		value  string
+		labels domain.Labels
+	}{
+		{value: "1", labels: domain.Labels{"iface": "eth0", "direction": "rx"}},
+		{value: "2", labels: domain.Labels{"iface": "eth0", "direction": "tx"}},
+		{value: "4", labels: domain.Labels{"iface": "eth1", "direction": "rx"}},
+	} {
+		currentRepo.AddMetric(host, &domain.CurrentMetric{
+			Name: "net.bytes", Datatype: "uint32", Value: m.value, Labels: m.labels, Timestamp: time.Now(),
+		})
+	}
+	currentRepo.AddHost(host)
+	assert.NoError(t, currentRepo.Commit())
+	server := NewServer(log.Logger, newTestApp(currentRepo, nil), testAPIConfig)
+
+	tests := []struct {
+		name         string
+		url          string
+		expectedCode int
+		expectedJSON string
+	}{
+		{
+			name:         "all series",
+			url:          "/metrics/net.bytes/current",
+			expectedCode: http.StatusOK,
+			expectedJSON: `[
+			  {"id": "1", "labels": {"direction": "rx", "iface": "eth0"}, "value": 1},
+			  {"id": "1", "labels": {"direction": "rx", "iface": "eth1"}, "value": 4},
+			  {"id": "1", "labels": {"direction": "tx", "iface": "eth0"}, "value": 2}
+			]`,
+		},
+		{
+			name:         "filtered by label",
+			url:          "/metrics/net.bytes/current?label=iface=eth0",
+			expectedCode: http.StatusOK,
+			expectedJSON: `[
+			  {"id": "1", "labels": {"direction": "rx", "iface": "eth0"}, "value": 1},
+			  {"id": "1", "labels": {"direction": "tx", "iface": "eth0"}, "value": 2}
+			]`,
+		},
+		{
+			name:         "grouped by label",
+			url:          "/metrics/net.bytes/current?group_by=iface",
+			expectedCode: http.StatusOK,
+			expectedJSON: `[
+			  {"id": "1", "labels": {"iface": "eth0"}, "value": 3},
+			  {"id": "1", "labels": {"iface": "eth1"}, "value": 4}
+			]`,
+		},
+		{
+			name:         "filtered and grouped by label",
+			url:          "/metrics/net.bytes/current?label=direction=rx&group_by=direction",
+			expectedCode: http.StatusOK,
+			expectedJSON: `[
+			  {"id": "1", "labels": {"direction": "rx"}, "value": 5}
+			]`,
+		},
+		{
+			name:         "invalid label filter",
+			url:          "/metrics/net.bytes/current?label=iface",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tt.url, nil)
+			assert.NoError(t, err, "unexpected failure building http request")
+			rr := httptest.NewRecorder()
+
+			// Action
+			server.Router.ServeHTTP(rr, req)
+
+			// Assertions
+			assert.Equal(t, tt.expectedCode, rr.Code, "unexpected status code")
+			if tt.expectedJSON != "" {
+				assert.JSONEq(t, tt.expectedJSON, rr.Body.String(), "unexpected body")
+			}
+		})
+	}
+}
+
+func Test_groupHistoricSeries(t *testing.T) {
+	nan := math.NaN()
+	metrics := map[domain.MetricName][]*domain.HistoricMetric{
+		"net.bytes;direction=rx;iface=eth0": {{Timestamp: 15, Value: 1}, {Timestamp: 30, Value: nan}},
+		"net.bytes;direction=tx;iface=eth0": {{Timestamp: 15, Value: 2}, {Timestamp: 30, Value: nan}},
+		"net.bytes;direction=rx;iface=eth1": {{Timestamp: 15, Value: 4}, {Timestamp: 30, Value: 8}},
+	}
+
+	tests := []struct {
+		name     string
+		groupBy  []string
+		expected []historicSeries
+	}{
+		{
+			name:    "each series",
+			groupBy: nil,
+			expected: []historicSeries{
+				{labels: domain.Labels{"direction": "rx", "iface": "eth0"}, values: metrics["net.bytes;direction=rx;iface=eth0"]},
+				{labels: domain.Labels{"direction": "rx", "iface": "eth1"}, values: metrics["net.bytes;direction=rx;iface=eth1"]},
+				{labels: domain.Labels{"direction": "tx", "iface": "eth0"}, values: metrics["net.bytes;direction=tx;iface=eth0"]},
+			},
+		},
+		{
+			name:    "grouped by label",
+			groupBy: []string{"direction"},
+			expected: []historicSeries{
+				{labels: domain.Labels{"direction": "rx"}, values: []*domain.HistoricMetric{{Timestamp: 15, Value: 5}, {Timestamp: 30, Value: 8}}},
+				{labels: domain.Labels{"direction": "tx"}, values: metrics["net.bytes;direction=tx;iface=eth0"]},
+			},
+		},
+		{
+			name:    "all series summed",
+			groupBy: []string{},
+			expected: []historicSeries{
+				{labels: domain.Labels{}, values: []*domain.HistoricMetric{{Timestamp: 15, Value: 7}, {Timestamp: 30, Value: 8}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Action
+			series := groupHistoricSeries(metrics, tt.groupBy)
+
+			// Assertions
+			assert.Len(t, series, len(tt.expected))
+			for i, expected := range tt.expected {
+				assert.Equal(t, expected.labels, series[i].labels)
+				assert.Equal(t, expected.values, series[i].values)
+			}
+		})
+	}
+}
+
+func Test_groupHistoricSeriesSumsDistributions(t *testing.T) {
+	// Setup
+	distribution := func(count, sum, p50 float64) *domain.HistoricMetric {
+		return &domain.HistoricMetric{
+			Timestamp:    15,
+			Value:        sum / count,
+			Distribution: &domain.HistoricDistribution{Count: count, Sum: sum, Quantiles: map[string]float64{"p50": p50}},
+		}
+	}
+	metrics := map[domain.MetricName][]*domain.HistoricMetric{
+		"job.latency;queue=a": {distribution(2, 10, 4)},
+		"job.latency;queue=b": {distribution(3, 5, 1)},
+	}
+
+	// Action
+	series := groupHistoricSeries(metrics, []string{})
+
+	// Assertions
+	if assert.Len(t, series, 1) && assert.Len(t, series[0].values, 1) {
+		value := series[0].values[0]
+		assert.Equal(t, 3.0, value.Value)
+		if assert.NotNil(t, value.Distribution) {
+			assert.Equal(t, 5.0, value.Distribution.Count)
+			assert.Equal(t, 15.0, value.Distribution.Sum)
+			assert.True(t, math.IsNaN(value.Distribution.Quantiles["p50"]), "expected quantiles to be unknown")
+		}
+	}
+}
+
+func Test_labelsFromTags(t *testing.T) {
+	tags := map[string]string{
+		"host":         "comp10",
+		"service.name": "api",
+		"service_name": "other",
+		"0day":         "x",
+		"region":       "eu",
+	}
+
+	labels := labelsFromTags(tags, "host")
+
+	expected := domain.Labels{"_0day": "x", "region": "eu", "service_name": "api"}
+	assert.Equal(t, expected, labels)
+	assert.Nil(t, labelsFromTags(map[string]string{"host": "comp10"}, "host"))
+}
+
+func Test_SeriesKeyRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		metric string
+		labels domain.Labels
+		key    domain.MetricName
+	}{
+		{name: "no labels", metric: "power.level", key: "power.level"},
+		{name: "labels are sorted", metric: "net.bytes", labels: domain.Labels{"iface": "eth0", "direction": "rx"}, key: "net.bytes;direction=rx;iface=eth0"},
+		{name: "values are escaped", metric: "disk.used", labels: domain.Labels{"mount": "/var/lib;x"}, key: "disk.used;mount=%2Fvar%2Flib%3Bx"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := domain.SeriesKey(tt.metric, tt.labels)
+			assert.Equal(t, tt.key, key)
+			name, labels := domain.ParseSeriesKey(key)
+			assert.Equal(t, tt.metric, name)
+			assert.Equal(t, tt.labels, labels)
+		})
+	}
+}
@@ -0,0 +1,179 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+)
+
+type metricDefinitionRequest struct {
+	Type        string   `json:"type"        validate:"omitempty,oneof=string int8 uint8 int16 uint16 int32 uint32 int64 uint64 float double bool timestamp enum distribution"`
+	Units       string   `json:"units"       validate:"excludesall=<>'\"&"`
+	Slope       string   `json:"slope"       validate:"omitempty,oneof=zero positive negative both derivative"`
+	Min         *float64 `json:"min"`
+	Max         *float64 `json:"max"`
+	States      []string `json:"states"`
+	Description string   `json:"description"`
+}
+
+type metricDefinitionResponse struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type,omitempty"`
+	Units       string   `json:"units,omitempty"`
+	Slope       string   `json:"slope,omitempty"`
+	Min         *float64 `json:"min,omitempty"`
+	Max         *float64 `json:"max,omitempty"`
+	States      []string `json:"states,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+func metricDefinitionResponseFromDefinition(src domain.MetricDefinition) metricDefinitionResponse {
+	return metricDefinitionResponse{
+		Name:        src.Name,
+		Type:        src.Type.String(),
+		Units:       src.Units,
+		Slope:       src.Slope.String(),
+		Min:         src.Min,
+		Max:         src.Max,
+		States:      src.States,
+		Description: src.Description,
+	}
+}
+
+// getMetricDefinitions returns a JSON list of all metric definitions.
+//
+//	[
+//	  {
+//	    "name": "power.level",
+//	    "type": "uint32",
+//	    "units": "W",
+//	    "slope": "both",
+//	    "min": 0,
+//	    "description": "Power drawn by the device"
+//	  },
+//	  ...
+//	]
+func (s *Server) getMetricDefinitions(rw http.ResponseWriter, r *http.Request) {
+	body := []metricDefinitionResponse{}
+	for _, definition := range s.app.DefinitionRepo.List() {
+		body = append(body, metricDefinitionResponseFromDefinition(definition))
+	}
+	renderJSON(body, http.StatusOK, rw)
+}
+
+// getMetricDefinition returns the metric definition with the given name or
+// pattern.
+func (s *Server) getMetricDefinition(rw http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	definition, ok := s.app.DefinitionRepo.Get(name)
+	if !ok {
+		NotFound(rw, r, fmt.Errorf("%w: %s", domain.ErrMetricDefinitionNotFound, name))
+		return
+	}
+	renderJSON(metricDefinitionResponseFromDefinition(definition), http.StatusOK, rw)
+}
+
+// putMetricDefinition creates or replaces the metric definition with the
+// given name or pattern.
+func (s *Server) putMetricDefinition(rw http.ResponseWriter, r *http.Request) {
+	req := &metricDefinitionRequest{}
+	err := parseJSONBody(req, rw, r)
+	if err != nil {
+		// The correct response has already been sent by parseJSONBody.
+		return
+	}
+	definition := domain.MetricDefinition{
+		Name:        chi.URLParam(r, "name"),
+		Type:        domain.MetricType(req.Type),
+		Units:       req.Units,
+		Slope:       domain.MetricSlope(req.Slope),
+		Min:         req.Min,
+		Max:         req.Max,
+		States:      req.States,
+		Description: req.Description,
+	}
+	err = s.app.DefinitionRepo.Put(definition)
+	if errors.Is(err, domain.ErrInvalidMetricDefinition) {
+		body := ErrorsPayload{
+			Status: http.StatusUnprocessableEntity,
+			Errors: []*ErrorObject{{
+				Status: http.StatusUnprocessableEntity,
+				Title:  "Invalid metric definition",
+				Detail: err.Error(),
+			}},
+		}
+		renderJSON(body, http.StatusUnprocessableEntity, rw)
+		return
+	} else if err != nil {
+		InternalError(rw, r, err)
+		return
+	}
+	renderJSON(metricDefinitionResponseFromDefinition(definition), http.StatusOK, rw)
+}
+
+// deleteMetricDefinition deletes the metric definition with the given name or
+// pattern.
+func (s *Server) deleteMetricDefinition(rw http.ResponseWriter, r *http.Request) {
+	err := s.app.DefinitionRepo.Delete(chi.URLParam(r, "name"))
+	if errors.Is(err, domain.ErrMetricDefinitionNotFound) {
+		NotFound(rw, r, err)
+		return
+	} else if err != nil {
+		InternalError(rw, r, err)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// definitionErrorObjects returns an ErrorObject for each of the ways in which
+// a reported metric conflicts with its definition.
+func definitionErrorObjects(err error) []*ErrorObject {
+	var defErr *domain.MetricDefinitionError
+	if !errors.As(err, &defErr) {
+		return []*ErrorObject{{
+			Status: http.StatusUnprocessableEntity,
+			Title:  "definition",
+			Detail: err.Error(),
+		}}
+	}
+	errs := make([]*ErrorObject, 0, len(defErr.Conflicts))
+	for _, conflict := range defErr.Conflicts {
+		errs = append(errs, &ErrorObject{
+			Status: http.StatusUnprocessableEntity,
+			Title:  "definition",
+			Detail: fmt.Sprintf("%s (metric definition %s)", conflict.Detail, defErr.Definition),
+			Source: conflict.Field,
+		})
+	}
+	return errs
+}
@@ -0,0 +1,215 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/inmem"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MetricDefinitionsCanBeManaged(t *testing.T) {
+	// Setup
+	server := NewServer(log.Logger, newTestApp(nil, nil), testAPIConfig)
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		return rr
+	}
+	doc := `{"type": "uint32", "units": "W", "slope": "both", "min": 0, "max": 5000, "description": "Power drawn by the device"}`
+
+	// Action
+	rr := serve(authorizedRequest(t, "PUT", "/metric-definitions/power.level", bytes.NewBufferString(doc)))
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rr.Code, "expected status code 200")
+	expectedJSON := `{"name": "power.level", "type": "uint32", "units": "W", "slope": "both", "min": 0, "max": 5000, "description": "Power drawn by the device"}`
+	assert.JSONEq(t, expectedJSON, rr.Body.String(), "unexpected body")
+
+	// Action
+	req, _ := http.NewRequest("GET", "/metric-definitions", nil)
+	rr = serve(req)
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rr.Code, "expected status code 200")
+	assert.JSONEq(t, "["+expectedJSON+"]", rr.Body.String(), "unexpected body")
+
+	// Action
+	rr = serve(authorizedRequest(t, "DELETE", "/metric-definitions/power.level", nil))
+
+	// Assertions
+	assert.Equal(t, http.StatusNoContent, rr.Code, "expected status code 204")
+	req, _ = http.NewRequest("GET", "/metric-definitions/power.level", nil)
+	rr = serve(req)
+	assert.Equal(t, http.StatusNotFound, rr.Code, "expected status code 404")
+}
+
+func Test_PutMetricDefinitionValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		doc  string
+	}{
+		{name: "invalid type", url: "/metric-definitions/foo", doc: `{"type": "invalid"}`},
+		{name: "min greater than max", url: "/metric-definitions/foo", doc: `{"min": 10, "max": 1}`},
+		{name: "invalid pattern", url: "/metric-definitions/foo[", doc: `{}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			server := NewServer(log.Logger, newTestApp(nil, nil), testAPIConfig)
+			req := authorizedRequest(t, "PUT", tt.url, bytes.NewBufferString(tt.doc))
+			rr := httptest.NewRecorder()
+
+			// Action
+			server.Router.ServeHTTP(rr, req)
+
+			// Assertions
+			assert.Equal(t, http.StatusUnprocessableEntity, rr.Code, "expected status code 422")
+		})
+	}
+}
+
+func Test_PutMetricConflictingWithDefinition(t *testing.T) {
+	// Setup
+	app := newTestApp(nil, nil)
+	max := 5000.0
+	err := app.DefinitionRepo.Put(domain.MetricDefinition{Name: "power.*", Type: "uint32", Units: "W", Max: &max})
+	assert.NoError(t, err)
+	server := NewServer(log.Logger, app, testAPIConfig)
+
+	tests := []struct {
+		name         string
+		doc          string
+		expectedCode int
+		expectedJSON string
+	}{
+		{
+			name:         "metric matching definition",
+			doc:          `{"type": "uint32", "name": "power.level", "value": 20, "units": "W", "slope": "both", "ttl": 60}`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "metric conflicting with definition",
+			doc:          `{"type": "float", "name": "power.level", "value": 6000, "units": "kW", "slope": "both", "ttl": 60}`,
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedJSON: `{
+			  "status": 422,
+			  "errors": [
+			    {"status": 422, "title": "definition", "detail": "type must be uint32 (metric definition power.*)", "source": "type"},
+			    {"status": 422, "title": "definition", "detail": "units must be W (metric definition power.*)", "source": "units"},
+			    {"status": 422, "title": "definition", "detail": "value must be 5000 or less (metric definition power.*)", "source": "value"}
+			  ]
+			}`,
+		},
+		{
+			name:         "metric without a definition",
+			doc:          `{"type": "float", "name": "temperature", "value": 6000, "units": "C", "slope": "both", "ttl": 60}`,
+			expectedCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := authorizedRequest(t, "PUT", "/1/metrics", bytes.NewBufferString(tt.doc))
+			rr := httptest.NewRecorder()
+
+			// Action
+			server.Router.ServeHTTP(rr, req)
+
+			// Assertions
+			assert.Equal(t, tt.expectedCode, rr.Code, "unexpected status code")
+			if tt.expectedJSON != "" {
+				assert.JSONEq(t, tt.expectedJSON, rr.Body.String(), "unexpected body")
+			}
+		})
+	}
+}
+
+func Test_getUniqueMetricsIncludesDescription(t *testing.T) {
+	// Setup
+	currentRepo := inmem.NewCurrentRepository(log.Logger)
+	assert.NoError(t, currentRepo.Begin())
+	dsm, _ := testDSMRepo.GetDSM("1")
+	host := &domain.CurrentHost{Id: "1", DSM: dsm, Metrics: map[domain.MetricName]domain.CurrentMetric{}}
+	currentRepo.AddMetric(host, &domain.CurrentMetric{
+		Name: "power.level", Datatype: "uint32", Units: "W", Value: "10", Nature: "volatile", Timestamp: time.Now(),
+	})
+	currentRepo.AddHost(host)
+	assert.NoError(t, currentRepo.Commit())
+	app := newTestApp(currentRepo, nil)
+	err := app.DefinitionRepo.Put(domain.MetricDefinition{Name: "power.level", Description: "Power drawn by the device"})
+	assert.NoError(t, err)
+	server := NewServer(log.Logger, app, testAPIConfig)
+	req, err := http.NewRequest("GET", "/metrics/current", nil)
+	assert.NoError(t, err, "unexpected failure building http request")
+	rr := httptest.NewRecorder()
+
+	// Action
+	server.Router.ServeHTTP(rr, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rr.Code, "expected status code 200")
+	expectedJSON := `[{
+	  "id": "power.level", "name": "power.level", "units": "W", "nature": "volatile",
+	  "min": 10, "max": 10, "description": "Power drawn by the device"
+	}]`
+	assert.JSONEq(t, expectedJSON, rr.Body.String(), "unexpected body")
+}
+
+func Test_PostInfluxWriteConflictingWithDefinition(t *testing.T) {
+	// Setup
+	server, pendingRepo := newInfluxTestServer()
+	definitions, err := inmem.NewDefinitionRepository(log.Logger, nil)
+	assert.NoError(t, err)
+	server.app.DefinitionRepo = definitions
+	err = definitions.Put(domain.MetricDefinition{Name: "power.*", Type: "int64"})
+	assert.NoError(t, err)
+	body := "power,concertim_device_id=1 level=20i,draw=1.5\n"
+	req := authorizedRequest(t, "POST", "/write", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+
+	// Action
+	server.Router.ServeHTTP(rr, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	host, ok := pendingRepo.GetHost("1")
+	if assert.True(t, ok) {
+		assert.Len(t, host.Metrics, 1, "expected metric conflicting with its definition to be rejected")
+		assert.Contains(t, host.Metrics, domain.MetricName("power.level"))
+	}
+}
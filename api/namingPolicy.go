@@ -0,0 +1,75 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+)
+
+// applyNamingPolicy normalises the metric's name and checks it against the
+// application's naming policy, if any.  If the name is not allowed, the
+// status code and error to report are returned.
+//
+// Application.AddPendingMetric makes the same checks; they are made here too
+// so that the scope of the request is checked against the normalised name.
+func (s *Server) applyNamingPolicy(r *http.Request, putMetric *putMetricRequest) (int, *ErrorObject) {
+	policy := s.app.NamingPolicy
+	if policy == nil {
+		return http.StatusOK, nil
+	}
+	putMetric.Name = policy.Normalise(putMetric.Name)
+	err := policy.Check(putMetric.Name, jwtSubject(r))
+	if err == nil {
+		return http.StatusOK, nil
+	}
+	return namingErrorObject(err)
+}
+
+// namingErrorObject returns the status code and error to report for the
+// given ErrInvalidMetricName or ErrReservedMetricName error.
+func namingErrorObject(err error) (int, *ErrorObject) {
+	status := http.StatusUnprocessableEntity
+	title := "metricname"
+	if errors.Is(err, domain.ErrReservedMetricName) {
+		status = http.StatusForbidden
+		title = "reserved"
+	}
+	return status, &ErrorObject{Status: status, Title: title, Detail: err.Error(), Source: "name"}
+}
+
+// jwtSubject returns the subject of the request's verified JWT token, or the
+// empty string if it does not have one.
+func jwtSubject(r *http.Request) string {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	subject, _ := claims["sub"].(string)
+	return subject
+}
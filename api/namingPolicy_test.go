@@ -0,0 +1,207 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/inmem"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_PutMetricNamingPolicy(t *testing.T) {
+	tests := []struct {
+		name           string
+		options        domain.NamingPolicyOptions
+		metricName     string
+		subject        string
+		expectedCode   int
+		expectedTitle  string
+		expectedMetric domain.MetricName
+	}{
+		{
+			name:           "allowed name",
+			options:        domain.NamingPolicyOptions{AllowedCharacters: "a-z.", MaxLength: 20},
+			metricName:     "power.level",
+			expectedCode:   http.StatusOK,
+			expectedMetric: "power.level",
+		},
+		{
+			name:          "name with characters that are not allowed",
+			options:       domain.NamingPolicyOptions{AllowedCharacters: "a-z."},
+			metricName:    "../power",
+			expectedCode:  http.StatusUnprocessableEntity,
+			expectedTitle: "metricname",
+		},
+		{
+			name:          "name that is too long",
+			options:       domain.NamingPolicyOptions{MaxLength: 5},
+			metricName:    "power.level",
+			expectedCode:  http.StatusUnprocessableEntity,
+			expectedTitle: "metricname",
+		},
+		{
+			name:           "normalised name",
+			options:        domain.NamingPolicyOptions{AllowedCharacters: "a-z._", Lowercase: true, Replacement: "_"},
+			metricName:     "Power Level/Watts",
+			expectedCode:   http.StatusOK,
+			expectedMetric: "power_level_watts",
+		},
+		{
+			name: "reserved prefix used by other subject",
+			options: domain.NamingPolicyOptions{
+				ReservedPrefixes: []domain.ReservedPrefix{{Prefix: "ct.ipmi.", Subjects: []string{"concertim"}}},
+			},
+			metricName:    "ct.ipmi.power",
+			subject:       "agent",
+			expectedCode:  http.StatusForbidden,
+			expectedTitle: "reserved",
+		},
+		{
+			name: "reserved prefix used by permitted subject",
+			options: domain.NamingPolicyOptions{
+				ReservedPrefixes: []domain.ReservedPrefix{{Prefix: "ct.ipmi.", Subjects: []string{"concertim"}}},
+			},
+			metricName:     "ct.ipmi.power",
+			subject:        "concertim",
+			expectedCode:   http.StatusOK,
+			expectedMetric: "ct.ipmi.power",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			policy, err := domain.NewNamingPolicy(tt.options)
+			assert.NoError(t, err)
+			pendingRepo := inmem.NewPendingRepository(log.Logger)
+			app := domain.NewApp(pendingRepo, testDSMRepo, testDSMUpdater, nil, nil, nil)
+			app.NamingPolicy = policy
+			server := NewServer(log.Logger, app, testAPIConfig)
+			doc := fmt.Sprintf(`{"type": "int32", "name": %q, "value": 1, "slope": "both", "ttl": 60}`, tt.metricName)
+			req, err := http.NewRequest("PUT", "/1/metrics", bytes.NewBufferString(doc))
+			assert.NoError(t, err, "unexpected failure building http request")
+			tokenAuth := jwtauth.New("HS256", testAPIConfig.JWTSecret, nil)
+			_, token, err := tokenAuth.Encode(map[string]interface{}{"sub": tt.subject})
+			assert.NoError(t, err, "unexpected failure creating auth token")
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+			rr := httptest.NewRecorder()
+
+			// Action
+			server.Router.ServeHTTP(rr, req)
+
+			// Assertions
+			assert.Equal(t, tt.expectedCode, rr.Code, "unexpected status code")
+			if tt.expectedTitle != "" {
+				assert.Contains(t, rr.Body.String(), fmt.Sprintf(`"title":%q`, tt.expectedTitle))
+				assert.Contains(t, rr.Body.String(), `"source":"name"`)
+			}
+			if tt.expectedMetric != "" {
+				host, _ := pendingRepo.GetHost("1")
+				assert.Contains(t, host.Metrics, tt.expectedMetric)
+			}
+		})
+	}
+}
+
+func Test_NewNamingPolicyRejectsInvalidOptions(t *testing.T) {
+	_, err := domain.NewNamingPolicy(domain.NamingPolicyOptions{AllowedCharacters: "a-z", Replacement: "_"})
+	assert.Error(t, err, "expected replacement with characters that are not allowed to be rejected")
+	_, err = domain.NewNamingPolicy(domain.NamingPolicyOptions{AllowedCharacters: "z-a"})
+	assert.Error(t, err, "expected invalid character class to be rejected")
+}
+
+func Test_PostInfluxWriteNamingPolicy(t *testing.T) {
+	// Setup
+	server, pendingRepo := newInfluxTestServer()
+	policy, err := domain.NewNamingPolicy(domain.NamingPolicyOptions{Lowercase: true, MaxLength: 10})
+	assert.NoError(t, err)
+	server.app.NamingPolicy = policy
+	body := "CPU,concertim_device_id=1 Idle=92.5,procs_running=12i\n"
+	req := authorizedRequest(t, "POST", "/write", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+
+	// Action
+	server.Router.ServeHTTP(rr, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	host, ok := pendingRepo.GetHost("1")
+	if assert.True(t, ok) {
+		assert.Len(t, host.Metrics, 1, "expected name that is too long to be rejected")
+		assert.Contains(t, host.Metrics, domain.MetricName("cpu.idle"), "expected name to be normalised")
+	}
+}
+
+func Test_PostInfluxWriteReservedPrefix(t *testing.T) {
+	tests := []struct {
+		name     string
+		subject  string
+		expected int
+	}{
+		{name: "permitted subject", subject: "concertim", expected: 2},
+		{name: "other subject", subject: "agent", expected: 1},
+		{name: "no subject", subject: "", expected: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			server, pendingRepo := newInfluxTestServer()
+			policy, err := domain.NewNamingPolicy(domain.NamingPolicyOptions{
+				ReservedPrefixes: []domain.ReservedPrefix{{Prefix: "ct.ipmi.", Subjects: []string{"concertim"}}},
+			})
+			assert.NoError(t, err)
+			server.app.NamingPolicy = policy
+			body := "ct,concertim_device_id=1 ipmi.power=10\ncpu,concertim_device_id=1 idle=92.5\n"
+			claims := map[string]interface{}{}
+			if tt.subject != "" {
+				claims["sub"] = tt.subject
+			}
+			req := scopedRequest(t, "POST", "/write", body, claims)
+			rr := httptest.NewRecorder()
+
+			// Action
+			server.Router.ServeHTTP(rr, req)
+
+			// Assertions
+			assert.Equal(t, http.StatusNoContent, rr.Code)
+			host, ok := pendingRepo.GetHost("1")
+			if assert.True(t, ok) {
+				assert.Len(t, host.Metrics, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/rs/zerolog/hlog"
+)
+
+// collectdValueList is a single value list as sent by collectd's write_http
+// plugin using its JSON format.
+type collectdValueList struct {
+	Values         []*json.Number `json:"values"`
+	DSTypes        []string       `json:"dstypes"`
+	DSNames        []string       `json:"dsnames"`
+	Time           float64        `json:"time"`
+	Interval       float64        `json:"interval"`
+	Host           string         `json:"host"`
+	Plugin         string         `json:"plugin"`
+	PluginInstance string         `json:"plugin_instance"`
+	Type           string         `json:"type"`
+	TypeInstance   string         `json:"type_instance"`
+}
+
+// postCollectd receives value lists sent by collectd's write_http plugin using
+// its JSON format.
+//
+// The device is identified by the value list's host name.  Each data source
+// of each value list is added to the pending repository as a metric named
+// `<plugin>.<type>[.<dsname>]`.  The data source name is only included if it
+// is not `value`.  The plugin and type instances, if any, are given as the
+// `plugin_instance` and `type_instance` labels.  Each metric is
+// reported at the value list's time.
+//
+// Value lists for which a device cannot be found are skipped.  A 204 no
+// content response is given if the request could be decoded.
+func (s *Server) postCollectd(rw http.ResponseWriter, r *http.Request) {
+	var valueLists []collectdValueList
+	if err := decodeJSONBody(&valueLists, rw, r); err != nil {
+		return
+	}
+	logger := hlog.FromRequest(r)
+	var accepted, skipped int
+	for _, vl := range valueLists {
+		n, err := s.addCollectdValueList(vl, jwtSubject(r))
+		accepted += n
+		if err != nil {
+			logger.Debug().Err(err).Str("host", vl.Host).Str("plugin", vl.Plugin).Msg("skipping value list")
+			skipped++
+		}
+	}
+	logger.Debug().Int("accepted", accepted).Int("skipped", skipped).Msg("processed collectd values")
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+var errMismatchedDataSources = errors.New("values, dstypes and dsnames differ in length")
+
+// addCollectdValueList adds each data source of the given value list to the
+// pending repository and returns the number added.
+func (s *Server) addCollectdValueList(vl collectdValueList, subject string) (int, error) {
+	if len(vl.Values) != len(vl.DSTypes) || len(vl.Values) != len(vl.DSNames) {
+		return 0, errMismatchedDataSources
+	}
+	hostId, err := s.collectdHostId(vl.Host)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	reported := now
+	if vl.Time > 0 {
+		reported, err = checkReportedTime(time.Unix(0, int64(vl.Time*float64(time.Second))), now, s.config.Timestamps)
+		if err != nil {
+			return 0, err
+		}
+	}
+	labels := domain.Labels{}
+	if vl.PluginInstance != "" {
+		labels["plugin_instance"] = vl.PluginInstance
+	}
+	if vl.TypeInstance != "" {
+		labels["type_instance"] = vl.TypeInstance
+	}
+	added := 0
+	var errs []error
+	for i, value := range vl.Values {
+		name := collectdMetricName(vl, vl.DSNames[i])
+		if value == nil {
+			// collectd reports NaN values as null.
+			errs = append(errs, fmt.Errorf("%s: null is %w", name, domain.ErrInvalidMetricVal))
+			continue
+		}
+		metricType, slope, err := collectdTypeAndSlope(vl.DSTypes[i])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		metric := domain.PendingMetric{
+			Name:     name,
+			Labels:   labelsOrNil(labels),
+			Slope:    slope,
+			Reported: reported,
+			TTL:      s.config.Collectd.TTL,
+			Type:     metricType,
+		}
+		metric.Value, err = domain.ParseMetricVal(*value, metric.Type)
+		if err == nil {
+			err = s.app.AddPendingMetric(metric, hostId, subject)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		added++
+	}
+	return added, errors.Join(errs...)
+}
+
+// collectdHostId returns the host id for the given collectd host name.  If
+// the host name is fully qualified and cannot be found, its short name is
+// tried.
+func (s *Server) collectdHostId(hostName string) (domain.HostId, error) {
+	if short, _, found := strings.Cut(hostName, "."); found && short != "" {
+		return s.app.HostIdForHostNames(hostName, short)
+	}
+	return s.app.HostIdForHostName(hostName)
+}
+
+// collectdMetricName returns the metric name for the given data source of the
+// given value list.
+func collectdMetricName(vl collectdValueList, dsName string) string {
+	name := fmt.Sprintf("%s.%s", vl.Plugin, vl.Type)
+	if dsName != "" && dsName != "value" {
+		name = fmt.Sprintf("%s.%s", name, dsName)
+	}
+	return name
+}
+
+// collectdTypeAndSlope returns the metric type and slope for the given
+// collectd data source type.  Gauges are floating point values that may
+// increase or decrease.  Counters are unsigned integer totals that only
+// increase.  Derives are signed integer totals whose rate of change is of
+// interest and which may decrease.  Absolutes are unsigned integers that are
+// reset each time they are read.
+func collectdTypeAndSlope(dsType string) (domain.MetricType, domain.MetricSlope, error) {
+	switch dsType {
+	case "gauge":
+		return domain.MetricTypeDouble, domain.MetricSlopeBoth, nil
+	case "counter":
+		return domain.MetricTypeUint64, domain.MetricSlopePositive, nil
+	case "derive":
+		return domain.MetricTypeInt64, domain.MetricSlopeDerivative, nil
+	case "absolute":
+		return domain.MetricTypeUint64, domain.MetricSlopeBoth, nil
+	default:
+		return "", "", fmt.Errorf("unknown data source type %q", dsType)
+	}
+}
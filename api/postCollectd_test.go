@@ -0,0 +1,117 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/inmem"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_PostCollectd(t *testing.T) {
+	// Setup
+	pendingRepo := inmem.NewPendingRepository(log.Logger)
+	app := domain.NewApp(pendingRepo, testDSMRepo, testDSMUpdater, nil, nil, nil)
+	config := testAPIConfig
+	config.Collectd.TTL = time.Minute
+	server := NewServer(log.Logger, app, config)
+	doc := `[
+	  {"values": [1901474177], "dstypes": ["counter"], "dsnames": ["value"], "time": 1280959128, "interval": 10,
+	   "host": "device:1", "plugin": "cpu", "plugin_instance": "0", "type": "cpu", "type_instance": "idle"},
+	  {"values": [0.25], "dstypes": ["gauge"], "dsnames": ["value"], "time": 1280959128, "interval": 10,
+	   "host": "device:1.example.com", "plugin": "load", "plugin_instance": "", "type": "load", "type_instance": "shortterm"},
+	  {"values": [1024, null], "dstypes": ["derive", "derive"], "dsnames": ["rx", "tx"], "time": 1280959128, "interval": 10,
+	   "host": "device:1", "plugin": "interface", "plugin_instance": "eth0", "type": "if_octets", "type_instance": ""},
+	  {"values": [1], "dstypes": ["gauge"], "dsnames": ["value"], "time": 1280959128, "interval": 10,
+	   "host": "NOPE", "plugin": "load", "plugin_instance": "", "type": "load", "type_instance": ""},
+	  {"values": [1, 2], "dstypes": ["gauge"], "dsnames": ["value"], "time": 1280959128, "interval": 10,
+	   "host": "device:1", "plugin": "bad", "plugin_instance": "", "type": "bad", "type_instance": ""}
+	]`
+	req := authorizedRequest(t, "POST", "/collectd", bytes.NewBufferString(doc))
+	rr := httptest.NewRecorder()
+
+	// Action
+	server.Router.ServeHTTP(rr, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	host, ok := pendingRepo.GetHost("1")
+	if assert.True(t, ok) {
+		expected := map[domain.MetricName]struct {
+			value  string
+			typ    domain.MetricType
+			slope  domain.MetricSlope
+			labels domain.Labels
+		}{
+			"cpu.cpu;plugin_instance=0;type_instance=idle": {
+				"1901474177", domain.MetricTypeUint64, domain.MetricSlopePositive,
+				domain.Labels{"plugin_instance": "0", "type_instance": "idle"},
+			},
+			"load.load;type_instance=shortterm": {
+				"0.250000", domain.MetricTypeDouble, domain.MetricSlopeBoth,
+				domain.Labels{"type_instance": "shortterm"},
+			},
+			"interface.if_octets.rx;plugin_instance=eth0": {
+				"1024", domain.MetricTypeInt64, domain.MetricSlopeDerivative,
+				domain.Labels{"plugin_instance": "eth0"},
+			},
+		}
+		assert.Len(t, host.Metrics, len(expected))
+		for name, e := range expected {
+			metric := host.Metrics[name]
+			assert.Equal(t, e.labels, metric.Labels, name)
+			assert.Equal(t, e.value, metric.Value, name)
+			assert.Equal(t, e.typ, metric.Type, name)
+			assert.Equal(t, e.slope, metric.Slope, name)
+			assert.Equal(t, time.Minute, metric.TTL, name)
+			assert.True(t, time.Unix(1280959128, 0).Equal(metric.Reported), "%s: unexpected reported time %s", name, metric.Reported)
+		}
+	}
+	assert.Len(t, pendingRepo.GetAll(), 1)
+}
+
+func Test_PostCollectdInvalidJSON(t *testing.T) {
+	// Setup
+	server := NewServer(log.Logger, newTestApp(nil, nil), testAPIConfig)
+	req := authorizedRequest(t, "POST", "/collectd", bytes.NewBufferString(`{"values": [1]}`))
+	rr := httptest.NewRecorder()
+
+	// Action
+	server.Router.ServeHTTP(rr, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assertContentType(t, rr, "application/json")
+}
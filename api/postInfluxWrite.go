@@ -0,0 +1,145 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/influx"
+	"github.com/rs/zerolog/hlog"
+)
+
+// postInfluxWrite receives points sent using the InfluxDB line protocol.  It
+// is compatible with InfluxDB's v1 `/write` endpoint and accepts gzip encoded
+// bodies.
+//
+// Each field of each point is added to the pending repository as a metric
+// named `<measurement>.<field>`.  The device is identified either by the
+// configured device tag, which holds the device's Concertim ID, or by the
+// configured host tag, which holds the device's host name.  Points for which
+// a device cannot be found are skipped.  The point's other tags become the
+// metrics' labels.  Each metric is reported at the point's timestamp, in the
+// precision given by the `precision` query parameter, or at the current time
+// if the point has no timestamp.
+//
+// A 204 no content response is given if every line could be parsed.
+// Otherwise, the lines that could be parsed are added and a 400 bad request
+// response is given detailing the lines that could not.
+func (s *Server) postInfluxWrite(rw http.ResponseWriter, r *http.Request) {
+	data, err := readCompressedBody(rw, r, s.config.Influx.MaxBodySize, s.config.Influx.MaxDecodedSize, "line protocol body")
+	if err != nil {
+		// The correct response has already been sent by readCompressedBody.
+		return
+	}
+	points, parseErrs := influx.Parse(data, r.URL.Query().Get("precision"))
+	logger := hlog.FromRequest(r)
+	var accepted, skipped int
+	for _, point := range points {
+		n, err := s.addInfluxPoint(point, jwtSubject(r))
+		accepted += n
+		if err != nil {
+			logger.Debug().Err(err).Str("measurement", point.Measurement).Msg("skipping point")
+			skipped++
+		}
+	}
+	logger.Debug().Int("accepted", accepted).Int("skipped", skipped).Int("invalid", len(parseErrs)).
+		Msg("processed line protocol")
+	if len(parseErrs) > 0 {
+		resp := ErrorsPayload{Status: http.StatusBadRequest}
+		for _, err := range parseErrs {
+			resp.Errors = append(resp.Errors, &ErrorObject{
+				Status: http.StatusBadRequest,
+				Title:  "error parsing line protocol",
+				Detail: err.Error(),
+			})
+		}
+		renderJSON(resp, http.StatusBadRequest, rw)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+var errNoDeviceTag = errors.New("point has neither device nor host tag")
+
+// addInfluxPoint adds each field of the given point to the pending repository
+// and returns the number of fields added.
+func (s *Server) addInfluxPoint(point influx.Point, subject string) (int, error) {
+	hostId, err := s.influxHostId(point)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	reported := now
+	if !point.Timestamp.IsZero() {
+		reported, err = checkReportedTime(point.Timestamp, now, s.config.Timestamps)
+		if err != nil {
+			return 0, err
+		}
+	}
+	labels := labelsFromTags(point.Tags, s.config.Influx.DeviceTag, s.config.Influx.HostTag)
+	added := 0
+	var errs []error
+	for _, field := range point.Fields {
+		metricType, value := inferMetricType(field.Value)
+		metric := domain.PendingMetric{
+			Name:     fmt.Sprintf("%s.%s", point.Measurement, field.Key),
+			Labels:   labels,
+			Slope:    domain.MetricSlopeBoth,
+			Reported: reported,
+			TTL:      s.config.Influx.TTL,
+			Type:     metricType,
+		}
+		metric.Value, err = domain.ParseMetricVal(value, metric.Type)
+		if err == nil {
+			err = s.app.AddPendingMetric(metric, hostId, subject)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("field %s: %w", field.Key, err))
+			continue
+		}
+		added++
+	}
+	return added, errors.Join(errs...)
+}
+
+// influxHostId returns the host id for the given point from either its device
+// tag or its host tag.
+func (s *Server) influxHostId(point influx.Point) (domain.HostId, error) {
+	if deviceId, ok := point.Tags[s.config.Influx.DeviceTag]; ok && deviceId != "" {
+		return domain.HostId(deviceId), nil
+	}
+	hostName, ok := point.Tags[s.config.Influx.HostTag]
+	if !ok || hostName == "" {
+		return "", errNoDeviceTag
+	}
+	return s.app.HostIdForHostName(hostName)
+}
@@ -0,0 +1,200 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/inmem"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func newInfluxTestServer() (*Server, *inmem.PendingRepository) {
+	pendingRepo := inmem.NewPendingRepository(log.Logger)
+	app := domain.NewApp(pendingRepo, testDSMRepo, testDSMUpdater, nil, nil, nil)
+	config := testAPIConfig
+	config.Influx.DeviceTag = "concertim_device_id"
+	config.Influx.HostTag = "host"
+	config.Influx.TTL = time.Minute
+	return NewServer(log.Logger, app, config), pendingRepo
+}
+
+func Test_PostInfluxWrite(t *testing.T) {
+	// Setup
+	server, pendingRepo := newInfluxTestServer()
+	body := "cpu,concertim_device_id=1 idle=92.5,procs=12i,big=5000000000i,huge=10000000000000000000u,ok=true,state=\"running\"\n" +
+		"mem,host=device:2,numa-node=0 free=1024u\n" +
+		"mem,host=NOPE free=1024u\n" +
+		"mem free=1024u\n"
+	req := authorizedRequest(t, "POST", "/write", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+
+	// Action
+	server.Router.ServeHTTP(rr, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	host, ok := pendingRepo.GetHost("1")
+	if assert.True(t, ok) {
+		expected := map[domain.MetricName]struct {
+			value string
+			typ   domain.MetricType
+		}{
+			"cpu.idle":  {"92.500000", domain.MetricTypeDouble},
+			"cpu.procs": {"12", domain.MetricTypeInt64},
+			"cpu.big":   {"5000000000", domain.MetricTypeInt64},
+			"cpu.huge":  {"10000000000000000000", domain.MetricTypeUint64},
+			"cpu.ok":    {"true", domain.MetricTypeBool},
+			"cpu.state": {"running", domain.MetricTypeString},
+		}
+		assert.Len(t, host.Metrics, len(expected))
+		for name, e := range expected {
+			assert.Equal(t, e.value, host.Metrics[name].Value, name)
+			assert.Equal(t, e.typ, host.Metrics[name].Type, name)
+			assert.Equal(t, time.Minute, host.Metrics[name].TTL, name)
+		}
+	}
+	host, ok = pendingRepo.GetHost("2")
+	if assert.True(t, ok) {
+		key := domain.SeriesKey("mem.free", domain.Labels{"numa_node": "0"})
+		assert.Equal(t, "1024", host.Metrics[key].Value)
+		assert.Equal(t, domain.MetricTypeInt64, host.Metrics[key].Type)
+		assert.Equal(t, domain.Labels{"numa_node": "0"}, host.Metrics[key].Labels)
+	}
+	assert.Len(t, pendingRepo.GetAll(), 2)
+}
+
+func Test_PostInfluxWriteWithTimestamp(t *testing.T) {
+	// Setup
+	server, pendingRepo := newInfluxTestServer()
+	reported := time.Now().Add(-time.Minute).Truncate(time.Millisecond)
+	body := fmt.Sprintf("cpu,concertim_device_id=1 idle=92.5 %d\n", reported.UnixMilli())
+	req := authorizedRequest(t, "POST", "/write?precision=ms", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+
+	// Action
+	server.Router.ServeHTTP(rr, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	host, ok := pendingRepo.GetHost("1")
+	if assert.True(t, ok) {
+		metric := host.Metrics["cpu.idle"]
+		assert.True(t, reported.Equal(metric.Reported), "unexpected reported time %s", metric.Reported)
+	}
+}
+
+func Test_PostInfluxWriteGzip(t *testing.T) {
+	// Setup
+	server, pendingRepo := newInfluxTestServer()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte("cpu,concertim_device_id=1 idle=92.5\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, gz.Close())
+	req := authorizedRequest(t, "POST", "/write", &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+
+	// Action
+	server.Router.ServeHTTP(rr, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	_, ok := pendingRepo.GetHost("1")
+	assert.True(t, ok)
+}
+
+func Test_PostInfluxWriteGzipTooLargeOnceDecompressed(t *testing.T) {
+	// Setup
+	server, pendingRepo := newInfluxTestServer()
+	server.config.Influx.MaxDecodedSize = 1024
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte("cpu,concertim_device_id=1 idle=92.5\n"))
+	assert.NoError(t, err)
+	_, err = gz.Write(bytes.Repeat([]byte("\n"), 4096))
+	assert.NoError(t, err)
+	assert.NoError(t, gz.Close())
+	req := authorizedRequest(t, "POST", "/write", &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+
+	// Action
+	server.Router.ServeHTTP(rr, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	_, ok := pendingRepo.GetHost("1")
+	assert.False(t, ok)
+}
+
+func Test_PostInfluxWriteBodyTooLarge(t *testing.T) {
+	// Setup
+	server, pendingRepo := newInfluxTestServer()
+	server.config.Influx.MaxBodySize = 16
+	body := bytes.NewBufferString("cpu,concertim_device_id=1 idle=92.5\n")
+	req := authorizedRequest(t, "POST", "/write", body)
+	rr := httptest.NewRecorder()
+
+	// Action
+	server.Router.ServeHTTP(rr, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	_, ok := pendingRepo.GetHost("1")
+	assert.False(t, ok)
+}
+
+func Test_PostInfluxWriteWithInvalidLines(t *testing.T) {
+	// Setup
+	server, pendingRepo := newInfluxTestServer()
+	body := "cpu,concertim_device_id=1 idle=92.5\ncpu,concertim_device_id=1\n"
+	req := authorizedRequest(t, "POST", "/write", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+
+	// Action
+	server.Router.ServeHTTP(rr, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assertContentType(t, rr, "application/json")
+	assert.Contains(t, rr.Body.String(), "line 2: invalid line protocol: missing fields")
+	host, ok := pendingRepo.GetHost("1")
+	if assert.True(t, ok) {
+		assert.Contains(t, host.Metrics, domain.MetricName("cpu.idle"))
+	}
+}
@@ -0,0 +1,191 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/rs/zerolog/hlog"
+)
+
+type postMetricsBatchEntry struct {
+	DeviceId string             `json:"device_id" validate:"required,notblank"`
+	Metrics  []putMetricRequest `json:"metrics"   validate:"required"`
+}
+
+type postMetricsBatchResponse struct {
+	Status  int                           `json:"status"`
+	Results []postMetricsBatchEntryResult `json:"results"`
+}
+
+type postMetricsBatchEntryResult struct {
+	DeviceId string                       `json:"device_id"`
+	Status   int                          `json:"status"`
+	Errors   []*ErrorObject               `json:"errors,omitempty"`
+	Metrics  []postMetricsBatchItemResult `json:"metrics"`
+}
+
+type postMetricsBatchItemResult struct {
+	Name   string         `json:"name"`
+	Status int            `json:"status"`
+	Errors []*ErrorObject `json:"errors,omitempty"`
+}
+
+// postMetricsBatchHandler adds many metrics for many devices in a single
+// request.  The body is a JSON list of entries each containing a device id
+// and a list of metrics in the same format accepted by putMetricHandler.
+//
+//	[
+//	  {
+//	    "device_id": "1",
+//	    "metrics": [
+//	      {"name": "power.level", "value": 12, "type": "uint32", ...},
+//	      ...
+//	    ]
+//	  },
+//	  ...
+//	]
+//
+// Each entry and each metric is validated and added independently of the
+// others.  So long as the body can be parsed a 200 response is given with a
+// status for each entry and each metric.  A single invalid metric or unknown
+// device does not prevent the other metrics from being added.
+func (s *Server) postMetricsBatchHandler(rw http.ResponseWriter, r *http.Request) {
+	entries := []postMetricsBatchEntry{}
+	err := decodeJSONBody(&entries, rw, r)
+	if err != nil {
+		// The correct response has already been sent by decodeJSONBody.
+		return
+	}
+	body := postMetricsBatchResponse{
+		Status:  http.StatusOK,
+		Results: make([]postMetricsBatchEntryResult, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		body.Results = append(body.Results, s.addBatchEntry(r, entry))
+	}
+	renderJSON(body, http.StatusOK, rw)
+}
+
+func (s *Server) addBatchEntry(r *http.Request, entry postMetricsBatchEntry) postMetricsBatchEntryResult {
+	result := postMetricsBatchEntryResult{
+		DeviceId: entry.DeviceId,
+		Status:   http.StatusOK,
+		Metrics:  make([]postMetricsBatchItemResult, 0, len(entry.Metrics)),
+	}
+	if err := validate.Struct(entry); err != nil {
+		result.Status = http.StatusUnprocessableEntity
+		result.Errors = validationErrorObjects(err)
+		return result
+	}
+	// The scope is checked first so that a token cannot use up the rate
+	// limit of a device outside of its scope.
+	hostId := domain.HostId(entry.DeviceId)
+	scope, err := writeScope(r)
+	if err == nil {
+		err = s.app.CheckWriteScope(scope, hostId)
+	}
+	if err != nil {
+		result.Status = http.StatusForbidden
+		result.Errors = []*ErrorObject{scopeErrorObject(err, "device_id")}
+		return result
+	}
+	if ok, _ := s.allowDevice(entry.DeviceId); !ok {
+		result.Status = http.StatusTooManyRequests
+		result.Errors = []*ErrorObject{{
+			Status: http.StatusTooManyRequests,
+			Title:  http.StatusText(http.StatusTooManyRequests),
+			Detail: fmt.Sprintf("rate limit exceeded for device %s", entry.DeviceId),
+		}}
+		return result
+	}
+	for _, putMetric := range entry.Metrics {
+		item := s.addBatchItem(r, putMetric, hostId, scope)
+		if item.Status != http.StatusOK {
+			result.Status = http.StatusMultiStatus
+		}
+		result.Metrics = append(result.Metrics, item)
+	}
+	return result
+}
+
+func (s *Server) addBatchItem(r *http.Request, putMetric putMetricRequest, hostId domain.HostId, scope domain.WriteScope) postMetricsBatchItemResult {
+	item := postMetricsBatchItemResult{Name: putMetric.Name, Status: http.StatusOK}
+	if err := validate.Struct(putMetric); err != nil {
+		item.Status = http.StatusUnprocessableEntity
+		item.Errors = validationErrorObjects(err)
+		return item
+	}
+	if status, errObj := s.applyNamingPolicy(r, &putMetric); errObj != nil {
+		item.Status = status
+		item.Errors = []*ErrorObject{errObj}
+		return item
+	}
+	if err := scope.CheckMetricName(putMetric.Name); err != nil {
+		item.Status = http.StatusForbidden
+		item.Errors = []*ErrorObject{scopeErrorObject(err, "name")}
+		return item
+	}
+	metric, err := domainMetricFromPutMetric(putMetric, s.config.Timestamps, s.logger)
+	if errors.Is(err, errInvalidTimestamp) {
+		item.Status = http.StatusUnprocessableEntity
+		item.Errors = []*ErrorObject{timestampErrorObject(err)}
+		return item
+	} else if err != nil {
+		item.Status = http.StatusBadRequest
+		item.Errors = []*ErrorObject{{Title: http.StatusText(http.StatusBadRequest), Detail: err.Error()}}
+		return item
+	}
+	err = s.app.AddPendingMetric(metric, hostId, jwtSubject(r))
+	if errors.Is(err, domain.ErrOutOfOrderUpdate) {
+		item.Status = http.StatusUnprocessableEntity
+		item.Errors = []*ErrorObject{timestampErrorObject(err)}
+	} else if errors.Is(err, domain.ErrTooManyMetricNames) {
+		item.Status = http.StatusUnprocessableEntity
+		item.Errors = []*ErrorObject{s.cardinalityErrorObject(err)}
+	} else if errors.Is(err, domain.ErrMetricDefinitionConflict) || errors.Is(err, domain.ErrEnumWithoutStates) {
+		item.Status = http.StatusUnprocessableEntity
+		item.Errors = definitionErrorObjects(err)
+	} else if errors.Is(err, domain.ErrInvalidMetricName) || errors.Is(err, domain.ErrReservedMetricName) {
+		status, errObj := namingErrorObject(err)
+		item.Status = status
+		item.Errors = []*ErrorObject{errObj}
+	} else if errors.Is(err, domain.ErrUnknownHost) {
+		item.Status = http.StatusNotFound
+		item.Errors = []*ErrorObject{{Title: "Host Not Found", Detail: err.Error()}}
+	} else if err != nil {
+		logger := hlog.FromRequest(r)
+		logger.Debug().Err(err).Send()
+		item.Status = http.StatusInternalServerError
+		item.Errors = []*ErrorObject{{Title: http.StatusText(http.StatusInternalServerError)}}
+	}
+	return item
+}
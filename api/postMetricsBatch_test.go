@@ -0,0 +1,115 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_PostMetricsBatch(t *testing.T) {
+	// Setup
+	server := NewServer(log.Logger, newTestApp(nil, nil), testAPIConfig)
+	doc := `[
+	  {
+	    "device_id": "1",
+	    "metrics": [
+	      {"type": "int32", "name": "foo", "value": 1, "slope": "both", "ttl": 60},
+	      {"type": "int32", "name": "bar", "value": "not an int", "slope": "both", "ttl": 60}
+	    ]
+	  },
+	  {
+	    "device_id": "NOPE",
+	    "metrics": [
+	      {"type": "int32", "name": "foo", "value": 1, "slope": "both", "ttl": 60}
+	    ]
+	  },
+	  {
+	    "device_id": "",
+	    "metrics": []
+	  }
+	]`
+	req := authorizedRequest(t, "POST", "/metrics/batch", bytes.NewBufferString(doc))
+	rr := httptest.NewRecorder()
+
+	// Action
+	server.Router.ServeHTTP(rr, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rr.Code, "expected status code 200")
+	assertContentType(t, rr, "application/json")
+	expectedJSON := `{
+	  "status": 200,
+	  "results": [
+	    {
+	      "device_id": "1",
+	      "status": 207,
+	      "metrics": [
+	        {"name": "foo", "status": 200},
+	        {"name": "bar", "status": 422, "errors": [
+	          {"status": 422, "title": "validtype", "detail": "value is not valid for type int32", "source": "value"}
+	        ]}
+	      ]
+	    },
+	    {
+	      "device_id": "NOPE",
+	      "status": 207,
+	      "metrics": [
+	        {"name": "foo", "status": 404, "errors": [
+	          {"title": "Host Not Found", "detail": "adding host: Unknown host: NOPE"}
+	        ]}
+	      ]
+	    },
+	    {
+	      "device_id": "",
+	      "status": 422,
+	      "errors": [
+	        {"status": 422, "title": "required", "detail": "device_id is a required field", "source": "device_id"}
+	      ],
+	      "metrics": []
+	    }
+	  ]
+	}`
+	assert.JSONEq(t, expectedJSON, rr.Body.String(), "unexpected body")
+}
+
+func Test_PostMetricsBatchRequiresAuthentication(t *testing.T) {
+	server := NewServer(log.Logger, newTestApp(nil, nil), testAPIConfig)
+	req, err := http.NewRequest("POST", "/metrics/batch", bytes.NewBufferString("[]"))
+	assert.NoError(t, err, "unexpected failure building http request")
+	rr := httptest.NewRecorder()
+
+	server.Router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code, "expected status code 401")
+}
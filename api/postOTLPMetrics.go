@@ -0,0 +1,193 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/otlp"
+	"github.com/rs/zerolog/hlog"
+)
+
+const (
+	otlpProtobufContentType = "application/x-protobuf"
+	otlpJSONContentType     = "application/json"
+)
+
+// postOTLPMetrics receives metrics exported using the OpenTelemetry protocol
+// over HTTP.  The body is either a protobuf or JSON encoded
+// ExportMetricsServiceRequest, optionally gzip encoded.
+//
+// Each gauge and sum is added to the pending repository as a metric with the
+// same name and units.  The device is identified either by the configured
+// device resource attribute, which holds the device's Concertim ID, or by the
+// configured host resource attribute, which holds the device's host name.
+// Resources for which a device cannot be found are skipped.
+//
+// A series is added for each distinct set of data point attributes, with the
+// attributes as its labels.  Only the most recent data point of each series
+// is used and it is reported at the data point's timestamp.  A 200 response
+// with an empty ExportMetricsServiceResponse is given if the request could be
+// decoded.
+func (s *Server) postOTLPMetrics(rw http.ResponseWriter, r *http.Request) {
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if contentType != otlpProtobufContentType && contentType != otlpJSONContentType {
+		err := fmt.Errorf("unsupported content type %q", contentType)
+		respondWithError(rw, r, err, http.StatusUnsupportedMediaType, http.StatusText(http.StatusUnsupportedMediaType), "")
+		return
+	}
+	data, err := readCompressedBody(rw, r, s.config.OTLP.MaxBodySize, s.config.OTLP.MaxDecodedSize, "OTLP body")
+	if err != nil {
+		// The correct response has already been sent by readCompressedBody.
+		return
+	}
+	var resources []otlp.ResourceMetrics
+	if contentType == otlpProtobufContentType {
+		resources, err = otlp.DecodeProtobuf(data)
+	} else {
+		resources, err = otlp.DecodeJSON(data)
+	}
+	if err != nil {
+		BadRequest(rw, r, err, "error decoding OTLP body")
+		return
+	}
+	logger := hlog.FromRequest(r)
+	var accepted, skipped int
+	for _, resource := range resources {
+		hostId, err := s.otlpHostId(resource)
+		if err != nil {
+			logger.Debug().Err(err).Msg("skipping resource")
+			skipped += len(resource.Metrics)
+			continue
+		}
+		for _, metric := range resource.Metrics {
+			n, err := s.addOTLPMetric(metric, hostId, jwtSubject(r))
+			accepted += n
+			if err != nil {
+				logger.Debug().Err(err).Str("metric", metric.Name).Msg("skipping metric")
+				skipped++
+			}
+		}
+	}
+	logger.Debug().Int("accepted", accepted).Int("skipped", skipped).Msg("processed OTLP metrics")
+	rw.Header().Set("Content-Type", contentType)
+	rw.WriteHeader(http.StatusOK)
+	if contentType == otlpJSONContentType {
+		rw.Write([]byte("{}")) //nolint:errcheck
+	}
+}
+
+var errNoDeviceAttribute = errors.New("resource has neither device nor host attribute")
+var errUnsupportedMetricKind = errors.New("only gauges and sums are supported")
+var errNoDataPoints = errors.New("metric has no data points")
+
+// addOTLPMetric adds a series for each distinct set of attributes of the
+// given metric's data points to the pending repository and returns the
+// number of series added.
+func (s *Server) addOTLPMetric(metric otlp.Metric, hostId domain.HostId, subject string) (int, error) {
+	if metric.Kind != otlp.KindGauge && metric.Kind != otlp.KindSum {
+		return 0, errUnsupportedMetricKind
+	}
+	dataPoints := metric.LatestDataPoints()
+	if len(dataPoints) == 0 {
+		return 0, errNoDataPoints
+	}
+	// Only cumulative monotonic sums only ever increase.  The values of delta
+	// sums are the change since the previous data point.
+	slope := domain.MetricSlopeBoth
+	if metric.Kind == otlp.KindSum && metric.Monotonic && metric.Temporality == otlp.TemporalityCumulative {
+		slope = domain.MetricSlopePositive
+	}
+	added := 0
+	var errs []error
+	for _, dp := range dataPoints {
+		err := s.addOTLPDataPoint(metric, dp, slope, hostId, subject)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		added++
+	}
+	return added, errors.Join(errs...)
+}
+
+func (s *Server) addOTLPDataPoint(metric otlp.Metric, dp otlp.NumberDataPoint, slope domain.MetricSlope, hostId domain.HostId, subject string) error {
+	var metricType domain.MetricType
+	var value any
+	if dp.IsInt {
+		metricType, value = inferMetricType(dp.IntValue)
+	} else {
+		if math.IsNaN(dp.DoubleValue) || math.IsInf(dp.DoubleValue, 0) {
+			return fmt.Errorf("%v is %w", dp.DoubleValue, domain.ErrInvalidMetricVal)
+		}
+		metricType, value = domain.MetricTypeDouble, dp.DoubleValue
+	}
+	now := time.Now()
+	reported := now
+	if dp.Timestamp.UnixNano() > 0 {
+		var err error
+		reported, err = checkReportedTime(dp.Timestamp, now, s.config.Timestamps)
+		if err != nil {
+			return err
+		}
+	}
+	pending := domain.PendingMetric{
+		Name:     metric.Name,
+		Labels:   labelsFromTags(dp.Attributes),
+		Units:    metric.Unit,
+		Slope:    slope,
+		Reported: reported,
+		TTL:      s.config.OTLP.TTL,
+		Type:     metricType,
+	}
+	var err error
+	pending.Value, err = domain.ParseMetricVal(value, pending.Type)
+	if err != nil {
+		return err
+	}
+	return s.app.AddPendingMetric(pending, hostId, subject)
+}
+
+// otlpHostId returns the host id for the given resource from either its
+// device attribute or its host attribute.
+func (s *Server) otlpHostId(resource otlp.ResourceMetrics) (domain.HostId, error) {
+	if deviceId, ok := resource.Attributes[s.config.OTLP.DeviceAttribute]; ok && deviceId != "" {
+		return domain.HostId(deviceId), nil
+	}
+	hostName, ok := resource.Attributes[s.config.OTLP.HostAttribute]
+	if !ok || hostName == "" {
+		return "", errNoDeviceAttribute
+	}
+	return s.app.HostIdForHostName(hostName)
+}
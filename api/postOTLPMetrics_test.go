@@ -0,0 +1,194 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/inmem"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func newOTLPTestServer() (*Server, *inmem.PendingRepository) {
+	pendingRepo := inmem.NewPendingRepository(log.Logger)
+	app := domain.NewApp(pendingRepo, testDSMRepo, testDSMUpdater, nil, nil, nil)
+	config := testAPIConfig
+	config.OTLP.DeviceAttribute = "concertim.device.id"
+	config.OTLP.HostAttribute = "host.name"
+	config.OTLP.TTL = time.Minute
+	return NewServer(log.Logger, app, config), pendingRepo
+}
+
+func Test_PostOTLPMetricsJSON(t *testing.T) {
+	// Setup
+	server, pendingRepo := newOTLPTestServer()
+	reported := time.Now().Add(-time.Minute)
+	doc := fmt.Sprintf(`{
+	  "resourceMetrics": [
+	    {
+	      "resource": {"attributes": [{"key": "concertim.device.id", "value": {"stringValue": "1"}}]},
+	      "scopeMetrics": [{"metrics": [
+	        {"name": "cpu.load", "unit": "1", "gauge": {"dataPoints": [{"timeUnixNano": "%[1]d", "asDouble": 1.5}]}},
+	        {"name": "net.io", "unit": "By", "sum": {"aggregationTemporality": 2, "isMonotonic": true, "dataPoints": [
+	          {"timeUnixNano": "%[1]d", "asInt": "1024", "attributes": [{"key": "network.io.direction", "value": {"stringValue": "receive"}}]},
+	          {"timeUnixNano": "%[1]d", "asInt": "2048", "attributes": [{"key": "network.io.direction", "value": {"stringValue": "transmit"}}]}
+	        ]}},
+	        {"name": "requests", "sum": {"aggregationTemporality": 1, "isMonotonic": true, "dataPoints": [{"timeUnixNano": "%[1]d", "asInt": "7"}]}},
+	        {"name": "queue.size", "sum": {"isMonotonic": false, "dataPoints": [{"timeUnixNano": "%[1]d", "asInt": "3"}]}},
+	        {"name": "http.duration", "histogram": {"dataPoints": []}}
+	      ]}]
+	    },
+	    {
+	      "resource": {"attributes": [{"key": "host.name", "value": {"stringValue": "device:2"}}]},
+	      "scopeMetrics": [{"metrics": [
+	        {"name": "cpu.load", "gauge": {"dataPoints": [{"asDouble": 0.5}]}}
+	      ]}]
+	    },
+	    {
+	      "resource": {"attributes": [{"key": "host.name", "value": {"stringValue": "NOPE"}}]},
+	      "scopeMetrics": [{"metrics": [
+	        {"name": "cpu.load", "gauge": {"dataPoints": [{"timeUnixNano": "1", "asDouble": 0.5}]}}
+	      ]}]
+	    }
+	  ]
+	}`, reported.UnixNano())
+	req := authorizedRequest(t, "POST", "/v1/metrics", bytes.NewBufferString(doc))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+
+	// Action
+	server.Router.ServeHTTP(rr, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assertContentType(t, rr, "application/json")
+	assert.JSONEq(t, "{}", rr.Body.String())
+
+	host, ok := pendingRepo.GetHost("1")
+	if assert.True(t, ok) {
+		assert.Len(t, host.Metrics, 5)
+		load := host.Metrics["cpu.load"]
+		assert.Equal(t, "1.500000", load.Value)
+		assert.Equal(t, "1", load.Units)
+		assert.Equal(t, domain.MetricTypeDouble, load.Type)
+		assert.Equal(t, domain.MetricSlopeBoth, load.Slope)
+		assert.Equal(t, time.Minute, load.TTL)
+		assert.True(t, reported.Equal(load.Reported), "unexpected reported time %s", load.Reported)
+		for direction, value := range map[string]string{"receive": "1024", "transmit": "2048"} {
+			labels := domain.Labels{"network_io_direction": direction}
+			io := host.Metrics[domain.SeriesKey("net.io", labels)]
+			assert.Equal(t, value, io.Value, direction)
+			assert.Equal(t, labels, io.Labels, direction)
+			assert.Equal(t, domain.MetricTypeInt64, io.Type, direction)
+			assert.Equal(t, domain.MetricSlopePositive, io.Slope, direction)
+		}
+		assert.Equal(t, domain.MetricSlopeBoth, host.Metrics["requests"].Slope)
+		assert.Equal(t, domain.MetricSlopeBoth, host.Metrics["queue.size"].Slope)
+	}
+	host, ok = pendingRepo.GetHost("2")
+	if assert.True(t, ok) {
+		assert.Equal(t, "0.500000", host.Metrics["cpu.load"].Value)
+	}
+	assert.Len(t, pendingRepo.GetAll(), 2)
+}
+
+func Test_PostOTLPMetricsErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{name: "unsupported content type", contentType: "text/plain", body: "{}", status: http.StatusUnsupportedMediaType},
+		{name: "invalid JSON", contentType: "application/json", body: "{", status: http.StatusBadRequest},
+		{name: "invalid protobuf", contentType: "application/x-protobuf", body: "\x0a\xff", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			server, _ := newOTLPTestServer()
+			req := authorizedRequest(t, "POST", "/v1/metrics", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rr := httptest.NewRecorder()
+
+			// Action
+			server.Router.ServeHTTP(rr, req)
+
+			// Assertions
+			assert.Equal(t, tt.status, rr.Code)
+			assertContentType(t, rr, "application/json")
+		})
+	}
+}
+
+func Test_PostOTLPMetricsTooLarge(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxBodySize    int64
+		maxDecodedSize int
+	}{
+		{name: "compressed body too large", maxBodySize: 16},
+		{name: "decompressed body too large", maxDecodedSize: 1024},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			server, _ := newOTLPTestServer()
+			server.config.OTLP.MaxBodySize = tt.maxBodySize
+			server.config.OTLP.MaxDecodedSize = tt.maxDecodedSize
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			_, err := gz.Write([]byte(`{"resourceMetrics":[]}`))
+			assert.NoError(t, err)
+			_, err = gz.Write(bytes.Repeat([]byte(" "), 4096))
+			assert.NoError(t, err)
+			assert.NoError(t, gz.Close())
+			req := authorizedRequest(t, "POST", "/v1/metrics", &buf)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Content-Encoding", "gzip")
+			rr := httptest.NewRecorder()
+
+			// Action
+			server.Router.ServeHTTP(rr, req)
+
+			// Assertions
+			assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+			assertContentType(t, rr, "application/json")
+		})
+	}
+}
@@ -0,0 +1,179 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/remotewrite"
+	"github.com/rs/zerolog/hlog"
+)
+
+// postRemoteWrite receives samples sent by Prometheus' remote write protocol.
+// The body is a snappy compressed protobuf encoded WriteRequest.
+//
+// Each series is added to the pending repository as a double metric named
+// after the series' `__name__` label.  The device is identified either by the
+// configured device label, which holds the device's Concertim ID, or by the
+// configured host label, which holds the device's host name.  Series for
+// which a device cannot be found are skipped.  The series' other labels
+// become the metric's labels, except for internal labels starting with `__`.
+//
+// Only the most recent sample of each series is used and it is reported at
+// the sample's timestamp.  A 204 no content response is given if the request
+// could be decoded.  Requests larger than the configured limits, either
+// before or after being decompressed, receive a 413 response.
+func (s *Server) postRemoteWrite(rw http.ResponseWriter, r *http.Request) {
+	if s.config.RemoteWrite.MaxBodySize > 0 {
+		r.Body = http.MaxBytesReader(rw, r.Body, s.config.RemoteWrite.MaxBodySize)
+	}
+	defer io.Copy(io.Discard, r.Body) //nolint:errcheck
+	data, err := io.ReadAll(r.Body)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		RequestEntityTooLarge(rw, r, err)
+		return
+	} else if err != nil {
+		BadRequest(rw, r, err, "error reading remote write body")
+		return
+	}
+	series, err := remotewrite.DecodeWriteRequest(data, s.config.RemoteWrite.MaxDecodedSize)
+	if errors.Is(err, remotewrite.ErrWriteRequestTooLarge) {
+		RequestEntityTooLarge(rw, r, err)
+		return
+	} else if err != nil {
+		BadRequest(rw, r, err, "error decoding remote write body")
+		return
+	}
+	logger := hlog.FromRequest(r)
+	var accepted, skipped int
+	for _, ts := range series {
+		err := s.addRemoteWriteSeries(ts, jwtSubject(r))
+		if err != nil {
+			logger.Debug().Err(err).Str("metric", ts.Name()).Msg("skipping series")
+			skipped++
+			continue
+		}
+		accepted++
+	}
+	logger.Debug().Int("accepted", accepted).Int("skipped", skipped).Msg("processed remote write")
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+var errNoSamples = errors.New("series has no samples")
+var errNoMetricName = errors.New("series has no metric name")
+var errNoDeviceLabel = errors.New("series has neither device nor host label")
+
+func (s *Server) addRemoteWriteSeries(ts remotewrite.TimeSeries, subject string) error {
+	if ts.Name() == "" {
+		return errNoMetricName
+	}
+	sample, ok := latestSample(ts.Samples)
+	if !ok {
+		return errNoSamples
+	}
+	hostId, err := s.remoteWriteHostId(ts)
+	if err != nil {
+		return err
+	}
+	reported, err := checkReportedTime(time.UnixMilli(sample.Timestamp), time.Now(), s.config.Timestamps)
+	if err != nil {
+		return err
+	}
+	metric := domain.PendingMetric{
+		Name:     ts.Name(),
+		Labels:   s.remoteWriteLabels(ts),
+		Slope:    domain.MetricSlopeBoth,
+		Reported: reported,
+		TTL:      s.config.RemoteWrite.TTL,
+		Type:     domain.MetricTypeDouble,
+	}
+	if err := metric.Labels.Validate(); err != nil {
+		return err
+	}
+	metric.Value, err = domain.ParseMetricVal(sample.Value, metric.Type)
+	if err != nil {
+		return err
+	}
+	return s.app.AddPendingMetric(metric, hostId, subject)
+}
+
+// remoteWriteLabels returns the labels of the metric for the given series.
+// These are the series' labels other than its metric name, the labels
+// identifying its device and any other internal labels starting with `__`.
+func (s *Server) remoteWriteLabels(ts remotewrite.TimeSeries) domain.Labels {
+	labels := domain.Labels{}
+	for name, value := range ts.Labels {
+		if strings.HasPrefix(name, "__") || name == s.config.RemoteWrite.DeviceLabel || name == s.config.RemoteWrite.HostLabel {
+			continue
+		}
+		labels[name] = value
+	}
+	return labelsOrNil(labels)
+}
+
+// remoteWriteHostId returns the host id for the given series from either its
+// device label or its host label.
+func (s *Server) remoteWriteHostId(ts remotewrite.TimeSeries) (domain.HostId, error) {
+	if deviceId, ok := ts.Labels[s.config.RemoteWrite.DeviceLabel]; ok && deviceId != "" {
+		return domain.HostId(deviceId), nil
+	}
+	hostName, ok := ts.Labels[s.config.RemoteWrite.HostLabel]
+	if !ok || hostName == "" {
+		return "", errNoDeviceLabel
+	}
+	// Prometheus' instance label is typically `host:port`.
+	if host, _, err := net.SplitHostPort(hostName); err == nil {
+		hostName = host
+	}
+	return s.app.HostIdForHostName(hostName)
+}
+
+// latestSample returns the most recent sample that is not a NaN.  Prometheus
+// uses a NaN value to mark a series as stale.
+func latestSample(samples []remotewrite.Sample) (remotewrite.Sample, bool) {
+	var latest remotewrite.Sample
+	found := false
+	for _, sample := range samples {
+		if math.IsNaN(sample.Value) {
+			continue
+		}
+		if !found || sample.Timestamp > latest.Timestamp {
+			latest = sample
+			found = true
+		}
+	}
+	return latest, found
+}
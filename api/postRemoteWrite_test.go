@@ -0,0 +1,155 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/config"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/inmem"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/remotewrite"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func Test_PostRemoteWrite(t *testing.T) {
+	// Setup
+	pendingRepo := inmem.NewPendingRepository(log.Logger)
+	app := domain.NewApp(pendingRepo, testDSMRepo, testDSMUpdater, nil, nil, nil)
+	config := testAPIConfig
+	config.RemoteWrite.DeviceLabel = "concertim_device_id"
+	config.RemoteWrite.TTL = time.Minute
+	server := NewServer(log.Logger, app, config)
+	sampledAt := time.Now().Add(-10 * time.Second).Truncate(time.Millisecond)
+	body := encodeRemoteWriteRequest([]remotewrite.TimeSeries{
+		{
+			Labels: map[string]string{
+				"__name__": "node_network_receive_bytes_total", "concertim_device_id": "1",
+				"device": "eth0", "__meta_internal": "dropped",
+			},
+			Samples: []remotewrite.Sample{{Value: 1024, Timestamp: sampledAt.UnixMilli()}},
+		},
+		{
+			Labels:  map[string]string{"__name__": "up", "concertim_device_id": "NOPE"},
+			Samples: []remotewrite.Sample{{Value: 1, Timestamp: sampledAt.UnixMilli()}},
+		},
+	})
+	req := authorizedRequest(t, "POST", "/api/v1/write", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+
+	// Action
+	server.Router.ServeHTTP(rr, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	host, ok := pendingRepo.GetHost("1")
+	if assert.True(t, ok) {
+		key := domain.SeriesKey("node_network_receive_bytes_total", domain.Labels{"device": "eth0"})
+		metric, ok := host.Metrics[key]
+		if assert.True(t, ok, "metric not found") {
+			assert.Equal(t, domain.Labels{"device": "eth0"}, metric.Labels)
+			assert.Equal(t, "1024.000000", metric.Value)
+			assert.True(t, sampledAt.Equal(metric.Reported), "unexpected reported time %s", metric.Reported)
+			assert.Equal(t, time.Minute, metric.TTL)
+		}
+		assert.Len(t, host.Metrics, 1)
+	}
+	assert.Len(t, pendingRepo.GetAll(), 1)
+}
+
+func Test_PostRemoteWriteTooLarge(t *testing.T) {
+	body := encodeRemoteWriteRequest([]remotewrite.TimeSeries{
+		{
+			Labels:  map[string]string{"__name__": "up", "concertim_device_id": "1"},
+			Samples: []remotewrite.Sample{{Value: 1, Timestamp: time.Now().UnixMilli()}},
+		},
+	})
+	tests := []struct {
+		name   string
+		config func(c *config.API)
+	}{
+		{"compressed body", func(c *config.API) { c.RemoteWrite.MaxBodySize = int64(len(body) - 1) }},
+		{"decompressed body", func(c *config.API) { c.RemoteWrite.MaxDecodedSize = 1 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			config := testAPIConfig
+			config.RemoteWrite.DeviceLabel = "concertim_device_id"
+			tt.config(&config)
+			server := NewServer(log.Logger, newTestApp(nil, nil), config)
+			req := authorizedRequest(t, "POST", "/api/v1/write", bytes.NewBuffer(body))
+			rr := httptest.NewRecorder()
+
+			// Action
+			server.Router.ServeHTTP(rr, req)
+
+			// Assertions
+			assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+			assertContentType(t, rr, "application/json")
+		})
+	}
+}
+
+// encodeRemoteWriteRequest encodes the given time series as a snappy
+// compressed Prometheus WriteRequest.
+func encodeRemoteWriteRequest(series []remotewrite.TimeSeries) []byte {
+	var req []byte
+	for _, ts := range series {
+		var tsBuf []byte
+		for name, value := range ts.Labels {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, name)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, value)
+			tsBuf = protowire.AppendTag(tsBuf, 1, protowire.BytesType)
+			tsBuf = protowire.AppendBytes(tsBuf, label)
+		}
+		for _, s := range ts.Samples {
+			var sample []byte
+			sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+			sample = protowire.AppendFixed64(sample, math.Float64bits(s.Value))
+			sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+			sample = protowire.AppendVarint(sample, uint64(s.Timestamp))
+			tsBuf = protowire.AppendTag(tsBuf, 2, protowire.BytesType)
+			tsBuf = protowire.AppendBytes(tsBuf, sample)
+		}
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, tsBuf)
+	}
+	return snappy.Encode(nil, req)
+}
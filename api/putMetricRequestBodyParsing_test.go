@@ -29,7 +29,6 @@ package api
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -91,6 +90,38 @@ func Test_MinimumDocumentIsValid(t *testing.T) {
 			name: "valid zero uint32 metric",
 			doc:  `{"type": "uint32", "name": "foo", "value": 0, "slope": "both", "ttl": 60}`,
 		},
+		{
+			name: "valid int64 metric",
+			doc:  `{"type": "int64", "name": "foo", "value": -9223372036854775808, "slope": "both", "ttl": 60}`,
+		},
+		{
+			name: "valid uint64 metric",
+			doc:  `{"type": "uint64", "name": "foo", "value": 18446744073709551615, "slope": "positive", "ttl": 60}`,
+		},
+		{
+			name: "valid bool metric",
+			doc:  `{"type": "bool", "name": "foo", "value": false, "slope": "both", "ttl": 60}`,
+		},
+		{
+			name: "valid timestamp metric",
+			doc:  `{"type": "timestamp", "name": "foo", "value": 1696431225, "slope": "zero", "ttl": 60}`,
+		},
+		{
+			name: "valid RFC 3339 timestamp metric",
+			doc:  `{"type": "timestamp", "name": "foo", "value": "2023-10-04T14:53:45Z", "slope": "zero", "ttl": 60}`,
+		},
+		{
+			name: "valid enum metric",
+			doc:  `{"type": "enum", "name": "foo", "value": "on", "slope": "both", "ttl": 60}`,
+		},
+		{
+			name: "valid persistent metric with zero ttl",
+			doc:  `{"type": "uint32", "name": "foo", "value": 0, "slope": "both", "ttl": 0}`,
+		},
+		{
+			name: "valid persistent metric without ttl",
+			doc:  `{"type": "uint32", "name": "foo", "value": 0, "slope": "both", "persistent": true}`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -135,7 +166,7 @@ func Test_SimpleValidations(t *testing.T) {
 			name:   "type must be oneof ...",
 			tags:   []string{"oneof"},
 			field:  "type",
-			detail: "type must be one of [string int8 uint8 int16 uint16 int32 uint32 float double]",
+			detail: "type must be one of [string int8 uint8 int16 uint16 int32 uint32 int64 uint64 float double bool timestamp enum distribution]",
 			doc:    `{"type": "invalid", "name": "foo", "value": 1, "units": " ", "slope": "both", "ttl": 60}`,
 		},
 		{
@@ -154,16 +185,16 @@ func Test_SimpleValidations(t *testing.T) {
 		},
 		{
 			name:   "ttl is required",
-			tags:   []string{"required"},
+			tags:   []string{"required_without"},
 			field:  "ttl",
 			detail: "ttl is a required field",
-			doc:    `{"type": "int32", "name": "foo", "value": 1, "units": " ", "slope": "both", "ttl": 0}`,
+			doc:    `{"type": "int32", "name": "foo", "value": 1, "units": " ", "slope": "both"}`,
 		},
 		{
-			name:   "ttl must be 1 or greater",
+			name:   "ttl must be 0 or greater",
 			tags:   []string{"min"},
 			field:  "ttl",
-			detail: "ttl must be 1 or greater",
+			detail: "ttl must be 0 or greater",
 			doc:    `{"type": "int32", "name": "foo", "value": 1, "units": " ", "slope": "both", "ttl": -1}`,
 		},
 		{
@@ -235,6 +266,81 @@ func Test_InvalidValueTypesAreInvalid(t *testing.T) {
 			typ:  "uint32",
 			doc:  `{"type": "uint32", "name": "foo", "value": -1, "units": "", "slope": "both", "ttl": 60}`,
 		},
+		{
+			name: "numbers are not bools",
+			typ:  "bool",
+			doc:  `{"type": "bool", "name": "foo", "value": 1, "units": "", "slope": "both", "ttl": 60}`,
+		},
+		{
+			name: "arbitrary strings are not timestamps",
+			typ:  "timestamp",
+			doc:  `{"type": "timestamp", "name": "foo", "value": "yesterday", "units": "", "slope": "both", "ttl": 60}`,
+		},
+		{
+			name: "numbers are not enums",
+			typ:  "enum",
+			doc:  `{"type": "enum", "name": "foo", "value": 1, "units": "", "slope": "both", "ttl": 60}`,
+		},
+		{
+			name: "negative numbers are not uint64",
+			typ:  "uint64",
+			doc:  `{"type": "uint64", "name": "foo", "value": -1, "units": "", "slope": "both", "ttl": 60}`,
+		},
+		{
+			name: "numbers larger than uint64 are not uint64",
+			typ:  "uint64",
+			doc:  `{"type": "uint64", "name": "foo", "value": 18446744073709551616, "units": "", "slope": "both", "ttl": 60}`,
+		},
+		{
+			name: "numbers larger than int64 are not int64",
+			typ:  "int64",
+			doc:  `{"type": "int64", "name": "foo", "value": 9223372036854775808, "units": "", "slope": "both", "ttl": 60}`,
+		},
+		{
+			name: "numbers larger than int8 are not int8",
+			typ:  "int8",
+			doc:  `{"type": "int8", "name": "foo", "value": 128, "units": "", "slope": "both", "ttl": 60}`,
+		},
+		{
+			name: "floats are not int64",
+			typ:  "int64",
+			doc:  `{"type": "int64", "name": "foo", "value": 1.5, "units": "", "slope": "both", "ttl": 60}`,
+		},
+		{
+			name: "numbers are not distributions",
+			typ:  "distribution",
+			doc:  `{"type": "distribution", "name": "foo", "value": 1, "units": "", "slope": "both", "ttl": 60}`,
+		},
+		{
+			name: "distributions need buckets or samples",
+			typ:  "distribution",
+			doc:  `{"type": "distribution", "name": "foo", "value": {"sum": 1}, "units": "", "slope": "both", "ttl": 60}`,
+		},
+		{
+			name: "distributions cannot have both buckets and samples",
+			typ:  "distribution",
+			doc:  `{"type": "distribution", "name": "foo", "value": {"buckets": [{"le": 1, "count": 1}], "sum": 1, "samples": [1]}, "units": "", "slope": "both", "ttl": 60}`,
+		},
+		{
+			name: "distribution buckets need a sum",
+			typ:  "distribution",
+			doc:  `{"type": "distribution", "name": "foo", "value": {"buckets": [{"le": 1, "count": 1}]}, "units": "", "slope": "both", "ttl": 60}`,
+		},
+		{
+			name: "distribution buckets must be increasing",
+			typ:  "distribution",
+			doc:  `{"type": "distribution", "name": "foo", "value": {"buckets": [{"le": 2, "count": 1}, {"le": 1, "count": 1}], "sum": 2}, "units": "", "slope": "both", "ttl": 60}`,
+		},
+		{
+			name: "only the last distribution bucket can be +Inf",
+			typ:  "distribution",
+			doc:  `{"type": "distribution", "name": "foo", "value": {"buckets": [{"le": "+Inf", "count": 1}, {"le": 1, "count": 1}], "sum": 2}, "units": "", "slope": "both", "ttl": 60}`,
+		},
+		{
+			name: "distribution bucket counts cannot be negative",
+			typ:  "distribution",
+			doc:  `{"type": "distribution", "name": "foo", "value": {"buckets": [{"le": 1, "count": -1}], "sum": 2}, "units": "", "slope": "both", "ttl": 60}`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -260,7 +366,7 @@ func Test_InvalidValueTypesAreInvalid(t *testing.T) {
 }
 
 func parseAndValidate(params any, body io.Reader) error {
-	err := json.NewDecoder(body).Decode(params)
+	err := newJSONDecoder(body).Decode(params)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,358 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/inmem"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_PutMetricWithTimestamp(t *testing.T) {
+	// Setup
+	pendingRepo := inmem.NewPendingRepository(log.Logger)
+	app := domain.NewApp(pendingRepo, testDSMRepo, testDSMUpdater, nil, nil, nil)
+	config := testAPIConfig
+	config.Timestamps.MaxSkew = time.Minute
+	server := NewServer(log.Logger, app, config)
+	now := time.Now().Truncate(time.Second)
+	put := func(timestamp time.Time) *httptest.ResponseRecorder {
+		doc := fmt.Sprintf(
+			`{"type": "int32", "name": "foo", "value": 1, "slope": "both", "ttl": 60, "timestamp": %d}`,
+			timestamp.Unix(),
+		)
+		req := authorizedRequest(t, "PUT", "/1/metrics", bytes.NewBufferString(doc))
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Action
+	rr := put(now.Add(-time.Minute))
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rr.Code, "expected status code 200")
+	host, _ := pendingRepo.GetHost("1")
+	assert.Equal(t, now.Add(-time.Minute), host.Metrics["foo"].Reported)
+
+	// Action
+	rr = put(now.Add(time.Hour))
+
+	// Assertions
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code, "expected status code 422")
+	assertContentType(t, rr, "application/json")
+	assert.Contains(t, rr.Body.String(), `"source":"timestamp"`)
+
+	// Setup
+	err := pendingRepo.UpdateLastProcessed("1", "foo", now)
+	assert.NoError(t, err)
+
+	// Action
+	rr = put(now.Add(-2 * time.Minute))
+
+	// Assertions
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code, "expected status code 422")
+	assert.Contains(t, rr.Body.String(), "Out of order update")
+}
+
+func Test_PutPersistentMetric(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+	}{
+		{
+			name: "ttl of zero",
+			doc:  `{"type": "int32", "name": "foo", "value": 1, "slope": "both", "ttl": 0}`,
+		},
+		{
+			name: "persistent flag",
+			doc:  `{"type": "int32", "name": "foo", "value": 1, "slope": "both", "persistent": true}`,
+		},
+		{
+			name: "persistent flag overrides ttl",
+			doc:  `{"type": "int32", "name": "foo", "value": 1, "slope": "both", "ttl": 60, "persistent": true}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			pendingRepo := inmem.NewPendingRepository(log.Logger)
+			app := domain.NewApp(pendingRepo, testDSMRepo, testDSMUpdater, nil, nil, nil)
+			server := NewServer(log.Logger, app, testAPIConfig)
+			req := authorizedRequest(t, "PUT", "/1/metrics", bytes.NewBufferString(tt.doc))
+			rr := httptest.NewRecorder()
+
+			// Action
+			server.Router.ServeHTTP(rr, req)
+
+			// Assertions
+			assert.Equal(t, http.StatusOK, rr.Code, "expected status code 200")
+			host, _ := pendingRepo.GetHost("1")
+			assert.Equal(t, time.Duration(0), host.Metrics["foo"].TTL, "expected metric to be persistent")
+		})
+	}
+}
+
+func Test_PutMetricPreservesIntegerValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		doc      string
+		expected string
+	}{
+		{
+			name:     "largest uint64",
+			doc:      `{"type": "uint64", "name": "foo", "value": 18446744073709551615, "slope": "positive", "ttl": 60}`,
+			expected: "18446744073709551615",
+		},
+		{
+			name:     "smallest int64",
+			doc:      `{"type": "int64", "name": "foo", "value": -9223372036854775808, "slope": "both", "ttl": 60}`,
+			expected: "-9223372036854775808",
+		},
+		{
+			name:     "negative int32",
+			doc:      `{"type": "int32", "name": "foo", "value": -20, "slope": "both", "ttl": 60}`,
+			expected: "-20",
+		},
+		{
+			name:     "integer with exponent",
+			doc:      `{"type": "uint64", "name": "foo", "value": 5e9, "slope": "both", "ttl": 60}`,
+			expected: "5000000000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			pendingRepo := inmem.NewPendingRepository(log.Logger)
+			app := domain.NewApp(pendingRepo, testDSMRepo, testDSMUpdater, nil, nil, nil)
+			server := NewServer(log.Logger, app, testAPIConfig)
+			req := authorizedRequest(t, "PUT", "/1/metrics", bytes.NewBufferString(tt.doc))
+			rr := httptest.NewRecorder()
+
+			// Action
+			server.Router.ServeHTTP(rr, req)
+
+			// Assertions
+			assert.Equal(t, http.StatusOK, rr.Code, "expected status code 200")
+			host, _ := pendingRepo.GetHost("1")
+			assert.Equal(t, tt.expected, host.Metrics["foo"].Value)
+		})
+	}
+}
+
+func Test_PutMetricNameCannotCollideWithSeriesKey(t *testing.T) {
+	// Setup
+	pendingRepo := inmem.NewPendingRepository(log.Logger)
+	app := domain.NewApp(pendingRepo, testDSMRepo, testDSMUpdater, nil, nil, nil)
+	server := NewServer(log.Logger, app, testAPIConfig)
+	labelled := `{"type": "int32", "name": "foo", "value": 1, "slope": "both", "ttl": 60, "labels": {"iface": "eth0"}}`
+	rr := httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, authorizedRequest(t, "PUT", "/1/metrics", bytes.NewBufferString(labelled)))
+	assert.Equal(t, http.StatusOK, rr.Code, "unexpected failure putting metric")
+	colliding := `{"type": "int32", "name": "foo;iface=eth0", "value": 2, "slope": "both", "ttl": 60}`
+	rr = httptest.NewRecorder()
+
+	// Action
+	server.Router.ServeHTTP(rr, authorizedRequest(t, "PUT", "/1/metrics", bytes.NewBufferString(colliding)))
+
+	// Assertions
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code, "expected name containing series key separators to be rejected")
+	assert.Contains(t, rr.Body.String(), `"title":"metricname"`)
+	host, _ := pendingRepo.GetHost("1")
+	key := domain.SeriesKey("foo", domain.Labels{"iface": "eth0"})
+	assert.Equal(t, key, domain.SeriesKey("foo;iface=eth0", nil), "expected names to have colliding series keys")
+	if assert.Len(t, host.Metrics, 1) {
+		assert.Equal(t, "1", host.Metrics[key].Value, "expected labelled series to be unchanged")
+	}
+}
+
+func Test_PutDistributionMetric(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected *domain.Distribution
+	}{
+		{
+			name:  "buckets",
+			value: `{"buckets": [{"le": 1, "count": 2}, {"le": 2, "count": 6}, {"le": "+Inf", "count": 2}], "sum": 15}`,
+			expected: &domain.Distribution{
+				Count: 10,
+				Sum:   15,
+				Buckets: []domain.Bucket{
+					{UpperBound: 1, Count: 2},
+					{UpperBound: 2, Count: 6},
+					{UpperBound: math.Inf(1), Count: 2},
+				},
+				Quantiles: map[string]float64{"p50": 1.5, "p90": 2, "p99": 2},
+			},
+		},
+		{
+			name:  "samples",
+			value: `{"samples": [5, 1, 2, 3, 4]}`,
+			expected: &domain.Distribution{
+				Count: 5,
+				Sum:   15,
+				Buckets: []domain.Bucket{
+					{UpperBound: 1.4, Count: 1},
+					{UpperBound: 1.8, Count: 0},
+					{UpperBound: 2.2, Count: 1},
+					{UpperBound: 2.6, Count: 0},
+					{UpperBound: 3, Count: 1},
+					{UpperBound: 3.4, Count: 0},
+					{UpperBound: 3.8, Count: 0},
+					{UpperBound: 4.2, Count: 1},
+					{UpperBound: 4.6, Count: 0},
+					{UpperBound: 5, Count: 1},
+				},
+				Quantiles: map[string]float64{"p50": 3, "p90": 4.6, "p99": 4.96},
+			},
+		},
+		{
+			name:  "identical samples",
+			value: `{"samples": [7, 7]}`,
+			expected: &domain.Distribution{
+				Count:     2,
+				Sum:       14,
+				Buckets:   []domain.Bucket{{UpperBound: 7, Count: 2}},
+				Quantiles: map[string]float64{"p50": 7, "p90": 7, "p99": 7},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			pendingRepo := inmem.NewPendingRepository(log.Logger)
+			app := domain.NewApp(pendingRepo, testDSMRepo, testDSMUpdater, nil, nil, nil)
+			server := NewServer(log.Logger, app, testAPIConfig)
+			doc := fmt.Sprintf(`{"type": "distribution", "name": "job.latency", "value": %s, "units": "ms", "slope": "both", "ttl": 60}`, tt.value)
+			req := authorizedRequest(t, "PUT", "/1/metrics", bytes.NewBufferString(doc))
+			rr := httptest.NewRecorder()
+
+			// Action
+			server.Router.ServeHTTP(rr, req)
+
+			// Assertions
+			assert.Equal(t, http.StatusOK, rr.Code, "expected status code 200")
+			host, _ := pendingRepo.GetHost("1")
+			d, err := domain.DecodeDistribution(host.Metrics["job.latency"].Value)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.expected.Count, d.Count)
+				assert.InDelta(t, tt.expected.Sum, d.Sum, 1e-9)
+				if assert.Len(t, d.Buckets, len(tt.expected.Buckets)) {
+					for i, b := range tt.expected.Buckets {
+						if math.IsInf(b.UpperBound, 1) {
+							assert.True(t, math.IsInf(d.Buckets[i].UpperBound, 1), "bucket %d", i)
+						} else {
+							assert.InDelta(t, b.UpperBound, d.Buckets[i].UpperBound, 1e-9, "bucket %d", i)
+						}
+						assert.Equal(t, b.Count, d.Buckets[i].Count, "bucket %d", i)
+					}
+				}
+				assert.InDeltaMapValues(t, tt.expected.Quantiles, d.Quantiles, 1e-9)
+			}
+		})
+	}
+}
+
+func Test_DeleteMetric(t *testing.T) {
+	// Setup
+	pendingRepo := inmem.NewPendingRepository(log.Logger)
+	app := domain.NewApp(pendingRepo, testDSMRepo, testDSMUpdater, nil, nil, nil)
+	server := NewServer(log.Logger, app, testAPIConfig)
+	for _, doc := range []string{
+		`{"type": "int32", "name": "foo", "value": 1, "slope": "both", "ttl": 60, "labels": {"iface": "eth0"}}`,
+		`{"type": "int32", "name": "foo", "value": 1, "slope": "both", "ttl": 60, "labels": {"iface": "eth1"}}`,
+		`{"type": "int32", "name": "bar", "value": 1, "slope": "both", "ttl": 60}`,
+	} {
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, authorizedRequest(t, "PUT", "/1/metrics", bytes.NewBufferString(doc)))
+		assert.Equal(t, http.StatusOK, rr.Code, "unexpected failure putting metric")
+	}
+	remove := func(url string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, authorizedRequest(t, "DELETE", url, nil))
+		return rr
+	}
+	metricKeys := func() []domain.MetricName {
+		host, _ := pendingRepo.GetHost("1")
+		keys := make([]domain.MetricName, 0, len(host.Metrics))
+		for key := range host.Metrics {
+			keys = append(keys, key)
+		}
+		return keys
+	}
+
+	// Action
+	rr := remove("/1/metrics/foo?label=iface=eth0")
+
+	// Assertions
+	assert.Equal(t, http.StatusNoContent, rr.Code, "expected status code 204")
+	assert.ElementsMatch(t, []domain.MetricName{"foo;iface=eth1", "bar"}, metricKeys())
+
+	// Action
+	rr = remove("/1/metrics/foo")
+
+	// Assertions
+	assert.Equal(t, http.StatusNoContent, rr.Code, "expected status code 204")
+	assert.ElementsMatch(t, []domain.MetricName{"bar"}, metricKeys())
+
+	// Action
+	rr = remove("/1/metrics/foo")
+
+	// Assertions
+	assert.Equal(t, http.StatusNotFound, rr.Code, "expected status code 404")
+
+	// Action
+	rr = remove("/2/metrics/bar")
+
+	// Assertions
+	assert.Equal(t, http.StatusNotFound, rr.Code, "expected status code 404")
+}
+
+func Test_DeleteMetricRequiresAuthentication(t *testing.T) {
+	server := NewServer(log.Logger, newTestApp(nil, nil), testAPIConfig)
+	req, err := http.NewRequest("DELETE", "/1/metrics/foo", nil)
+	assert.NoError(t, err, "unexpected failure building http request")
+	rr := httptest.NewRecorder()
+
+	server.Router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code, "expected status code 401")
+}
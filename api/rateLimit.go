@@ -0,0 +1,181 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// limiterSweepInterval is the minimum interval between sweeps for idle
+// limiters.
+const limiterSweepInterval = time.Minute
+
+// keyedLimiter is a set of token bucket rate limiters, one for each key.  A
+// nil *keyedLimiter allows all requests.
+//
+// A limiter that has been idle for long enough to refill its bucket behaves
+// as a new one would, so such limiters are periodically evicted to stop the
+// set growing without bound.
+type keyedLimiter struct {
+	burst     int
+	limit     rate.Limit
+	idle      time.Duration
+	limiters  map[string]*keyedLimiterEntry
+	lastSweep time.Time
+	mux       sync.Mutex
+}
+
+type keyedLimiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newKeyedLimiter returns a *keyedLimiter allowing perSecond requests per
+// second for each key with bursts of up to burst requests.  If perSecond is
+// not positive, nil is returned.
+func newKeyedLimiter(perSecond float64, burst int) *keyedLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = int(math.Ceil(perSecond))
+	}
+	return &keyedLimiter{
+		burst:    burst,
+		limit:    rate.Limit(perSecond),
+		idle:     time.Duration(float64(burst) / perSecond * float64(time.Second)),
+		limiters: map[string]*keyedLimiterEntry{},
+	}
+}
+
+// allow reports whether a request for the given key is allowed at the given
+// time.  If it is not, the time to wait before retrying is also returned.
+func (l *keyedLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mux.Lock()
+	l.sweep(now)
+	entry, ok := l.limiters[key]
+	if !ok {
+		entry = &keyedLimiterEntry{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.limiters[key] = entry
+	}
+	if now.After(entry.lastSeen) {
+		entry.lastSeen = now
+	}
+	limiter := entry.limiter
+	l.mux.Unlock()
+	reservation := limiter.ReserveN(now, 1)
+	delay := reservation.DelayFrom(now)
+	if delay > 0 {
+		reservation.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// sweep evicts the limiters that have been idle for long enough to refill
+// their buckets.  It sweeps at most once every limiterSweepInterval and must
+// be called with l.mux held.
+func (l *keyedLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < limiterSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, entry := range l.limiters {
+		if now.Sub(entry.lastSeen) > l.idle {
+			delete(l.limiters, key)
+		}
+	}
+}
+
+// rejectionCounters counts the requests rejected for exceeding a limit.
+type rejectionCounters struct {
+	deviceRateLimit   atomic.Int64
+	subjectRateLimit  atomic.Int64
+	metricCardinality atomic.Int64
+}
+
+type rejectionCountersResponse struct {
+	DeviceRateLimit   int64 `json:"device_rate_limit"`
+	SubjectRateLimit  int64 `json:"subject_rate_limit"`
+	MetricCardinality int64 `json:"metric_cardinality"`
+}
+
+func (c *rejectionCounters) response() rejectionCountersResponse {
+	return rejectionCountersResponse{
+		DeviceRateLimit:   c.deviceRateLimit.Load(),
+		SubjectRateLimit:  c.subjectRateLimit.Load(),
+		MetricCardinality: c.metricCardinality.Load(),
+	}
+}
+
+// subjectRateLimit is middleware limiting the rate of requests for each JWT
+// subject.  It should be used after the JWT token has been verified.  Tokens
+// without a subject share a single limit.
+func (s *Server) subjectRateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		subject := jwtSubject(r)
+		if ok, retryAfter := s.subjectLimiter.allow(subject, time.Now()); !ok {
+			s.rejected.subjectRateLimit.Add(1)
+			TooManyRequests(rw, r, fmt.Errorf("rate limit exceeded for subject %q", subject), retryAfter)
+			return
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// allowDevice reports whether a request for the given device is allowed.  If
+// it is not, the rejection is counted and the time to wait before retrying is
+// returned.
+//
+// It is used for single metric requests and each entry of a batch request.
+// The other ingestion protocols report metrics for many devices in each
+// request and are limited by the per-subject limit only.
+func (s *Server) allowDevice(deviceId string) (bool, time.Duration) {
+	ok, retryAfter := s.deviceLimiter.allow(deviceId, time.Now())
+	if !ok {
+		s.rejected.deviceRateLimit.Add(1)
+	}
+	return ok, retryAfter
+}
+
+// retryAfterSeconds returns the value of the Retry-After header for the given
+// delay.  It is rounded up to a whole number of seconds.
+func retryAfterSeconds(delay time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(delay.Seconds())), 10)
+}
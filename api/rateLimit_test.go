@@ -0,0 +1,222 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_keyedLimiter(t *testing.T) {
+	// Setup
+	limiter := newKeyedLimiter(1, 2)
+	now := time.Now()
+
+	// Action & Assertions
+	for i := 0; i < 2; i++ {
+		ok, _ := limiter.allow("1", now)
+		assert.True(t, ok, "expected burst to be allowed")
+	}
+	ok, retryAfter := limiter.allow("1", now)
+	assert.False(t, ok, "expected request beyond burst to be rejected")
+	assert.Equal(t, time.Second, retryAfter)
+	ok, _ = limiter.allow("2", now)
+	assert.True(t, ok, "expected other keys to have their own limit")
+	ok, _ = limiter.allow("1", now.Add(time.Second))
+	assert.True(t, ok, "expected request to be allowed after waiting")
+}
+
+func Test_keyedLimiterEvictsIdleLimiters(t *testing.T) {
+	// Setup
+	limiter := newKeyedLimiter(1, 2)
+	now := time.Now()
+	limiter.allow("1", now)
+	limiter.allow("2", now)
+	later := now.Add(limiterSweepInterval)
+
+	// Action
+	limiter.allow("2", later)
+	limiter.allow("2", later)
+
+	// Assertions
+	assert.Len(t, limiter.limiters, 1, "expected idle limiter to be evicted")
+	assert.NotContains(t, limiter.limiters, "1")
+	ok, _ := limiter.allow("2", later)
+	assert.False(t, ok, "expected limiter in use to keep its state")
+}
+
+func Test_keyedLimiterDisabled(t *testing.T) {
+	limiter := newKeyedLimiter(0, 0)
+	for i := 0; i < 100; i++ {
+		ok, _ := limiter.allow("1", time.Now())
+		assert.True(t, ok)
+	}
+}
+
+func Test_PutMetricRateLimits(t *testing.T) {
+	doc := `{"type": "int32", "name": "foo", "value": 1, "slope": "both", "ttl": 60}`
+	subjectRequest := func(t *testing.T, url, subject string) *http.Request {
+		req, err := http.NewRequest("PUT", url, bytes.NewBufferString(doc))
+		assert.NoError(t, err, "unexpected failure building http request")
+		tokenAuth := jwtauth.New("HS256", testAPIConfig.JWTSecret, nil)
+		_, token, err := tokenAuth.Encode(map[string]interface{}{"sub": subject})
+		assert.NoError(t, err, "unexpected failure creating auth token")
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		return req
+	}
+
+	tests := []struct {
+		name            string
+		perDevice       float64
+		perSubject      float64
+		second          func(t *testing.T) *http.Request
+		expectedCode    int
+		expectedCounter string
+	}{
+		{
+			name:            "device limit applies to same device",
+			perDevice:       0.1,
+			second:          func(t *testing.T) *http.Request { return subjectRequest(t, "/1/metrics", "other") },
+			expectedCode:    http.StatusTooManyRequests,
+			expectedCounter: `"device_rate_limit":1`,
+		},
+		{
+			name:         "device limit does not apply to other devices",
+			perDevice:    0.1,
+			second:       func(t *testing.T) *http.Request { return subjectRequest(t, "/2/metrics", "agent") },
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:            "subject limit applies to same subject",
+			perSubject:      0.1,
+			second:          func(t *testing.T) *http.Request { return subjectRequest(t, "/2/metrics", "agent") },
+			expectedCode:    http.StatusTooManyRequests,
+			expectedCounter: `"subject_rate_limit":1`,
+		},
+		{
+			name:         "subject limit does not apply to other subjects",
+			perSubject:   0.1,
+			second:       func(t *testing.T) *http.Request { return subjectRequest(t, "/1/metrics", "other") },
+			expectedCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			config := testAPIConfig
+			config.Limits.PerDevice = tt.perDevice
+			config.Limits.PerSubject = tt.perSubject
+			server := NewServer(log.Logger, newTestApp(nil, nil), config)
+			rr := httptest.NewRecorder()
+			server.Router.ServeHTTP(rr, subjectRequest(t, "/1/metrics", "agent"))
+			assert.Equal(t, http.StatusOK, rr.Code, "expected first request to succeed")
+
+			// Action
+			rr = httptest.NewRecorder()
+			server.Router.ServeHTTP(rr, tt.second(t))
+
+			// Assertions
+			assert.Equal(t, tt.expectedCode, rr.Code, "unexpected status code")
+			if tt.expectedCode == http.StatusTooManyRequests {
+				assert.Equal(t, "10", rr.Header().Get("Retry-After"))
+				status := httptest.NewRecorder()
+				server.Router.ServeHTTP(status, httptest.NewRequest("GET", "/status", nil))
+				assert.Contains(t, status.Body.String(), tt.expectedCounter)
+			}
+		})
+	}
+}
+
+func Test_PutMetricCardinalityLimit(t *testing.T) {
+	// Setup
+	app := newTestApp(nil, nil)
+	app.MaxMetricNamesPerHost = 2
+	server := NewServer(log.Logger, app, testAPIConfig)
+	put := func(name string, labels string) *httptest.ResponseRecorder {
+		doc := fmt.Sprintf(
+			`{"type": "int32", "name": %q, "value": 1, "slope": "both", "ttl": 60, "labels": %s}`,
+			name, labels,
+		)
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, authorizedRequest(t, "PUT", "/1/metrics", bytes.NewBufferString(doc)))
+		return rr
+	}
+
+	// Action & Assertions
+	assert.Equal(t, http.StatusOK, put("foo", `{}`).Code)
+	assert.Equal(t, http.StatusOK, put("bar", `{}`).Code)
+	assert.Equal(t, http.StatusOK, put("bar", `{"iface": "eth0"}`).Code, "expected new series of existing name to be allowed")
+	rr := put("baz", `{}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code, "expected new name to be rejected")
+	assert.Contains(t, rr.Body.String(), `"title":"cardinality"`)
+	status := httptest.NewRecorder()
+	server.Router.ServeHTTP(status, httptest.NewRequest("GET", "/status", nil))
+	assert.Contains(t, status.Body.String(), `"metric_cardinality":1`)
+}
+
+func Test_PutMetricCardinalityLimitUnderConcurrentReports(t *testing.T) {
+	// Setup
+	app := newTestApp(nil, nil)
+	app.MaxMetricNamesPerHost = 2
+	server := NewServer(log.Logger, app, testAPIConfig)
+	codes := make(chan int, 10)
+	var wg sync.WaitGroup
+
+	// Action
+	for i := 0; i < cap(codes); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			doc := fmt.Sprintf(`{"type": "int32", "name": "foo%d", "value": 1, "slope": "both", "ttl": 60}`, i)
+			rr := httptest.NewRecorder()
+			server.Router.ServeHTTP(rr, authorizedRequest(t, "PUT", "/1/metrics", bytes.NewBufferString(doc)))
+			codes <- rr.Code
+		}(i)
+	}
+	wg.Wait()
+	close(codes)
+
+	// Assertions
+	accepted := 0
+	for code := range codes {
+		if code == http.StatusOK {
+			accepted++
+		}
+	}
+	assert.Equal(t, 2, accepted, "expected only the limit of new names to be accepted")
+}
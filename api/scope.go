@@ -0,0 +1,144 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+)
+
+// The JWT claims that restrict the scope of a token's writes.  Each is a list
+// of strings.  A token without a claim is not restricted by it.
+const (
+	deviceIdsClaim      = "device_ids"
+	clustersClaim       = "clusters"
+	metricPrefixesClaim = "metric_prefixes"
+)
+
+// adminClaim is the JWT claim, a boolean, that permits a token to make
+// administrative requests such as decommissioning devices.
+const adminClaim = "admin"
+
+// writeScope returns the scope of the writes permitted by the request's
+// verified JWT token.  An ErrOutOfScope error is returned if the token's
+// scope claims are invalid.
+func writeScope(r *http.Request) (domain.WriteScope, error) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var scope domain.WriteScope
+	deviceIds, err := stringsClaim(claims, deviceIdsClaim)
+	if err != nil {
+		return scope, err
+	}
+	if deviceIds != nil {
+		scope.DeviceIds = make([]domain.HostId, 0, len(deviceIds))
+		for _, id := range deviceIds {
+			scope.DeviceIds = append(scope.DeviceIds, domain.HostId(id))
+		}
+	}
+	if scope.Clusters, err = stringsClaim(claims, clustersClaim); err != nil {
+		return scope, err
+	}
+	if scope.MetricPrefixes, err = stringsClaim(claims, metricPrefixesClaim); err != nil {
+		return scope, err
+	}
+	return scope, nil
+}
+
+// stringsClaim returns the value of the named claim, which must be a list of
+// strings, or nil if the claim is not present.
+func stringsClaim(claims map[string]interface{}, name string) ([]string, error) {
+	value, ok := claims[name]
+	if !ok {
+		return nil, nil
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: the %s claim is not a list", domain.ErrOutOfScope, name)
+	}
+	strs := make([]string, 0, len(list))
+	for _, item := range list {
+		str, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: the %s claim is not a list of strings", domain.ErrOutOfScope, name)
+		}
+		strs = append(strs, str)
+	}
+	return strs, nil
+}
+
+// scopeErrorObject returns an ErrorObject for a write that is outside of the
+// scope of the request's token.
+func scopeErrorObject(err error, source string) *ErrorObject {
+	return &ErrorObject{
+		Status: http.StatusForbidden,
+		Title:  "scope",
+		Detail: err.Error(),
+		Source: source,
+	}
+}
+
+// unscoped rejects requests with a token whose writes are restricted to a
+// scope.  It wraps the routes that do not enforce write scopes.
+func (s *Server) unscoped(next http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		scope, err := writeScope(r)
+		if err == nil && scope.Restricted() {
+			err = fmt.Errorf("%w: %s %s is not permitted for scoped tokens", domain.ErrOutOfScope, r.Method, r.URL.Path)
+		}
+		if err != nil {
+			body := ErrorsPayload{
+				Status: http.StatusForbidden,
+				Errors: []*ErrorObject{scopeErrorObject(err, "")},
+			}
+			renderJSON(body, http.StatusForbidden, rw)
+			return
+		}
+		next(rw, r)
+	}
+}
+
+// admin rejects requests with a token that does not have the admin claim.
+// It wraps the routes that make administrative changes.
+func (s *Server) admin(next http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		_, claims, _ := jwtauth.FromContext(r.Context())
+		if isAdmin, _ := claims[adminClaim].(bool); !isAdmin {
+			err := fmt.Errorf("%w: %s %s requires an admin token", domain.ErrOutOfScope, r.Method, r.URL.Path)
+			body := ErrorsPayload{
+				Status: http.StatusForbidden,
+				Errors: []*ErrorObject{scopeErrorObject(err, "")},
+			}
+			renderJSON(body, http.StatusForbidden, rw)
+			return
+		}
+		next(rw, r)
+	}
+}
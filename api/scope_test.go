@@ -0,0 +1,232 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/inmem"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// scopedRequest returns a new request with a valid JWT token with the given
+// claims set in its Authorization header.
+func scopedRequest(t *testing.T, method, url, body string, claims map[string]interface{}) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+	assert.NoError(t, err, "unexpected failure building http request")
+	tokenAuth := jwtauth.New("HS256", testAPIConfig.JWTSecret, nil)
+	_, token, err := tokenAuth.Encode(claims)
+	assert.NoError(t, err, "unexpected failure creating auth token")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	return req
+}
+
+func Test_PutMetricWriteScope(t *testing.T) {
+	tests := []struct {
+		name           string
+		claims         map[string]interface{}
+		deviceId       string
+		metricName     string
+		expectedCode   int
+		expectedSource string
+	}{
+		{
+			name:         "unscoped token",
+			claims:       map[string]interface{}{},
+			deviceId:     "1",
+			metricName:   "power.level",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "device in scope",
+			claims:       map[string]interface{}{"device_ids": []string{"1", "2"}},
+			deviceId:     "1",
+			metricName:   "power.level",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:           "device out of scope",
+			claims:         map[string]interface{}{"device_ids": []string{"2"}},
+			deviceId:       "1",
+			metricName:     "power.level",
+			expectedCode:   http.StatusForbidden,
+			expectedSource: "deviceId",
+		},
+		{
+			name:         "device in cluster in scope",
+			claims:       map[string]interface{}{"clusters": []string{"unspecified"}},
+			deviceId:     "1",
+			metricName:   "power.level",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:           "device in cluster out of scope",
+			claims:         map[string]interface{}{"clusters": []string{"other"}},
+			deviceId:       "1",
+			metricName:     "power.level",
+			expectedCode:   http.StatusForbidden,
+			expectedSource: "deviceId",
+		},
+		{
+			name:         "metric prefix in scope",
+			claims:       map[string]interface{}{"device_ids": []string{"1"}, "metric_prefixes": []string{"node.", "power."}},
+			deviceId:     "1",
+			metricName:   "power.level",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:           "metric prefix out of scope",
+			claims:         map[string]interface{}{"device_ids": []string{"1"}, "metric_prefixes": []string{"node."}},
+			deviceId:       "1",
+			metricName:     "power.level",
+			expectedCode:   http.StatusForbidden,
+			expectedSource: "name",
+		},
+		{
+			name:           "invalid scope claim",
+			claims:         map[string]interface{}{"device_ids": "1"},
+			deviceId:       "1",
+			metricName:     "power.level",
+			expectedCode:   http.StatusForbidden,
+			expectedSource: "deviceId",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			pendingRepo := inmem.NewPendingRepository(log.Logger)
+			app := domain.NewApp(pendingRepo, testDSMRepo, testDSMUpdater, nil, nil, nil)
+			server := NewServer(log.Logger, app, testAPIConfig)
+			doc := fmt.Sprintf(`{"type": "int32", "name": %q, "value": 1, "slope": "both", "ttl": 60}`, tt.metricName)
+			req := scopedRequest(t, "PUT", fmt.Sprintf("/%s/metrics", tt.deviceId), doc, tt.claims)
+			rr := httptest.NewRecorder()
+
+			// Action
+			server.Router.ServeHTTP(rr, req)
+
+			// Assertions
+			assert.Equal(t, tt.expectedCode, rr.Code, "unexpected status code")
+			_, found := pendingRepo.GetHost(domain.HostId(tt.deviceId))
+			if tt.expectedCode != http.StatusOK {
+				assertContentType(t, rr, "application/json")
+				var body ErrorsPayload
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+				assert.Equal(t, http.StatusForbidden, body.Status)
+				if assert.Len(t, body.Errors, 1) {
+					assert.Equal(t, "scope", body.Errors[0].Title)
+					assert.Equal(t, tt.expectedSource, body.Errors[0].Source)
+				}
+				assert.False(t, found, "expected metric not to be added")
+			} else {
+				assert.True(t, found, "expected metric to be added")
+			}
+		})
+	}
+}
+
+func Test_PostMetricsBatchWriteScope(t *testing.T) {
+	// Setup
+	pendingRepo := inmem.NewPendingRepository(log.Logger)
+	app := domain.NewApp(pendingRepo, testDSMRepo, testDSMUpdater, nil, nil, nil)
+	server := NewServer(log.Logger, app, testAPIConfig)
+	doc := `[
+	  {"device_id": "1", "metrics": [
+	    {"type": "int32", "name": "node.load", "value": 1, "slope": "both", "ttl": 60},
+	    {"type": "int32", "name": "power.level", "value": 1, "slope": "both", "ttl": 60}
+	  ]},
+	  {"device_id": "2", "metrics": [
+	    {"type": "int32", "name": "node.load", "value": 1, "slope": "both", "ttl": 60}
+	  ]}
+	]`
+	claims := map[string]interface{}{"device_ids": []string{"1"}, "metric_prefixes": []string{"node."}}
+	req := scopedRequest(t, "POST", "/metrics/batch", doc, claims)
+	rr := httptest.NewRecorder()
+
+	// Action
+	server.Router.ServeHTTP(rr, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rr.Code, "unexpected status code")
+	var body postMetricsBatchResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+	if assert.Len(t, body.Results, 2) {
+		assert.Equal(t, http.StatusMultiStatus, body.Results[0].Status)
+		if assert.Len(t, body.Results[0].Metrics, 2) {
+			assert.Equal(t, http.StatusOK, body.Results[0].Metrics[0].Status)
+			assert.Equal(t, http.StatusForbidden, body.Results[0].Metrics[1].Status)
+		}
+		assert.Equal(t, http.StatusForbidden, body.Results[1].Status)
+	}
+	_, found := pendingRepo.GetHost("2")
+	assert.False(t, found, "expected device out of scope not to be added")
+}
+
+func Test_UnscopedRouteRejectsScopedToken(t *testing.T) {
+	// Setup
+	pendingRepo := inmem.NewPendingRepository(log.Logger)
+	app := domain.NewApp(pendingRepo, testDSMRepo, testDSMUpdater, nil, nil, nil)
+	server := NewServer(log.Logger, app, testAPIConfig)
+	claims := map[string]interface{}{"device_ids": []string{"1"}}
+	req := scopedRequest(t, "POST", "/write", "power.level,host=comp1 value=1", claims)
+	rr := httptest.NewRecorder()
+
+	// Action
+	server.Router.ServeHTTP(rr, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusForbidden, rr.Code, "unexpected status code")
+	assert.Contains(t, rr.Body.String(), `"title":"scope"`)
+}
+
+func Test_OutOfScopeWriteDoesNotUseDeviceRateLimit(t *testing.T) {
+	// Setup
+	config := testAPIConfig
+	config.Limits.PerDevice = 0.1
+	server := NewServer(log.Logger, newTestApp(nil, nil), config)
+	doc := `{"type": "int32", "name": "power.level", "value": 1, "slope": "both", "ttl": 60}`
+	rr := httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, scopedRequest(t, "PUT", "/2/metrics", doc, map[string]interface{}{"device_ids": []string{"1"}}))
+	assert.Equal(t, http.StatusForbidden, rr.Code, "expected write outside of scope to be rejected")
+
+	// Action
+	rr = httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, scopedRequest(t, "PUT", "/2/metrics", doc, map[string]interface{}{}))
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rr.Code, "expected device's rate limit not to have been used")
+}
@@ -48,24 +48,29 @@ import (
 
 // Server is a wrapper around a net/http.Server.
 type Server struct {
-	app        *domain.Application
-	config     config.API
-	httpServer *http.Server
-	logger     zerolog.Logger
-	tokenAuth  *jwtauth.JWTAuth
-	Router     chi.Router
+	app            *domain.Application
+	config         config.API
+	deviceLimiter  *keyedLimiter
+	httpServer     *http.Server
+	logger         zerolog.Logger
+	rejected       rejectionCounters
+	subjectLimiter *keyedLimiter
+	tokenAuth      *jwtauth.JWTAuth
+	Router         chi.Router
 }
 
 // NewServer returns an *http.Server configured as an API server.
 func NewServer(logger zerolog.Logger, app *domain.Application, config config.API) *Server {
-	server := Server{
-		app:       app,
-		config:    config,
-		logger:    logger.With().Str("component", "http-api").Logger(),
-		tokenAuth: jwtauth.New("HS256", config.JWTSecret, nil),
+	server := &Server{
+		app:            app,
+		config:         config,
+		deviceLimiter:  newKeyedLimiter(config.Limits.PerDevice, config.Limits.PerDeviceBurst),
+		logger:         logger.With().Str("component", "http-api").Logger(),
+		subjectLimiter: newKeyedLimiter(config.Limits.PerSubject, config.Limits.PerSubjectBurst),
+		tokenAuth:      jwtauth.New("HS256", config.JWTSecret, nil),
 	}
 	server.addRoutes()
-	return &server
+	return server
 }
 
 // ListenAndServe runs the HTTP API server.
@@ -97,29 +102,47 @@ func (s *Server) addRoutes() chi.Router {
 
 	r.Get("/status", s.statusHandler)
 	r.Group(func(r chi.Router) {
-		// Currently, as long as the JWT token can be verified, we allow all
-		// access.  Later we probably want to check the claims that are being
-		// made.
+		// Any verified JWT token is allowed access unless its claims restrict
+		// its writes to a scope.  Scoped tokens may only be used with the
+		// routes that enforce the scope.  See writeScope.
 		r.Use(jwtauth.Verifier(s.tokenAuth))
 		r.Use(jwtauth.Authenticator(s.tokenAuth))
+		r.Use(s.subjectRateLimit)
 
 		r.Put("/{deviceId}/metrics", s.putMetricHandler)
+		r.Delete("/{deviceId}/metrics/{metricName}", s.unscoped(s.deleteMetricHandler))
+		r.Delete("/devices/{deviceId}", s.admin(s.deleteDevice))
+		r.Post("/metrics/batch", s.postMetricsBatchHandler)
+		r.Post("/api/v1/write", s.unscoped(s.postRemoteWrite))
+		r.Post("/write", s.unscoped(s.postInfluxWrite))
+		r.Post("/v1/metrics", s.unscoped(s.postOTLPMetrics))
+		r.Post("/collectd", s.unscoped(s.postCollectd))
+		r.Put("/metric-definitions/{name}", s.unscoped(s.putMetricDefinition))
+		r.Delete("/metric-definitions/{name}", s.unscoped(s.deleteMetricDefinition))
 	})
 
+	// Routes to get metric definitions.
+	r.Get("/metric-definitions", s.getMetricDefinitions)
+	r.Get("/metric-definitions/{name}", s.getMetricDefinition)
+
 	// Route to get metrics for a single device.
-	r.Get("/devices/{deviceId}/metrics/current", s.getCurrentHostMetrics)
+	r.Get("/devices/{deviceId}/metrics/current", s.current(s.getCurrentHostMetrics))
 	r.Get("/devices/{deviceId}/metrics/historic", s.getHistoricHostMetricNames)
-	r.Get("/devices/{deviceId}/metrics/{metricName}/historic/last/{duration}", s.getHistoricHostMetricValuesLastX)
-	r.Get("/devices/{deviceId}/metrics/{metricName}/historic/{startTime}/{endTime}", s.getHistoricHostMetricValues)
+	r.Get("/devices/{deviceId}/metrics/{metricName}/historic/last/{duration}", s.historic(s.getHistoricHostMetricValuesLastX))
+	r.Get("/devices/{deviceId}/metrics/{metricName}/historic/{startTime}/{endTime}", s.historic(s.getHistoricHostMetricValues))
+	r.Get("/devices/{deviceId}/metrics/{metricName}/states/at/{time}", s.getHostMetricStateAt)
+	r.Get("/devices/{deviceId}/metrics/{metricName}/states/{startTime}/{endTime}", s.getHistoricHostMetricStates)
 
 	// Routes to get metrics for all devices.
-	r.Get("/metrics/unique", s.deprecated(s.getUniqueMetrics))
-	r.Get("/metrics/current", s.getUniqueMetrics)
+	r.Get("/metrics/unique", s.deprecated(s.current(s.getUniqueMetrics)))
+	r.Get("/metrics/current", s.current(s.getUniqueMetrics))
+	r.Get("/metrics/current/prometheus", s.current(s.getPrometheusMetrics))
+	r.Get("/metrics/conflicts", s.current(s.getMetricConflicts))
 	r.Get("/metrics/historic", s.getHistoricMetricNames)
-	r.Get("/metrics/{metricName}/historic/last/{duration}", s.getHistoricMetricValuesLastX)
-	r.Get("/metrics/{metricName}/historic/{startTime}/{endTime}", s.getHistoricMetricValues)
-	r.Get("/metrics/{metricName}/current", s.getMetricValues)
-	r.Get("/metrics/{metricName}/values", s.deprecated(s.getMetricValues))
+	r.Get("/metrics/{metricName}/historic/last/{duration}", s.historic(s.getHistoricMetricValuesLastX))
+	r.Get("/metrics/{metricName}/historic/{startTime}/{endTime}", s.historic(s.getHistoricMetricValues))
+	r.Get("/metrics/{metricName}/current", s.current(s.getMetricValues))
+	r.Get("/metrics/{metricName}/values", s.deprecated(s.current(s.getMetricValues)))
 
 	return r
 }
@@ -128,9 +151,22 @@ type putMetricRequest struct {
 	Name  string `json:"name"  validate:"required,notblank"`
 	Val   any    `json:"value" validate:"required"`
 	Units string `json:"units" validate:"excludesall=<>'\"&"`
-	Type  string `json:"type"  validate:"required,oneof=string int8 uint8 int16 uint16 int32 uint32 float double"`
+	Type  string `json:"type"  validate:"required,oneof=string int8 uint8 int16 uint16 int32 uint32 int64 uint64 float double bool timestamp enum distribution"`
 	Slope string `json:"slope" validate:"required,oneof=zero positive negative both derivative"`
-	TTL   int    `json:"ttl"   validate:"required,min=1"`
+	// TTL is the number of seconds for which the value is current.  A TTL
+	// of 0 results in a persistent metric.  It is required unless the
+	// metric is persistent.
+	TTL *int `json:"ttl" validate:"required_without=Persistent,omitempty,min=0"`
+	// Persistent is an optional flag marking the metric as persistent.  A
+	// persistent metric never becomes stale and remains current until it is
+	// deleted or a new value is reported.  If set, TTL is ignored.
+	Persistent bool `json:"persistent,omitempty"`
+	// Timestamp is the optional time, in seconds since the unix epoch, that
+	// the value was recorded.  If not given the current time is used.
+	Timestamp *int64 `json:"timestamp,omitempty" validate:"omitempty,min=1"`
+	// Labels are optional key/value pairs distinguishing this series of the
+	// metric from others with the same name.
+	Labels map[string]string `json:"labels,omitempty" validate:"omitempty,dive,keys,labelname,endkeys"`
 }
 
 type putMetricResponse struct {
@@ -138,19 +174,84 @@ type putMetricResponse struct {
 }
 
 func (s *Server) putMetricHandler(rw http.ResponseWriter, r *http.Request) {
+	deviceId := chi.URLParam(r, "deviceId")
+	// The scope is checked first so that a token cannot use up the rate
+	// limit of a device outside of its scope.
+	scope, err := writeScope(r)
+	if err == nil {
+		err = s.app.CheckWriteScope(scope, domain.HostId(deviceId))
+	}
+	if err != nil {
+		body := ErrorsPayload{
+			Status: http.StatusForbidden,
+			Errors: []*ErrorObject{scopeErrorObject(err, "deviceId")},
+		}
+		renderJSON(body, http.StatusForbidden, rw)
+		return
+	}
+	if ok, retryAfter := s.allowDevice(deviceId); !ok {
+		TooManyRequests(rw, r, fmt.Errorf("rate limit exceeded for device %s", deviceId), retryAfter)
+		return
+	}
 	putMetric := &putMetricRequest{}
-	err := parseJSONBody(putMetric, rw, r)
+	err = parseJSONBody(putMetric, rw, r)
 	if err != nil {
 		// The correct response has already been sent by parseJSONBody.
 		return
 	}
-	metric, err := domainMetricFromPutMetric(*putMetric, s.logger)
-	if err != nil {
+	if status, errObj := s.applyNamingPolicy(r, putMetric); errObj != nil {
+		body := ErrorsPayload{Status: status, Errors: []*ErrorObject{errObj}}
+		renderJSON(body, status, rw)
+		return
+	}
+	if err := scope.CheckMetricName(putMetric.Name); err != nil {
+		body := ErrorsPayload{
+			Status: http.StatusForbidden,
+			Errors: []*ErrorObject{scopeErrorObject(err, "name")},
+		}
+		renderJSON(body, http.StatusForbidden, rw)
+		return
+	}
+	metric, err := domainMetricFromPutMetric(*putMetric, s.config.Timestamps, s.logger)
+	if errors.Is(err, errInvalidTimestamp) {
+		body := ErrorsPayload{
+			Status: http.StatusUnprocessableEntity,
+			Errors: []*ErrorObject{timestampErrorObject(err)},
+		}
+		renderJSON(body, http.StatusUnprocessableEntity, rw)
+		return
+	} else if err != nil {
 		BadRequest(rw, r, err, "")
 		return
 	}
-	err = s.app.AddPendingMetric(metric, domain.HostId(chi.URLParam(r, "deviceId")))
-	if errors.Is(err, domain.ErrUnknownHost) {
+	err = s.app.AddPendingMetric(metric, domain.HostId(deviceId), jwtSubject(r))
+	if errors.Is(err, domain.ErrOutOfOrderUpdate) {
+		body := ErrorsPayload{
+			Status: http.StatusUnprocessableEntity,
+			Errors: []*ErrorObject{timestampErrorObject(err)},
+		}
+		renderJSON(body, http.StatusUnprocessableEntity, rw)
+		return
+	} else if errors.Is(err, domain.ErrTooManyMetricNames) {
+		body := ErrorsPayload{
+			Status: http.StatusUnprocessableEntity,
+			Errors: []*ErrorObject{s.cardinalityErrorObject(err)},
+		}
+		renderJSON(body, http.StatusUnprocessableEntity, rw)
+		return
+	} else if errors.Is(err, domain.ErrMetricDefinitionConflict) || errors.Is(err, domain.ErrEnumWithoutStates) {
+		body := ErrorsPayload{
+			Status: http.StatusUnprocessableEntity,
+			Errors: definitionErrorObjects(err),
+		}
+		renderJSON(body, http.StatusUnprocessableEntity, rw)
+		return
+	} else if errors.Is(err, domain.ErrInvalidMetricName) || errors.Is(err, domain.ErrReservedMetricName) {
+		status, errObj := namingErrorObject(err)
+		body := ErrorsPayload{Status: status, Errors: []*ErrorObject{errObj}}
+		renderJSON(body, status, rw)
+		return
+	} else if errors.Is(err, domain.ErrUnknownHost) {
 		body := ErrorsPayload{
 			Status: http.StatusNotFound,
 			Errors: []*ErrorObject{{Title: "Host Not Found", Detail: err.Error()}},
@@ -168,11 +269,24 @@ func (s *Server) putMetricHandler(rw http.ResponseWriter, r *http.Request) {
 	renderJSON(body, http.StatusOK, rw)
 }
 
+// cardinalityErrorObject counts the rejection of a metric for exceeding the
+// metric name limit and returns an ErrorObject for it.
+func (s *Server) cardinalityErrorObject(err error) *ErrorObject {
+	s.rejected.metricCardinality.Add(1)
+	return &ErrorObject{
+		Status: http.StatusUnprocessableEntity,
+		Title:  "cardinality",
+		Detail: err.Error(),
+		Source: "name",
+	}
+}
+
 func (s *Server) statusHandler(rw http.ResponseWriter, r *http.Request) {
 	type response struct {
-		Status int `json:"status"`
+		Status   int                       `json:"status"`
+		Rejected rejectionCountersResponse `json:"rejected"`
 	}
-	body := response{Status: http.StatusOK}
+	body := response{Status: http.StatusOK, Rejected: s.rejected.response()}
 	renderJSON(body, http.StatusOK, rw)
 }
 
@@ -49,12 +49,20 @@ func Test_Status(t *testing.T) {
 	// Assertions
 	assert.Equal(t, http.StatusOK, rr.Code, "expected status code 200")
 	assertContentType(t, rr, "application/json")
-	assert.JSONEq(t, `{"status": 200}`, rr.Body.String(), "unexpected body")
+	expectedJSON := `{
+	  "status": 200,
+	  "rejected": {"device_rate_limit": 0, "subject_rate_limit": 0, "metric_cardinality": 0}
+	}`
+	assert.JSONEq(t, expectedJSON, rr.Body.String(), "unexpected body")
 }
 
 func Test_Status_2(t *testing.T) {
 	server := NewServer(log.Logger, nil, testAPIConfig)
 	assert.HTTPSuccess(t, server.Router.ServeHTTP, "GET", "/status", nil)
 	body := assert.HTTPBody(server.Router.ServeHTTP, "GET", "/status", nil)
-	assert.JSONEq(t, `{"status": 200}`, body, "unexpected body")
+	expectedJSON := `{
+	  "status": 200,
+	  "rejected": {"device_rate_limit": 0, "subject_rate_limit": 0, "metric_cardinality": 0}
+	}`
+	assert.JSONEq(t, expectedJSON, body, "unexpected body")
 }
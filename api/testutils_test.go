@@ -29,12 +29,17 @@ package api
 
 import (
 	"fmt"
+	"io"
+	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
+	"github.com/go-chi/jwtauth/v5"
 	"github.com/openflighthpc/concertim-metric-reporting-daemon/config"
 	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/inmem"
+	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -66,12 +71,49 @@ func (fakeDSMRepo) GetHostId(dsm domain.DSM) (domain.HostId, bool) {
 	return domain.HostId(parts[1]), true
 }
 
+func (f fakeDSMRepo) GetHostIdForHostName(hostName string) (domain.HostId, bool) {
+	// Only short host names are known.
+	if hostName == "NOPE" || strings.Contains(hostName, ".") {
+		return "", false
+	}
+	return f.GetHostId(domain.DSM{HostName: hostName})
+}
+
 func (fakeDSMRepo) Update(_ map[domain.HostId]domain.DSM, _ map[domain.DSM]domain.HostId) (_ error) {
 	panic("not implemented") // TODO: Implement
 }
 
 var testDSMRepo = fakeDSMRepo{}
 
+type fakeDSMUpdater struct{}
+
+func (fakeDSMUpdater) RunPeriodicUpdateLoop() {}
+
+func (fakeDSMUpdater) UpdateNow() {}
+
+var testDSMUpdater = fakeDSMUpdater{}
+
+// newTestApp returns an Application with in-memory pending and metric
+// definition repositories and the given current and historic repositories.
+func newTestApp(currentRepo domain.CurrentRepository, historicRepo domain.HistoricRepository) *domain.Application {
+	pendingRepo := inmem.NewPendingRepository(log.Logger)
+	definitionRepo, _ := inmem.NewDefinitionRepository(log.Logger, nil)
+	return domain.NewApp(pendingRepo, testDSMRepo, testDSMUpdater, currentRepo, historicRepo, definitionRepo)
+}
+
+// authorizedRequest returns a new request with a valid JWT token set in its
+// Authorization header.
+func authorizedRequest(t *testing.T, method, url string, body io.Reader) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(method, url, body)
+	assert.NoError(t, err, "unexpected failure building http request")
+	tokenAuth := jwtauth.New("HS256", testAPIConfig.JWTSecret, nil)
+	_, token, err := tokenAuth.Encode(map[string]interface{}{})
+	assert.NoError(t, err, "unexpected failure creating auth token")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	return req
+}
+
 func assertContentType(t *testing.T, rr *httptest.ResponseRecorder, expected string) {
 	t.Helper()
 	contentType := rr.Result().Header["Content-Type"]
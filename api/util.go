@@ -29,6 +29,7 @@ package api
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -87,6 +88,33 @@ func init() {
 		panic(err)
 	}
 
+	err = validate.RegisterValidation("labelname", func(fl validator.FieldLevel) bool {
+		return domain.IsValidLabelName(fl.Field().String())
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	err = validate.RegisterTranslation("labelname", trans, func(ut ut.Translator) error {
+		return ut.Add("labelname", "{0} is not a valid label name", true)
+	}, func(ut ut.Translator, fe validator.FieldError) string {
+		t, _ := ut.T("labelname", fe.Field())
+		return t
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	err = validate.RegisterTranslation("required_without", trans, func(ut ut.Translator) error {
+		return ut.Add("required_without", "{0} is a required field", true)
+	}, func(ut ut.Translator, fe validator.FieldError) string {
+		t, _ := ut.T("required_without", fe.Field())
+		return t
+	})
+	if err != nil {
+		panic(err)
+	}
+
 	validate.RegisterStructValidation(valueIsValidType, putMetricRequest{})
 
 	err = validate.RegisterTranslation("validtype", trans, func(ut ut.Translator) error {
@@ -115,6 +143,57 @@ func valueIsValidType(sl validator.StructLevel) {
 	}
 }
 
+// readCompressedBody reads the request body, decompressing it if it is gzip
+// encoded.  The body is limited to maxBodySize bytes and, once decompressed,
+// to maxDecodedSize bytes.  A limit of zero means no limit.  Any remaining
+// content in the request body is discarded.
+//
+// If an error is encountered either a 400 bad request or a 413 request entity
+// too large response is written and an error returned.  description describes
+// the body in the 400 response.
+func readCompressedBody(rw http.ResponseWriter, r *http.Request, maxBodySize int64, maxDecodedSize int, description string) ([]byte, error) {
+	if maxBodySize > 0 {
+		r.Body = http.MaxBytesReader(rw, r.Body, maxBodySize)
+	}
+	defer io.Copy(io.Discard, r.Body) //nolint:errcheck
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			respondToBodyError(rw, r, err, "error decompressing "+description)
+			return nil, err
+		}
+		defer gz.Close()
+		body = gz
+	}
+	if maxDecodedSize > 0 {
+		body = io.LimitReader(body, int64(maxDecodedSize)+1)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		respondToBodyError(rw, r, err, "error reading "+description)
+		return nil, err
+	}
+	if maxDecodedSize > 0 && len(data) > maxDecodedSize {
+		err := fmt.Errorf("request body is larger than %d bytes once decompressed", maxDecodedSize)
+		RequestEntityTooLarge(rw, r, err)
+		return nil, err
+	}
+	return data, nil
+}
+
+// respondToBodyError responds with a 413 request entity too large error if
+// err is due to the request body exceeding its limit, otherwise with a 400 bad
+// request error.
+func respondToBodyError(rw http.ResponseWriter, r *http.Request, err error, logMsg string) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		RequestEntityTooLarge(rw, r, err)
+		return
+	}
+	BadRequest(rw, r, err, logMsg)
+}
+
 // parseJSONBody reads a single JSON-encoded value from the request body and
 // stores it in the value pointed to by params.  Any remaining content in the
 // request body is discarded.
@@ -122,28 +201,15 @@ func valueIsValidType(sl validator.StructLevel) {
 // If an error is encountered either a 400 bad request or a 422 unprocessable
 // entity response is written and an error returned.
 func parseJSONBody(params any, rw http.ResponseWriter, r *http.Request) error {
-	defer io.Copy(io.Discard, r.Body) //nolint:errcheck
-	err := json.NewDecoder(r.Body).Decode(params)
+	err := decodeJSONBody(params, rw, r)
 	if err != nil {
-		BadRequest(rw, r, err, "error parsing JSON body")
 		return err
 	}
 	err = validate.Struct(params)
 	if err != nil {
-		errs := make([]*ErrorObject, 0)
-		for _, err := range err.(validator.ValidationErrors) {
-			eo := ErrorObject{
-				Status: http.StatusUnprocessableEntity,
-				Title:  err.Tag(),
-				Detail: err.Translate(trans),
-				Source: err.Field(),
-			}
-			errs = append(errs, &eo)
-		}
-
 		resp := ErrorsPayload{
 			Status: http.StatusUnprocessableEntity,
-			Errors: errs,
+			Errors: validationErrorObjects(err),
 		}
 		renderJSON(resp, http.StatusUnprocessableEntity, rw)
 		return err
@@ -152,6 +218,56 @@ func parseJSONBody(params any, rw http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// decodeJSONBody reads a single JSON-encoded value from the request body and
+// stores it in the value pointed to by params without validating it.  Any
+// remaining content in the request body is discarded.
+//
+// If an error is encountered a 400 bad request response is written and an
+// error returned.
+func decodeJSONBody(params any, rw http.ResponseWriter, r *http.Request) error {
+	defer io.Copy(io.Discard, r.Body) //nolint:errcheck
+	err := newJSONDecoder(r.Body).Decode(params)
+	if err != nil {
+		BadRequest(rw, r, err, "error parsing JSON body")
+		return err
+	}
+	return nil
+}
+
+// newJSONDecoder returns a json.Decoder reading from r.  Numbers are decoded
+// as json.Number so that 64-bit integer metric values are not rounded to the
+// nearest float64.
+func newJSONDecoder(r io.Reader) *json.Decoder {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	return decoder
+}
+
+// validationErrorObjects converts the error returned from validate.Struct to
+// a slice of ErrorObjects, one for each failed validation.
+func validationErrorObjects(err error) []*ErrorObject {
+	errs := make([]*ErrorObject, 0)
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		eo := ErrorObject{
+			Status: http.StatusUnprocessableEntity,
+			Title:  http.StatusText(http.StatusUnprocessableEntity),
+			Detail: err.Error(),
+		}
+		return append(errs, &eo)
+	}
+	for _, err := range validationErrs {
+		eo := ErrorObject{
+			Status: http.StatusUnprocessableEntity,
+			Title:  err.Tag(),
+			Detail: err.Translate(trans),
+			Source: err.Field(),
+		}
+		errs = append(errs, &eo)
+	}
+	return errs
+}
+
 // renderJSON writes a JSON representation of `body` to `rw`, sets the content
 // type header to application/json and sets the status header to `status`.
 //
@@ -212,6 +328,43 @@ func parseTime(timeString string) (time.Time, error) {
 	return val, nil
 }
 
+// significantDigitsHeader is the response header set on routes returning
+// historic metric values.  Its value is the number of significant digits to
+// which the values are exact.  Historic values are stored as double precision
+// floating point numbers and read with rrdtool fetch, which formats them with
+// 11 significant digits.  Larger integers, e.g., large int64 and uint64
+// counters, are rounded.
+const significantDigitsHeader = "X-Value-Significant-Digits"
+
+// historicSignificantDigits is the value of the significantDigitsHeader.
+const historicSignificantDigits = "11"
+
+// historic sets the significantDigitsHeader on responses for routes returning
+// historic metric values.
+func (s *Server) historic(next http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set(significantDigitsHeader, historicSignificantDigits)
+		next(rw, r)
+	}
+}
+
+// restoredHeader is the response header set when the current metrics were
+// restored from the previous instance of the daemon.  Its value is the time
+// that the previous instance committed them.
+const restoredHeader = "X-Restored-From-Previous-Instance"
+
+// current sets the restoredHeader on responses for routes returning current
+// metrics if those metrics were restored from the previous instance of the
+// daemon.
+func (s *Server) current(next http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if committed, ok := s.app.CurrentRepo.RestoredAt(); ok {
+			rw.Header().Set(restoredHeader, committed.UTC().Format(time.RFC3339))
+		}
+		next(rw, r)
+	}
+}
+
 func (s *Server) deprecated(next http.HandlerFunc) http.HandlerFunc {
 	return func(rw http.ResponseWriter, r *http.Request) {
 		hlog.FromRequest(r).Info().
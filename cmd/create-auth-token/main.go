@@ -31,13 +31,20 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/go-chi/jwtauth/v5"
 	"github.com/openflighthpc/concertim-metric-reporting-daemon/config"
 )
 
-var configFile = flag.String("config-file", config.DefaultPath, "path to config file")
+var (
+	configFile     = flag.String("config-file", config.DefaultPath, "path to config file")
+	deviceIds      = flag.String("device-ids", "", "comma separated device ids the token may write to")
+	clusters       = flag.String("clusters", "", "comma separated clusters whose devices the token may write to")
+	metricPrefixes = flag.String("metric-prefixes", "", "comma separated metric name prefixes the token may write")
+	admin          = flag.Bool("admin", false, "permit the token to make administrative requests, e.g., decommissioning devices")
+)
 
 func loadConfig() (*config.Config, error) {
 	if *configFile == "" {
@@ -59,6 +66,12 @@ func main() {
 
 	claims := map[string]interface{}{}
 	jwtauth.SetExpiryIn(claims, expiresIn)
+	setScopeClaim(claims, "device_ids", *deviceIds)
+	setScopeClaim(claims, "clusters", *clusters)
+	setScopeClaim(claims, "metric_prefixes", *metricPrefixes)
+	if *admin {
+		claims["admin"] = true
+	}
 
 	_, tokenString, err := tokenAuth.Encode(claims)
 	if err != nil {
@@ -67,3 +80,12 @@ func main() {
 
 	fmt.Print(tokenString, "\n")
 }
+
+// setScopeClaim sets the named claim to the given comma separated values, if
+// any.
+func setScopeClaim(claims map[string]interface{}, name, values string) {
+	if values == "" {
+		return
+	}
+	claims[name] = strings.Split(values, ",")
+}
@@ -50,9 +50,13 @@ import (
 	"github.com/openflighthpc/concertim-metric-reporting-daemon/config"
 	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
 	"github.com/openflighthpc/concertim-metric-reporting-daemon/dsmRepository"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/ganglia"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/graphite"
 	"github.com/openflighthpc/concertim-metric-reporting-daemon/inmem"
 	"github.com/openflighthpc/concertim-metric-reporting-daemon/rrd"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/statsd"
 	"github.com/openflighthpc/concertim-metric-reporting-daemon/visualizer"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/wal"
 )
 
 var (
@@ -142,13 +146,39 @@ func main() {
 	if err = configureLogger(config); err != nil {
 		log.Fatal().Err(err).Msg("Error configuring logger")
 	}
-	pendingRepo := inmem.NewPendingRepository(log.Logger)
+	pendingRepo, err := newPendingRepository(config.Pending)
+	if err != nil {
+		log.Fatal().Err(err).Msg("loading pending repository failed")
+	}
+	stopSnapshots := make(chan struct{})
+	snapshotsStopped := make(chan struct{})
+	if walRepo, ok := pendingRepo.(*wal.PendingRepository); ok {
+		go func() {
+			walRepo.RunPeriodicSnapshotLoop(stopSnapshots)
+			close(snapshotsStopped)
+		}()
+	} else {
+		close(snapshotsStopped)
+	}
 	dsmRetriever := getDSMRetriever(config)
 	dsmRepo := inmem.NewDSMRepo(log.Logger, config.DSM)
 	dsmUpdater := dsmRepository.NewUpdater(log.Logger, config.DSM, dsmRepo, dsmRetriever)
-	currentRepo := inmem.NewCurrentRepository(log.Logger)
+	currentRepo, err := newCurrentRepository(config.Current)
+	if err != nil {
+		log.Fatal().Err(err).Msg("loading current repository failed")
+	}
 	historicRepo := rrd.NewHistoricRepo(log.Logger, config.RRD, dsmRepo)
-	app := domain.NewApp(pendingRepo, dsmRepo, dsmUpdater, currentRepo, historicRepo)
+	definitionRepo, err := inmem.NewDefinitionRepository(log.Logger, config.MetricDefinitions)
+	if err != nil {
+		log.Fatal().Err(err).Msg("loading metric definitions failed")
+	}
+	app := domain.NewApp(pendingRepo, dsmRepo, dsmUpdater, currentRepo, historicRepo, definitionRepo)
+	app.MaxMetricNamesPerHost = config.API.Limits.MaxMetricNamesPerDevice
+	app.NamingPolicy, err = namingPolicyFromConfig(config.NamingPolicy)
+	if err != nil {
+		log.Fatal().Err(err).Msg("loading naming policy failed")
+	}
+	go checkStoredMetricNames(historicRepo, app.NamingPolicy)
 	apiServer := api.NewServer(log.Logger, app, config.API)
 	go func() {
 		err := apiServer.ListenAndServe()
@@ -158,9 +188,59 @@ func main() {
 			log.Fatal().Err(err).Msg("api.Server.ListenAndServe")
 		}
 	}()
+	var graphiteServer *graphite.Server
+	if config.Graphite.Enabled {
+		graphiteServer = graphite.NewServer(log.Logger, app, config.Graphite, config.API.Timestamps)
+		go func() {
+			err := graphiteServer.ListenAndServe()
+			if err != nil && errors.Is(err, graphite.ErrServerClosed) {
+				log.Info().Msg("graphite.Server closed")
+			} else if err != nil {
+				log.Fatal().Err(err).Msg("graphite.Server.ListenAndServe")
+			}
+		}()
+	}
+	var statsdServer *statsd.Server
+	if config.StatsD.Enabled {
+		statsdServer = statsd.NewServer(log.Logger, app, config.StatsD, config.RRD.Step)
+		go func() {
+			err := statsdServer.ListenAndServe()
+			if err != nil && errors.Is(err, statsd.ErrServerClosed) {
+				log.Info().Msg("statsd.Server closed")
+			} else if err != nil {
+				log.Fatal().Err(err).Msg("statsd.Server.ListenAndServe")
+			}
+		}()
+	}
+	var gangliaPoller *ganglia.Poller
+	if config.Ganglia.Enabled {
+		gangliaPoller = ganglia.NewPoller(log.Logger, app, config.Ganglia)
+		go func() {
+			err := gangliaPoller.Run()
+			if err != nil && errors.Is(err, ganglia.ErrPollerClosed) {
+				log.Info().Msg("ganglia.Poller closed")
+			} else if err != nil {
+				log.Fatal().Err(err).Msg("ganglia.Poller.Run")
+			}
+		}()
+	}
+	processor := domain.NewProcessor(pendingRepo, currentRepo, historicRepo, config.RRD.Step, log.Logger)
+	stopProcessor := make(chan struct{})
+	processorStopped := make(chan struct{})
 	go func() {
-		runMetricProcessor(config, pendingRepo, currentRepo, historicRepo)
+		runMetricProcessor(processor, config.RRD.Step, stopProcessor)
+		close(processorStopped)
 	}()
+	stopDecommissioner := make(chan struct{})
+	decommissionerStopped := make(chan struct{})
+	if config.Decommission.Automatic {
+		go func() {
+			runDecommissioner(config, app, dsmUpdater, stopDecommissioner)
+			close(decommissionerStopped)
+		}()
+	} else {
+		close(decommissionerStopped)
+	}
 
 	gracefulExitSigs := []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP}
 	sigint := make(chan os.Signal, 1)
@@ -169,10 +249,71 @@ func main() {
 	log.Info().Msg("Closing connections")
 	signal.Reset(gracefulExitSigs...)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	if err := apiServer.Shutdown(ctx); err != nil {
-		log.Error().Err(err).Msg("http.Server.Shutdown")
+	// Stop accepting reported metrics.
+	runShutdownPhase("stop writes", config.Shutdown.StopWritesTimeout, func(ctx context.Context) {
+		if err := apiServer.Shutdown(ctx); err != nil {
+			log.Error().Err(err).Msg("http.Server.Shutdown")
+		}
+		if graphiteServer != nil {
+			if err := graphiteServer.Shutdown(ctx); err != nil {
+				log.Error().Err(err).Msg("graphite.Server.Shutdown")
+			}
+		}
+		if statsdServer != nil {
+			if err := statsdServer.Shutdown(ctx); err != nil {
+				log.Error().Err(err).Msg("statsd.Server.Shutdown")
+			}
+		}
+		if gangliaPoller != nil {
+			if err := gangliaPoller.Shutdown(ctx); err != nil {
+				log.Error().Err(err).Msg("ganglia.Poller.Shutdown")
+			}
+		}
+		// Hosts must not be decommissioned during the final processing run.
+		close(stopDecommissioner)
+		select {
+		case <-decommissionerStopped:
+		case <-ctx.Done():
+			log.Error().Err(ctx.Err()).Msg("domain.Decommissioner.Check")
+		}
+	})
+	// Wait for any ongoing processing run and then process the metrics
+	// reported since it.
+	runShutdownPhase("process", config.Shutdown.ProcessTimeout, func(ctx context.Context) {
+		close(stopProcessor)
+		finished := make(chan struct{})
+		go func() {
+			<-processorStopped
+			processor.Process()
+			close(finished)
+		}()
+		select {
+		case <-finished:
+		case <-ctx.Done():
+			log.Error().Err(ctx.Err()).Msg("domain.Processor.Process")
+		}
+	})
+	runShutdownPhase("rrdtool", config.Shutdown.RRDToolTimeout, func(ctx context.Context) {
+		if err := historicRepo.Shutdown(ctx); err != nil {
+			log.Error().Err(err).Msg("rrd.HistoricRepo.Shutdown")
+		}
+	})
+	runShutdownPhase("dsm", config.Shutdown.DSMTimeout, func(ctx context.Context) {
+		if err := dsmUpdater.Stop(ctx); err != nil {
+			log.Error().Err(err).Msg("dsmRepository.Updater.Stop")
+		}
+	})
+	if err := currentRepo.Save(); err != nil {
+		log.Error().Err(err).Msg("inmem.CurrentRepository.Save")
+	}
+	// The periodic snapshots must have stopped before the final snapshot is
+	// taken.
+	close(stopSnapshots)
+	<-snapshotsStopped
+	if walRepo, ok := pendingRepo.(*wal.PendingRepository); ok {
+		if err := walRepo.Close(); err != nil {
+			log.Error().Err(err).Msg("wal.PendingRepository.Close")
+		}
 	}
 
 	if *memprofile != "" {
@@ -189,18 +330,120 @@ func main() {
 	}
 }
 
-func runMetricProcessor(
-	config *config.Config,
-	pendingRepo domain.PendingRepository,
-	currentRepo domain.CurrentRepository,
-	historicRepo domain.HistoricRepository,
-) {
-	step := config.RRD.Step
-	processor := domain.NewProcessor(pendingRepo, currentRepo, historicRepo, step, log.Logger)
+// newPendingRepository returns the configured pending repository.
+func newPendingRepository(config config.Pending) (domain.PendingRepository, error) {
+	switch config.Store {
+	case "", "memory":
+		return inmem.NewPendingRepository(log.Logger), nil
+	case "wal":
+		repo, err := wal.NewPendingRepository(log.Logger, config)
+		if err != nil {
+			return nil, err
+		}
+		return repo, nil
+	default:
+		return nil, fmt.Errorf("unknown pending store %q", config.Store)
+	}
+}
+
+// newCurrentRepository returns the current repository.  If a snapshot file is
+// configured, the current metrics are saved to it and restored from it.
+func newCurrentRepository(config config.Current) (*inmem.CurrentRepository, error) {
+	if config.SnapshotFile == "" {
+		return inmem.NewCurrentRepository(log.Logger), nil
+	}
+	return inmem.NewPersistentCurrentRepository(log.Logger, config.SnapshotFile)
+}
+
+// runMetricProcessor runs a processing run every step until done is closed.
+// An ongoing processing run is completed before it returns.
+func runMetricProcessor(processor *domain.Processor, step time.Duration, done <-chan struct{}) {
 	ticker := time.NewTicker(step)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			processor.Process()
+		case <-done:
+			return
+		}
+	}
+}
+
+// runShutdownPhase runs the given phase of the shutdown with a context that
+// is done once the timeout has elapsed.  A timeout of zero means the phase has
+// no deadline.
+func runShutdownPhase(name string, timeout time.Duration, phase func(ctx context.Context)) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+	log.Info().Str("phase", name).Dur("timeout", timeout).Msg("Shutting down")
+	start := time.Now()
+	phase(ctx)
+	log.Info().Str("phase", name).Dur("duration", time.Since(start)).Msg("Shut down")
+}
+
+// runDecommissioner periodically decommissions devices that have been missing
+// from the data source map for longer than the configured grace period.  The
+// check is made as often as the data source map is updated until done is
+// closed.  An ongoing check is completed before it returns.
+func runDecommissioner(config *config.Config, app *domain.Application, dsmStatus domain.DataSourceMapStatus, done <-chan struct{}) {
+	decommissioner := domain.NewDecommissioner(app, dsmStatus, config.Decommission.GracePeriod, log.Logger)
+	ticker := time.NewTicker(config.DSM.Frequency)
+	defer ticker.Stop()
 	for {
-		<-ticker.C
-		processor.Process()
+		select {
+		case <-ticker.C:
+			decommissioner.Check(time.Now())
+		case <-done:
+			return
+		}
+	}
+}
+
+func namingPolicyFromConfig(src config.NamingPolicy) (*domain.NamingPolicy, error) {
+	reserved := make([]domain.ReservedPrefix, 0, len(src.ReservedPrefixes))
+	for _, r := range src.ReservedPrefixes {
+		reserved = append(reserved, domain.ReservedPrefix{Prefix: r.Prefix, Subjects: r.Subjects})
+	}
+	return domain.NewNamingPolicy(domain.NamingPolicyOptions{
+		AllowedCharacters: src.AllowedCharacters,
+		MaxLength:         src.MaxLength,
+		ReservedPrefixes:  reserved,
+		Lowercase:         src.Lowercase,
+		Replacement:       src.Replacement,
+	})
+}
+
+// storedMetricNameLister lists the metric names of the stored historic
+// metrics.
+type storedMetricNameLister interface {
+	ListStoredMetricNames() ([]string, error)
+}
+
+// checkStoredMetricNames logs a warning for each metric name in the historic
+// repository that does not conform to the naming policy.  Such metrics were
+// reported before the policy was configured.  If they are reported again
+// they will either be rejected or, if normalised, recorded under a different
+// name.
+func checkStoredMetricNames(historicRepo storedMetricNameLister, policy *domain.NamingPolicy) {
+	names, err := historicRepo.ListStoredMetricNames()
+	if err != nil {
+		log.Warn().Err(err).Msg("checking stored metric names")
+		return
+	}
+	for _, name := range names {
+		normalised := policy.Normalise(name)
+		if err := policy.Validate(normalised); err != nil {
+			log.Warn().Err(err).Str("metric", name).Msg("stored metric name does not conform to naming policy")
+		} else if normalised != name {
+			log.Warn().Str("metric", name).Str("normalised", normalised).Msg("stored metric name is not normalised")
+		}
 	}
 }
 
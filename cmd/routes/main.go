@@ -71,7 +71,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	app := domain.NewApp(nil, nil, nil, nil, nil)
+	app := domain.NewApp(nil, nil, nil, nil, nil, nil)
 	apiServer := api.NewServer(log.Logger, app, config.API)
 
 	walkFunc := func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
@@ -47,6 +47,17 @@ type Config struct {
 	DSM              `yaml:"dsm"`
 	VisualizerAPI    `yaml:"visualizer_api"`
 	RRD              `yaml:"rrd"`
+	Pending          `yaml:"pending"`
+	Current          `yaml:"current"`
+	Shutdown         `yaml:"shutdown"`
+	Graphite         `yaml:"graphite"`
+	StatsD           `yaml:"statsd"`
+	Ganglia          `yaml:"ganglia"`
+	Decommission     `yaml:"decommission"`
+	NamingPolicy     `yaml:"naming_policy"`
+	// MetricDefinitions are the metric definitions loaded at startup.  More
+	// can be added over the API.
+	MetricDefinitions []MetricDefinition `yaml:"metric_definitions"`
 }
 
 // API is the configuration for the HTTP API component.
@@ -57,13 +68,106 @@ type API struct {
 	ReadTimeout  time.Duration `yaml:"read_timeout"`
 	WriteTimeout time.Duration `yaml:"write_timeout"`
 	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+	RemoteWrite  RemoteWrite   `yaml:"remote_write"`
+	Influx       Influx        `yaml:"influx"`
+	OTLP         OTLP          `yaml:"otlp"`
+	Collectd     Collectd      `yaml:"collectd"`
+	Timestamps   Timestamps    `yaml:"timestamps"`
+	Limits       Limits        `yaml:"limits"`
+}
+
+// RemoteWrite is the configuration for the Prometheus remote write receiver.
+type RemoteWrite struct {
+	// DeviceLabel is the name of the label holding the Concertim ID of the
+	// device.
+	DeviceLabel string `yaml:"device_label"`
+	// HostLabel is the name of the label holding the host name of the
+	// device.  It is used if a series does not have the DeviceLabel.
+	HostLabel string `yaml:"host_label"`
+	// TTL is the time-to-live given to the ingested metrics.
+	TTL time.Duration `yaml:"ttl"`
+	// MaxBodySize is the maximum size in bytes of a compressed request body.
+	// Zero means no limit.
+	MaxBodySize int64 `yaml:"max_body_size"`
+	// MaxDecodedSize is the maximum size in bytes of a request body once it
+	// has been decompressed.  Zero means no limit.
+	MaxDecodedSize int `yaml:"max_decoded_size"`
+}
+
+// Influx is the configuration for the InfluxDB line protocol write endpoint.
+type Influx struct {
+	// DeviceTag is the name of the tag holding the Concertim ID of the
+	// device.
+	DeviceTag string `yaml:"device_tag"`
+	// HostTag is the name of the tag holding the host name of the device.  It
+	// is used if a point does not have the DeviceTag.
+	HostTag string `yaml:"host_tag"`
+	// TTL is the time-to-live given to the ingested metrics.
+	TTL time.Duration `yaml:"ttl"`
+	// MaxBodySize is the maximum size in bytes of a compressed request body.
+	// Zero means no limit.
+	MaxBodySize int64 `yaml:"max_body_size"`
+	// MaxDecodedSize is the maximum size in bytes of a request body once it
+	// has been decompressed.  Zero means no limit.
+	MaxDecodedSize int `yaml:"max_decoded_size"`
+}
+
+// OTLP is the configuration for the OpenTelemetry OTLP/HTTP metrics endpoint.
+type OTLP struct {
+	// DeviceAttribute is the name of the resource attribute holding the
+	// Concertim ID of the device.
+	DeviceAttribute string `yaml:"device_attribute"`
+	// HostAttribute is the name of the resource attribute holding the host
+	// name of the device.  It is used if a resource does not have the
+	// DeviceAttribute.
+	HostAttribute string `yaml:"host_attribute"`
+	// TTL is the time-to-live given to the ingested metrics.
+	TTL time.Duration `yaml:"ttl"`
+	// MaxBodySize is the maximum size in bytes of a compressed request body.
+	// Zero means no limit.
+	MaxBodySize int64 `yaml:"max_body_size"`
+	// MaxDecodedSize is the maximum size in bytes of a request body once it
+	// has been decompressed.  Zero means no limit.
+	MaxDecodedSize int `yaml:"max_decoded_size"`
+}
+
+// Collectd is the configuration for the collectd write_http endpoint.
+type Collectd struct {
+	// TTL is the time-to-live given to the ingested metrics.
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// Timestamps is the configuration for metrics reported with a timestamp.
+type Timestamps struct {
+	// MaxSkew is how far in the future a metric's timestamp can be.
+	MaxSkew time.Duration `yaml:"max_skew"`
+	// MaxAge is how far in the past a metric's timestamp can be.
+	MaxAge time.Duration `yaml:"max_age"`
+}
+
+// Limits is the configuration for limiting the metrics reported.  A value of
+// zero disables the limit.
+type Limits struct {
+	// PerDevice is the number of requests per second allowed for each
+	// device.  Only single metric and batch requests are limited.
+	PerDevice      float64 `yaml:"per_device"`
+	PerDeviceBurst int     `yaml:"per_device_burst"`
+	// PerSubject is the number of requests per second allowed for each JWT
+	// subject.
+	PerSubject      float64 `yaml:"per_subject"`
+	PerSubjectBurst int     `yaml:"per_subject_burst"`
+	// MaxMetricNamesPerDevice is the maximum number of distinct current
+	// metric names for each device.
+	MaxMetricNamesPerDevice int `yaml:"max_metric_names_per_device"`
 }
 
 // DSM is the configuration for the Data Source Map component.
 type DSM struct {
-	Frequency time.Duration `yaml:"frequency"`
-	Testdata  string        `yaml:"testdata"`
-	Throttle  time.Duration `yaml:"throttle"`
+	ClusterName string        `yaml:"cluster_name"`
+	Frequency   time.Duration `yaml:"frequency"`
+	GridName    string        `yaml:"grid_name"`
+	Testdata    string        `yaml:"testdata"`
+	Throttle    time.Duration `yaml:"throttle"`
 }
 
 type VisualizerAPI struct {
@@ -81,6 +185,138 @@ type RRD struct {
 	GridName    string        `yaml:"grid_name"`
 	Step        time.Duration `yaml:"step"`
 	ToolPath    string        `yaml:"rrd_tool_path"`
+	// ArchiveDirectory is the directory that a decommissioned device's RRD
+	// files are moved to.  If empty, the files are deleted.
+	ArchiveDirectory string `yaml:"archive_directory"`
+}
+
+// Pending is the configuration for the repository of reported metrics pending
+// their processing.
+type Pending struct {
+	// Store is where pending metrics are stored.  Either `memory`, the
+	// default, or `wal` to store them in memory and in a write-ahead log on
+	// disk, so that they survive a restart.
+	Store string `yaml:"store"`
+	// Directory is the directory containing the write-ahead log and its
+	// snapshots.
+	Directory string `yaml:"directory"`
+	// SnapshotInterval is how often the write-ahead log is compacted into a
+	// snapshot.  Zero means a snapshot is only taken at startup and
+	// shutdown.
+	SnapshotInterval time.Duration `yaml:"snapshot_interval"`
+	// Sync, if true, syncs the write-ahead log to disk after each change.
+	Sync bool `yaml:"sync"`
+}
+
+// Current is the configuration for the repository of current metrics.
+type Current struct {
+	// SnapshotFile is the file that the current metrics are saved to after
+	// each processing run and on shutdown.  They are restored from it on
+	// startup.  If empty, the current metrics are not saved.
+	SnapshotFile string `yaml:"snapshot_file"`
+}
+
+// Shutdown is the configuration for shutting down the daemon.  Each phase of
+// the shutdown is given up to its timeout to complete before the next phase
+// starts.  A timeout of zero means the phase is waited on indefinitely.
+type Shutdown struct {
+	// StopWritesTimeout is how long to wait for the HTTP API and the other
+	// listeners to finish handling in-flight requests.
+	StopWritesTimeout time.Duration `yaml:"stop_writes_timeout"`
+	// ProcessTimeout is how long to wait for the final processing run, which
+	// processes the metrics reported since the last processing run.
+	ProcessTimeout time.Duration `yaml:"process_timeout"`
+	// RRDToolTimeout is how long to wait for in-flight rrdtool commands.
+	RRDToolTimeout time.Duration `yaml:"rrdtool_timeout"`
+	// DSMTimeout is how long to wait for an in-flight update of the data
+	// source map.
+	DSMTimeout time.Duration `yaml:"dsm_timeout"`
+}
+
+// Graphite is the configuration for the graphite plaintext protocol listener.
+type Graphite struct {
+	Enabled bool   `yaml:"enabled"`
+	IP      string `yaml:"ip"`
+	Port    int    `yaml:"port"`
+	TCP     bool   `yaml:"tcp"`
+	UDP     bool   `yaml:"udp"`
+	// HostSegment is the zero-based index of the metric path segment holding
+	// the host name.
+	HostSegment int `yaml:"host_segment"`
+	// TTL is the time-to-live given to the received metrics.
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// Ganglia is the configuration for the gmond XML poller.
+type Ganglia struct {
+	Enabled bool `yaml:"enabled"`
+	// Addresses are the host:port addresses of the gmond XML ports to poll.
+	Addresses []string      `yaml:"addresses"`
+	Interval  time.Duration `yaml:"interval"`
+	Timeout   time.Duration `yaml:"timeout"`
+}
+
+// Decommission is the configuration for decommissioning devices.
+type Decommission struct {
+	// Automatic enables the automatic decommissioning of devices that are no
+	// longer in the data source map.
+	Automatic bool `yaml:"automatic"`
+	// GracePeriod is how long a device must be missing from the data source
+	// map before it is automatically decommissioned.
+	GracePeriod time.Duration `yaml:"grace_period"`
+}
+
+// NamingPolicy is the configuration for the policy that reported metric names
+// must conform to.
+type NamingPolicy struct {
+	// AllowedCharacters is the body of a regular expression character class
+	// matching the characters allowed in a metric name.  If empty, any
+	// character is allowed.
+	AllowedCharacters string `yaml:"allowed_characters"`
+	// MaxLength is the maximum length of a metric name.  Zero means no
+	// maximum.
+	MaxLength int `yaml:"max_length"`
+	// ReservedPrefixes are the metric name prefixes that only the given JWT
+	// subjects may use.
+	ReservedPrefixes []ReservedPrefix `yaml:"reserved_prefixes"`
+	// Lowercase converts metric names to lowercase.
+	Lowercase bool `yaml:"lowercase"`
+	// Replacement, if not empty, replaces characters that are not allowed
+	// instead of the metric being rejected.
+	Replacement string `yaml:"replacement"`
+}
+
+// ReservedPrefix is a metric name prefix that only the given JWT subjects may
+// use.
+type ReservedPrefix struct {
+	Prefix   string   `yaml:"prefix"`
+	Subjects []string `yaml:"subjects"`
+}
+
+// StatsD is the configuration for the statsd listener.
+type StatsD struct {
+	Enabled bool   `yaml:"enabled"`
+	IP      string `yaml:"ip"`
+	Port    int    `yaml:"port"`
+	// HostSegment is the zero-based index of the metric name segment holding
+	// the host name.
+	HostSegment int `yaml:"host_segment"`
+	// TTL is the time-to-live given to the aggregated metrics.
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// MetricDefinition is the configuration for a single metric definition.
+type MetricDefinition struct {
+	// Name is the metric name or a pattern matching several metric names,
+	// e.g., `ct.ipmi.*`.
+	Name        string   `yaml:"name"`
+	Type        string   `yaml:"type"`
+	Units       string   `yaml:"units"`
+	Slope       string   `yaml:"slope"`
+	Min         *float64 `yaml:"min"`
+	Max         *float64 `yaml:"max"`
+	States      []string `yaml:"states"`
+	Description string   `yaml:"description"`
 }
 
 // DefaultPath is the path to the default config file.
@@ -0,0 +1,65 @@
+#!/bin/bash
+
+set -e
+set -o pipefail
+# set -x
+
+# The base URL against which relative URLs are constructed.
+CONCERTIM_HOST=${CONCERTIM_HOST:-command.concertim.alces-flight.com}
+BASE_URL=${BASE_URL:="https://${CONCERTIM_HOST}/mrd"}
+
+# This script reports multiple int32 metrics for multiple devices in a single
+# request.
+
+# The Concertim IDs for the devices that the metrics are being reported for.
+# The rack and device API contains an endpoint to list valid ids.  See the
+# example scripts in the ct-visualisation-app repository.
+DEVICE_IDS=("${@:-1}")
+
+# An auth token is required for creating metrics.  One can be generated with
+# the `ct-visualisation-app/docs/api/get-auth-token.sh` script and exported as
+# the environment variable AUTH_TOKEN.
+if [ -z "${AUTH_TOKEN}" ] ; then
+  echo "$(basename $0) AUTH_TOKEN not set" >&2
+  exit 1
+fi
+
+
+# Build the list of metrics for a single device.  This assumes that they have
+# the same, data type, units, slope and ttl.
+device_entry() {
+  local device_id
+  device_id="$1"
+
+  jq --null-input \
+    --arg device_id "${device_id}" \
+    --arg caffeine $(shuf -i 12-24 -n 1) \
+    --arg power $(shuf -i 8900-9100 -n 1) \
+    --arg load $(shuf -i 0-5 -n 1) \
+    '
+{
+  "device_id": $device_id,
+  "metrics": [
+    {"name": "caffeine.level", "value": $caffeine|tonumber},
+    {"name": "power.level", "value": $power|tonumber},
+    {"name": "load.1", "value": $load|tonumber}
+  ] | map(. + {"type": "int32", "units": "", "slope": "both", "ttl": 3600})
+}
+'
+}
+
+
+# Use `jq` to combine the entries for each device into a single JSON list.
+BODY=$(
+  for device_id in "${DEVICE_IDS[@]}" ; do
+    device_entry "${device_id}"
+  done | jq --slurp '.'
+)
+
+
+# Finally, we make the request to report all of the metrics.
+curl -s -k \
+  -H 'Content-Type: application/json' \
+  -H "Authorization: Bearer ${AUTH_TOKEN}" \
+  -X POST "${BASE_URL}/metrics/batch" \
+  -d "${BODY}"
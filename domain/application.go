@@ -29,6 +29,8 @@ package domain
 
 import (
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -41,11 +43,18 @@ import (
 // It provides a number of methods that coordinate the interaction between the
 // repositories.
 type Application struct {
-	pendingRepo  PendingRepository
-	dsmRepo      DataSourceMapRepository
-	dsmUpdater   DataSourceMapRepoUpdater
-	CurrentRepo  CurrentRepository
-	HistoricRepo HistoricRepository
+	pendingRepo    PendingRepository
+	dsmRepo        DataSourceMapRepository
+	dsmUpdater     DataSourceMapRepoUpdater
+	CurrentRepo    CurrentRepository
+	HistoricRepo   HistoricRepository
+	DefinitionRepo MetricDefinitionRepository
+	// MaxMetricNamesPerHost is the maximum number of distinct current metric
+	// names that a host can report.  Zero means no limit.
+	MaxMetricNamesPerHost int
+	// NamingPolicy is the policy that reported metric names must conform
+	// to.  If nil, any metric name is accepted.
+	NamingPolicy *NamingPolicy
 }
 
 // NewApp returns a newly configured Application.
@@ -55,42 +64,252 @@ func NewApp(
 	dsmUpdater DataSourceMapRepoUpdater,
 	currentRepo CurrentRepository,
 	historicRepo HistoricRepository,
+	definitionRepo MetricDefinitionRepository,
 ) *Application {
 	return &Application{
-		pendingRepo:  pendingRepo,
-		dsmRepo:      dsmRepo,
-		dsmUpdater:   dsmUpdater,
-		CurrentRepo:  currentRepo,
-		HistoricRepo: historicRepo,
+		pendingRepo:    pendingRepo,
+		dsmRepo:        dsmRepo,
+		dsmUpdater:     dsmUpdater,
+		CurrentRepo:    currentRepo,
+		HistoricRepo:   historicRepo,
+		DefinitionRepo: definitionRepo,
 	}
 }
 
+// CheckMetricDefinition returns a *MetricDefinitionError if the given metric
+// conflicts with the metric definition that applies to it, if any.
+//
+// Enum metrics must have a definition listing their states.  If they do not,
+// an ErrEnumWithoutStates error is returned.
+func (app *Application) CheckMetricDefinition(metric PendingMetric) error {
+	var definition MetricDefinition
+	var ok bool
+	if app.DefinitionRepo != nil {
+		definition, ok = app.DefinitionRepo.Match(metric.Name)
+	}
+	if metric.Type == MetricTypeEnum && (!ok || len(definition.States) == 0) {
+		return fmt.Errorf("%w: %s", ErrEnumWithoutStates, metric.Name)
+	}
+	if !ok {
+		return nil
+	}
+	return definition.Check(metric)
+}
+
 // AddPendingMetric adds the given metric for the specified host to the pending
 // repository. If the host has not previously been added it will also be added
 // if its data source map to host can be found in the DataSourceMapRepository.
-func (app *Application) AddPendingMetric(metric PendingMetric, hostId HostId) error {
+//
+// The metric's name is normalised according to the application's naming
+// policy, if any.  An ErrInvalidMetricName error is returned if the name is
+// not safe to use, see ValidateMetricName, or does not conform to the policy.
+// An ErrReservedMetricName error is returned if the name has a reserved
+// prefix that the given subject may not use.  Reporters that are not
+// authenticated have an empty subject and may not use any reserved prefix.
+//
+// The metric is checked against its metric definition, if any, see
+// CheckMetricDefinition.
+func (app *Application) AddPendingMetric(metric PendingMetric, hostId HostId, subject string) error {
+	if app.NamingPolicy != nil {
+		metric.Name = app.NamingPolicy.Normalise(metric.Name)
+	}
+	if err := ValidateMetricName(metric.Name); err != nil {
+		return err
+	}
+	if app.NamingPolicy != nil {
+		if err := app.NamingPolicy.Check(metric.Name, subject); err != nil {
+			return err
+		}
+	}
+	if err := app.CheckMetricDefinition(metric); err != nil {
+		return err
+	}
 	host, ok := app.pendingRepo.GetHost(hostId)
 	if !ok {
 		var err error
-		host, err = app.addHost(hostId)
+		host, err = app.newPendingHost(hostId)
 		if err != nil {
 			return errors.Wrap(err, "adding host")
 		}
 	}
 	host.Reported = time.Now()
-	err := app.pendingRepo.PutHost(host)
-	if err != nil {
-		return errors.Wrap(err, "updating host")
+	// The metric is merged with the repository locked so that concurrent
+	// reports for the same series are not lost, and concurrent reports of
+	// new metric names are all counted towards the limit.
+	var mergeErr error
+	err := app.pendingRepo.MergeMetric(host, func(stored PendingHost) (PendingMetric, error) {
+		existing, ok := stored.Metrics[metric.SeriesKey()]
+		if !ok {
+			mergeErr = app.checkMetricNameLimit(stored, metric.Name)
+			return metric, mergeErr
+		}
+		var merged PendingMetric
+		merged, mergeErr = mergePendingMetric(existing, metric)
+		return merged, mergeErr
+	})
+	if mergeErr != nil {
+		return mergeErr
 	}
-	err = app.pendingRepo.PutMetric(host, metric)
 	return errors.Wrap(err, "putting metric")
 }
 
-// addHost creates a new PendingHost and adds it to the pending repository.
+// DeletePendingMetric removes each series of the given metric matching the
+// given labels from the specified host in the pending repository.  The
+// metric will not be present in the next processing run.
+//
+// If the host has no matching series an ErrMetricNotFound error is returned.
+func (app *Application) DeletePendingMetric(hostId HostId, metricName string, labels Labels) error {
+	deleted, err := app.pendingRepo.DeleteMatchingMetrics(hostId, func(metric PendingMetric) bool {
+		return metric.Name == metricName && metric.Labels.Matches(labels)
+	})
+	if errors.Is(err, ErrUnknownHost) {
+		return err
+	} else if err != nil {
+		return errors.Wrap(err, "deleting metric")
+	}
+	if len(deleted) == 0 {
+		return fmt.Errorf("%w: %s", ErrMetricNotFound, metricName)
+	}
+	return nil
+}
+
+// checkMetricNameLimit returns an ErrTooManyMetricNames error if reporting the
+// named metric would take the host over MaxMetricNamesPerHost.  Metrics that
+// have expired do not count towards the limit.
+func (app *Application) checkMetricNameLimit(host PendingHost, metricName string) error {
+	if app.MaxMetricNamesPerHost <= 0 {
+		return nil
+	}
+	now := time.Now()
+	names := map[string]struct{}{}
+	for _, m := range host.Metrics {
+		if m.Name == metricName {
+			return nil
+		}
+		if m.TTL == 0 || m.Reported.Add(m.TTL).After(now) {
+			names[m.Name] = struct{}{}
+		}
+	}
+	if len(names) >= app.MaxMetricNamesPerHost {
+		return fmt.Errorf(
+			"%w: %s already reports %d metric names, the maximum allowed",
+			ErrTooManyMetricNames, host.Id, len(names),
+		)
+	}
+	return nil
+}
+
+// mergePendingMetric merges a newly reported metric with the existing pending
+// metric for the same series.
+//
+// If the existing metric has been processed, the new metric replaces it
+// unless it was reported before the existing metric was last processed, in
+// which case an ErrOutOfOrderUpdate error is returned.  The comparison is made
+// on whole seconds as that is the resolution of the historic repository.
+//
+// If the existing metric has not yet been processed, its value is retained
+// as a backfill value so that it can be recorded by the next processing run.
+// The most recently reported value becomes the metric's value.  If two
+// values are reported for the same second, the newer report wins.
+func mergePendingMetric(existing, metric PendingMetric) (PendingMetric, error) {
+	if existing.LastProcessed != nil {
+		lastProcessed := existing.LastProcessed.Truncate(time.Second)
+		if metric.Reported.Truncate(time.Second).Before(lastProcessed) {
+			return PendingMetric{}, fmt.Errorf(
+				"%w: %s reported for %s which is before its last recorded value at %s",
+				ErrOutOfOrderUpdate, metric.Name, metric.Reported.Format(time.RFC3339), lastProcessed.Format(time.RFC3339),
+			)
+		}
+		return metric, nil
+	}
+
+	values := make([]PendingValue, 0, len(existing.Backfill)+2)
+	values = append(values, existing.Backfill...)
+	values = append(values, PendingValue{Value: existing.Value, Reported: existing.Reported})
+	values = append(values, PendingValue{Value: metric.Value, Reported: metric.Reported})
+	// A stable sort retains the order of reports for the same second.
+	slices.SortStableFunc(values, func(a, b PendingValue) int {
+		return a.Reported.Truncate(time.Second).Compare(b.Reported.Truncate(time.Second))
+	})
+	merged := make([]PendingValue, 0, len(values))
+	for _, v := range values {
+		last := len(merged) - 1
+		if last >= 0 && merged[last].Reported.Truncate(time.Second).Equal(v.Reported.Truncate(time.Second)) {
+			merged[last] = v
+			continue
+		}
+		merged = append(merged, v)
+	}
+	latest := merged[len(merged)-1]
+	metric.Value = latest.Value
+	metric.Reported = latest.Reported
+	metric.Backfill = nil
+	if len(merged) > 1 {
+		metric.Backfill = merged[:len(merged)-1]
+	}
+	return metric, nil
+}
+
+// HostIdForHostName returns the host id for the host with the given name.  If
+// the host cannot be found, the DataSourceMapRepository is updated and the
+// lookup retried.  If the host still cannot be found an ErrUnknownHost error is
+// returned.
 //
-// The host is only added if a data source map can be found in the
+// It is intended for metric ingestion protocols that identify a host by its
+// name rather than its Concertim ID.
+func (app *Application) HostIdForHostName(hostName string) (HostId, error) {
+	return app.HostIdForHostNames(hostName)
+}
+
+// HostIdForHostNames returns the host id for the first of the given host
+// names that can be found.  If none of them can be found, the
+// DataSourceMapRepository is updated once and the lookups retried.  If none
+// can still be found an ErrUnknownHost error is returned.
+//
+// It is intended for metric ingestion protocols that may identify a host by
+// either its fully qualified or its short name.
+func (app *Application) HostIdForHostNames(hostNames ...string) (HostId, error) {
+	lookup := func() (HostId, bool) {
+		for _, hostName := range hostNames {
+			if hostId, ok := app.dsmRepo.GetHostIdForHostName(hostName); ok {
+				return hostId, true
+			}
+		}
+		return "", false
+	}
+	hostId, ok := lookup()
+	if !ok {
+		app.dsmUpdater.UpdateNow()
+		hostId, ok = lookup()
+	}
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownHost, strings.Join(hostNames, ", "))
+	}
+	return hostId, nil
+}
+
+// HostIdForDSM returns the host id for the host with the given data source
+// map.  If the host cannot be found, the DataSourceMapRepository is updated
+// and the lookup retried.  If the host still cannot be found an
+// ErrUnknownHost error is returned.
+func (app *Application) HostIdForDSM(dsm DSM) (HostId, error) {
+	hostId, ok := app.dsmRepo.GetHostId(dsm)
+	if !ok {
+		app.dsmUpdater.UpdateNow()
+		hostId, ok = app.dsmRepo.GetHostId(dsm)
+	}
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownHost, dsm)
+	}
+	return hostId, nil
+}
+
+// newPendingHost creates a new PendingHost for adding to the pending
+// repository.
+//
+// The host is only created if a data source map can be found in the
 // DataSourceMapRepository.  Otherwise an error is returned.
-func (app *Application) addHost(hostId HostId) (PendingHost, error) {
+func (app *Application) newPendingHost(hostId HostId) (PendingHost, error) {
 	dsm, ok := app.dsmRepo.GetDSM(hostId)
 	if !ok {
 		app.dsmUpdater.UpdateNow()
@@ -105,9 +324,5 @@ func (app *Application) addHost(hostId HostId) (PendingHost, error) {
 		Reported: time.Now(),
 		Metrics:  map[MetricName]PendingMetric{},
 	}
-	err := app.pendingRepo.PutHost(host)
-	if err != nil {
-		return PendingHost{}, err
-	}
 	return host, nil
 }
@@ -0,0 +1,154 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package domain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// DecommissionHost removes the given host and its metrics from the pending
+// and current repositories and deletes, or archives, its historic metrics.
+//
+// The host's data source map is taken from the pending or current
+// repositories if present there, so that hosts already removed from the
+// DataSourceMapRepository can be decommissioned.  If the host cannot be found
+// in any of them an ErrUnknownHost error is returned.
+func (app *Application) DecommissionHost(hostId HostId) error {
+	dsm, ok := app.dsmForDecommission(hostId)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownHost, hostId)
+	}
+	err := app.pendingRepo.DeleteHost(hostId)
+	if err != nil && !errors.Is(err, ErrUnknownHost) {
+		return errors.Wrap(err, "removing pending host")
+	}
+	if app.CurrentRepo != nil {
+		err = app.CurrentRepo.RemoveHost(hostId)
+		if err != nil && !errors.Is(err, ErrHostNotFound) && !errors.Is(err, ErrWaitingOnProcessingRun) {
+			return errors.Wrap(err, "removing current host")
+		}
+	}
+	if app.HistoricRepo != nil {
+		err = app.HistoricRepo.RemoveHost(dsm)
+		if err != nil {
+			return errors.Wrap(err, "removing historic metrics")
+		}
+	}
+	return nil
+}
+
+func (app *Application) dsmForDecommission(hostId HostId) (DSM, bool) {
+	if host, ok := app.pendingRepo.GetHost(hostId); ok {
+		return host.DSM, true
+	}
+	if app.CurrentRepo != nil {
+		hosts, _ := app.CurrentRepo.GetHosts()
+		for _, host := range hosts {
+			if host.Id == hostId {
+				return host.DSM, true
+			}
+		}
+	}
+	return app.dsmRepo.GetDSM(hostId)
+}
+
+// Decommissioner automatically decommissions hosts that have been missing from
+// the DataSourceMapRepository for longer than a grace period.
+//
+// Only hosts in the pending repository are considered.  A host that is
+// removed from Concertim whilst the daemon is not running will not be
+// automatically decommissioned.
+//
+// Hosts are only considered missing whilst the DataSourceMapRepository is
+// synced.  Otherwise, a failure to retrieve the data source map would see
+// every host decommissioned.
+type Decommissioner struct {
+	app          *Application
+	dsmStatus    DataSourceMapStatus
+	gracePeriod  time.Duration
+	logger       zerolog.Logger
+	missingSince map[HostId]time.Time
+}
+
+// NewDecommissioner returns a new *Decommissioner.
+func NewDecommissioner(app *Application, dsmStatus DataSourceMapStatus, gracePeriod time.Duration, logger zerolog.Logger) *Decommissioner {
+	return &Decommissioner{
+		app:          app,
+		dsmStatus:    dsmStatus,
+		gracePeriod:  gracePeriod,
+		logger:       logger.With().Str("component", "decommissioner").Logger(),
+		missingSince: map[HostId]time.Time{},
+	}
+}
+
+// Check records when each pending host was first found to be missing from the
+// DataSourceMapRepository and decommissions those that have been missing for
+// longer than the grace period.  Hosts that reappear are forgiven.
+//
+// The check is skipped if the DataSourceMapRepository is not synced, that is
+// if it has not yet been updated or its most recent update failed or
+// retrieved no hosts.
+func (d *Decommissioner) Check(now time.Time) {
+	if !d.dsmStatus.Synced() {
+		d.logger.Debug().Msg("data source map not synced; skipping check")
+		return
+	}
+	present := map[HostId]bool{}
+	for _, host := range d.app.pendingRepo.GetAll() {
+		present[host.Id] = true
+		if _, ok := d.app.dsmRepo.GetDSM(host.Id); ok {
+			delete(d.missingSince, host.Id)
+			continue
+		}
+		since, ok := d.missingSince[host.Id]
+		if !ok {
+			d.logger.Info().Stringer("host", host.Id).Dur("grace period", d.gracePeriod).Msg("host missing from data source map")
+			d.missingSince[host.Id] = now
+			continue
+		}
+		if now.Sub(since) < d.gracePeriod {
+			continue
+		}
+		d.logger.Info().Stringer("host", host.Id).Time("missing since", since).Msg("decommissioning host")
+		if err := d.app.DecommissionHost(host.Id); err != nil {
+			d.logger.Warn().Err(err).Stringer("host", host.Id).Msg("decommissioning host")
+			continue
+		}
+		delete(d.missingSince, host.Id)
+	}
+	// Forget hosts that have been decommissioned by other means.
+	for hostId := range d.missingSince {
+		if !present[hostId] {
+			delete(d.missingSince, hostId)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidMetricDefinition is returned if a metric definition is not valid.
+var ErrInvalidMetricDefinition = errors.New("invalid metric definition")
+
+// ErrMetricDefinitionNotFound is returned if a metric definition cannot be
+// found.
+var ErrMetricDefinitionNotFound = errors.New("Metric definition not found")
+
+// ErrMetricDefinitionConflict is returned if a reported metric conflicts with
+// its metric definition.
+var ErrMetricDefinitionConflict = errors.New("Metric conflicts with its definition")
+
+// ErrEnumWithoutStates is returned if an enum metric is reported without a
+// metric definition listing its states.
+var ErrEnumWithoutStates = errors.New("enum metrics require a metric definition with states")
+
+// MetricDefinition defines the expected type, units, slope and range of the
+// metrics with a given name.
+//
+// Name is either a metric name or a pattern matching several metric names.
+// Patterns use the syntax of path.Match, e.g., `ct.ipmi.*`.  All other fields
+// are optional; an empty value places no constraint on reported metrics.
+//
+// States lists the values allowed for an enum metric, e.g., `on`, `off` and
+// `unknown` for a power state.  It is required if Type is enum and cannot be
+// given otherwise.
+type MetricDefinition struct {
+	Name        string
+	Type        MetricType
+	Units       string
+	Slope       MetricSlope
+	Min         *float64
+	Max         *float64
+	States      []string
+	Description string
+}
+
+// IsPattern returns true if the definition's name is a pattern.
+func (d MetricDefinition) IsPattern() bool {
+	return strings.ContainsAny(d.Name, `*?[\`)
+}
+
+// Matches returns true if the definition applies to the given metric name.
+func (d MetricDefinition) Matches(metricName string) bool {
+	if !d.IsPattern() {
+		return d.Name == metricName
+	}
+	matched, err := path.Match(d.Name, metricName)
+	return err == nil && matched
+}
+
+// Validate returns an ErrInvalidMetricDefinition error if the definition is
+// not valid.
+func (d MetricDefinition) Validate() error {
+	if strings.TrimSpace(d.Name) == "" {
+		return fmt.Errorf("%w: name cannot be blank", ErrInvalidMetricDefinition)
+	}
+	if _, err := path.Match(d.Name, ""); err != nil {
+		return fmt.Errorf("%w: %q is not a valid pattern", ErrInvalidMetricDefinition, d.Name)
+	}
+	if d.Type != "" && !d.Type.IsValid() {
+		return fmt.Errorf("%w: %s is %s", ErrInvalidMetricDefinition, d.Type, ErrInvalidMetricType)
+	}
+	if d.Slope != "" && !d.Slope.IsValid() {
+		return fmt.Errorf("%w: %s is %s", ErrInvalidMetricDefinition, d.Slope, ErrInvalidMetricSlope)
+	}
+	if d.Min != nil && d.Max != nil && *d.Min > *d.Max {
+		return fmt.Errorf("%w: min cannot be greater than max", ErrInvalidMetricDefinition)
+	}
+	if d.Type == MetricTypeEnum && len(d.States) == 0 {
+		return fmt.Errorf("%w: states are required for enum metrics", ErrInvalidMetricDefinition)
+	}
+	if d.Type != MetricTypeEnum && len(d.States) > 0 {
+		return fmt.Errorf("%w: states can only be given for enum metrics", ErrInvalidMetricDefinition)
+	}
+	for i, state := range d.States {
+		if strings.TrimSpace(state) == "" {
+			return fmt.Errorf("%w: states cannot be blank", ErrInvalidMetricDefinition)
+		}
+		if slices.Contains(d.States[:i], state) {
+			return fmt.Errorf("%w: state %q is given more than once", ErrInvalidMetricDefinition, state)
+		}
+	}
+	return nil
+}
+
+// MetricDefinitionConflict is a single way in which a reported metric
+// conflicts with its definition.
+type MetricDefinitionConflict struct {
+	// Field is the metric field that conflicts, one of `type`, `units`,
+	// `slope` or `value`.
+	Field  string
+	Detail string
+}
+
+// MetricDefinitionError is returned if a reported metric conflicts with its
+// definition.  It wraps ErrMetricDefinitionConflict.
+type MetricDefinitionError struct {
+	Definition string
+	Conflicts  []MetricDefinitionConflict
+}
+
+func (e *MetricDefinitionError) Error() string {
+	details := make([]string, 0, len(e.Conflicts))
+	for _, c := range e.Conflicts {
+		details = append(details, c.Detail)
+	}
+	return fmt.Sprintf("%s: %s: %s", ErrMetricDefinitionConflict, e.Definition, strings.Join(details, "; "))
+}
+
+func (e *MetricDefinitionError) Unwrap() error { return ErrMetricDefinitionConflict }
+
+// Check returns a *MetricDefinitionError if the given metric conflicts with
+// the definition.
+func (d MetricDefinition) Check(metric PendingMetric) error {
+	conflicts := make([]MetricDefinitionConflict, 0)
+	if d.Type != "" && metric.Type != d.Type {
+		conflicts = append(conflicts, MetricDefinitionConflict{
+			Field:  "type",
+			Detail: fmt.Sprintf("type must be %s", d.Type),
+		})
+	}
+	if d.Units != "" && metric.Units != d.Units {
+		conflicts = append(conflicts, MetricDefinitionConflict{
+			Field:  "units",
+			Detail: fmt.Sprintf("units must be %s", d.Units),
+		})
+	}
+	if d.Slope != "" && metric.Slope != d.Slope {
+		conflicts = append(conflicts, MetricDefinitionConflict{
+			Field:  "slope",
+			Detail: fmt.Sprintf("slope must be %s", d.Slope),
+		})
+	}
+	if (d.Min != nil || d.Max != nil) && metric.Type != MetricTypeString {
+		value, err := strconv.ParseFloat(metric.Value, 64)
+		if err == nil && d.Min != nil && value < *d.Min {
+			conflicts = append(conflicts, MetricDefinitionConflict{
+				Field:  "value",
+				Detail: fmt.Sprintf("value must be %s or greater", strconv.FormatFloat(*d.Min, 'f', -1, 64)),
+			})
+		}
+		if err == nil && d.Max != nil && value > *d.Max {
+			conflicts = append(conflicts, MetricDefinitionConflict{
+				Field:  "value",
+				Detail: fmt.Sprintf("value must be %s or less", strconv.FormatFloat(*d.Max, 'f', -1, 64)),
+			})
+		}
+	}
+	if metric.Type == MetricTypeEnum && len(d.States) > 0 && !slices.Contains(d.States, metric.Value) {
+		conflicts = append(conflicts, MetricDefinitionConflict{
+			Field:  "value",
+			Detail: fmt.Sprintf("value must be one of [%s]", strings.Join(d.States, " ")),
+		})
+	}
+	if len(conflicts) > 0 {
+		return &MetricDefinitionError{Definition: d.Name, Conflicts: conflicts}
+	}
+	return nil
+}
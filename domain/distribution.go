@@ -0,0 +1,324 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// DistributionQuantile is a quantile calculated for each value of a
+// distribution metric.
+type DistributionQuantile struct {
+	// The name of the quantile, e.g., p90.
+	Name string
+	// The quantile, e.g., 0.9.
+	Quantile float64
+}
+
+// DistributionQuantiles are the quantiles calculated for each value of a
+// distribution metric.  They are fixed, rather than configurable, as they
+// are recorded in the HistoricRepository.
+var DistributionQuantiles = []DistributionQuantile{
+	{Name: "p50", Quantile: 0.5},
+	{Name: "p90", Quantile: 0.9},
+	{Name: "p99", Quantile: 0.99},
+}
+
+// sampleBuckets is the number of buckets that the samples of a distribution
+// are counted into.
+const sampleBuckets = 10
+
+// Distribution is the value of a distribution metric.  It records the
+// number of observations in each of a number of buckets, the total number and
+// sum of the observations and the DistributionQuantiles of the observations.
+type Distribution struct {
+	Count   uint64   `json:"count"`
+	Sum     float64  `json:"sum"`
+	Buckets []Bucket `json:"buckets"`
+	// A map from the name of each of the DistributionQuantiles to its value.
+	// Empty if there are no observations.
+	Quantiles map[string]float64 `json:"quantiles"`
+}
+
+// Bucket is a single bucket of a Distribution.  It counts the observations
+// greater than the upper bound of the previous bucket and less than or equal
+// to its own upper bound.
+type Bucket struct {
+	UpperBound float64
+	Count      uint64
+}
+
+type bucketJSON struct {
+	UpperBound any    `json:"le"`
+	Count      uint64 `json:"count"`
+}
+
+// MarshalJSON implements the json.Marshaler interface.  An infinite upper
+// bound is encoded as the string "+Inf".
+func (b Bucket) MarshalJSON() ([]byte, error) {
+	var upperBound any = b.UpperBound
+	if math.IsInf(b.UpperBound, 1) {
+		upperBound = "+Inf"
+	}
+	return json.Marshal(bucketJSON{UpperBound: upperBound, Count: b.Count})
+}
+
+// distributionInput is a reported distribution.  Either the buckets and sum
+// or the samples are given.
+type distributionInput struct {
+	Buckets []struct {
+		UpperBound json.RawMessage `json:"le"`
+		Count      *uint64         `json:"count"`
+	} `json:"buckets"`
+	Sum     *float64  `json:"sum"`
+	Samples []float64 `json:"samples"`
+}
+
+// ParseDistribution parses the given reported distribution.  The value is a
+// map decoded from a JSON object.  It can give the count of
+// observations in each bucket, along with the sum of the observations:
+//
+//	{"buckets": [{"le": 0.5, "count": 3}, {"le": "+Inf", "count": 1}], "sum": 2.7}
+//
+// Or it can give the observations themselves, which are counted into buckets
+// of equal width between the smallest and largest observation:
+//
+//	{"samples": [0.2, 0.4, 0.4, 0.6, 1.1]}
+//
+// Bucket counts are not cumulative and the buckets' upper bounds must be
+// increasing.  Only the last bucket's upper bound can be "+Inf".
+func ParseDistribution(val any) (*Distribution, error) {
+	data, err := json.Marshal(val)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMetricVal, err)
+	}
+	var input distributionInput
+	if err := json.Unmarshal(data, &input); err != nil {
+		return nil, fmt.Errorf("%w: invalid distribution: %s", ErrInvalidMetricVal, err)
+	}
+	switch {
+	case len(input.Buckets) > 0 && len(input.Samples) > 0:
+		return nil, fmt.Errorf("%w: distribution cannot have both buckets and samples", ErrInvalidMetricVal)
+	case len(input.Buckets) > 0:
+		return distributionFromBuckets(input)
+	case len(input.Samples) > 0:
+		return distributionFromSamples(input.Samples)
+	default:
+		return nil, fmt.Errorf("%w: distribution must have either buckets or samples", ErrInvalidMetricVal)
+	}
+}
+
+func distributionFromBuckets(input distributionInput) (*Distribution, error) {
+	if input.Sum == nil {
+		return nil, fmt.Errorf("%w: distribution with buckets must have a sum", ErrInvalidMetricVal)
+	}
+	d := &Distribution{Sum: *input.Sum, Buckets: make([]Bucket, 0, len(input.Buckets))}
+	for i, b := range input.Buckets {
+		upperBound, err := parseUpperBound(b.UpperBound)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bucket %d: %s", ErrInvalidMetricVal, i, err)
+		}
+		if b.Count == nil {
+			return nil, fmt.Errorf("%w: bucket %d: count is required", ErrInvalidMetricVal, i)
+		}
+		if i > 0 && upperBound <= d.Buckets[i-1].UpperBound {
+			return nil, fmt.Errorf("%w: bucket %d: upper bounds must be increasing", ErrInvalidMetricVal, i)
+		}
+		if math.IsInf(upperBound, 1) && i != len(input.Buckets)-1 {
+			return nil, fmt.Errorf("%w: bucket %d: only the last bucket can have an upper bound of +Inf", ErrInvalidMetricVal, i)
+		}
+		d.Buckets = append(d.Buckets, Bucket{UpperBound: upperBound, Count: *b.Count})
+		d.Count += *b.Count
+	}
+	if math.IsInf(d.Sum, 0) || math.IsNaN(d.Sum) {
+		return nil, fmt.Errorf("%w: distribution sum must be finite", ErrInvalidMetricVal)
+	}
+	d.Quantiles = bucketQuantiles(d.Buckets, d.Count)
+	return d, nil
+}
+
+// parseUpperBound parses a bucket's upper bound, which is either a number or
+// the string "+Inf".
+func parseUpperBound(data json.RawMessage) (float64, error) {
+	if len(data) == 0 {
+		return 0, fmt.Errorf("le is required")
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		if s == "+Inf" {
+			return math.Inf(1), nil
+		}
+		return 0, fmt.Errorf("le must be a number or +Inf")
+	}
+	f, err := strconv.ParseFloat(string(data), 64)
+	if err != nil {
+		return 0, fmt.Errorf("le must be a number or +Inf")
+	}
+	return f, nil
+}
+
+func distributionFromSamples(samples []float64) (*Distribution, error) {
+	sorted := make([]float64, len(samples))
+	copy(sorted, samples)
+	sort.Float64s(sorted)
+	d := &Distribution{Count: uint64(len(sorted))}
+	for _, sample := range sorted {
+		d.Sum += sample
+	}
+	if math.IsInf(d.Sum, 0) {
+		return nil, fmt.Errorf("%w: distribution sum must be finite", ErrInvalidMetricVal)
+	}
+	lowest, highest := sorted[0], sorted[len(sorted)-1]
+	if lowest == highest {
+		d.Buckets = []Bucket{{UpperBound: highest, Count: d.Count}}
+	} else {
+		width := (highest - lowest) / sampleBuckets
+		d.Buckets = make([]Bucket, sampleBuckets)
+		for i := range d.Buckets {
+			d.Buckets[i].UpperBound = lowest + width*float64(i+1)
+		}
+		// Avoid rounding errors excluding the highest sample.
+		d.Buckets[sampleBuckets-1].UpperBound = highest
+		i := 0
+		for _, sample := range sorted {
+			for sample > d.Buckets[i].UpperBound {
+				i++
+			}
+			d.Buckets[i].Count++
+		}
+	}
+	d.Quantiles = make(map[string]float64, len(DistributionQuantiles))
+	for _, q := range DistributionQuantiles {
+		d.Quantiles[q.Name] = sampleQuantile(sorted, q.Quantile)
+	}
+	return d, nil
+}
+
+// sampleQuantile returns the q-quantile of the given sorted samples,
+// interpolating linearly between the closest samples.
+func sampleQuantile(sorted []float64, q float64) float64 {
+	rank := q * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	if lower+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lower] + (sorted[lower+1]-sorted[lower])*(rank-float64(lower))
+}
+
+// bucketQuantiles returns the DistributionQuantiles of the observations
+// counted in the given buckets.  The observations are assumed to be spread
+// evenly throughout each bucket, as Prometheus' histogram_quantile does.  The
+// lower bound of the first bucket is taken to be 0, unless its upper bound is
+// not positive, in which case its upper bound is used.  A quantile falling in
+// a bucket with an infinite upper bound is taken to be the upper bound of
+// the previous bucket.  A quantile that cannot be estimated is omitted.
+func bucketQuantiles(buckets []Bucket, count uint64) map[string]float64 {
+	quantiles := make(map[string]float64, len(DistributionQuantiles))
+	if count == 0 {
+		return quantiles
+	}
+	for _, q := range DistributionQuantiles {
+		rank := q.Quantile * float64(count)
+		var cumulative uint64
+		for i, b := range buckets {
+			previous := cumulative
+			cumulative += b.Count
+			if b.Count == 0 || float64(cumulative) < rank {
+				continue
+			}
+			if math.IsInf(b.UpperBound, 1) {
+				if i > 0 {
+					quantiles[q.Name] = buckets[i-1].UpperBound
+				}
+			} else if i == 0 && b.UpperBound <= 0 {
+				quantiles[q.Name] = b.UpperBound
+			} else {
+				var lowerBound float64
+				if i > 0 {
+					lowerBound = buckets[i-1].UpperBound
+				}
+				fraction := (rank - float64(previous)) / float64(b.Count)
+				quantiles[q.Name] = lowerBound + (b.UpperBound-lowerBound)*fraction
+			}
+			break
+		}
+	}
+	return quantiles
+}
+
+// String returns the JSON encoding of the distribution.  It is how a
+// distribution is stored as a metric's value, see DecodeDistribution.
+func (d *Distribution) String() string {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// DecodeDistribution decodes the value of a distribution metric previously
+// encoded by Distribution.String.
+func DecodeDistribution(value string) (*Distribution, error) {
+	d := &Distribution{}
+	if err := json.Unmarshal([]byte(value), d); err != nil {
+		return nil, fmt.Errorf("decoding distribution: %w", err)
+	}
+	return d, nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (d *Distribution) UnmarshalJSON(data []byte) error {
+	var stored struct {
+		Count   uint64  `json:"count"`
+		Sum     float64 `json:"sum"`
+		Buckets []struct {
+			UpperBound json.RawMessage `json:"le"`
+			Count      uint64          `json:"count"`
+		} `json:"buckets"`
+		Quantiles map[string]float64 `json:"quantiles"`
+	}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+	d.Count = stored.Count
+	d.Sum = stored.Sum
+	d.Quantiles = stored.Quantiles
+	d.Buckets = make([]Bucket, 0, len(stored.Buckets))
+	for _, b := range stored.Buckets {
+		upperBound, err := parseUpperBound(b.UpperBound)
+		if err != nil {
+			return err
+		}
+		d.Buckets = append(d.Buckets, Bucket{UpperBound: upperBound, Count: b.Count})
+	}
+	return nil
+}
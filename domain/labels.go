@@ -0,0 +1,148 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package domain
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Labels are optional key/value pairs reported with a metric.  They allow a
+// device to report several series for the same metric, e.g., one for each
+// network interface, rather than encoding the label into the metric's name.
+type Labels map[string]string
+
+// ErrInvalidLabels is returned if a metric's labels are not valid.
+var ErrInvalidLabels = fmt.Errorf("invalid labels")
+
+var labelNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// seriesKeySeparator separates a metric's name from its labels, and its
+// labels from each other, in a series key.
+const seriesKeySeparator = ";"
+
+// IsValidLabelName returns true if the given name is a valid label name.
+// Valid label names consist of ASCII letters, digits and underscores and do
+// not start with a digit.
+func IsValidLabelName(name string) bool {
+	return labelNameRegexp.MatchString(name)
+}
+
+// Validate returns an ErrInvalidLabels error if any of the label names are
+// not valid.
+func (l Labels) Validate() error {
+	for name := range l {
+		if !IsValidLabelName(name) {
+			return fmt.Errorf("%w: %q is not a valid label name", ErrInvalidLabels, name)
+		}
+	}
+	return nil
+}
+
+// Names returns the label names sorted alphabetically.
+func (l Labels) Names() []string {
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// String returns the canonical representation of the labels.  Labels are
+// sorted by name and their values escaped so that the representation is safe
+// for use in a file name.
+//
+//	direction=rx;iface=eth0
+func (l Labels) String() string {
+	pairs := make([]string, 0, len(l))
+	for _, name := range l.Names() {
+		pairs = append(pairs, name+"="+url.PathEscape(l[name]))
+	}
+	return strings.Join(pairs, seriesKeySeparator)
+}
+
+// Matches returns true if the labels have all of the given label values.
+// Empty labels match any labels.
+func (l Labels) Matches(filter Labels) bool {
+	for name, value := range filter {
+		if v, ok := l[name]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Subset returns labels containing only the given label names.  Label names
+// that are not present are included with an empty value.
+func (l Labels) Subset(names []string) Labels {
+	subset := make(Labels, len(names))
+	for _, name := range names {
+		subset[name] = l[name]
+	}
+	return subset
+}
+
+// SeriesKey returns the key identifying a single series of the given metric.
+// A metric with no labels has a single series keyed by its name.  Otherwise,
+// the key is the metric name followed by the labels' canonical
+// representation.
+//
+//	net.bytes;direction=rx;iface=eth0
+func SeriesKey(name string, labels Labels) MetricName {
+	if len(labels) == 0 {
+		return MetricName(name)
+	}
+	return MetricName(name + seriesKeySeparator + labels.String())
+}
+
+// ParseSeriesKey returns the metric name and labels for the given series key.
+// It is the inverse of SeriesKey.  A key that does not contain valid labels
+// is considered to be a metric name with no labels.
+func ParseSeriesKey(key MetricName) (string, Labels) {
+	parts := strings.Split(string(key), seriesKeySeparator)
+	if len(parts) == 1 {
+		return string(key), nil
+	}
+	labels := make(Labels, len(parts)-1)
+	for _, pair := range parts[1:] {
+		name, escaped, found := strings.Cut(pair, "=")
+		if !found || !IsValidLabelName(name) {
+			return string(key), nil
+		}
+		value, err := url.PathUnescape(escaped)
+		if err != nil {
+			return string(key), nil
+		}
+		labels[name] = value
+	}
+	return parts[0], labels
+}
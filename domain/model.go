@@ -34,9 +34,12 @@
 package domain
 
 import (
+	"encoding/json"
 	"fmt"
 	"math"
+	"math/big"
 	"reflect"
+	"strconv"
 	"time"
 )
 
@@ -53,10 +56,19 @@ type MetricSlope string
 
 // MetricType describes the data type of the metric.
 //
-// ENUM(string, int8, uint8, int16, uint16, int32, uint32, float, double).
+// MetricTypeBool: either true or false.
+// MetricTypeTimestamp: a time as the number of seconds since the unix epoch.
+// MetricTypeEnum: one of the states listed in the metric's definition.
+// MetricTypeDistribution: a distribution of observations, see Distribution.
+//
+// ENUM(string, int8, uint8, int16, uint16, int32, uint32, int64, uint64, float, double, bool, timestamp, enum, distribution).
 type MetricType string
 
-var NumericMetricTypes = []string{"int8", "uint8", "int16", "uint16", "int32", "uint32", "float", "double"}
+var NumericMetricTypes = []string{"int8", "uint8", "int16", "uint16", "int32", "uint32", "int64", "uint64", "float", "double"}
+
+// StateMetricTypes are the metric types whose historic record is the changes
+// in their value rather than a series of values.
+var StateMetricTypes = []string{"bool", "enum"}
 
 // HostId exists to document some function signatures.
 type HostId string
@@ -87,8 +99,8 @@ type PendingHost struct {
 	DSM DSM
 	// The time at which metrics were most recently reported for this host.
 	Reported time.Time
-	// A map from metric name to the most recently reported metric with that
-	// name.
+	// A map from metric series key to the most recently reported metric for
+	// that series.  See SeriesKey.
 	Metrics map[MetricName]PendingMetric
 }
 
@@ -105,15 +117,33 @@ type PendingMetric struct {
 	Reported      time.Time
 	TTL           time.Duration
 	Type          MetricType
+	Labels        Labels
 	LastProcessed *time.Time
+	// Backfill holds values reported for the metric with a timestamp earlier
+	// than Reported that have not yet been processed, ordered oldest first.
+	Backfill []PendingValue
+}
+
+// SeriesKey returns the key identifying the metric's series.  See SeriesKey.
+func (m PendingMetric) SeriesKey() MetricName {
+	return SeriesKey(m.Name, m.Labels)
+}
+
+// PendingValue is a single value of a PendingMetric and the time it was
+// reported for.
+type PendingValue struct {
+	Value    string
+	Reported time.Time
 }
 
 // CurrentHost is the domain model representing a single host that has been
 // fully processed.
 type CurrentHost struct {
 	// The Concertim ID for the host.
-	Id      HostId
-	DSM     DSM
+	Id  HostId
+	DSM DSM
+	// A map from metric series key to the metric for that series.  See
+	// SeriesKey.
 	Metrics map[MetricName]CurrentMetric
 	// Time that metrics were last reported for the host.
 	Mtime *time.Time
@@ -129,12 +159,21 @@ type CurrentMetric struct {
 	Value    string
 	Nature   string
 	Dmax     int
+	Labels   Labels
+	// The slope of the metric.  It determines how the metric's historic
+	// values are recorded.
+	Slope MetricSlope
 	// The processing time for the metric.
 	Timestamp time.Time
 	// Whether the metric has expired.
 	Stale bool
 }
 
+// SeriesKey returns the key identifying the metric's series.  See SeriesKey.
+func (m CurrentMetric) SeriesKey() MetricName {
+	return SeriesKey(m.Name, m.Labels)
+}
+
 type UniqueMetric struct {
 	// XXX Min and max are calculated for all devices across all clusters
 	// across all projects.  This is consistent with the initial behaviour
@@ -147,18 +186,70 @@ type UniqueMetric struct {
 	Units    string
 }
 
+// MetricConflict records a metric that was reported with more than one
+// datatype or more than one set of units by different hosts in a single
+// processing run.
+type MetricConflict struct {
+	Name string
+	// A map from each datatype the metric was reported with to the hosts
+	// reporting it with that datatype.
+	Datatypes map[string][]HostId
+	// A map from each set of units the metric was reported with to the hosts
+	// reporting it with those units.
+	Units map[string][]HostId
+}
+
+// Conflicting returns true if the metric was reported with more than one
+// datatype or more than one set of units.
+func (c MetricConflict) Conflicting() bool {
+	return len(c.Datatypes) > 1 || len(c.Units) > 1
+}
+
 // HistoricHost is the domain model representing a single host loaded with its
 // historic metric values.
 type HistoricHost struct {
 	// The Concertim ID for the host.
-	Id      HostId
-	DSM     DSM
+	Id  HostId
+	DSM DSM
+	// A map from metric series key to the historic values for that series.
+	// See SeriesKey.
 	Metrics map[MetricName][]*HistoricMetric
 }
 
 type HistoricMetric struct {
 	Value     float64
 	Timestamp int64
+	// The consolidated values of a distribution metric.  Nil for other
+	// metrics.  Value is the mean of the distribution's observations.
+	Distribution *HistoricDistribution
+}
+
+// HistoricDistribution is the historic value of a distribution metric.  Any
+// of its values can be NaN if unknown.
+type HistoricDistribution struct {
+	// The number of observations.
+	Count float64
+	// The sum of the observations.
+	Sum float64
+	// A map from the name of each of the DistributionQuantiles to its value.
+	Quantiles map[string]float64
+}
+
+// HistoricHostStates is the domain model representing a single host loaded
+// with the historic state changes of a state metric.  See StateMetricTypes.
+type HistoricHostStates struct {
+	// The Concertim ID for the host.
+	Id  HostId
+	DSM DSM
+	// A map from metric series key to the state changes for that series.
+	// See SeriesKey.
+	Metrics map[MetricName][]*StateChange
+}
+
+// StateChange records that a state metric entered a state at a time.
+type StateChange struct {
+	State     string
+	Timestamp int64
 }
 
 // MetricSummary is a summary of a single metric across all hosts.  It includes
@@ -180,10 +271,62 @@ var ErrInvalidMetricVal = fmt.Errorf("not a valid metric value")
 
 // ParseMetricVal attempts to parse the given value according to the given
 // metric type.  If successful, the value will be returned as a string.
+//
+// The value can be a json.Number, in which case integer values are parsed
+// without loss of precision.  Integer values must be in range for the given
+// metric type.
+//
+// Timestamps can be given as the number of seconds since the unix epoch or as
+// an RFC 3339 string and are returned as the number of seconds since the unix
+// epoch.  Whether an enum value is one of the metric's states is checked
+// against its definition, see MetricDefinition.Check.  Distributions are
+// parsed by ParseDistribution and returned in the form decoded by
+// DecodeDistribution.
 func ParseMetricVal(val any, metricType MetricType) (string, error) {
-	value := reflect.ValueOf(val)
-	const epsilon = 1e-9 // Margin of error for converting floats to ints.
+	if signed, bitSize, ok := integerType(metricType); ok {
+		i, ok := parseInteger(val)
+		if ok && integerInRange(i, signed, bitSize) {
+			return i.String(), nil
+		}
+		return "", fmt.Errorf("%v is %w", val, ErrInvalidMetricVal)
+	}
+	switch metricType {
+	case MetricTypeTimestamp:
+		if s, ok := val.(string); ok {
+			t, err := time.Parse(time.RFC3339, s)
+			if err == nil {
+				return strconv.FormatInt(t.Unix(), 10), nil
+			}
+		} else if i, ok := parseInteger(val); ok && integerInRange(i, true, 64) {
+			return i.String(), nil
+		}
+		return "", fmt.Errorf("%v is %w", val, ErrInvalidMetricVal)
+	case MetricTypeBool:
+		if b, ok := val.(bool); ok {
+			return strconv.FormatBool(b), nil
+		}
+		return "", fmt.Errorf("%v is %w", val, ErrInvalidMetricVal)
+	case MetricTypeEnum:
+		if s, ok := val.(string); ok && s != "" {
+			return s, nil
+		}
+		return "", fmt.Errorf("%v is %w", val, ErrInvalidMetricVal)
+	case MetricTypeDistribution:
+		d, err := ParseDistribution(val)
+		if err != nil {
+			return "", err
+		}
+		return d.String(), nil
+	}
 
+	if n, ok := val.(json.Number); ok {
+		// A json.Number is only valid for the floating point types.
+		f, err := n.Float64()
+		if err == nil {
+			val = f
+		}
+	}
+	value := reflect.ValueOf(val)
 	switch metricType {
 	case MetricTypeString:
 		if value.Kind() == reflect.String {
@@ -193,27 +336,82 @@ func ParseMetricVal(val any, metricType MetricType) (string, error) {
 		if value.CanFloat() {
 			return fmt.Sprintf("%f", value.Float()), nil
 		}
-	case MetricTypeInt8, MetricTypeInt16, MetricTypeInt32:
-		if !value.CanFloat() {
-			break
-		}
-		intPart, frac := math.Modf(math.Abs(value.Float()))
-		if math.Abs(frac) < epsilon {
-			return fmt.Sprintf("%d", int(intPart)), nil
+	default:
+		return "", fmt.Errorf("%s is %w", metricType, ErrInvalidMetricType)
+
+	}
+	return "", fmt.Errorf("%v is %w", val, ErrInvalidMetricVal)
+}
+
+// integerType returns whether the given metric type is a signed integer type
+// and its size in bits.  ok is false if it is not an integer type.
+func integerType(metricType MetricType) (signed bool, bitSize int, ok bool) {
+	switch metricType {
+	case MetricTypeInt8:
+		return true, 8, true
+	case MetricTypeInt16:
+		return true, 16, true
+	case MetricTypeInt32:
+		return true, 32, true
+	case MetricTypeInt64:
+		return true, 64, true
+	case MetricTypeUint8:
+		return false, 8, true
+	case MetricTypeUint16:
+		return false, 16, true
+	case MetricTypeUint32:
+		return false, 32, true
+	case MetricTypeUint64:
+		return false, 64, true
+	}
+	return false, 0, false
+}
+
+// parseInteger returns the given value as an integer if it is a whole number.
+// Floating point values within a small margin of error of a whole number are
+// rounded to it.
+func parseInteger(val any) (*big.Int, bool) {
+	const epsilon = 1e-9 // Margin of error for converting floats to ints.
+
+	if n, ok := val.(json.Number); ok {
+		r, ok := new(big.Rat).SetString(n.String())
+		if !ok || !r.IsInt() {
+			return nil, false
 		}
-	case MetricTypeUint8, MetricTypeUint16, MetricTypeUint32:
-		if !value.CanFloat() || math.Signbit(value.Float()) {
-			break
+		return r.Num(), true
+	}
+	value := reflect.ValueOf(val)
+	switch {
+	case value.CanInt():
+		return big.NewInt(value.Int()), true
+	case value.CanUint():
+		return new(big.Int).SetUint64(value.Uint()), true
+	case value.CanFloat():
+		f := value.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, false
 		}
-		intPart, frac := math.Modf(math.Abs(value.Float()))
-		if math.Abs(frac) < epsilon {
-			return fmt.Sprintf("%d", int(intPart)), nil
+		rounded := math.Round(f)
+		if math.Abs(f-rounded) >= epsilon {
+			return nil, false
 		}
-	default:
-		return "", fmt.Errorf("%s is %w", metricType, ErrInvalidMetricType)
+		i, _ := big.NewFloat(rounded).Int(nil)
+		return i, true
+	}
+	return nil, false
+}
 
+// integerInRange returns whether i can be represented by a signed or unsigned
+// integer of the given size.
+func integerInRange(i *big.Int, signed bool, bitSize int) bool {
+	one := big.NewInt(1)
+	if signed {
+		max := new(big.Int).Lsh(one, uint(bitSize-1))
+		min := new(big.Int).Neg(max)
+		return i.Cmp(min) >= 0 && i.Cmp(max) < 0
 	}
-	return "", fmt.Errorf("%s is %w", val, ErrInvalidMetricVal)
+	max := new(big.Int).Lsh(one, uint(bitSize))
+	return i.Sign() >= 0 && i.Cmp(max) < 0
 }
 
 // HistoricMetricDuration specifies a duration and resolution for
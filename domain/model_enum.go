@@ -164,10 +164,22 @@ const (
 	MetricTypeInt32 MetricType = "int32"
 	// MetricTypeUint32 is a MetricType of type uint32.
 	MetricTypeUint32 MetricType = "uint32"
+	// MetricTypeInt64 is a MetricType of type int64.
+	MetricTypeInt64 MetricType = "int64"
+	// MetricTypeUint64 is a MetricType of type uint64.
+	MetricTypeUint64 MetricType = "uint64"
 	// MetricTypeFloat is a MetricType of type float.
 	MetricTypeFloat MetricType = "float"
 	// MetricTypeDouble is a MetricType of type double.
 	MetricTypeDouble MetricType = "double"
+	// MetricTypeBool is a MetricType of type bool.
+	MetricTypeBool MetricType = "bool"
+	// MetricTypeTimestamp is a MetricType of type timestamp.
+	MetricTypeTimestamp MetricType = "timestamp"
+	// MetricTypeEnum is a MetricType of type enum.
+	MetricTypeEnum MetricType = "enum"
+	// MetricTypeDistribution is a MetricType of type distribution.
+	MetricTypeDistribution MetricType = "distribution"
 )
 
 var ErrInvalidMetricType = fmt.Errorf("not a valid MetricType, try [%s]", strings.Join(_MetricTypeNames, ", "))
@@ -180,8 +192,14 @@ var _MetricTypeNames = []string{
 	string(MetricTypeUint16),
 	string(MetricTypeInt32),
 	string(MetricTypeUint32),
+	string(MetricTypeInt64),
+	string(MetricTypeUint64),
 	string(MetricTypeFloat),
 	string(MetricTypeDouble),
+	string(MetricTypeBool),
+	string(MetricTypeTimestamp),
+	string(MetricTypeEnum),
+	string(MetricTypeDistribution),
 }
 
 // MetricTypeNames returns a list of possible string values of MetricType.
@@ -204,15 +222,21 @@ func (x MetricType) IsValid() bool {
 }
 
 var _MetricTypeValue = map[string]MetricType{
-	"string": MetricTypeString,
-	"int8":   MetricTypeInt8,
-	"uint8":  MetricTypeUint8,
-	"int16":  MetricTypeInt16,
-	"uint16": MetricTypeUint16,
-	"int32":  MetricTypeInt32,
-	"uint32": MetricTypeUint32,
-	"float":  MetricTypeFloat,
-	"double": MetricTypeDouble,
+	"string":       MetricTypeString,
+	"int8":         MetricTypeInt8,
+	"uint8":        MetricTypeUint8,
+	"int16":        MetricTypeInt16,
+	"uint16":       MetricTypeUint16,
+	"int32":        MetricTypeInt32,
+	"uint32":       MetricTypeUint32,
+	"int64":        MetricTypeInt64,
+	"uint64":       MetricTypeUint64,
+	"float":        MetricTypeFloat,
+	"double":       MetricTypeDouble,
+	"bool":         MetricTypeBool,
+	"timestamp":    MetricTypeTimestamp,
+	"enum":         MetricTypeEnum,
+	"distribution": MetricTypeDistribution,
 }
 
 // ParseMetricType attempts to convert a string to a MetricType.
@@ -0,0 +1,165 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidMetricName is the error reported when a metric name does not
+// conform to the naming policy.
+var ErrInvalidMetricName = errors.New("Invalid metric name")
+
+// ErrReservedMetricName is the error reported when a metric name has a
+// reserved prefix that the reporter is not permitted to use.
+var ErrReservedMetricName = errors.New("Reserved metric name")
+
+// ValidateMetricName returns an ErrInvalidMetricName error if the given metric
+// name is empty or cannot be safely used as part of a file name or a series
+// key.  Unlike the naming policy, this check is always made regardless of
+// configuration as the metric name is used to name the metric's RRD file.
+func ValidateMetricName(name string) error {
+	if name == "" {
+		return fmt.Errorf("%w: name is empty", ErrInvalidMetricName)
+	}
+	if strings.Contains(name, "/") || strings.Contains(name, "..") {
+		return fmt.Errorf("%w: %q contains a path separator or %q", ErrInvalidMetricName, name, "..")
+	}
+	// A name containing the series key's separators could have the same
+	// series key as a metric with labels.
+	if strings.ContainsAny(name, seriesKeySeparator+"=") {
+		return fmt.Errorf("%w: %q contains %q or %q", ErrInvalidMetricName, name, seriesKeySeparator, "=")
+	}
+	if strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return fmt.Errorf("%w: %q contains control characters", ErrInvalidMetricName, name)
+	}
+	return nil
+}
+
+// ReservedPrefix is a metric name prefix that can only be used by the given
+// subjects.
+type ReservedPrefix struct {
+	Prefix   string
+	Subjects []string
+}
+
+// NamingPolicyOptions are the options for creating a NamingPolicy.
+type NamingPolicyOptions struct {
+	// AllowedCharacters is the body of a regular expression character
+	// class, e.g., `a-zA-Z0-9._-`.  If empty, any character is allowed.
+	AllowedCharacters string
+	// MaxLength is the maximum length of a metric name in bytes.  If zero,
+	// there is no maximum.
+	MaxLength int
+	// ReservedPrefixes are the metric name prefixes that only certain
+	// subjects may use.
+	ReservedPrefixes []ReservedPrefix
+	// Lowercase converts metric names to lowercase.
+	Lowercase bool
+	// Replacement, if not empty, replaces each run of characters that are not
+	// allowed.  If empty, metric names with such characters are rejected.
+	Replacement string
+}
+
+// NamingPolicy normalises metric names and checks that they conform to the
+// configured rules.
+type NamingPolicy struct {
+	disallowed  *regexp.Regexp
+	lowercase   bool
+	maxLength   int
+	replacement string
+	reserved    []ReservedPrefix
+}
+
+// NewNamingPolicy returns a new *NamingPolicy for the given options.
+func NewNamingPolicy(opts NamingPolicyOptions) (*NamingPolicy, error) {
+	policy := &NamingPolicy{
+		lowercase:   opts.Lowercase,
+		maxLength:   opts.MaxLength,
+		replacement: opts.Replacement,
+		reserved:    opts.ReservedPrefixes,
+	}
+	if opts.AllowedCharacters != "" {
+		disallowed, err := regexp.Compile(fmt.Sprintf("[^%s]+", opts.AllowedCharacters))
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed characters %q: %w", opts.AllowedCharacters, err)
+		}
+		if disallowed.MatchString(opts.Replacement) {
+			return nil, fmt.Errorf("replacement %q contains characters that are not allowed", opts.Replacement)
+		}
+		policy.disallowed = disallowed
+	}
+	return policy, nil
+}
+
+// Normalise returns the given metric name normalised according to the
+// policy.
+func (p *NamingPolicy) Normalise(name string) string {
+	if p.lowercase {
+		name = strings.ToLower(name)
+	}
+	if p.disallowed != nil && p.replacement != "" {
+		name = p.disallowed.ReplaceAllLiteralString(name, p.replacement)
+	}
+	return name
+}
+
+// Validate returns an ErrInvalidMetricName error if the given, already
+// normalised, metric name does not conform to the policy.  Reserved prefixes
+// are not checked.
+func (p *NamingPolicy) Validate(name string) error {
+	if p.maxLength > 0 && len(name) > p.maxLength {
+		return fmt.Errorf("%w: %q is longer than %d characters", ErrInvalidMetricName, name, p.maxLength)
+	}
+	if p.disallowed != nil {
+		if invalid := p.disallowed.FindString(name); invalid != "" {
+			return fmt.Errorf("%w: %q contains characters that are not allowed: %q", ErrInvalidMetricName, name, invalid)
+		}
+	}
+	return nil
+}
+
+// Check returns an error if the given, already normalised, metric name does
+// not conform to the policy or if it has a reserved prefix that the given
+// subject may not use.  An empty subject may not use any reserved prefix.
+func (p *NamingPolicy) Check(name string, subject string) error {
+	if err := p.Validate(name); err != nil {
+		return err
+	}
+	for _, reserved := range p.reserved {
+		if strings.HasPrefix(name, reserved.Prefix) && (subject == "" || !slices.Contains(reserved.Subjects, subject)) {
+			return fmt.Errorf("%w: the prefix %q is reserved", ErrReservedMetricName, reserved.Prefix)
+		}
+	}
+	return nil
+}
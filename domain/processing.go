@@ -110,18 +110,21 @@ func (p *Processor) Process() {
 				stats.numStaleMetrics++
 				continue
 			}
-			err := p.pendingRepo.UpdateLastProcessed(pendingHost.Id, MetricName(pendingMetric.Name), metric.Timestamp)
+			err := p.pendingRepo.UpdateLastProcessed(pendingHost.Id, pendingMetric.SeriesKey(), metric.Timestamp)
 			if err != nil {
 				p.logger.Warn().Err(err).Msg("updating metric last processed timestamp")
 			}
 			p.currentRepo.AddMetric(&host, &metric)
 			if slices.Contains(NumericMetricTypes, metric.Datatype) {
-				if err := p.historicRepo.UpdateMetric(&host, &metric); err != nil {
-					p.logger.Warn().Err(err).Msg("updating historic repo")
-				}
+				p.updateHistoricMetric(&host, pendingMetric, metric)
 				if err = summaries.AddMetric(metric); err != nil {
 					p.logger.Warn().Err(err).Msg("consolidating metric")
 				}
+			} else if metric.Datatype == MetricTypeDistribution.String() {
+				// Distributions are not summarised across hosts.
+				p.updateHistoricMetric(&host, pendingMetric, metric)
+			} else if slices.Contains(StateMetricTypes, metric.Datatype) {
+				p.recordStateChanges(&host, pendingMetric, metric)
 			}
 		}
 		p.currentRepo.AddHost(&host)
@@ -139,9 +142,26 @@ func (p *Processor) Process() {
 	if err == nil {
 		stats.numUniqueMetrics = len(um)
 	}
+	conflicts, err := p.currentRepo.GetMetricConflicts()
+	if err == nil {
+		stats.numConflictingMetrics = len(conflicts)
+		logMetricConflicts(p.logger, conflicts)
+	}
 	logProcessResults(p.logger, stats, time.Since(start))
 }
 
+// logMetricConflicts logs a warning for each metric reported with
+// conflicting datatypes or units.
+func logMetricConflicts(logger zerolog.Logger, conflicts []*MetricConflict) {
+	for _, conflict := range conflicts {
+		logger.Warn().
+			Str("metric", conflict.Name).
+			Any("datatypes", conflict.Datatypes).
+			Any("units", conflict.Units).
+			Msg("metric reported with conflicting datatypes or units")
+	}
+}
+
 func logProcessResults(logger zerolog.Logger, stats processLogStats, duration time.Duration) {
 	logger.Info().
 		Dur("duration", duration).
@@ -149,16 +169,18 @@ func logProcessResults(logger zerolog.Logger, stats processLogStats, duration ti
 		Int("metrics", stats.numMetrics).
 		Int("unique metrics", stats.numUniqueMetrics).
 		Int("stale metrics", stats.numStaleMetrics).
+		Int("conflicting metrics", stats.numConflictingMetrics).
 		Msg("completed")
 }
 
 // processLogStats contains information useful for logging the results of the
 // processing run.
 type processLogStats struct {
-	numHosts         int
-	numMetrics       int
-	numStaleMetrics  int
-	numUniqueMetrics int
+	numHosts              int
+	numMetrics            int
+	numStaleMetrics       int
+	numUniqueMetrics      int
+	numConflictingMetrics int
 }
 
 func (p *Processor) currentMetricFromPendingMetric(src PendingMetric, now time.Time) CurrentMetric {
@@ -172,7 +194,7 @@ func (p *Processor) currentMetricFromPendingMetric(src PendingMetric, now time.T
 		stale = src.LastProcessed != nil && expirationTime.Before(now)
 	}
 	nature := "volatile"
-	if src.Type == "string" || src.Type == "timestamp" {
+	if src.Type == "string" || src.Type == "timestamp" || src.Type == "enum" {
 		nature = "string_and_time"
 	} else if src.Slope == "zero" {
 		nature = "constant"
@@ -209,8 +231,10 @@ func (p *Processor) currentMetricFromPendingMetric(src PendingMetric, now time.T
 	}
 
 	dst.Name = src.Name
+	dst.Labels = src.Labels
 	dst.Datatype = src.Type.String()
 	dst.Units = src.Units
+	dst.Slope = src.Slope
 	dst.Value = src.Value
 	dst.Nature = nature
 	dst.Timestamp = timestamp
@@ -218,6 +242,92 @@ func (p *Processor) currentMetricFromPendingMetric(src PendingMetric, now time.T
 	return dst
 }
 
+// updateHistoricMetric updates the historic repo with the pending metric's
+// backfill values and then with metric, the metric's current value.
+func (p *Processor) updateHistoricMetric(host *CurrentHost, src PendingMetric, metric CurrentMetric) {
+	p.backfillHistoricMetric(host, src, metric)
+	if err := p.historicRepo.UpdateMetric(host, &metric); err != nil {
+		p.logger.Warn().Err(err).
+			Str("host", host.DSM.HostName).
+			Str("metric", metric.Name).
+			Int64("timestamp", metric.Timestamp.Unix()).
+			Msg("updating historic repo")
+	}
+}
+
+// backfillHistoricMetric updates the historic repo with the pending metric's
+// backfill values.  It is called before the historic repo is updated with
+// metric, the metric's current value.
+//
+// Only backfill values reported more than a step before the current value's
+// timestamp are recorded.  Values within a step of the current value would be
+// consolidated with it by the historic repo anyway.  Of the remaining values,
+// only the most recent for each step is recorded.
+func (p *Processor) backfillHistoricMetric(host *CurrentHost, src PendingMetric, metric CurrentMetric) {
+	for _, value := range p.backfillValues(src, metric.Timestamp) {
+		backfill := metric
+		backfill.Value = value.Value
+		backfill.Timestamp = value.Reported
+		if err := p.historicRepo.UpdateMetric(host, &backfill); err != nil {
+			p.logger.Warn().Err(err).
+				Str("host", host.DSM.HostName).
+				Str("metric", metric.Name).
+				Int64("timestamp", backfill.Timestamp.Unix()).
+				Msg("backfilling historic repo")
+		}
+	}
+}
+
+// recordStateChanges updates the historic repo with the state metric's
+// backfill values and its current value.  The historic repo only records
+// changes of state, so, unlike backfillHistoricMetric, every unprocessed
+// backfill value is given to it.
+func (p *Processor) recordStateChanges(host *CurrentHost, src PendingMetric, metric CurrentMetric) {
+	states := make([]CurrentMetric, 0, len(src.Backfill)+1)
+	for _, value := range src.Backfill {
+		if !value.Reported.Before(metric.Timestamp) {
+			break
+		}
+		if src.LastProcessed != nil && !value.Reported.After(*src.LastProcessed) {
+			continue
+		}
+		backfill := metric
+		backfill.Value = value.Value
+		backfill.Timestamp = value.Reported
+		states = append(states, backfill)
+	}
+	states = append(states, metric)
+	for i := range states {
+		if err := p.historicRepo.UpdateState(host, &states[i]); err != nil {
+			p.logger.Warn().Err(err).
+				Str("host", host.DSM.HostName).
+				Str("metric", metric.Name).
+				Int64("timestamp", states[i].Timestamp.Unix()).
+				Msg("recording state change")
+		}
+	}
+}
+
+func (p *Processor) backfillValues(src PendingMetric, timestamp time.Time) []PendingValue {
+	cutoff := timestamp.Add(-p.step)
+	values := make([]PendingValue, 0, len(src.Backfill))
+	for _, v := range src.Backfill {
+		if !v.Reported.Before(cutoff) {
+			break
+		}
+		if src.LastProcessed != nil && !v.Reported.After(*src.LastProcessed) {
+			continue
+		}
+		last := len(values) - 1
+		if last >= 0 && values[last].Reported.Truncate(p.step).Equal(v.Reported.Truncate(p.step)) {
+			values[last] = v
+			continue
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
 func currentHostFromPendingHost(src PendingHost) CurrentHost {
 	var dst CurrentHost
 	dst.Id = src.Id
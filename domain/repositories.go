@@ -39,6 +39,15 @@ var ErrWaitingOnProcessingRun = errors.New("Waiting on metric processing run")
 var ErrHostNotFound = errors.New("Host not found")
 var ErrMetricNotFound = errors.New("Metric not found")
 
+// ErrOutOfOrderUpdate is the error reported when a metric value is reported,
+// or recorded, with a timestamp that is not after that of a previously
+// recorded value.
+var ErrOutOfOrderUpdate = errors.New("Out of order update")
+
+// ErrTooManyMetricNames is the error reported when a host reports a new
+// metric name having already reported the maximum number of metric names.
+var ErrTooManyMetricNames = errors.New("Too many metric names")
+
 // PendingRepository is the interface for storing reported metrics that have
 // not yet been processed.  Metrics in this repository are processed
 // periodically and once processed become the current metrics.
@@ -55,6 +64,15 @@ type PendingRepository interface {
 	// returned.
 	PutMetric(PendingHost, PendingMetric) error
 
+	// MergeMetric adds a metric to the repository for the given Host as a
+	// single operation.  If the Host has not been added it is added,
+	// otherwise its reported time is updated.
+	//
+	// merge is called, with the repository locked, with the Host as stored
+	// and returns the Metric to store.  It must not call the repository.
+	// If merge returns an error, the repository is not changed.
+	MergeMetric(host PendingHost, merge func(stored PendingHost) (PendingMetric, error)) error
+
 	// GetAll returns a slice of all Hosts added to the repository, populated
 	// with all of their Metrics.
 	GetAll() []PendingHost
@@ -62,8 +80,23 @@ type PendingRepository interface {
 	// GetHost returns the host identified by HostId if present.
 	GetHost(HostId) (PendingHost, bool)
 
-	// UpdateLastProcessed updates the metric's LastProcessed field.
+	// UpdateLastProcessed updates the metric's LastProcessed field and
+	// discards any backfill values reported at or before that time.  The
+	// metric is identified by its series key.
 	UpdateLastProcessed(HostId, MetricName, time.Time) error
+
+	// DeleteMetric removes the metric, identified by its series key, from
+	// the given host.
+	DeleteMetric(HostId, MetricName) error
+
+	// DeleteMatchingMetrics removes the metrics of the given host for which
+	// match returns true as a single operation and returns their series
+	// keys.  match is called with the repository locked and must not call
+	// the repository.
+	DeleteMatchingMetrics(hostId HostId, match func(PendingMetric) bool) ([]MetricName, error)
+
+	// DeleteHost removes the host and its metrics from the repository.
+	DeleteHost(HostId) error
 }
 
 // DataSourceMapRepository is the interface for looking up a device's data
@@ -78,6 +111,10 @@ type DataSourceMapRepository interface {
 	// GetHostId returns the host id for the given data source map.
 	GetHostId(dsm DSM) (HostId, bool)
 
+	// GetHostIdForHostName returns the host id for the given host name.  The
+	// host is looked up in the configured grid and cluster.
+	GetHostIdForHostName(hostName string) (HostId, bool)
+
 	// Update updates the state of the repository.
 	Update(map[HostId]DSM, map[DSM]HostId) error
 }
@@ -94,6 +131,14 @@ type DataSourceMapRepoUpdater interface {
 	UpdateNow()
 }
 
+// DataSourceMapStatus is the interface for checking whether the
+// DataSourceMapRepository is up to date.
+type DataSourceMapStatus interface {
+	// Synced reports whether the most recent update of the repository
+	// succeeded and retrieved at least one host.
+	Synced() bool
+}
+
 // CurrentRepository is the interface for storing the most recently processed
 // metrics.
 type CurrentRepository interface {
@@ -101,12 +146,18 @@ type CurrentRepository interface {
 	// last processing run.  The uniqueness of a metric is determined by
 	// its name.
 	GetUniqueMetrics() ([]*UniqueMetric, error)
+	// GetMetricConflicts returns the metrics that were reported with
+	// conflicting datatypes or units in the last processing run.
+	GetMetricConflicts() ([]*MetricConflict, error)
 	// GetMetricsForHost returns the metrics reported by the given host in the
 	// most recent processing run.
 	GetMetricsForHost(hostId HostId) ([]*CurrentMetric, error)
 	// HostsWithMetric returns a slice of CurrentHosts that had the given
-	// metric in the last processing run.
+	// metric, for any labels, in the last processing run.
 	HostsWithMetric(metricName MetricName) ([]*CurrentHost, error)
+	// GetHosts returns a slice of all CurrentHosts processed in the last
+	// processing run.  Each host contains its current metrics.
+	GetHosts() ([]*CurrentHost, error)
 	// Begin records the start of a processing run.
 	Begin() error
 	// Commit commits the results of a processing run.
@@ -115,21 +166,31 @@ type CurrentRepository interface {
 	AddHost(host *CurrentHost)
 	// AddMetric records the presence of a metric in the current processing run.
 	AddMetric(host *CurrentHost, metric *CurrentMetric)
+	// RemoveHost removes the host and its metrics from the results of the
+	// last processing run.
+	RemoveHost(hostId HostId) error
+	// RestoredAt returns true if the results of the last processing run were
+	// restored from a previous instance of the daemon rather than processed
+	// by this one, along with the time they were committed.
+	RestoredAt() (time.Time, bool)
 }
 
 // HistoricRepository is the interface for storing and retrieving historic
 // metrics.
 type HistoricRepository interface {
 	// GetValuesForMetric returns all historic values for all hosts that
-	// reported the metric in the given duration.
-	GetValuesForMetric(metricName MetricName, lastConfig HistoricMetricDuration) ([]*HistoricHost, error)
+	// reported the metric in the given duration.  Only series whose labels
+	// match the given labels are included.
+	GetValuesForMetric(metricName MetricName, labels Labels, lastConfig HistoricMetricDuration) ([]*HistoricHost, error)
 	// GetValuesForHostAndMetric returns all historic values for the given host
-	// and metric between the given duration.
-	GetValuesForHostAndMetric(hostId HostId, metricName MetricName, lastConfig HistoricMetricDuration) (*HistoricHost, error)
+	// and metric between the given duration.  Only series whose labels match
+	// the given labels are included.
+	GetValuesForHostAndMetric(hostId HostId, metricName MetricName, labels Labels, lastConfig HistoricMetricDuration) (*HistoricHost, error)
 	// ListMetricNames lists all historic metric names for all hosts.  If a
 	// metric is reported for more than one host it will only be included once.
 	ListMetricNames() ([]string, error)
-	// ListHostMetricNames lists all historic metric names for the given hosts.
+	// ListHostMetricNames lists all historic metric series keys for the
+	// given hosts.
 	ListHostMetricNames(hostId HostId) ([]string, error)
 	// UpdateHostMetric updates the historic record for the given host and
 	// metric with the metric's current value.
@@ -137,6 +198,40 @@ type HistoricRepository interface {
 	// UpdateSummaryMetrics updates the historic record for the given
 	// summaries.
 	UpdateSummaryMetrics(MetricSummaries) error
+	// UpdateState records the given state metric's value as a state change
+	// for the given host, if it differs from the last recorded state.  See
+	// StateMetricTypes.
+	UpdateState(host *CurrentHost, metric *CurrentMetric) error
+	// GetStatesForHostAndMetric returns the state changes recorded for the
+	// given host and state metric between the given start and end times.
+	// The state in effect at the start time, if any, is included as the
+	// first state change.  Only series whose labels match the given labels
+	// are included.
+	GetStatesForHostAndMetric(hostId HostId, metricName MetricName, labels Labels, start, end time.Time) (*HistoricHostStates, error)
+	// RemoveHost deletes or archives the historic record of all metrics for
+	// the host with the given data source map.
+	RemoveHost(dsm DSM) error
+}
+
+// MetricDefinitionRepository is the interface for storing metric
+// definitions.
+type MetricDefinitionRepository interface {
+	// List returns all metric definitions sorted by name.
+	List() []MetricDefinition
+	// Get returns the metric definition with the given name or pattern.
+	Get(name string) (MetricDefinition, bool)
+	// Put adds the given metric definition, replacing any existing
+	// definition with the same name or pattern.
+	Put(MetricDefinition) error
+	// Delete removes the metric definition with the given name or pattern.
+	// If there is no such definition an ErrMetricDefinitionNotFound error is
+	// returned.
+	Delete(name string) error
+	// Match returns the metric definition that applies to the given metric
+	// name.  A definition for the exact name is preferred over a pattern.
+	// If several patterns match, the longest, and presumably most specific,
+	// is used.
+	Match(metricName string) (MetricDefinition, bool)
 }
 
 // MetricSummaries is the interface for calculating metric summaries.  The
@@ -0,0 +1,96 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ErrOutOfScope is the error reported when a write is outside of the scope
+// that the reporter is permitted to write to.
+var ErrOutOfScope = errors.New("Out of scope")
+
+// WriteScope restricts the devices and metric names that a reporter may write
+// to.  A nil field places no restriction.
+type WriteScope struct {
+	// DeviceIds are the devices that may be written to.
+	DeviceIds []HostId
+	// Clusters are the data source map clusters whose devices may be
+	// written to.  If both DeviceIds and Clusters are set, a device may be
+	// written to if it is allowed by either.
+	Clusters []string
+	// MetricPrefixes are the prefixes of the metric names that may be
+	// written.
+	MetricPrefixes []string
+}
+
+// Restricted returns true if the scope places any restriction on writes.
+func (s WriteScope) Restricted() bool {
+	return s.DeviceIds != nil || s.Clusters != nil || s.MetricPrefixes != nil
+}
+
+// CheckMetricName returns an ErrOutOfScope error if the given, already
+// normalised, metric name does not have one of the scope's prefixes.
+func (s WriteScope) CheckMetricName(name string) error {
+	if s.MetricPrefixes == nil {
+		return nil
+	}
+	for _, prefix := range s.MetricPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: metric name %q does not have a permitted prefix", ErrOutOfScope, name)
+}
+
+// CheckWriteScope returns an ErrOutOfScope error if the given scope does not
+// permit writes to the given host.  If the scope is restricted to clusters,
+// the host's data source map is looked up, updating the
+// DataSourceMapRepository if the host cannot be found.
+func (app *Application) CheckWriteScope(scope WriteScope, hostId HostId) error {
+	if scope.DeviceIds == nil && scope.Clusters == nil {
+		return nil
+	}
+	if slices.Contains(scope.DeviceIds, hostId) {
+		return nil
+	}
+	if len(scope.Clusters) > 0 {
+		dsm, ok := app.dsmRepo.GetDSM(hostId)
+		if !ok {
+			app.dsmUpdater.UpdateNow()
+			dsm, ok = app.dsmRepo.GetDSM(hostId)
+		}
+		if ok && slices.Contains(scope.Clusters, dsm.ClusterName) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: device %s", ErrOutOfScope, hostId)
+}
@@ -29,6 +29,7 @@ package domain
 
 import (
 	"fmt"
+	"math"
 	"reflect"
 	"strconv"
 
@@ -71,7 +72,7 @@ func (ms *metricSummaries) GetSummaries() map[MetricName]*MetricSummary {
 // Hoops are jumped through to handle the various data types.
 func addMetricValueToSum(summary *MetricSummary, metric CurrentMetric) error {
 	switch metric.Datatype {
-	case "int8", "int16", "int32":
+	case "int8", "int16", "int32", "int64":
 		i, err := strconv.ParseInt(metric.Value, 10, 64)
 		if err != nil {
 			return err
@@ -81,11 +82,19 @@ func addMetricValueToSum(summary *MetricSummary, metric CurrentMetric) error {
 		} else {
 			sumVal := reflect.ValueOf(summary.Sum)
 			if sumVal.CanInt() {
-				summary.Sum = sumVal.Int() + i
+				sum := sumVal.Int()
+				if (i > 0 && sum > math.MaxInt64-i) || (i < 0 && sum < math.MinInt64-i) {
+					// The sum no longer fits in an int64.
+					summary.Sum = float64(sum) + float64(i)
+				} else {
+					summary.Sum = sum + i
+				}
+			} else if sumVal.CanFloat() {
+				summary.Sum = sumVal.Float() + float64(i)
 			}
 		}
 		return nil
-	case "uint8", "uint16", "uint32":
+	case "uint8", "uint16", "uint32", "uint64":
 		i, err := strconv.ParseUint(metric.Value, 10, 64)
 		if err != nil {
 			return err
@@ -95,7 +104,15 @@ func addMetricValueToSum(summary *MetricSummary, metric CurrentMetric) error {
 		} else {
 			sumVal := reflect.ValueOf(summary.Sum)
 			if sumVal.CanUint() {
-				summary.Sum = sumVal.Uint() + i
+				sum := sumVal.Uint()
+				if sum > math.MaxUint64-i {
+					// The sum no longer fits in a uint64.
+					summary.Sum = float64(sum) + float64(i)
+				} else {
+					summary.Sum = sum + i
+				}
+			} else if sumVal.CanFloat() {
+				summary.Sum = sumVal.Float() + float64(i)
 			}
 		}
 		return nil
@@ -0,0 +1,64 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidTimestamp is used if a metric's timestamp is outside of the
+// configured limits.
+var ErrInvalidTimestamp = errors.New("invalid timestamp")
+
+// CheckReportedTime checks the time that a metric was reported, as given by
+// one of the metric ingestion protocols, and returns the time to record it
+// at.
+//
+// Timestamps more than maxSkew in the future or, if maxAge is not zero, more
+// than maxAge in the past result in an ErrInvalidTimestamp error.  Timestamps
+// in the future by no more than maxSkew are treated as now.  Recording values
+// in the future would cause the historic repository to reject the values
+// reported until then.
+func CheckReportedTime(reported time.Time, now time.Time, maxSkew time.Duration, maxAge time.Duration) (time.Time, error) {
+	if reported.After(now.Add(maxSkew)) {
+		return time.Time{}, fmt.Errorf(
+			"%w: %d is more than %s in the future", ErrInvalidTimestamp, reported.Unix(), maxSkew,
+		)
+	}
+	if maxAge > 0 && reported.Before(now.Add(-maxAge)) {
+		return time.Time{}, fmt.Errorf(
+			"%w: %d is more than %s in the past", ErrInvalidTimestamp, reported.Unix(), maxAge,
+		)
+	}
+	if reported.After(now) {
+		return now, nil
+	}
+	return reported, nil
+}
@@ -28,6 +28,9 @@
 package dsmRepository
 
 import (
+	"context"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/time/rate"
@@ -40,11 +43,15 @@ import (
 
 type Updater struct {
 	config    config.DSM
+	done      chan struct{}
 	limiter   rate.Sometimes
 	logger    zerolog.Logger
 	repo      domain.DataSourceMapRepository
 	retriever domain.DataSourceMapRetreiver
+	stopOnce  sync.Once
+	synced    atomic.Bool
 	ticker    *time.Ticker
+	wg        sync.WaitGroup
 }
 
 // New returns a new Updater.  It will be populated with assuming that the data
@@ -58,6 +65,7 @@ func NewUpdater(
 	logger = logger.With().Str("component", "dsm-updater").Logger()
 	u := &Updater{
 		config:    config,
+		done:      make(chan struct{}),
 		repo:      repo,
 		ticker:    time.NewTicker(config.Frequency),
 		limiter:   rate.Sometimes{First: 1, Interval: config.Throttle},
@@ -69,7 +77,9 @@ func NewUpdater(
 }
 
 func (u *Updater) RunPeriodicUpdateLoop() {
+	u.wg.Add(1)
 	go func() {
+		defer u.wg.Done()
 		u.logger.Debug().Dur("frequency", u.config.Frequency).Msg("Starting periodic retreival")
 		for {
 			u.limiter.Do(func() {
@@ -78,11 +88,36 @@ func (u *Updater) RunPeriodicUpdateLoop() {
 					u.logger.Warn().Err(err).Msg("periodic update failed")
 				}
 			})
-			<-u.ticker.C
+			select {
+			case <-u.ticker.C:
+			case <-u.done:
+				u.logger.Debug().Msg("Stopped periodic retreival")
+				return
+			}
 		}
 	}()
 }
 
+// Stop stops the periodic update loop and waits for any in-flight update to
+// complete or for the context to be done.
+func (u *Updater) Stop(ctx context.Context) error {
+	u.stopOnce.Do(func() {
+		u.ticker.Stop()
+		close(u.done)
+	})
+	finished := make(chan struct{})
+	go func() {
+		u.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (u *Updater) UpdateNow() {
 	u.limiter.Do(func() {
 		err := u.update()
@@ -96,14 +131,23 @@ func (u *Updater) UpdateNow() {
 // internal repository.
 //
 // The external source to use is configured when creating a new DSMRepo.
+// Synced reports whether the most recent update succeeded and retrieved at
+// least one host.
+func (u *Updater) Synced() bool {
+	return u.synced.Load()
+}
+
 func (u *Updater) update() error {
 	hostIdToDSM, dsmToHostId, err := u.retriever.GetDSM()
 	if err != nil {
+		u.synced.Store(false)
 		return errors.Wrap(err, "retrieving DSM")
 	}
 	err = u.repo.Update(hostIdToDSM, dsmToHostId)
 	if err != nil {
+		u.synced.Store(false)
 		return errors.Wrap(err, "updating DSM")
 	}
+	u.synced.Store(len(hostIdToDSM) > 0)
 	return nil
 }
@@ -0,0 +1,204 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+// Package ganglia provides a poller for ingesting metrics from Ganglia's gmond
+// agents.
+package ganglia
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/config"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/rs/zerolog"
+)
+
+// ErrPollerClosed is returned by Run after a call to Shutdown.
+var ErrPollerClosed = errors.New("ganglia: Poller closed")
+
+// Poller periodically polls the XML port of the configured gmond agents and
+// adds the metrics found to the pending repository.
+type Poller struct {
+	app    *domain.Application
+	config config.Ganglia
+	logger zerolog.Logger
+	once   sync.Once
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func NewPoller(logger zerolog.Logger, app *domain.Application, config config.Ganglia) *Poller {
+	return &Poller{
+		app:    app,
+		config: config,
+		logger: logger.With().Str("component", "ganglia").Logger(),
+		done:   make(chan struct{}),
+	}
+}
+
+// Run polls the configured gmond agents every configured interval.  It blocks
+// until Shutdown is called, after which it returns ErrPollerClosed.
+func (p *Poller) Run() error {
+	if p.config.Interval <= 0 {
+		return fmt.Errorf("ganglia: invalid interval %s", p.config.Interval)
+	}
+	p.wg.Add(1)
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.config.Interval)
+	defer ticker.Stop()
+	for {
+		p.PollAll()
+		select {
+		case <-ticker.C:
+		case <-p.done:
+			return ErrPollerClosed
+		}
+	}
+}
+
+// Shutdown stops the poller and waits for any in progress poll to complete or
+// for the context to be done.
+func (p *Poller) Shutdown(ctx context.Context) error {
+	p.once.Do(func() { close(p.done) })
+	finished := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// PollAll polls each of the configured gmond agents once.
+func (p *Poller) PollAll() {
+	for _, addr := range p.config.Addresses {
+		logger := p.logger.With().Str("address", addr).Logger()
+		count, err := p.Poll(addr)
+		if err != nil {
+			logger.Warn().Err(err).Msg("polling gmond")
+			continue
+		}
+		logger.Debug().Int("count", count).Msg("polled gmond")
+	}
+}
+
+// Poll reads gmond's XML output from the given address and adds the metrics
+// found to the pending repository.  The number of metrics added is returned.
+func (p *Poller) Poll(addr string) (int, error) {
+	conn, err := net.DialTimeout("tcp", addr, p.config.Timeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if p.config.Timeout > 0 {
+		if err := conn.SetReadDeadline(time.Now().Add(p.config.Timeout)); err != nil {
+			return 0, err
+		}
+	}
+	hosts, err := ParseXML(conn)
+	if err != nil {
+		return 0, err
+	}
+	return p.addHosts(hosts), nil
+}
+
+func (p *Poller) addHosts(hosts []Host) int {
+	count := 0
+	now := time.Now()
+	for _, host := range hosts {
+		dsm := domain.DSM{GridName: host.GridName, ClusterName: host.ClusterName, HostName: host.Name}
+		logger := p.logger.With().Stringer("dsm", dsm).Logger()
+		hostId, err := p.app.HostIdForDSM(dsm)
+		if err != nil {
+			logger.Debug().Err(err).Msg("looking up host")
+			continue
+		}
+		for _, m := range host.Metrics {
+			metric, err := PendingMetric(m, now)
+			if err != nil {
+				logger.Debug().Err(err).Str("metric", m.Name).Msg("converting metric")
+				continue
+			}
+			err = p.app.AddPendingMetric(metric, hostId, "")
+			if err != nil {
+				logger.Debug().Err(err).Str("metric", m.Name).Msg("adding metric")
+				continue
+			}
+			count++
+		}
+	}
+	return count
+}
+
+// PendingMetric converts the given gmond metric to a PendingMetric.  The
+// metric is considered to have been reported when it was polled and its TTL is
+// taken from DMAX.  A DMAX of zero results in a persistent metric.
+//
+// TN is not used to calculate the report time.  gmond continues to report a
+// metric's last value until DMAX expires, so doing so would result in the
+// same, already processed, report time being given on each poll.
+func PendingMetric(m Metric, now time.Time) (domain.PendingMetric, error) {
+	metricType, err := domain.ParseMetricType(m.Type)
+	if err != nil {
+		return domain.PendingMetric{}, err
+	}
+	slope, err := domain.ParseMetricSlope(m.Slope)
+	if err != nil {
+		// gmond reports `unspecified` for some metrics.
+		slope = domain.MetricSlopeBoth
+	}
+	var val any = m.Val
+	if metricType != domain.MetricTypeString {
+		val, err = strconv.ParseFloat(m.Val, 64)
+		if err != nil {
+			return domain.PendingMetric{}, fmt.Errorf("%q is %w", m.Val, domain.ErrInvalidMetricVal)
+		}
+	}
+	value, err := domain.ParseMetricVal(val, metricType)
+	if err != nil {
+		return domain.PendingMetric{}, err
+	}
+	return domain.PendingMetric{
+		Name:     m.Name,
+		Value:    value,
+		Units:    m.Units,
+		Slope:    slope,
+		Reported: now,
+		TTL:      time.Duration(m.DMAX) * time.Second,
+		Type:     metricType,
+	}, nil
+}
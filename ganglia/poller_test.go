@@ -0,0 +1,199 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package ganglia
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/config"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/inmem"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	consoleWriter := zerolog.ConsoleWriter{Out: os.Stderr}
+	log.Logger = zerolog.New(consoleWriter).With().Timestamp().Logger()
+}
+
+// newTestDSMRepo returns a data source map repository containing the host
+// comp10 in the cluster rack1.
+func newTestDSMRepo() *inmem.DSMRepo {
+	dsmConfig := config.DSM{GridName: DefaultGridName, ClusterName: "rack1"}
+	repo := inmem.NewDSMRepo(log.Logger, dsmConfig)
+	dsm := domain.DSM{GridName: DefaultGridName, ClusterName: "rack1", HostName: "comp10"}
+	repo.Update(map[domain.HostId]domain.DSM{"10": dsm}, map[domain.DSM]domain.HostId{dsm: "10"}) //nolint:errcheck
+	return repo
+}
+
+type fakeDSMUpdater struct{}
+
+func (fakeDSMUpdater) RunPeriodicUpdateLoop() {}
+
+func (fakeDSMUpdater) UpdateNow() {}
+
+// serveXML listens on a random port and writes the given XML to each
+// connection.
+func serveXML(t *testing.T, doc string) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			fmt.Fprint(conn, doc)
+			conn.Close()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func Test_PendingMetric(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		metric   Metric
+		expected domain.PendingMetric
+	}{
+		{
+			name:   "numeric metric",
+			metric: Metric{Name: "load_one", Val: "0.25", Type: "float", Units: " ", Slope: "both", TN: 5, TMAX: 70, DMAX: 0},
+			expected: domain.PendingMetric{
+				Name: "load_one", Value: "0.250000", Units: " ", Slope: domain.MetricSlopeBoth,
+				Reported: now, TTL: 0, Type: domain.MetricTypeFloat,
+			},
+		},
+		{
+			name:   "string metric",
+			metric: Metric{Name: "os_name", Val: "Linux", Type: "string", Slope: "zero", DMAX: 3600},
+			expected: domain.PendingMetric{
+				Name: "os_name", Value: "Linux", Slope: domain.MetricSlopeZero,
+				Reported: now, TTL: time.Hour, Type: domain.MetricTypeString,
+			},
+		},
+		{
+			name:   "timestamp metric",
+			metric: Metric{Name: "boottime", Val: "1696431225", Type: "timestamp", Units: "s", Slope: "zero", DMAX: 3600},
+			expected: domain.PendingMetric{
+				Name: "boottime", Value: "1696431225", Units: "s", Slope: domain.MetricSlopeZero,
+				Reported: now, TTL: time.Hour, Type: domain.MetricTypeTimestamp,
+			},
+		},
+		{
+			name:   "unspecified slope",
+			metric: Metric{Name: "cpu_num", Val: "8", Type: "uint16", Slope: "unspecified"},
+			expected: domain.PendingMetric{
+				Name: "cpu_num", Value: "8", Slope: domain.MetricSlopeBoth,
+				Reported: now, Type: domain.MetricTypeUint16,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metric, err := PendingMetric(tt.metric, now)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, metric)
+		})
+	}
+}
+
+func Test_PendingMetricErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		metric Metric
+	}{
+		{name: "unknown type", metric: Metric{Name: "m", Val: "1", Type: "complex"}},
+		{name: "invalid value", metric: Metric{Name: "m", Val: "high", Type: "uint32"}},
+		{name: "value out of range for type", metric: Metric{Name: "m", Val: "-1", Type: "uint32"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := PendingMetric(tt.metric, time.Now())
+			assert.Error(t, err)
+		})
+	}
+}
+
+func Test_PollAddsMetricsForKnownHosts(t *testing.T) {
+	// Setup
+	pendingRepo := inmem.NewPendingRepository(log.Logger)
+	app := domain.NewApp(pendingRepo, newTestDSMRepo(), fakeDSMUpdater{}, nil, nil, nil)
+	addr := serveXML(t, gmondXML)
+	unknownAddr := serveXML(t, gmetadXML)
+	poller := NewPoller(log.Logger, app, config.Ganglia{Interval: time.Minute, Timeout: time.Second})
+
+	// Action
+	count, err := poller.Poll(addr)
+	unknownCount, unknownErr := poller.Poll(unknownAddr)
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.NoError(t, unknownErr)
+	assert.Equal(t, 0, unknownCount)
+	host, ok := pendingRepo.GetHost("10")
+	assert.True(t, ok)
+	assert.Equal(t, "0.250000", host.Metrics["load_one"].Value)
+	assert.Equal(t, "Linux", host.Metrics["os_name"].Value)
+	assert.Len(t, pendingRepo.GetAll(), 1)
+}
+
+func Test_RunReturnsAfterShutdown(t *testing.T) {
+	// Setup
+	pendingRepo := inmem.NewPendingRepository(log.Logger)
+	app := domain.NewApp(pendingRepo, newTestDSMRepo(), fakeDSMUpdater{}, nil, nil, nil)
+	addr := serveXML(t, gmondXML)
+	poller := NewPoller(log.Logger, app, config.Ganglia{Addresses: []string{addr}, Interval: time.Hour, Timeout: time.Second})
+	ran := make(chan error, 1)
+	go func() { ran <- poller.Run() }()
+
+	// Action
+	assert.Eventually(t, func() bool {
+		_, ok := pendingRepo.GetHost("10")
+		return ok
+	}, time.Second, 10*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// Assertions
+	assert.NoError(t, poller.Shutdown(ctx))
+	assert.ErrorIs(t, <-ran, ErrPollerClosed)
+}
@@ -0,0 +1,162 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package ganglia
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultGridName is the grid name used for clusters reported outside of a
+// GRID element.  It matches the default grid name used by gmetad.
+const DefaultGridName = "unspecified"
+
+// Host is a host and its metrics parsed from gmond's XML output.
+type Host struct {
+	GridName    string
+	ClusterName string
+	Name        string
+	Metrics     []Metric
+}
+
+// Metric is a single metric parsed from gmond's XML output.
+type Metric struct {
+	Name  string `xml:"NAME,attr"`
+	Val   string `xml:"VAL,attr"`
+	Type  string `xml:"TYPE,attr"`
+	Units string `xml:"UNITS,attr"`
+	Slope string `xml:"SLOPE,attr"`
+	// TN is the number of seconds since the metric was last reported.
+	TN int `xml:"TN,attr"`
+	// TMAX is the maximum number of seconds between reports.
+	TMAX int `xml:"TMAX,attr"`
+	// DMAX is the number of seconds after which the metric is deleted.  Zero
+	// means it is never deleted.
+	DMAX int `xml:"DMAX,attr"`
+}
+
+type gangliaXML struct {
+	Grids    []gridXML    `xml:"GRID"`
+	Clusters []clusterXML `xml:"CLUSTER"`
+}
+
+type gridXML struct {
+	Name     string       `xml:"NAME,attr"`
+	Grids    []gridXML    `xml:"GRID"`
+	Clusters []clusterXML `xml:"CLUSTER"`
+}
+
+type clusterXML struct {
+	Name  string    `xml:"NAME,attr"`
+	Hosts []hostXML `xml:"HOST"`
+}
+
+type hostXML struct {
+	Name    string   `xml:"NAME,attr"`
+	Metrics []Metric `xml:"METRIC"`
+}
+
+// ParseXML parses the XML document output by gmond, or gmetad, and returns
+// the hosts found in it.
+func ParseXML(r io.Reader) ([]Host, error) {
+	var doc gangliaXML
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = charsetReader
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parsing ganglia XML: %w", err)
+	}
+	hosts := make([]Host, 0)
+	hosts = appendClusters(hosts, DefaultGridName, doc.Clusters)
+	for _, grid := range doc.Grids {
+		hosts = appendGrid(hosts, grid)
+	}
+	return hosts, nil
+}
+
+func appendGrid(hosts []Host, grid gridXML) []Host {
+	hosts = appendClusters(hosts, grid.Name, grid.Clusters)
+	for _, g := range grid.Grids {
+		hosts = appendGrid(hosts, g)
+	}
+	return hosts
+}
+
+func appendClusters(hosts []Host, gridName string, clusters []clusterXML) []Host {
+	for _, cluster := range clusters {
+		for _, host := range cluster.Hosts {
+			hosts = append(hosts, Host{
+				GridName:    gridName,
+				ClusterName: cluster.Name,
+				Name:        host.Name,
+				Metrics:     host.Metrics,
+			})
+		}
+	}
+	return hosts
+}
+
+// charsetReader supports the ISO-8859-1 encoding declared by gmond's XML
+// output.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1":
+		return &latin1Reader{r: bufio.NewReader(input)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported charset: %s", charset)
+	}
+}
+
+// latin1Reader converts ISO-8859-1 encoded input to UTF-8.
+type latin1Reader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+func (l *latin1Reader) Read(p []byte) (int, error) {
+	for len(l.buf) < len(p) {
+		if len(l.buf) > 0 && l.r.Buffered() == 0 {
+			// Avoid blocking on further input when some is ready.
+			break
+		}
+		b, err := l.r.ReadByte()
+		if err != nil {
+			if len(l.buf) > 0 {
+				break
+			}
+			return 0, err
+		}
+		l.buf = utf8.AppendRune(l.buf, rune(b))
+	}
+	n := copy(p, l.buf)
+	l.buf = l.buf[n:]
+	return n, nil
+}
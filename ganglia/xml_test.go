@@ -0,0 +1,101 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package ganglia
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const gmondXML = `<?xml version="1.0" encoding="ISO-8859-1" standalone="yes"?>
+<!DOCTYPE GANGLIA_XML [
+   <!ELEMENT GANGLIA_XML (GRID|CLUSTER|HOST)*>
+]>
+<GANGLIA_XML VERSION="3.7.2" SOURCE="gmond">
+<CLUSTER NAME="rack1" LOCALTIME="1696431225" OWNER="unspecified" LATLONG="unspecified" URL="unspecified">
+<HOST NAME="comp10" IP="10.0.0.10" REPORTED="1696431220" TN="5" TMAX="20" DMAX="0" LOCATION="unspecified" GMOND_STARTED="1696400000" TAGS="">
+<METRIC NAME="load_one" VAL="0.25" TYPE="float" UNITS=" " TN="5" TMAX="70" DMAX="0" SLOPE="both" SOURCE="gmond">
+<EXTRA_DATA>
+<EXTRA_ELEMENT NAME="GROUP" VAL="load"/>
+</EXTRA_DATA>
+</METRIC>
+<METRIC NAME="os_name" VAL="Linux" TYPE="string" UNITS="" TN="5" TMAX="1200" DMAX="0" SLOPE="zero" SOURCE="gmond"/>
+</HOST>
+</CLUSTER>
+</GANGLIA_XML>
+`
+
+const gmetadXML = `<?xml version="1.0" encoding="ISO-8859-1" standalone="yes"?>
+<GANGLIA_XML VERSION="3.7.2" SOURCE="gmetad">
+<GRID NAME="grid1" AUTHORITY="http://localhost/ganglia/" LOCALTIME="1696431225">
+<CLUSTER NAME="rack2">
+<HOST NAME="comp20">
+<METRIC NAME="cpu_num" VAL="8" TYPE="uint16" UNITS="CPUs" TN="5" TMAX="1200" DMAX="0" SLOPE="zero"/>
+</HOST>
+</CLUSTER>
+</GRID>
+</GANGLIA_XML>
+`
+
+func Test_ParseXMLFromGmond(t *testing.T) {
+	// Action
+	hosts, err := ParseXML(strings.NewReader(gmondXML))
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.Len(t, hosts, 1)
+	host := hosts[0]
+	assert.Equal(t, DefaultGridName, host.GridName)
+	assert.Equal(t, "rack1", host.ClusterName)
+	assert.Equal(t, "comp10", host.Name)
+	assert.Equal(t, []Metric{
+		{Name: "load_one", Val: "0.25", Type: "float", Units: " ", Slope: "both", TN: 5, TMAX: 70},
+		{Name: "os_name", Val: "Linux", Type: "string", Slope: "zero", TN: 5, TMAX: 1200},
+	}, host.Metrics)
+}
+
+func Test_ParseXMLFromGmetad(t *testing.T) {
+	// Action
+	hosts, err := ParseXML(strings.NewReader(gmetadXML))
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.Len(t, hosts, 1)
+	host := hosts[0]
+	assert.Equal(t, "grid1", host.GridName)
+	assert.Equal(t, "rack2", host.ClusterName)
+	assert.Equal(t, "comp20", host.Name)
+	assert.Len(t, host.Metrics, 1)
+}
+
+func Test_ParseXMLInvalid(t *testing.T) {
+	_, err := ParseXML(strings.NewReader("<GANGLIA_XML><CLUSTER>"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,97 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package graphite
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidLine is returned if a line cannot be parsed.
+var ErrInvalidLine = fmt.Errorf("invalid graphite line")
+
+// ErrInvalidPath is returned if the host name cannot be extracted from a
+// metric path.
+var ErrInvalidPath = fmt.Errorf("invalid graphite metric path")
+
+// Line is a single parsed line of the graphite plaintext protocol.
+type Line struct {
+	Path      string
+	Value     float64
+	Timestamp time.Time
+}
+
+// ParseLine parses a single line of the graphite plaintext protocol.  The
+// line has the format `<metric path> <metric value> <metric timestamp>`.
+//
+// Any tags given in the metric path, e.g., `disk.used;datacenter=dc1`, are
+// discarded.  If the timestamp is missing or is -1 the current time is used.
+func ParseLine(line string) (Line, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 2 && len(fields) != 3 {
+		return Line{}, fmt.Errorf("%w: expected 3 fields found %d: %q", ErrInvalidLine, len(fields), line)
+	}
+	path, _, _ := strings.Cut(fields[0], ";")
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return Line{}, fmt.Errorf("%w: invalid value: %q", ErrInvalidLine, fields[1])
+	}
+	timestamp := time.Now()
+	if len(fields) == 3 && fields[2] != "-1" {
+		secs, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return Line{}, fmt.Errorf("%w: invalid timestamp: %q", ErrInvalidLine, fields[2])
+		}
+		timestamp = time.Unix(int64(secs), 0)
+	}
+	return Line{Path: path, Value: value, Timestamp: timestamp}, nil
+}
+
+// SplitPath splits the given metric path into a host name and a metric name.
+// The host name is the path segment at index hostSegment and the metric name
+// is the remaining segments joined with a `.`.
+//
+// E.g., with a hostSegment of 1 the path `servers.comp10.cpu.load` is split
+// into the host name `comp10` and metric name `servers.cpu.load`.
+func SplitPath(path string, hostSegment int) (string, string, error) {
+	segments := strings.Split(path, ".")
+	if hostSegment < 0 || hostSegment >= len(segments)-1 {
+		return "", "", fmt.Errorf("%w: segment %d is not a host name in %q", ErrInvalidPath, hostSegment, path)
+	}
+	hostName := segments[hostSegment]
+	metricSegments := make([]string, 0, len(segments)-1)
+	metricSegments = append(metricSegments, segments[:hostSegment]...)
+	metricSegments = append(metricSegments, segments[hostSegment+1:]...)
+	metricName := strings.Join(metricSegments, ".")
+	if hostName == "" || metricName == "" {
+		return "", "", fmt.Errorf("%w: %q", ErrInvalidPath, path)
+	}
+	return hostName, metricName, nil
+}
@@ -0,0 +1,152 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package graphite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		expected Line
+	}{
+		{
+			name:     "path value and timestamp",
+			line:     "comp10.cpu.load 1.5 1696431225",
+			expected: Line{Path: "comp10.cpu.load", Value: 1.5, Timestamp: time.Unix(1696431225, 0)},
+		},
+		{
+			name:     "extra whitespace is ignored",
+			line:     "  comp10.cpu.load\t 2  1696431225 ",
+			expected: Line{Path: "comp10.cpu.load", Value: 2, Timestamp: time.Unix(1696431225, 0)},
+		},
+		{
+			name:     "tags are discarded",
+			line:     "comp10.disk.used;datacenter=dc1 42 1696431225",
+			expected: Line{Path: "comp10.disk.used", Value: 42, Timestamp: time.Unix(1696431225, 0)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line, err := ParseLine(tt.line)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, line)
+		})
+	}
+}
+
+func Test_ParseLineWithoutTimestampUsesCurrentTime(t *testing.T) {
+	for _, text := range []string{"comp10.cpu.load 1", "comp10.cpu.load 1 -1"} {
+		before := time.Now()
+		line, err := ParseLine(text)
+		assert.NoError(t, err)
+		assert.False(t, line.Timestamp.Before(before), "expected timestamp to be the current time")
+	}
+}
+
+func Test_ParseLineErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{name: "missing value", line: "comp10.cpu.load"},
+		{name: "too many fields", line: "comp10.cpu.load 1 1696431225 extra"},
+		{name: "invalid value", line: "comp10.cpu.load high 1696431225"},
+		{name: "invalid timestamp", line: "comp10.cpu.load 1 yesterday"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseLine(tt.line)
+			assert.ErrorIs(t, err, ErrInvalidLine)
+		})
+	}
+}
+
+func Test_SplitPath(t *testing.T) {
+	tests := []struct {
+		name         string
+		path         string
+		hostSegment  int
+		expectedHost string
+		expectedName string
+		expectedErr  error
+	}{
+		{
+			name:         "host name is the first segment",
+			path:         "comp10.cpu.load",
+			hostSegment:  0,
+			expectedHost: "comp10",
+			expectedName: "cpu.load",
+		},
+		{
+			name:         "host name is a middle segment",
+			path:         "servers.comp10.cpu.load",
+			hostSegment:  1,
+			expectedHost: "comp10",
+			expectedName: "servers.cpu.load",
+		},
+		{
+			name:        "host name cannot be the last segment",
+			path:        "cpu.load.comp10",
+			hostSegment: 2,
+			expectedErr: ErrInvalidPath,
+		},
+		{
+			name:        "host segment out of range",
+			path:        "comp10.cpu",
+			hostSegment: 5,
+			expectedErr: ErrInvalidPath,
+		},
+		{
+			name:        "empty host name",
+			path:        ".cpu.load",
+			hostSegment: 0,
+			expectedErr: ErrInvalidPath,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, name, err := SplitPath(tt.path, tt.hostSegment)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedHost, host)
+			assert.Equal(t, tt.expectedName, name)
+		})
+	}
+}
@@ -0,0 +1,274 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+// Package graphite provides a listener for the graphite plaintext protocol.
+package graphite
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/config"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/rs/zerolog"
+)
+
+// ErrServerClosed is returned by ListenAndServe after a call to Shutdown.
+var ErrServerClosed = errors.New("graphite: Server closed")
+
+// maxPacketSize is the maximum size of a UDP packet that will be read.
+const maxPacketSize = 65536
+
+// Server listens for metrics sent using the graphite plaintext protocol over
+// TCP and UDP and adds them to the pending repository.
+type Server struct {
+	app         *domain.Application
+	config      config.Graphite
+	timestamps  config.Timestamps
+	logger      zerolog.Logger
+	mux         sync.Mutex
+	tcpListener net.Listener
+	udpConn     net.PacketConn
+	conns       map[net.Conn]struct{}
+	closed      bool
+	wg          sync.WaitGroup
+}
+
+func NewServer(logger zerolog.Logger, app *domain.Application, config config.Graphite, timestamps config.Timestamps) *Server {
+	return &Server{
+		app:        app,
+		config:     config,
+		timestamps: timestamps,
+		logger:     logger.With().Str("component", "graphite").Logger(),
+		conns:      map[net.Conn]struct{}{},
+	}
+}
+
+// ListenAndServe listens on the configured TCP and UDP addresses and handles
+// the received lines.  It blocks until Shutdown is called, after which it
+// returns ErrServerClosed.
+func (s *Server) ListenAndServe() error {
+	addr := fmt.Sprintf("%s:%d", s.config.IP, s.config.Port)
+	if !s.config.TCP && !s.config.UDP {
+		return errors.New("graphite: neither tcp nor udp enabled")
+	}
+	s.mux.Lock()
+	if s.closed {
+		s.mux.Unlock()
+		return ErrServerClosed
+	}
+	if s.config.TCP {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			s.mux.Unlock()
+			return err
+		}
+		s.tcpListener = l
+		s.logger.Info().Str("address", addr).Msg("Listening on TCP")
+		s.wg.Add(1)
+		go s.serveTCP(l)
+	}
+	if s.config.UDP {
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			s.mux.Unlock()
+			s.closeListeners()
+			return err
+		}
+		s.udpConn = conn
+		s.logger.Info().Str("address", addr).Msg("Listening on UDP")
+		s.wg.Add(1)
+		go s.serveUDP(conn)
+	}
+	s.mux.Unlock()
+	s.wg.Wait()
+	return ErrServerClosed
+}
+
+// Shutdown stops listening for new connections and packets, closes any open
+// connections and waits for the lines already read to be handled or for the
+// context to be done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.closeListeners()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Server) closeListeners() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.closed = true
+	if s.tcpListener != nil {
+		s.tcpListener.Close() //nolint:errcheck
+	}
+	if s.udpConn != nil {
+		s.udpConn.Close() //nolint:errcheck
+	}
+	for conn := range s.conns {
+		conn.Close() //nolint:errcheck
+	}
+}
+
+func (s *Server) isClosed() bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.closed
+}
+
+func (s *Server) serveTCP(l net.Listener) {
+	defer s.wg.Done()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return
+			}
+			s.logger.Warn().Err(err).Msg("accepting connection")
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		if !s.trackConn(conn) {
+			conn.Close() //nolint:errcheck
+			return
+		}
+		s.wg.Add(1)
+		go s.handleConn(conn)
+	}
+}
+
+func (s *Server) trackConn(conn net.Conn) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mux.Lock()
+		delete(s.conns, conn)
+		s.mux.Unlock()
+		conn.Close() //nolint:errcheck
+	}()
+	logger := s.logger.With().Stringer("remote", conn.RemoteAddr()).Logger()
+	logger.Debug().Msg("accepted connection")
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		s.handleLine(logger, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil && !s.isClosed() {
+		logger.Debug().Err(err).Msg("reading connection")
+	}
+}
+
+func (s *Server) serveUDP(conn net.PacketConn) {
+	defer s.wg.Done()
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if s.isClosed() {
+				return
+			}
+			s.logger.Warn().Err(err).Msg("reading packet")
+			continue
+		}
+		logger := s.logger.With().Stringer("remote", addr).Logger()
+		scanner := bufio.NewScanner(bytes.NewReader(buf[:n]))
+		for scanner.Scan() {
+			s.handleLine(logger, scanner.Text())
+		}
+	}
+}
+
+// handleLine parses the given line and adds the metric to the pending
+// repository.  Errors are logged and otherwise ignored; the plaintext protocol
+// has no way of reporting them to the client.
+//
+// The metric is reported at the line's timestamp, or at the current time if
+// the timestamp is in the future.  Metric names that are not safe to use are
+// rejected by the application.
+func (s *Server) handleLine(logger zerolog.Logger, text string) {
+	if text == "" {
+		return
+	}
+	line, err := ParseLine(text)
+	if err != nil {
+		logger.Debug().Err(err).Msg("parsing line")
+		return
+	}
+	hostName, metricName, err := SplitPath(line.Path, s.config.HostSegment)
+	if err != nil {
+		logger.Debug().Err(err).Msg("parsing metric path")
+		return
+	}
+	hostId, err := s.app.HostIdForHostName(hostName)
+	if err != nil {
+		logger.Debug().Err(err).Str("metric", metricName).Msg("looking up host")
+		return
+	}
+	reported, err := domain.CheckReportedTime(line.Timestamp, time.Now(), s.timestamps.MaxSkew, s.timestamps.MaxAge)
+	if err != nil {
+		logger.Debug().Err(err).Str("metric", metricName).Msg("checking timestamp")
+		return
+	}
+	metric := domain.PendingMetric{
+		Name:     metricName,
+		Slope:    domain.MetricSlopeBoth,
+		Reported: reported,
+		TTL:      s.config.TTL,
+		Type:     domain.MetricTypeDouble,
+	}
+	metric.Value, err = domain.ParseMetricVal(line.Value, metric.Type)
+	if err != nil {
+		logger.Debug().Err(err).Str("metric", metricName).Msg("parsing metric value")
+		return
+	}
+	err = s.app.AddPendingMetric(metric, hostId, "")
+	if err != nil {
+		logger.Debug().Err(err).Str("metric", metricName).Msg("adding metric")
+	}
+}
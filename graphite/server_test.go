@@ -0,0 +1,144 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package graphite
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/config"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/inmem"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	consoleWriter := zerolog.ConsoleWriter{Out: os.Stderr}
+	log.Logger = zerolog.New(consoleWriter).With().Timestamp().Logger()
+}
+
+// newTestDSMRepo returns a data source map repository containing the hosts
+// comp10 and comp11.
+func newTestDSMRepo() *inmem.DSMRepo {
+	dsmConfig := config.DSM{GridName: "unspecified", ClusterName: "unspecified"}
+	repo := inmem.NewDSMRepo(log.Logger, dsmConfig)
+	hostIdToDSM := map[domain.HostId]domain.DSM{}
+	dsmToHostId := map[domain.DSM]domain.HostId{}
+	for _, hostId := range []domain.HostId{"10", "11"} {
+		dsm := domain.DSM{GridName: "unspecified", ClusterName: "unspecified", HostName: "comp" + string(hostId)}
+		hostIdToDSM[hostId] = dsm
+		dsmToHostId[dsm] = hostId
+	}
+	repo.Update(hostIdToDSM, dsmToHostId) //nolint:errcheck
+	return repo
+}
+
+type fakeDSMUpdater struct{}
+
+func (fakeDSMUpdater) RunPeriodicUpdateLoop() {}
+
+func (fakeDSMUpdater) UpdateNow() {}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func Test_ServerAddsReceivedMetrics(t *testing.T) {
+	// Setup
+	pendingRepo := inmem.NewPendingRepository(log.Logger)
+	app := domain.NewApp(pendingRepo, newTestDSMRepo(), fakeDSMUpdater{}, nil, nil, nil)
+	policy, err := domain.NewNamingPolicy(domain.NamingPolicyOptions{
+		ReservedPrefixes: []domain.ReservedPrefix{{Prefix: "servers.ipmi.", Subjects: []string{"concertim"}}},
+	})
+	assert.NoError(t, err)
+	app.NamingPolicy = policy
+	graphiteConfig := config.Graphite{
+		IP:          "127.0.0.1",
+		Port:        freePort(t),
+		TCP:         true,
+		HostSegment: 1,
+		TTL:         time.Minute,
+	}
+	timestamps := config.Timestamps{MaxSkew: time.Minute, MaxAge: 24 * time.Hour}
+	server := NewServer(log.Logger, app, graphiteConfig, timestamps)
+	served := make(chan error, 1)
+	go func() { served <- server.ListenAndServe() }()
+
+	// Action
+	var conn net.Conn
+	addr := fmt.Sprintf("127.0.0.1:%d", graphiteConfig.Port)
+	assert.Eventually(t, func() bool {
+		conn, err = net.Dial("tcp", addr)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	// The valid line is sent last so that the others have been handled once
+	// its metric has been added.
+	reported := time.Now().Add(-time.Minute).Unix()
+	lines := []string{
+		fmt.Sprintf("servers.unknown.cpu.load 2 %d", reported),
+		fmt.Sprintf("servers.comp11.cpu/../../../etc/passwd 3 %d", reported),
+		fmt.Sprintf("servers.comp11.cpu..load 3 %d", reported),
+		fmt.Sprintf("servers.comp10.ipmi.power 3 %d", reported),
+		"servers.comp10.cpu.old 3 1696431225",
+		fmt.Sprintf("servers.comp10.cpu.future 3 %d", time.Now().Add(time.Hour).Unix()),
+		"invalid",
+		fmt.Sprintf("servers.comp10.cpu.load 1.5 %d", reported),
+	}
+	_, err = fmt.Fprint(conn, strings.Join(lines, "\n")+"\n")
+	assert.NoError(t, err)
+
+	// Assertions
+	assert.Eventually(t, func() bool {
+		_, ok := pendingRepo.GetHost("10")
+		return ok
+	}, time.Second, 10*time.Millisecond)
+	host, _ := pendingRepo.GetHost("10")
+	assert.Len(t, host.Metrics, 1, "expected reserved prefix and invalid timestamps to be rejected")
+	metric := host.Metrics["servers.cpu.load"]
+	assert.Equal(t, "1.500000", metric.Value)
+	assert.Equal(t, domain.MetricTypeDouble, metric.Type)
+	assert.Equal(t, time.Minute, metric.TTL)
+	assert.True(t, time.Unix(reported, 0).Equal(metric.Reported), "unexpected reported time %s", metric.Reported)
+	assert.Len(t, pendingRepo.GetAll(), 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, server.Shutdown(ctx))
+	assert.ErrorIs(t, <-served, ErrServerClosed)
+}
@@ -0,0 +1,261 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+// Package influx provides a parser for the InfluxDB line protocol.
+package influx
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidLine is returned if a line cannot be parsed.
+var ErrInvalidLine = fmt.Errorf("invalid line protocol")
+
+// Point is a single parsed line.
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      []Field
+	// Timestamp is the zero time if the line did not include a timestamp.
+	Timestamp time.Time
+}
+
+// Field is a single field of a point.  Value is one of float64, int64,
+// uint64, string or bool.
+type Field struct {
+	Key   string
+	Value any
+}
+
+// LineError records the failure to parse a single line.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string { return fmt.Sprintf("line %d: %s", e.Line, e.Err) }
+
+func (e *LineError) Unwrap() error { return e.Err }
+
+// Parse parses each line of the given line protocol data.  Empty lines and
+// comments are skipped.  The points for the lines that could be parsed are
+// returned along with an error for each line that could not.
+//
+// precision is the unit of the timestamps, one of `ns`, `u`, `ms`, `s`, `m`
+// or `h`.  An empty precision is the same as `ns`.
+func Parse(data []byte, precision string) ([]Point, []error) {
+	unit, err := precisionUnit(precision)
+	if err != nil {
+		return nil, []error{err}
+	}
+	points := make([]Point, 0)
+	var errs []error
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		point, err := ParseLine(line, unit)
+		if err != nil {
+			errs = append(errs, &LineError{Line: lineNo, Err: err})
+			continue
+		}
+		points = append(points, point)
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return points, errs
+}
+
+func precisionUnit(precision string) (time.Duration, error) {
+	switch precision {
+	case "", "n", "ns":
+		return time.Nanosecond, nil
+	case "u", "us":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	case "m":
+		return time.Minute, nil
+	case "h":
+		return time.Hour, nil
+	default:
+		return 0, fmt.Errorf("invalid precision: %q", precision)
+	}
+}
+
+// ParseLine parses a single line of the line protocol.  The line has the
+// format `<measurement>[,<tag>=<value>...] <field>=<value>[,<field>=<value>...] [timestamp]`.
+// unit is the unit of the timestamp.
+func ParseLine(line string, unit time.Duration) (Point, error) {
+	point := Point{Tags: map[string]string{}}
+	var i int
+	point.Measurement, i = scanToken(line, 0, ", ")
+	if point.Measurement == "" {
+		return Point{}, fmt.Errorf("%w: missing measurement", ErrInvalidLine)
+	}
+	for i < len(line) && line[i] == ',' {
+		var key, value string
+		key, i = scanToken(line, i+1, "=, ")
+		if key == "" || i >= len(line) || line[i] != '=' {
+			return Point{}, fmt.Errorf("%w: invalid tag", ErrInvalidLine)
+		}
+		value, i = scanToken(line, i+1, ", ")
+		if value == "" {
+			return Point{}, fmt.Errorf("%w: missing value for tag %q", ErrInvalidLine, key)
+		}
+		point.Tags[key] = value
+	}
+	if i >= len(line) || line[i] != ' ' {
+		return Point{}, fmt.Errorf("%w: missing fields", ErrInvalidLine)
+	}
+	i = skipSpaces(line, i)
+	for {
+		var key string
+		key, i = scanToken(line, i, "=, ")
+		if key == "" || i >= len(line) || line[i] != '=' {
+			return Point{}, fmt.Errorf("%w: invalid field", ErrInvalidLine)
+		}
+		var value any
+		var err error
+		value, i, err = scanFieldValue(line, i+1)
+		if err != nil {
+			return Point{}, fmt.Errorf("%w: field %q: %s", ErrInvalidLine, key, err)
+		}
+		point.Fields = append(point.Fields, Field{Key: key, Value: value})
+		if i < len(line) && line[i] == ',' {
+			i++
+			continue
+		}
+		break
+	}
+	i = skipSpaces(line, i)
+	if i < len(line) {
+		ts, err := strconv.ParseInt(line[i:], 10, 64)
+		if err != nil {
+			return Point{}, fmt.Errorf("%w: invalid timestamp: %q", ErrInvalidLine, line[i:])
+		}
+		point.Timestamp = time.Unix(0, ts*int64(unit))
+	}
+	return point, nil
+}
+
+// scanToken reads from line starting at i until one of the unescaped stop
+// characters is found.  Backslash escaped characters are unescaped.  The
+// token and the index of the stop character are returned.
+func scanToken(line string, i int, stops string) (string, int) {
+	var b strings.Builder
+	for i < len(line) {
+		c := line[i]
+		if c == '\\' && i+1 < len(line) && strings.IndexByte(stops+"\\=\"", line[i+1]) >= 0 {
+			b.WriteByte(line[i+1])
+			i += 2
+			continue
+		}
+		if strings.IndexByte(stops, c) >= 0 {
+			break
+		}
+		b.WriteByte(c)
+		i++
+	}
+	return b.String(), i
+}
+
+func skipSpaces(line string, i int) int {
+	for i < len(line) && line[i] == ' ' {
+		i++
+	}
+	return i
+}
+
+// scanFieldValue reads a field value from line starting at i.  It returns the
+// typed value and the index after the value.
+func scanFieldValue(line string, i int) (any, int, error) {
+	if i < len(line) && line[i] == '"' {
+		var b strings.Builder
+		i++
+		for i < len(line) {
+			c := line[i]
+			if c == '\\' && i+1 < len(line) && (line[i+1] == '"' || line[i+1] == '\\') {
+				b.WriteByte(line[i+1])
+				i += 2
+				continue
+			}
+			if c == '"' {
+				return b.String(), i + 1, nil
+			}
+			b.WriteByte(c)
+			i++
+		}
+		return nil, i, fmt.Errorf("unterminated string")
+	}
+	raw, next := scanToken(line, i, ", ")
+	value, err := parseFieldValue(raw)
+	return value, next, err
+}
+
+func parseFieldValue(raw string) (any, error) {
+	switch raw {
+	case "":
+		return nil, fmt.Errorf("missing value")
+	case "t", "T", "true", "True", "TRUE":
+		return true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return false, nil
+	}
+	switch raw[len(raw)-1] {
+	case 'i':
+		v, err := strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer: %q", raw)
+		}
+		return v, nil
+	case 'u':
+		v, err := strconv.ParseUint(raw[:len(raw)-1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid unsigned integer: %q", raw)
+		}
+		return v, nil
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid float: %q", raw)
+	}
+	return v, nil
+}
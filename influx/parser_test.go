@@ -0,0 +1,133 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package influx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		expected Point
+	}{
+		{
+			name: "measurement tags fields and timestamp",
+			line: `cpu,host=comp10,region=uk usage_idle=92.5,usage_user=7i 1696431225000000000`,
+			expected: Point{
+				Measurement: "cpu",
+				Tags:        map[string]string{"host": "comp10", "region": "uk"},
+				Fields: []Field{
+					{Key: "usage_idle", Value: 92.5},
+					{Key: "usage_user", Value: int64(7)},
+				},
+				Timestamp: time.Unix(1696431225, 0),
+			},
+		},
+		{
+			name: "no tags or timestamp",
+			line: `mem free=1024u,ok=true`,
+			expected: Point{
+				Measurement: "mem",
+				Tags:        map[string]string{},
+				Fields: []Field{
+					{Key: "free", Value: uint64(1024)},
+					{Key: "ok", Value: true},
+				},
+			},
+		},
+		{
+			name: "strings and escapes",
+			line: `disk\ io,path=/var\,log status="it's \"ok\", mostly",count=1`,
+			expected: Point{
+				Measurement: "disk io",
+				Tags:        map[string]string{"path": "/var,log"},
+				Fields: []Field{
+					{Key: "status", Value: `it's "ok", mostly`},
+					{Key: "count", Value: 1.0},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			point, err := ParseLine(tt.line, time.Nanosecond)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, point)
+		})
+	}
+}
+
+func Test_ParseLineErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{name: "missing fields", line: "cpu,host=comp10"},
+		{name: "missing field value", line: "cpu value="},
+		{name: "invalid tag", line: "cpu,host value=1"},
+		{name: "invalid integer", line: "cpu value=1.5i"},
+		{name: "unterminated string", line: `cpu value="oops`},
+		{name: "invalid timestamp", line: "cpu value=1 yesterday"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseLine(tt.line, time.Nanosecond)
+			assert.ErrorIs(t, err, ErrInvalidLine)
+		})
+	}
+}
+
+func Test_Parse(t *testing.T) {
+	// Setup
+	data := []byte("# a comment\ncpu value=1 1696431225\n\ninvalid\nmem value=2\n")
+
+	// Action
+	points, errs := Parse(data, "s")
+
+	// Assertions
+	assert.Len(t, points, 2)
+	assert.Equal(t, time.Unix(1696431225, 0), points[0].Timestamp)
+	if assert.Len(t, errs, 1) {
+		var lineErr *LineError
+		assert.ErrorAs(t, errs[0], &lineErr)
+		assert.Equal(t, 4, lineErr.Line)
+		assert.ErrorIs(t, errs[0], ErrInvalidLine)
+	}
+}
+
+func Test_ParseInvalidPrecision(t *testing.T) {
+	_, errs := Parse([]byte("cpu value=1"), "fortnight")
+	assert.Len(t, errs, 1)
+}
@@ -28,7 +28,13 @@
 package inmem
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
@@ -46,8 +52,27 @@ type processingResult struct {
 	// uniqueMetrics is a set of unique metrics by name.
 	uniqueMetrics map[domain.MetricName]*domain.UniqueMetric
 
+	// reportedAs is a map from a metric's name to the datatypes and units
+	// that it has been reported with and the hosts reporting them.  Only
+	// those with more than one datatype or units are conflicting.
+	reportedAs map[domain.MetricName]*domain.MetricConflict
+
 	// hosts is a slice of CurrentHosts.  Each host contains its current metrics.
 	hosts []*domain.CurrentHost
+
+	// committed is the time that the processing run was committed.
+	committed time.Time
+
+	// restored is true if the result was restored from a snapshot taken by
+	// a previous instance of the daemon.
+	restored bool
+}
+
+// currentSnapshot is the result of a processing run saved to disk.  The
+// result is recreated from the hosts when it is loaded.
+type currentSnapshot struct {
+	Committed time.Time             `json:"committed"`
+	Hosts     []*domain.CurrentHost `json:"hosts"`
 }
 
 var _ domain.CurrentRepository = (*CurrentRepository)(nil)
@@ -55,38 +80,166 @@ var _ domain.CurrentRepository = (*CurrentRepository)(nil)
 // CurrentRepository implements the domain.CurrentRepository interface.  The
 // results from the most recently completed processing run, if any, are stored
 // in the result field.  The ongoing processing run, if any, is stored in the
-// nextResult field.
+// nextResult field.  Hosts removed while a processing run is in progress are
+// recorded in removedDuringRun and removed again when that run is committed.
+//
+// If snapshotPath is set, the results are saved to that file each time they
+// change, see NewPersistentCurrentRepository.
 type CurrentRepository struct {
-	logger     zerolog.Logger
-	mux        sync.Mutex
-	result     *processingResult
-	nextResult *processingResult
+	logger           zerolog.Logger
+	mux              sync.RWMutex
+	result           *processingResult
+	nextResult       *processingResult
+	removedDuringRun map[domain.HostId]struct{}
+	snapshotPath     string
+	snapshotMux      sync.Mutex
 }
 
 func NewCurrentRepository(logger zerolog.Logger) *CurrentRepository {
 	return &CurrentRepository{
 		logger: logger.With().Str("component", "current-repo").Logger(),
-		mux:    sync.Mutex{},
+		mux:    sync.RWMutex{},
 	}
 }
 
+// NewPersistentCurrentRepository returns a CurrentRepository that saves the
+// results of each processing run to the given file.  If the file was saved by
+// a previous instance of the daemon, the results in it are loaded and marked
+// as restored.  They are available until the first processing run is
+// committed.
+func NewPersistentCurrentRepository(logger zerolog.Logger, snapshotPath string) (*CurrentRepository, error) {
+	pr := NewCurrentRepository(logger)
+	pr.snapshotPath = snapshotPath
+	if err := pr.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	return pr, nil
+}
+
 func (pr *CurrentRepository) Begin() error {
 	pr.logger.Debug().Msg("begin transaction")
 	pr.mux.Lock()
 	defer pr.mux.Unlock()
-	pr.nextResult = &processingResult{
+	pr.nextResult = newProcessingResult()
+	pr.removedDuringRun = nil
+	return nil
+}
+
+func newProcessingResult() *processingResult {
+	return &processingResult{
 		hostsByMetric: map[domain.MetricName][]*domain.CurrentHost{},
 		uniqueMetrics: map[domain.MetricName]*domain.UniqueMetric{},
+		reportedAs:    map[domain.MetricName]*domain.MetricConflict{},
 	}
-	return nil
 }
 
 func (pr *CurrentRepository) Commit() error {
 	pr.logger.Debug().Any("results", pr.nextResult).Msg("committing transaction")
 	pr.mux.Lock()
-	defer pr.mux.Unlock()
+	if pr.nextResult != nil {
+		if len(pr.removedDuringRun) > 0 {
+			// The run may have read the pending metrics of hosts removed
+			// whilst it was in progress.
+			pr.nextResult, _ = pr.withoutHosts(pr.nextResult, pr.removedDuringRun)
+		}
+		pr.nextResult.committed = time.Now()
+	}
 	pr.result = pr.nextResult
 	pr.nextResult = nil
+	pr.removedDuringRun = nil
+	pr.mux.Unlock()
+	// Failing to save the snapshot does not affect the processing run.
+	if err := pr.saveSnapshot(); err != nil {
+		pr.logger.Warn().Err(err).Msg("saving snapshot")
+	}
+	return nil
+}
+
+// RestoredAt returns true if the results of the last processing run were
+// loaded from the snapshot saved by a previous instance of the daemon, along
+// with the time they were committed.
+func (pr *CurrentRepository) RestoredAt() (time.Time, bool) {
+	pr.mux.RLock()
+	defer pr.mux.RUnlock()
+	if pr.result == nil || !pr.result.restored {
+		return time.Time{}, false
+	}
+	return pr.result.committed, true
+}
+
+// Save saves the results of the last processing run to the snapshot file, if
+// one is configured.  It is intended to be called on shutdown; the results
+// are also saved whenever they change.
+func (pr *CurrentRepository) Save() error {
+	return pr.saveSnapshot()
+}
+
+// saveSnapshot saves the current results to the snapshot file, if one is
+// configured.  The snapshot is written to a temporary file which then
+// replaces the previous snapshot.
+//
+// It must not be called with pr.mux held.  The results are read under the
+// lock once any earlier save has completed, so that a newer result is never
+// overwritten by an older one, and written without holding it, so that
+// readers are not blocked by the disk I/O.  Published results are not
+// modified, so they can be encoded without holding the lock.
+func (pr *CurrentRepository) saveSnapshot() error {
+	if pr.snapshotPath == "" {
+		return nil
+	}
+	pr.snapshotMux.Lock()
+	defer pr.snapshotMux.Unlock()
+	pr.mux.RLock()
+	result := pr.result
+	pr.mux.RUnlock()
+	if result == nil {
+		return nil
+	}
+	data, err := json.Marshal(currentSnapshot{Committed: result.committed, Hosts: result.hosts})
+	if err != nil {
+		return fmt.Errorf("%s %w", "encoding current metrics snapshot", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(pr.snapshotPath), 0755); err != nil {
+		return fmt.Errorf("%s %w", "creating current metrics snapshot directory", err)
+	}
+	tmp := pr.snapshotPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("%s %w", "writing current metrics snapshot", err)
+	}
+	if err := os.Rename(tmp, pr.snapshotPath); err != nil {
+		return fmt.Errorf("%s %w", "writing current metrics snapshot", err)
+	}
+	pr.logger.Debug().Str("path", pr.snapshotPath).Int("hosts", len(result.hosts)).Msg("saved snapshot")
+	return nil
+}
+
+// loadSnapshot loads the result saved in the snapshot file, if there is one.
+func (pr *CurrentRepository) loadSnapshot() error {
+	data, err := os.ReadFile(pr.snapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("%s %w", "reading current metrics snapshot", err)
+	}
+	var snapshot currentSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("%s %w", "decoding current metrics snapshot", err)
+	}
+	result := newProcessingResult()
+	for _, host := range snapshot.Hosts {
+		if host.Metrics == nil {
+			host.Metrics = map[domain.MetricName]domain.CurrentMetric{}
+		}
+		for _, metric := range host.Metrics {
+			metric := metric
+			pr.addMetric(result, host, &metric)
+		}
+		result.hosts = append(result.hosts, host)
+	}
+	result.committed = snapshot.Committed
+	result.restored = true
+	pr.result = result
+	pr.logger.Info().Str("path", pr.snapshotPath).Int("hosts", len(result.hosts)).Time("committed", result.committed).Msg("restored current metrics")
 	return nil
 }
 
@@ -111,15 +264,22 @@ func (pr *CurrentRepository) AddMetric(host *domain.CurrentHost, metric *domain.
 	// 	return fmt.Errorf("adding host outside of transaction")
 	// }
 	pr.logger.Debug().Stringer("host", host.DSM).Str("metric", metric.Name).Msg("adding metric")
-	nextResult := pr.nextResult
+	pr.addMetric(pr.nextResult, host, metric)
+}
+
+func (pr *CurrentRepository) addMetric(nextResult *processingResult, host *domain.CurrentHost, metric *domain.CurrentMetric) {
 	metricName := domain.MetricName(metric.Name)
-	host.Metrics[metricName] = *metric
+	host.Metrics[metric.SeriesKey()] = *metric
 	hosts, ok := nextResult.hostsByMetric[metricName]
 	if !ok {
 		hosts = make([]*domain.CurrentHost, 0)
 		nextResult.hostsByMetric[metricName] = hosts
 	}
-	nextResult.hostsByMetric[metricName] = append(hosts, host)
+	// A host's metrics are added together, so a host reporting several series
+	// of the metric will have been added by the first of them.
+	if len(hosts) == 0 || hosts[len(hosts)-1] != host {
+		nextResult.hostsByMetric[metricName] = append(hosts, host)
+	}
 	um, found := nextResult.uniqueMetrics[metricName]
 	if !found {
 		um = uniqueMetricFromMetric(*metric)
@@ -127,10 +287,100 @@ func (pr *CurrentRepository) AddMetric(host *domain.CurrentHost, metric *domain.
 		nextResult.uniqueMetrics[metricName] = um
 	}
 	adjustMinMax(um, *metric)
+	recordReportedAs(nextResult.reportedAs, host.Id, *metric)
 	// pr.numMetrics++
 }
 
+// RemoveHost removes the given host and its metrics from the results of the
+// most recently completed processing run.  The unique metrics and their
+// minimum and maximum values are recalculated from the remaining hosts.  If
+// a processing run is in progress, the host is also removed from its results
+// when it is committed.
+func (pr *CurrentRepository) RemoveHost(hostId domain.HostId) error {
+	if err := pr.removeHost(hostId); err != nil {
+		return err
+	}
+	if err := pr.saveSnapshot(); err != nil {
+		pr.logger.Warn().Err(err).Msg("saving snapshot")
+	}
+	return nil
+}
+
+func (pr *CurrentRepository) removeHost(hostId domain.HostId) error {
+	pr.mux.Lock()
+	defer pr.mux.Unlock()
+	if pr.nextResult != nil {
+		if pr.removedDuringRun == nil {
+			pr.removedDuringRun = map[domain.HostId]struct{}{}
+		}
+		pr.removedDuringRun[hostId] = struct{}{}
+	}
+	if pr.result == nil {
+		return domain.ErrWaitingOnProcessingRun
+	}
+	pr.logger.Debug().Stringer("host", hostId).Msg("removing host")
+	result, found := pr.withoutHosts(pr.result, map[domain.HostId]struct{}{hostId: {}})
+	if !found {
+		return fmt.Errorf("%w: %s", domain.ErrHostNotFound, hostId)
+	}
+	pr.result = result
+	return nil
+}
+
+// withoutHosts returns a copy of the given result without the given hosts,
+// along with whether any of them were found.  The remaining hosts are copied
+// so that the given result, which may be in use by readers, is not modified.
+func (pr *CurrentRepository) withoutHosts(src *processingResult, hostIds map[domain.HostId]struct{}) (*processingResult, bool) {
+	result := newProcessingResult()
+	found := false
+	for _, host := range src.hosts {
+		if _, ok := hostIds[host.Id]; ok {
+			found = true
+			continue
+		}
+		hostCopy := *host
+		hostCopy.Metrics = make(map[domain.MetricName]domain.CurrentMetric, len(host.Metrics))
+		for _, metric := range host.Metrics {
+			metric := metric
+			pr.addMetric(result, &hostCopy, &metric)
+		}
+		result.hosts = append(result.hosts, &hostCopy)
+	}
+	result.committed = src.committed
+	result.restored = src.restored
+	return result, found
+}
+
+// recordReportedAs records that the given host reported the metric with its
+// datatype and units.
+func recordReportedAs(reportedAs map[domain.MetricName]*domain.MetricConflict, hostId domain.HostId, metric domain.CurrentMetric) {
+	metricName := domain.MetricName(metric.Name)
+	conflict, ok := reportedAs[metricName]
+	if !ok {
+		conflict = &domain.MetricConflict{
+			Name:      metric.Name,
+			Datatypes: map[string][]domain.HostId{},
+			Units:     map[string][]domain.HostId{},
+		}
+		reportedAs[metricName] = conflict
+	}
+	conflict.Datatypes[metric.Datatype] = appendHostId(conflict.Datatypes[metric.Datatype], hostId)
+	conflict.Units[metric.Units] = appendHostId(conflict.Units[metric.Units], hostId)
+}
+
+// appendHostId appends hostId to hostIds unless it is already the last
+// entry.  A host's metrics are added together, so this is sufficient to
+// avoid duplicates.
+func appendHostId(hostIds []domain.HostId, hostId domain.HostId) []domain.HostId {
+	if len(hostIds) > 0 && hostIds[len(hostIds)-1] == hostId {
+		return hostIds
+	}
+	return append(hostIds, hostId)
+}
+
 func (pr *CurrentRepository) GetUniqueMetrics() ([]*domain.UniqueMetric, error) {
+	pr.mux.RLock()
+	defer pr.mux.RUnlock()
 	if pr.result == nil {
 		return nil, domain.ErrWaitingOnProcessingRun
 	}
@@ -141,7 +391,29 @@ func (pr *CurrentRepository) GetUniqueMetrics() ([]*domain.UniqueMetric, error)
 	return metrics, nil
 }
 
+// GetMetricConflicts returns the metrics reported with conflicting datatypes
+// or units in the last processing run ordered by name.
+func (pr *CurrentRepository) GetMetricConflicts() ([]*domain.MetricConflict, error) {
+	pr.mux.RLock()
+	defer pr.mux.RUnlock()
+	if pr.result == nil {
+		return nil, domain.ErrWaitingOnProcessingRun
+	}
+	conflicts := make([]*domain.MetricConflict, 0)
+	for _, conflict := range pr.result.reportedAs {
+		if conflict.Conflicting() {
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].Name < conflicts[j].Name
+	})
+	return conflicts, nil
+}
+
 func (pr *CurrentRepository) HostsWithMetric(metric domain.MetricName) ([]*domain.CurrentHost, error) {
+	pr.mux.RLock()
+	defer pr.mux.RUnlock()
 	if pr.result == nil {
 		return nil, domain.ErrWaitingOnProcessingRun
 	}
@@ -152,7 +424,20 @@ func (pr *CurrentRepository) HostsWithMetric(metric domain.MetricName) ([]*domai
 	return hosts, nil
 }
 
+func (pr *CurrentRepository) GetHosts() ([]*domain.CurrentHost, error) {
+	pr.mux.RLock()
+	defer pr.mux.RUnlock()
+	if pr.result == nil {
+		return nil, domain.ErrWaitingOnProcessingRun
+	}
+	hosts := make([]*domain.CurrentHost, len(pr.result.hosts))
+	copy(hosts, pr.result.hosts)
+	return hosts, nil
+}
+
 func (pr *CurrentRepository) GetMetricsForHost(hostId domain.HostId) ([]*domain.CurrentMetric, error) {
+	pr.mux.RLock()
+	defer pr.mux.RUnlock()
 	if pr.result == nil {
 		return nil, domain.ErrWaitingOnProcessingRun
 	}
@@ -187,9 +472,8 @@ func uniqueMetricFromMetric(src domain.CurrentMetric) *domain.UniqueMetric {
 func adjustMinMax(unique *domain.UniqueMetric, metric domain.CurrentMetric) {
 	// XXX Add some logging of what's going on.  Especially for the error cases.
 	switch metric.Datatype {
-	case "int8", "int16", "int32":
-		// i, err := strconv.ParseInt(metric.Value, 10, 64)
-		i, err := strconv.Atoi(metric.Value)
+	case "int8", "int16", "int32", "int64":
+		i, err := strconv.ParseInt(metric.Value, 10, 64)
 		if err != nil {
 			return
 		}
@@ -198,7 +482,7 @@ func adjustMinMax(unique *domain.UniqueMetric, metric domain.CurrentMetric) {
 		} else {
 			minVal := reflect.ValueOf(unique.Min)
 			if minVal.CanInt() {
-				if int64(i) < minVal.Int() {
+				if i < minVal.Int() {
 					unique.Min = i
 				}
 			}
@@ -208,12 +492,12 @@ func adjustMinMax(unique *domain.UniqueMetric, metric domain.CurrentMetric) {
 		} else {
 			maxVal := reflect.ValueOf(unique.Max)
 			if maxVal.CanInt() {
-				if int64(i) > maxVal.Int() {
+				if i > maxVal.Int() {
 					unique.Max = i
 				}
 			}
 		}
-	case "uint8", "uint16", "uint32":
+	case "uint8", "uint16", "uint32", "uint64":
 		i, err := strconv.ParseUint(metric.Value, 10, 64)
 		if err != nil {
 			return
@@ -0,0 +1,209 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package inmem
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func commitCurrentHost(t *testing.T, repo *CurrentRepository, host *domain.CurrentHost) {
+	t.Helper()
+	assert.NoError(t, repo.Begin())
+	metrics := host.Metrics
+	host.Metrics = map[domain.MetricName]domain.CurrentMetric{}
+	for _, metric := range metrics {
+		metric := metric
+		repo.AddMetric(host, &metric)
+	}
+	repo.AddHost(host)
+	assert.NoError(t, repo.Commit())
+}
+
+func Test_CurrentRepositoryRestoredFromSnapshot(t *testing.T) {
+	// Setup
+	path := filepath.Join(t.TempDir(), "current.json")
+	repo, err := NewPersistentCurrentRepository(log.Logger, path)
+	assert.NoError(t, err)
+	_, restored := repo.RestoredAt()
+	assert.False(t, restored, "expected new repository not to be restored")
+	host := &domain.CurrentHost{
+		Id:  "10",
+		DSM: dsm_for("comp10"),
+		Metrics: map[domain.MetricName]domain.CurrentMetric{
+			"load": {Name: "load", Datatype: "double", Value: "1.5", Slope: domain.MetricSlopeBoth, Timestamp: time.Now()},
+		},
+	}
+	commitCurrentHost(t, repo, host)
+
+	// Action
+	restoredRepo, err := NewPersistentCurrentRepository(log.Logger, path)
+	assert.NoError(t, err)
+
+	// Assertions
+	committed, restored := restoredRepo.RestoredAt()
+	assert.True(t, restored, "expected repository to be restored")
+	assert.WithinDuration(t, time.Now(), committed, time.Minute)
+	metrics, err := restoredRepo.GetMetricsForHost("10")
+	assert.NoError(t, err)
+	if assert.Len(t, metrics, 1) {
+		assert.Equal(t, "1.5", metrics[0].Value)
+		assert.Equal(t, domain.MetricSlopeBoth, metrics[0].Slope)
+	}
+	uniqueMetrics, err := restoredRepo.GetUniqueMetrics()
+	assert.NoError(t, err)
+	assert.Len(t, uniqueMetrics, 1)
+	hosts, err := restoredRepo.HostsWithMetric("load")
+	assert.NoError(t, err)
+	assert.Len(t, hosts, 1)
+}
+
+func Test_CurrentRepositoryCommitClearsRestored(t *testing.T) {
+	// Setup
+	path := filepath.Join(t.TempDir(), "current.json")
+	repo, err := NewPersistentCurrentRepository(log.Logger, path)
+	assert.NoError(t, err)
+	commitCurrentHost(t, repo, &domain.CurrentHost{Id: "10", DSM: dsm_for("comp10")})
+	restoredRepo, err := NewPersistentCurrentRepository(log.Logger, path)
+	assert.NoError(t, err)
+
+	// Action
+	commitCurrentHost(t, restoredRepo, &domain.CurrentHost{Id: "11", DSM: dsm_for("comp11")})
+
+	// Assertions
+	_, restored := restoredRepo.RestoredAt()
+	assert.False(t, restored, "expected repository not to be restored after commit")
+	hosts, err := restoredRepo.GetHosts()
+	assert.NoError(t, err)
+	if assert.Len(t, hosts, 1) {
+		assert.Equal(t, domain.HostId("11"), hosts[0].Id)
+	}
+}
+
+func Test_CurrentRepositoryWithoutSnapshotFile(t *testing.T) {
+	// Setup
+	repo := NewCurrentRepository(log.Logger)
+	commitCurrentHost(t, repo, &domain.CurrentHost{Id: "10", DSM: dsm_for("comp10")})
+
+	// Action
+	err := repo.Save()
+
+	// Assertions
+	assert.NoError(t, err)
+	_, restored := repo.RestoredAt()
+	assert.False(t, restored)
+}
+
+func Test_CurrentRepositoryRemoveHostLeavesReadHostsUnchanged(t *testing.T) {
+	// Setup
+	repo := NewCurrentRepository(log.Logger)
+	assert.NoError(t, repo.Begin())
+	for _, id := range []domain.HostId{"10", "11"} {
+		host := &domain.CurrentHost{Id: id, DSM: dsm_for("comp" + string(id)), Metrics: map[domain.MetricName]domain.CurrentMetric{}}
+		repo.AddMetric(host, &domain.CurrentMetric{Name: "load", Datatype: "double", Value: "1.5", Slope: domain.MetricSlopeBoth, Timestamp: time.Now()})
+		repo.AddHost(host)
+	}
+	assert.NoError(t, repo.Commit())
+	hosts, err := repo.GetHosts()
+	assert.NoError(t, err)
+
+	// Action
+	err = repo.RemoveHost("10")
+
+	// Assertions
+	assert.NoError(t, err)
+	for _, host := range hosts {
+		assert.Len(t, host.Metrics, 1, "expected previously read host to be unchanged")
+	}
+	remaining, err := repo.GetHosts()
+	assert.NoError(t, err)
+	if assert.Len(t, remaining, 1) {
+		assert.Equal(t, domain.HostId("11"), remaining[0].Id)
+		assert.NotSame(t, hosts[1], remaining[0], "expected remaining host to be copied")
+	}
+}
+
+func Test_CurrentRepositoryRemoveHostSavesSnapshot(t *testing.T) {
+	// Setup
+	path := filepath.Join(t.TempDir(), "current.json")
+	repo, err := NewPersistentCurrentRepository(log.Logger, path)
+	assert.NoError(t, err)
+	assert.NoError(t, repo.Begin())
+	for _, id := range []domain.HostId{"10", "11"} {
+		host := &domain.CurrentHost{Id: id, DSM: dsm_for("comp" + string(id)), Metrics: map[domain.MetricName]domain.CurrentMetric{}}
+		repo.AddMetric(host, &domain.CurrentMetric{Name: "load", Datatype: "double", Value: "1.5", Slope: domain.MetricSlopeBoth, Timestamp: time.Now()})
+		repo.AddHost(host)
+	}
+	assert.NoError(t, repo.Commit())
+
+	// Action
+	err = repo.RemoveHost("10")
+
+	// Assertions
+	assert.NoError(t, err)
+	restoredRepo, err := NewPersistentCurrentRepository(log.Logger, path)
+	assert.NoError(t, err)
+	hosts, err := restoredRepo.GetHosts()
+	assert.NoError(t, err)
+	if assert.Len(t, hosts, 1) {
+		assert.Equal(t, domain.HostId("11"), hosts[0].Id)
+	}
+}
+
+func Test_CurrentRepositoryRemoveHostDuringProcessingRun(t *testing.T) {
+	// Setup
+	repo := NewCurrentRepository(log.Logger)
+	commitCurrentHost(t, repo, &domain.CurrentHost{Id: "10", DSM: dsm_for("comp10")})
+	assert.NoError(t, repo.Begin())
+	for _, id := range []domain.HostId{"10", "11"} {
+		host := &domain.CurrentHost{Id: id, DSM: dsm_for("comp" + string(id)), Metrics: map[domain.MetricName]domain.CurrentMetric{}}
+		repo.AddMetric(host, &domain.CurrentMetric{Name: "load", Datatype: "double", Value: "1.5", Slope: domain.MetricSlopeBoth, Timestamp: time.Now()})
+		repo.AddHost(host)
+	}
+
+	// Action
+	assert.NoError(t, repo.RemoveHost("10"))
+	assert.NoError(t, repo.Commit())
+
+	// Assertions
+	hosts, err := repo.GetHosts()
+	assert.NoError(t, err)
+	if assert.Len(t, hosts, 1) {
+		assert.Equal(t, domain.HostId("11"), hosts[0].Id)
+	}
+	_, err = repo.GetMetricsForHost("10")
+	assert.ErrorIs(t, err, domain.ErrHostNotFound)
+	metricHosts, err := repo.HostsWithMetric("load")
+	assert.NoError(t, err)
+	assert.Len(t, metricHosts, 1)
+}
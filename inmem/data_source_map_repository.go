@@ -94,6 +94,20 @@ func (r *DSMRepo) GetHostId(dsm domain.DSM) (domain.HostId, bool) {
 	return hostId, ok
 }
 
+// GetHostIdForHostName looks up the DSM for the given host name in the
+// configured grid and cluster and returns the stored host id.
+//
+// A second boolean value is returned indicating if the DSM was found, similar
+// to indexing into a map.
+func (r *DSMRepo) GetHostIdForHostName(hostName string) (domain.HostId, bool) {
+	dsm := domain.DSM{
+		GridName:    r.config.GridName,
+		ClusterName: r.config.ClusterName,
+		HostName:    hostName,
+	}
+	return r.GetHostId(dsm)
+}
+
 // Update the state of the repository with the given data.
 func (r *DSMRepo) Update(newHostIdToDSM map[domain.HostId]domain.DSM, newDSMToHostId map[domain.DSM]domain.HostId) error {
 	r.mux.Lock()
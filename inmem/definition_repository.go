@@ -0,0 +1,144 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package inmem
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/config"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/rs/zerolog"
+)
+
+var _ domain.MetricDefinitionRepository = (*DefinitionRepository)(nil)
+
+// DefinitionRepository is an in-memory repository of metric definitions.
+type DefinitionRepository struct {
+	definitions map[string]domain.MetricDefinition
+	mux         sync.Mutex
+	logger      zerolog.Logger
+}
+
+// NewDefinitionRepository returns a DefinitionRepository populated with the
+// given configured metric definitions.  An error is returned if any of the
+// definitions are not valid.
+func NewDefinitionRepository(logger zerolog.Logger, definitions []config.MetricDefinition) (*DefinitionRepository, error) {
+	repo := &DefinitionRepository{
+		definitions: map[string]domain.MetricDefinition{},
+		mux:         sync.Mutex{},
+		logger:      logger.With().Str("component", "definition-repo").Logger(),
+	}
+	for _, d := range definitions {
+		definition := domain.MetricDefinition{
+			Name:        d.Name,
+			Type:        domain.MetricType(d.Type),
+			Units:       d.Units,
+			Slope:       domain.MetricSlope(d.Slope),
+			Min:         d.Min,
+			Max:         d.Max,
+			States:      d.States,
+			Description: d.Description,
+		}
+		if err := repo.Put(definition); err != nil {
+			return nil, fmt.Errorf("loading metric definition %s: %w", d.Name, err)
+		}
+	}
+	return repo, nil
+}
+
+// List returns all metric definitions sorted by name.
+func (r *DefinitionRepository) List() []domain.MetricDefinition {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	definitions := make([]domain.MetricDefinition, 0, len(r.definitions))
+	for _, d := range r.definitions {
+		definitions = append(definitions, d)
+	}
+	sort.Slice(definitions, func(i, j int) bool {
+		return definitions[i].Name < definitions[j].Name
+	})
+	return definitions
+}
+
+// Get returns the metric definition with the given name or pattern.
+func (r *DefinitionRepository) Get(name string) (domain.MetricDefinition, bool) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	d, ok := r.definitions[name]
+	return d, ok
+}
+
+// Put adds the given metric definition, replacing any existing definition
+// with the same name or pattern.
+func (r *DefinitionRepository) Put(definition domain.MetricDefinition) error {
+	if err := definition.Validate(); err != nil {
+		return err
+	}
+	r.logger.Debug().Str("definition", definition.Name).Msg("putting metric definition")
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.definitions[definition.Name] = definition
+	return nil
+}
+
+// Delete removes the metric definition with the given name or pattern.
+func (r *DefinitionRepository) Delete(name string) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if _, ok := r.definitions[name]; !ok {
+		return fmt.Errorf("%w: %s", domain.ErrMetricDefinitionNotFound, name)
+	}
+	r.logger.Debug().Str("definition", name).Msg("deleting metric definition")
+	delete(r.definitions, name)
+	return nil
+}
+
+// Match returns the metric definition that applies to the given metric name.
+//
+// See domain.MetricDefinitionRepository interface for more details.
+func (r *DefinitionRepository) Match(metricName string) (domain.MetricDefinition, bool) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if d, ok := r.definitions[metricName]; ok && !d.IsPattern() {
+		return d, true
+	}
+	var match domain.MetricDefinition
+	found := false
+	for _, d := range r.definitions {
+		if !d.IsPattern() || !d.Matches(metricName) {
+			continue
+		}
+		if !found || len(d.Name) > len(match.Name) || (len(d.Name) == len(match.Name) && d.Name < match.Name) {
+			match = d
+			found = true
+		}
+	}
+	return match, found
+}
@@ -0,0 +1,102 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package inmem
+
+import (
+	"testing"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/config"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DefinitionRepositoryMatch(t *testing.T) {
+	// Setup
+	repo, err := NewDefinitionRepository(log.Logger, []config.MetricDefinition{
+		{Name: "ct.*", Description: "any ct metric"},
+		{Name: "ct.ipmi.*", Description: "any ipmi metric"},
+		{Name: "ct.ipmi.power", Description: "ipmi power"},
+	})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		metric      string
+		expected    string
+		expectFound bool
+	}{
+		{name: "exact name is preferred", metric: "ct.ipmi.power", expected: "ipmi power", expectFound: true},
+		{name: "longest pattern is preferred", metric: "ct.ipmi.temp", expected: "any ipmi metric", expectFound: true},
+		{name: "pattern match", metric: "ct.snmp.temp", expected: "any ct metric", expectFound: true},
+		{name: "no match", metric: "power.level", expectFound: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Action
+			definition, found := repo.Match(tt.metric)
+
+			// Assertions
+			assert.Equal(t, tt.expectFound, found)
+			assert.Equal(t, tt.expected, definition.Description)
+		})
+	}
+}
+
+func Test_DefinitionRepositoryRejectsInvalidDefinitions(t *testing.T) {
+	_, err := NewDefinitionRepository(log.Logger, []config.MetricDefinition{
+		{Name: "power.level", Type: "not-a-type"},
+	})
+	assert.ErrorIs(t, err, domain.ErrInvalidMetricDefinition)
+}
+
+func Test_DefinitionRepositoryValidatesEnumStates(t *testing.T) {
+	tests := []struct {
+		name       string
+		definition config.MetricDefinition
+		valid      bool
+	}{
+		{name: "enum with states", definition: config.MetricDefinition{Name: "power.state", Type: "enum", States: []string{"on", "off"}}, valid: true},
+		{name: "enum without states", definition: config.MetricDefinition{Name: "power.state", Type: "enum"}},
+		{name: "states for a non-enum", definition: config.MetricDefinition{Name: "power.state", Type: "string", States: []string{"on"}}},
+		{name: "blank state", definition: config.MetricDefinition{Name: "power.state", Type: "enum", States: []string{"on", " "}}},
+		{name: "duplicate state", definition: config.MetricDefinition{Name: "power.state", Type: "enum", States: []string{"on", "off", "on"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewDefinitionRepository(log.Logger, []config.MetricDefinition{tt.definition})
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, domain.ErrInvalidMetricDefinition)
+			}
+		})
+	}
+}
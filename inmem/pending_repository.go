@@ -75,7 +75,35 @@ func (pr *PendingRepository) PutMetric(host domain.PendingHost, metric domain.Pe
 	if !pr.isHostStored(host.Id) {
 		return fmt.Errorf("%w: %s", domain.ErrUnknownHost, host.Id)
 	}
-	host.Metrics[domain.MetricName(metric.Name)] = metric
+	host.Metrics[metric.SeriesKey()] = metric
+	return nil
+}
+
+// MergeMetric adds a metric to the repository for the given Host as a single
+// operation.  If the Host has not been added it is added, otherwise its
+// reported time is updated.
+//
+// merge is called, with the repository locked, with the Host as stored and
+// returns the Metric to store.  If merge returns an error, the repository is
+// not changed.
+func (pr *PendingRepository) MergeMetric(host domain.PendingHost, merge func(domain.PendingHost) (domain.PendingMetric, error)) error {
+	pr.logger.Debug().Stringer("host", host.Id).Msg("Merging metric")
+	pr.mux.Lock()
+	defer pr.mux.Unlock()
+	stored, ok := pr.getHost(host.Id)
+	if !ok {
+		stored = host
+		if stored.Metrics == nil {
+			stored.Metrics = map[domain.MetricName]domain.PendingMetric{}
+		}
+	}
+	metric, err := merge(stored)
+	if err != nil {
+		return err
+	}
+	stored.Reported = host.Reported
+	stored.Metrics[metric.SeriesKey()] = metric
+	pr.hosts[host.Id] = stored
 	return nil
 }
 
@@ -109,7 +137,8 @@ func (pr *PendingRepository) getHost(hostId domain.HostId) (domain.PendingHost,
 	return host, true
 }
 
-// UpdateLastProcessed updates the metric's LastProcessed field.
+// UpdateLastProcessed updates the metric's LastProcessed field and discards
+// any backfill values reported at or before that time.
 func (pr *PendingRepository) UpdateLastProcessed(hostId domain.HostId, metricName domain.MetricName, t time.Time) error {
 	pr.logger.Debug().Stringer("host", hostId).Str("metric", string(metricName)).Time("last processed", t).Msg("updating last processed")
 	pr.mux.Lock()
@@ -123,10 +152,69 @@ func (pr *PendingRepository) UpdateLastProcessed(hostId domain.HostId, metricNam
 		return fmt.Errorf("%w: %s", domain.ErrMetricNotFound, metricName)
 	}
 	metric.LastProcessed = &t
+	backfill := make([]domain.PendingValue, 0, len(metric.Backfill))
+	for _, v := range metric.Backfill {
+		if v.Reported.After(t) {
+			backfill = append(backfill, v)
+		}
+	}
+	metric.Backfill = nil
+	if len(backfill) > 0 {
+		metric.Backfill = backfill
+	}
 	host.Metrics[metricName] = metric
 	return nil
 }
 
+// DeleteMetric removes the metric, identified by its series key, from the
+// given host.
+func (pr *PendingRepository) DeleteMetric(hostId domain.HostId, metricName domain.MetricName) error {
+	pr.logger.Debug().Stringer("host", hostId).Str("metric", string(metricName)).Msg("deleting metric")
+	pr.mux.Lock()
+	defer pr.mux.Unlock()
+	host, ok := pr.getHost(hostId)
+	if !ok {
+		return fmt.Errorf("%w: %s", domain.ErrUnknownHost, hostId)
+	}
+	if _, ok := host.Metrics[metricName]; !ok {
+		return fmt.Errorf("%w: %s", domain.ErrMetricNotFound, metricName)
+	}
+	delete(host.Metrics, metricName)
+	return nil
+}
+
+// DeleteMatchingMetrics removes the metrics of the given host for which match
+// returns true and returns their series keys.
+func (pr *PendingRepository) DeleteMatchingMetrics(hostId domain.HostId, match func(domain.PendingMetric) bool) ([]domain.MetricName, error) {
+	pr.logger.Debug().Stringer("host", hostId).Msg("deleting matching metrics")
+	pr.mux.Lock()
+	defer pr.mux.Unlock()
+	host, ok := pr.getHost(hostId)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", domain.ErrUnknownHost, hostId)
+	}
+	deleted := make([]domain.MetricName, 0)
+	for key, metric := range host.Metrics {
+		if match(metric) {
+			deleted = append(deleted, key)
+			delete(host.Metrics, key)
+		}
+	}
+	return deleted, nil
+}
+
+// DeleteHost removes the host and its metrics from the repository.
+func (pr *PendingRepository) DeleteHost(hostId domain.HostId) error {
+	pr.logger.Debug().Stringer("host", hostId).Msg("deleting host")
+	pr.mux.Lock()
+	defer pr.mux.Unlock()
+	if !pr.isHostStored(hostId) {
+		return fmt.Errorf("%w: %s", domain.ErrUnknownHost, hostId)
+	}
+	delete(pr.hosts, hostId)
+	return nil
+}
+
 // New returns an empty in-memory pending repository.
 func NewPendingRepository(logger zerolog.Logger) *PendingRepository {
 	mr := &PendingRepository{
@@ -30,6 +30,8 @@ package inmem
 import (
 	"encoding/json"
 	"os"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -337,3 +339,120 @@ func Test_UpdateLastProcessed(t *testing.T) {
 		})
 	}
 }
+
+func Test_UpdateLastProcessedDiscardsProcessedBackfill(t *testing.T) {
+	// Setup
+	repo := NewPendingRepository(log.Logger)
+	now := time.Now()
+	host := domain.PendingHost{Id: "10", Reported: now, Metrics: map[domain.MetricName]domain.PendingMetric{}}
+	metric := domain.PendingMetric{
+		Name: "power", Value: "10", Units: "W", Slope: "both", TTL: 60, Type: "int32", Reported: now,
+		Backfill: []domain.PendingValue{
+			{Value: "7", Reported: now.Add(-2 * time.Minute)},
+			{Value: "8", Reported: now.Add(-time.Minute)},
+		},
+	}
+	assert.NoError(t, repo.PutHost(host))
+	assert.NoError(t, repo.PutMetric(host, metric))
+
+	// Action
+	err := repo.UpdateLastProcessed("10", "power", now.Add(-90*time.Second))
+
+	// Assertions
+	assert.NoError(t, err)
+	host, _ = repo.GetHost("10")
+	assert.Equal(t, []domain.PendingValue{{Value: "8", Reported: now.Add(-time.Minute)}}, host.Metrics["power"].Backfill)
+
+	// Action
+	err = repo.UpdateLastProcessed("10", "power", now)
+
+	// Assertions
+	assert.NoError(t, err)
+	host, _ = repo.GetHost("10")
+	assert.Nil(t, host.Metrics["power"].Backfill)
+}
+
+func Test_MergeMetricIsNotLostUnderConcurrentReports(t *testing.T) {
+	// Setup
+	repo := NewPendingRepository(log.Logger)
+	host := domain.PendingHost{Id: "10", DSM: dsm_for("comp10"), Metrics: map[domain.MetricName]domain.PendingMetric{}}
+	var wg sync.WaitGroup
+
+	// Action
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := repo.MergeMetric(host, func(stored domain.PendingHost) (domain.PendingMetric, error) {
+				count := 0
+				if existing, ok := stored.Metrics["requests"]; ok {
+					count, _ = strconv.Atoi(existing.Value)
+				}
+				return domain.PendingMetric{Name: "requests", Value: strconv.Itoa(count + 1), Type: domain.MetricTypeInt32}, nil
+			})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	// Assertions
+	stored, ok := repo.GetHost("10")
+	if assert.True(t, ok) {
+		assert.Equal(t, "50", stored.Metrics["requests"].Value)
+	}
+}
+
+func Test_MergeMetricErrorLeavesRepositoryUnchanged(t *testing.T) {
+	// Setup
+	repo := NewPendingRepository(log.Logger)
+	host := domain.PendingHost{Id: "10", DSM: dsm_for("comp10"), Metrics: map[domain.MetricName]domain.PendingMetric{}}
+
+	// Action
+	err := repo.MergeMetric(host, func(domain.PendingHost) (domain.PendingMetric, error) {
+		return domain.PendingMetric{}, domain.ErrOutOfOrderUpdate
+	})
+
+	// Assertions
+	assert.ErrorIs(t, err, domain.ErrOutOfOrderUpdate)
+	assert.Empty(t, repo.GetAll())
+}
+
+func Test_DeleteMatchingMetricsUnderConcurrentReports(t *testing.T) {
+	// Setup
+	repo := NewPendingRepository(log.Logger)
+	host := domain.PendingHost{Id: "10", DSM: dsm_for("comp10"), Metrics: map[domain.MetricName]domain.PendingMetric{}}
+	var wg sync.WaitGroup
+
+	// Action
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			err := repo.MergeMetric(host, func(domain.PendingHost) (domain.PendingMetric, error) {
+				return domain.PendingMetric{Name: "requests", Value: strconv.Itoa(i), Type: domain.MetricTypeInt32, Labels: domain.Labels{"n": strconv.Itoa(i)}}, nil
+			})
+			assert.NoError(t, err)
+		}(i)
+		go func() {
+			defer wg.Done()
+			_, _ = repo.DeleteMatchingMetrics("10", func(m domain.PendingMetric) bool { return m.Name == "requests" })
+		}()
+	}
+	wg.Wait()
+	_, err := repo.DeleteMatchingMetrics("10", func(m domain.PendingMetric) bool { return m.Name == "requests" })
+
+	// Assertions
+	assert.NoError(t, err)
+	stored, ok := repo.GetHost("10")
+	if assert.True(t, ok) {
+		assert.Empty(t, stored.Metrics)
+	}
+}
+
+func Test_DeleteMatchingMetricsUnknownHost(t *testing.T) {
+	repo := NewPendingRepository(log.Logger)
+
+	_, err := repo.DeleteMatchingMetrics("10", func(domain.PendingMetric) bool { return true })
+
+	assert.ErrorIs(t, err, domain.ErrUnknownHost)
+}
@@ -0,0 +1,210 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package otlp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// The JSON encoding of the ExportMetricsServiceRequest as described by the
+// OTLP specification.  Field names are camelCase and 64 bit integers may be
+// given as either strings or numbers.
+type jsonRequest struct {
+	ResourceMetrics []jsonResourceMetrics `json:"resourceMetrics"`
+}
+
+type jsonResourceMetrics struct {
+	Resource struct {
+		Attributes []jsonKeyValue `json:"attributes"`
+	} `json:"resource"`
+	ScopeMetrics []struct {
+		Metrics []jsonMetric `json:"metrics"`
+	} `json:"scopeMetrics"`
+}
+
+type jsonMetric struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Unit        string `json:"unit"`
+	Gauge       *struct {
+		DataPoints []jsonNumberDataPoint `json:"dataPoints"`
+	} `json:"gauge"`
+	Sum *struct {
+		DataPoints             []jsonNumberDataPoint `json:"dataPoints"`
+		AggregationTemporality jsonTemporality       `json:"aggregationTemporality"`
+		IsMonotonic            bool                  `json:"isMonotonic"`
+	} `json:"sum"`
+}
+
+type jsonNumberDataPoint struct {
+	Attributes   []jsonKeyValue `json:"attributes"`
+	TimeUnixNano jsonInt64      `json:"timeUnixNano"`
+	AsDouble     *jsonFloat64   `json:"asDouble"`
+	AsInt        *jsonInt64     `json:"asInt"`
+}
+
+type jsonKeyValue struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue *string      `json:"stringValue"`
+		BoolValue   *bool        `json:"boolValue"`
+		IntValue    *jsonInt64   `json:"intValue"`
+		DoubleValue *jsonFloat64 `json:"doubleValue"`
+	} `json:"value"`
+}
+
+// jsonInt64 is an int64 encoded as either a JSON string or number.
+type jsonInt64 int64
+
+func (i *jsonInt64) UnmarshalJSON(data []byte) error {
+	data = bytes.Trim(data, `"`)
+	v, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid integer: %s", data)
+	}
+	*i = jsonInt64(v)
+	return nil
+}
+
+// jsonTemporality is an AggregationTemporality encoded as either a JSON
+// number or the name of the enum value, e.g.,
+// `AGGREGATION_TEMPORALITY_CUMULATIVE`.
+type jsonTemporality AggregationTemporality
+
+func (t *jsonTemporality) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case `"AGGREGATION_TEMPORALITY_UNSPECIFIED"`:
+		*t = jsonTemporality(TemporalityUnspecified)
+	case `"AGGREGATION_TEMPORALITY_DELTA"`:
+		*t = jsonTemporality(TemporalityDelta)
+	case `"AGGREGATION_TEMPORALITY_CUMULATIVE"`:
+		*t = jsonTemporality(TemporalityCumulative)
+	default:
+		v, err := strconv.Atoi(string(data))
+		if err != nil {
+			return fmt.Errorf("invalid aggregation temporality: %s", data)
+		}
+		*t = jsonTemporality(v)
+	}
+	return nil
+}
+
+// jsonFloat64 is a float64 encoded as either a JSON number or one of the
+// strings `NaN`, `Infinity` or `-Infinity`.
+type jsonFloat64 float64
+
+func (f *jsonFloat64) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case `"NaN"`:
+		*f = jsonFloat64(math.NaN())
+	case `"Infinity"`:
+		*f = jsonFloat64(math.Inf(1))
+	case `"-Infinity"`:
+		*f = jsonFloat64(math.Inf(-1))
+	default:
+		v, err := strconv.ParseFloat(string(bytes.Trim(data, `"`)), 64)
+		if err != nil {
+			return fmt.Errorf("invalid float: %s", data)
+		}
+		*f = jsonFloat64(v)
+	}
+	return nil
+}
+
+// DecodeJSON decodes the given JSON encoded ExportMetricsServiceRequest.
+func DecodeJSON(data []byte) ([]ResourceMetrics, error) {
+	var req jsonRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRequest, err)
+	}
+	resources := make([]ResourceMetrics, 0, len(req.ResourceMetrics))
+	for _, jrm := range req.ResourceMetrics {
+		rm := ResourceMetrics{Attributes: jsonAttributes(jrm.Resource.Attributes)}
+		for _, sm := range jrm.ScopeMetrics {
+			for _, jm := range sm.Metrics {
+				rm.Metrics = append(rm.Metrics, jsonToMetric(jm))
+			}
+		}
+		resources = append(resources, rm)
+	}
+	return resources, nil
+}
+
+func jsonToMetric(jm jsonMetric) Metric {
+	metric := Metric{Name: jm.Name, Description: jm.Description, Unit: jm.Unit}
+	var dataPoints []jsonNumberDataPoint
+	switch {
+	case jm.Gauge != nil:
+		metric.Kind = KindGauge
+		dataPoints = jm.Gauge.DataPoints
+	case jm.Sum != nil:
+		metric.Kind = KindSum
+		metric.Monotonic = jm.Sum.IsMonotonic
+		metric.Temporality = AggregationTemporality(jm.Sum.AggregationTemporality)
+		dataPoints = jm.Sum.DataPoints
+	}
+	for _, jdp := range dataPoints {
+		dp := NumberDataPoint{
+			Attributes: jsonAttributes(jdp.Attributes),
+			Timestamp:  time.Unix(0, int64(jdp.TimeUnixNano)),
+		}
+		if jdp.AsInt != nil {
+			dp.IsInt = true
+			dp.IntValue = int64(*jdp.AsInt)
+		} else if jdp.AsDouble != nil {
+			dp.DoubleValue = float64(*jdp.AsDouble)
+		}
+		metric.DataPoints = append(metric.DataPoints, dp)
+	}
+	return metric
+}
+
+func jsonAttributes(kvs []jsonKeyValue) map[string]string {
+	attrs := map[string]string{}
+	for _, kv := range kvs {
+		v := kv.Value
+		switch {
+		case v.StringValue != nil:
+			attrs[kv.Key] = *v.StringValue
+		case v.BoolValue != nil:
+			attrs[kv.Key] = strconv.FormatBool(*v.BoolValue)
+		case v.IntValue != nil:
+			attrs[kv.Key] = strconv.FormatInt(int64(*v.IntValue), 10)
+		case v.DoubleValue != nil:
+			attrs[kv.Key] = strconv.FormatFloat(float64(*v.DoubleValue), 'f', -1, 64)
+		default:
+			attrs[kv.Key] = ""
+		}
+	}
+	return attrs
+}
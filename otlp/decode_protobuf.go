@@ -0,0 +1,259 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package otlp
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers from the OpenTelemetry protocol's metrics.proto,
+// resource.proto and common.proto.
+const (
+	requestResourceMetrics      protowire.Number = 1
+	resourceMetricsResource     protowire.Number = 1
+	resourceMetricsScopeMetrics protowire.Number = 2
+	resourceAttributes          protowire.Number = 1
+	scopeMetricsMetrics         protowire.Number = 2
+	metricName                  protowire.Number = 1
+	metricDescription           protowire.Number = 2
+	metricUnit                  protowire.Number = 3
+	metricGauge                 protowire.Number = 5
+	metricSum                   protowire.Number = 7
+	gaugeDataPoints             protowire.Number = 1
+	sumDataPoints               protowire.Number = 1
+	sumAggregationTemporality   protowire.Number = 2
+	sumIsMonotonic              protowire.Number = 3
+	dataPointTimeUnixNano       protowire.Number = 3
+	dataPointAsDouble           protowire.Number = 4
+	dataPointAsInt              protowire.Number = 6
+	dataPointAttributes         protowire.Number = 7
+	keyValueKey                 protowire.Number = 1
+	keyValueValue               protowire.Number = 2
+	anyValueString              protowire.Number = 1
+	anyValueBool                protowire.Number = 2
+	anyValueInt                 protowire.Number = 3
+	anyValueDouble              protowire.Number = 4
+	anyValueBytes               protowire.Number = 7
+)
+
+// DecodeProtobuf decodes the given protobuf encoded
+// ExportMetricsServiceRequest.
+func DecodeProtobuf(data []byte) ([]ResourceMetrics, error) {
+	resources := make([]ResourceMetrics, 0)
+	err := walkFields(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		if num != requestResourceMetrics || typ != protowire.BytesType {
+			return nil
+		}
+		rm, err := decodeResourceMetrics(value)
+		if err != nil {
+			return err
+		}
+		resources = append(resources, rm)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRequest, err)
+	}
+	return resources, nil
+}
+
+func decodeResourceMetrics(data []byte) (ResourceMetrics, error) {
+	rm := ResourceMetrics{Attributes: map[string]string{}}
+	err := walkFields(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case resourceMetricsResource:
+			return walkFields(value, func(num protowire.Number, typ protowire.Type, value []byte) error {
+				if num != resourceAttributes || typ != protowire.BytesType {
+					return nil
+				}
+				return decodeKeyValue(value, rm.Attributes)
+			})
+		case resourceMetricsScopeMetrics:
+			return walkFields(value, func(num protowire.Number, typ protowire.Type, value []byte) error {
+				if num != scopeMetricsMetrics || typ != protowire.BytesType {
+					return nil
+				}
+				metric, err := decodeMetric(value)
+				if err != nil {
+					return err
+				}
+				rm.Metrics = append(rm.Metrics, metric)
+				return nil
+			})
+		}
+		return nil
+	})
+	return rm, errors.Wrap(err, "decoding resource metrics")
+}
+
+func decodeMetric(data []byte) (Metric, error) {
+	var metric Metric
+	err := walkFields(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case metricName:
+			metric.Name = string(value)
+		case metricDescription:
+			metric.Description = string(value)
+		case metricUnit:
+			metric.Unit = string(value)
+		case metricGauge, metricSum:
+			metric.Kind = KindGauge
+			if num == metricSum {
+				metric.Kind = KindSum
+			}
+			return walkFields(value, func(num protowire.Number, typ protowire.Type, value []byte) error {
+				switch {
+				case num == gaugeDataPoints && typ == protowire.BytesType:
+					dp, err := decodeNumberDataPoint(value)
+					if err != nil {
+						return err
+					}
+					metric.DataPoints = append(metric.DataPoints, dp)
+				case metric.Kind == KindSum && num == sumAggregationTemporality && typ == protowire.VarintType:
+					v, _ := protowire.ConsumeVarint(value)
+					metric.Temporality = AggregationTemporality(v)
+				case metric.Kind == KindSum && num == sumIsMonotonic && typ == protowire.VarintType:
+					v, _ := protowire.ConsumeVarint(value)
+					metric.Monotonic = protowire.DecodeBool(v)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return metric, errors.Wrap(err, "decoding metric")
+}
+
+func decodeNumberDataPoint(data []byte) (NumberDataPoint, error) {
+	dp := NumberDataPoint{Attributes: map[string]string{}}
+	err := walkFields(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch {
+		case num == dataPointTimeUnixNano && typ == protowire.Fixed64Type:
+			v, _ := protowire.ConsumeFixed64(value)
+			dp.Timestamp = time.Unix(0, int64(v))
+		case num == dataPointAsDouble && typ == protowire.Fixed64Type:
+			v, _ := protowire.ConsumeFixed64(value)
+			dp.DoubleValue = math.Float64frombits(v)
+			dp.IsInt = false
+		case num == dataPointAsInt && typ == protowire.Fixed64Type:
+			v, _ := protowire.ConsumeFixed64(value)
+			dp.IntValue = int64(v)
+			dp.IsInt = true
+		case num == dataPointAttributes && typ == protowire.BytesType:
+			return decodeKeyValue(value, dp.Attributes)
+		}
+		return nil
+	})
+	return dp, errors.Wrap(err, "decoding data point")
+}
+
+// decodeKeyValue decodes a KeyValue message and stores it in attrs.
+func decodeKeyValue(data []byte, attrs map[string]string) error {
+	var key, val string
+	err := walkFields(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch {
+		case num == keyValueKey && typ == protowire.BytesType:
+			key = string(value)
+		case num == keyValueValue && typ == protowire.BytesType:
+			val = decodeAnyValue(value)
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "decoding attribute")
+	}
+	attrs[key] = val
+	return nil
+}
+
+// decodeAnyValue decodes an AnyValue message as a string.  Arrays and key
+// value lists are not supported and are decoded as an empty string.
+func decodeAnyValue(data []byte) string {
+	var val string
+	walkFields(data, func(num protowire.Number, typ protowire.Type, value []byte) error { //nolint:errcheck
+		switch {
+		case num == anyValueString && typ == protowire.BytesType:
+			val = string(value)
+		case num == anyValueBool && typ == protowire.VarintType:
+			v, _ := protowire.ConsumeVarint(value)
+			val = strconv.FormatBool(protowire.DecodeBool(v))
+		case num == anyValueInt && typ == protowire.VarintType:
+			v, _ := protowire.ConsumeVarint(value)
+			val = strconv.FormatInt(int64(v), 10)
+		case num == anyValueDouble && typ == protowire.Fixed64Type:
+			v, _ := protowire.ConsumeFixed64(value)
+			val = strconv.FormatFloat(math.Float64frombits(v), 'f', -1, 64)
+		case num == anyValueBytes && typ == protowire.BytesType:
+			val = fmt.Sprintf("%x", value)
+		}
+		return nil
+	})
+	return val
+}
+
+// walkFields calls f for each field in the given protobuf message.  For
+// length-delimited fields, value is the field's content.  For all other field
+// types value is the field's encoded value.
+func walkFields(data []byte, f func(num protowire.Number, typ protowire.Type, value []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		var value []byte
+		if typ == protowire.BytesType {
+			value, n = protowire.ConsumeBytes(data)
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n >= 0 {
+				value = data[:n]
+			}
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if err := f(num, typ, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package otlp
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendFixed64(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, v)
+}
+
+func encodeStringAttribute(key, value string) []byte {
+	var anyValue []byte
+	anyValue = appendString(anyValue, anyValueString, value)
+	var kv []byte
+	kv = appendString(kv, keyValueKey, key)
+	return appendMessage(kv, keyValueValue, anyValue)
+}
+
+func encodeIntAttribute(key string, value int64) []byte {
+	var anyValue []byte
+	anyValue = protowire.AppendTag(anyValue, anyValueInt, protowire.VarintType)
+	anyValue = protowire.AppendVarint(anyValue, uint64(value))
+	var kv []byte
+	kv = appendString(kv, keyValueKey, key)
+	return appendMessage(kv, keyValueValue, anyValue)
+}
+
+// encodeRequest encodes a request with a single resource having a
+// `host.name` and a `pid` attribute, a gauge, a monotonic sum and a
+// histogram.
+func encodeRequest() []byte {
+	var resource []byte
+	resource = appendMessage(resource, resourceAttributes, encodeStringAttribute("host.name", "comp10"))
+	resource = appendMessage(resource, resourceAttributes, encodeIntAttribute("pid", 42))
+
+	var gaugeDP1, gaugeDP2 []byte
+	gaugeDP1 = appendFixed64(gaugeDP1, dataPointTimeUnixNano, uint64(time.Unix(100, 0).UnixNano()))
+	gaugeDP1 = appendFixed64(gaugeDP1, dataPointAsDouble, math.Float64bits(1.5))
+	gaugeDP1 = appendMessage(gaugeDP1, dataPointAttributes, encodeStringAttribute("cpu", "0"))
+	gaugeDP2 = appendFixed64(gaugeDP2, dataPointTimeUnixNano, uint64(time.Unix(200, 0).UnixNano()))
+	gaugeDP2 = appendFixed64(gaugeDP2, dataPointAsDouble, math.Float64bits(2.5))
+	var gauge []byte
+	gauge = appendMessage(gauge, gaugeDataPoints, gaugeDP1)
+	gauge = appendMessage(gauge, gaugeDataPoints, gaugeDP2)
+	var gaugeMetric []byte
+	gaugeMetric = appendString(gaugeMetric, metricName, "system.cpu.load")
+	gaugeMetric = appendString(gaugeMetric, metricDescription, "CPU load")
+	gaugeMetric = appendString(gaugeMetric, metricUnit, "1")
+	gaugeMetric = appendMessage(gaugeMetric, metricGauge, gauge)
+
+	var sumDP []byte
+	sumDP = appendFixed64(sumDP, dataPointTimeUnixNano, uint64(time.Unix(200, 0).UnixNano()))
+	sumDP = appendFixed64(sumDP, dataPointAsInt, 1024)
+	var sum []byte
+	sum = appendMessage(sum, sumDataPoints, sumDP)
+	sum = protowire.AppendTag(sum, sumAggregationTemporality, protowire.VarintType)
+	sum = protowire.AppendVarint(sum, 2)
+	sum = protowire.AppendTag(sum, sumIsMonotonic, protowire.VarintType)
+	sum = protowire.AppendVarint(sum, 1)
+	var sumMetric []byte
+	sumMetric = appendString(sumMetric, metricName, "system.network.io")
+	sumMetric = appendString(sumMetric, metricUnit, "By")
+	sumMetric = appendMessage(sumMetric, metricSum, sum)
+
+	var histogramMetric []byte
+	histogramMetric = appendString(histogramMetric, metricName, "http.duration")
+	histogramMetric = appendMessage(histogramMetric, 9, nil)
+
+	var scopeMetrics []byte
+	scopeMetrics = appendMessage(scopeMetrics, 1, appendString(nil, 1, "scope"))
+	scopeMetrics = appendMessage(scopeMetrics, scopeMetricsMetrics, gaugeMetric)
+	scopeMetrics = appendMessage(scopeMetrics, scopeMetricsMetrics, sumMetric)
+	scopeMetrics = appendMessage(scopeMetrics, scopeMetricsMetrics, histogramMetric)
+
+	var rm []byte
+	rm = appendMessage(rm, resourceMetricsResource, resource)
+	rm = appendMessage(rm, resourceMetricsScopeMetrics, scopeMetrics)
+	return appendMessage(nil, requestResourceMetrics, rm)
+}
+
+var expectedResources = []ResourceMetrics{
+	{
+		Attributes: map[string]string{"host.name": "comp10", "pid": "42"},
+		Metrics: []Metric{
+			{
+				Name:        "system.cpu.load",
+				Description: "CPU load",
+				Unit:        "1",
+				Kind:        KindGauge,
+				DataPoints: []NumberDataPoint{
+					{Attributes: map[string]string{"cpu": "0"}, Timestamp: time.Unix(100, 0), DoubleValue: 1.5},
+					{Attributes: map[string]string{}, Timestamp: time.Unix(200, 0), DoubleValue: 2.5},
+				},
+			},
+			{
+				Name:        "system.network.io",
+				Unit:        "By",
+				Kind:        KindSum,
+				Monotonic:   true,
+				Temporality: TemporalityCumulative,
+				DataPoints: []NumberDataPoint{
+					{Attributes: map[string]string{}, Timestamp: time.Unix(200, 0), IsInt: true, IntValue: 1024},
+				},
+			},
+			{
+				Name: "http.duration",
+				Kind: KindOther,
+			},
+		},
+	},
+}
+
+func Test_DecodeProtobuf(t *testing.T) {
+	// Action
+	resources, err := DecodeProtobuf(encodeRequest())
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.Equal(t, expectedResources, resources)
+}
+
+func Test_DecodeProtobufInvalid(t *testing.T) {
+	_, err := DecodeProtobuf([]byte{0x0a, 0xff})
+	assert.ErrorIs(t, err, ErrInvalidRequest)
+}
+
+func Test_DecodeJSON(t *testing.T) {
+	// Setup
+	doc := `{
+	  "resourceMetrics": [{
+	    "resource": {"attributes": [
+	      {"key": "host.name", "value": {"stringValue": "comp10"}},
+	      {"key": "pid", "value": {"intValue": "42"}}
+	    ]},
+	    "scopeMetrics": [{
+	      "scope": {"name": "scope"},
+	      "metrics": [
+	        {
+	          "name": "system.cpu.load", "description": "CPU load", "unit": "1",
+	          "gauge": {"dataPoints": [
+	            {"timeUnixNano": "100000000000", "asDouble": 1.5, "attributes": [{"key": "cpu", "value": {"stringValue": "0"}}]},
+	            {"timeUnixNano": 200000000000, "asDouble": 2.5}
+	          ]}
+	        },
+	        {
+	          "name": "system.network.io", "unit": "By",
+	          "sum": {"aggregationTemporality": 2, "isMonotonic": true, "dataPoints": [
+	            {"timeUnixNano": "200000000000", "asInt": "1024"}
+	          ]}
+	        },
+	        {"name": "http.duration", "histogram": {"dataPoints": []}}
+	      ]
+	    }]
+	  }]
+	}`
+
+	// Action
+	resources, err := DecodeJSON([]byte(doc))
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.Equal(t, expectedResources, resources)
+}
+
+func Test_DecodeJSONInvalid(t *testing.T) {
+	_, err := DecodeJSON([]byte(`{"resourceMetrics": [{"scopeMetrics": [{"metrics": [{"gauge": {"dataPoints": [{"asInt": "many"}]}}]}]}]}`))
+	assert.ErrorIs(t, err, ErrInvalidRequest)
+}
+
+func Test_DecodeJSONTemporalityName(t *testing.T) {
+	doc := `{"resourceMetrics": [{"scopeMetrics": [{"metrics": [
+	  {"name": "requests", "sum": {"aggregationTemporality": "AGGREGATION_TEMPORALITY_DELTA", "dataPoints": []}}
+	]}]}]}`
+
+	resources, err := DecodeJSON([]byte(doc))
+
+	assert.NoError(t, err)
+	assert.Equal(t, TemporalityDelta, resources[0].Metrics[0].Temporality)
+}
+
+func Test_LatestDataPoints(t *testing.T) {
+	metric := Metric{
+		DataPoints: []NumberDataPoint{
+			{Attributes: map[string]string{"cpu": "0"}, Timestamp: time.Unix(200, 0), DoubleValue: 1},
+			{Attributes: map[string]string{"cpu": "1"}, Timestamp: time.Unix(100, 0), DoubleValue: 2},
+			{Attributes: map[string]string{"cpu": "0"}, Timestamp: time.Unix(100, 0), DoubleValue: 3},
+			{Attributes: map[string]string{"cpu": "1"}, Timestamp: time.Unix(300, 0), DoubleValue: 4},
+			{Attributes: map[string]string{}, Timestamp: time.Unix(100, 0), DoubleValue: 5},
+		},
+	}
+
+	latest := metric.LatestDataPoints()
+
+	values := make([]float64, 0, len(latest))
+	for _, dp := range latest {
+		values = append(values, dp.DoubleValue)
+	}
+	assert.Equal(t, []float64{1, 4, 5}, values)
+	assert.Empty(t, Metric{}.LatestDataPoints())
+}
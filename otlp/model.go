@@ -0,0 +1,129 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+// Package otlp decodes OpenTelemetry OTLP/HTTP metrics export requests.
+//
+// Requests can be decoded from either their protobuf or JSON encodings.  Only
+// the subset of the OTLP metrics data model needed to ingest gauges and sums
+// is decoded.  Histograms, summaries and exemplars are ignored.
+package otlp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrInvalidRequest is returned if the export request cannot be decoded.
+var ErrInvalidRequest = fmt.Errorf("invalid OTLP metrics request")
+
+// MetricKind is the kind of an OTLP metric.
+type MetricKind int
+
+const (
+	// KindOther is any kind of metric other than a gauge or a sum.
+	KindOther MetricKind = iota
+	KindGauge
+	KindSum
+)
+
+// AggregationTemporality is the aggregation temporality of an OTLP sum.
+type AggregationTemporality int
+
+const (
+	TemporalityUnspecified AggregationTemporality = 0
+	// TemporalityDelta sums report the change since the previous data point.
+	TemporalityDelta AggregationTemporality = 1
+	// TemporalityCumulative sums report the total since a fixed start time.
+	TemporalityCumulative AggregationTemporality = 2
+)
+
+// ResourceMetrics are the metrics for a single resource, e.g., a host.
+type ResourceMetrics struct {
+	// Attributes are the resource's attributes.  Non-string values are
+	// formatted as strings.
+	Attributes map[string]string
+	Metrics    []Metric
+}
+
+// Metric is a single OTLP metric.
+type Metric struct {
+	Name        string
+	Description string
+	Unit        string
+	Kind        MetricKind
+	// Monotonic is true for sums that only increase.
+	Monotonic bool
+	// Temporality is the aggregation temporality of a sum.
+	Temporality AggregationTemporality
+	DataPoints  []NumberDataPoint
+}
+
+// NumberDataPoint is a single data point of a gauge or sum.
+type NumberDataPoint struct {
+	Attributes map[string]string
+	Timestamp  time.Time
+	// IsInt is true if the data point's value was given as an integer.  In
+	// which case IntValue holds the value.  Otherwise DoubleValue does.
+	IsInt       bool
+	IntValue    int64
+	DoubleValue float64
+}
+
+// LatestDataPoints returns the data point with the latest timestamp for each
+// distinct set of attributes, in the order that the attribute sets first
+// appear.
+func (m Metric) LatestDataPoints() []NumberDataPoint {
+	latest := make([]NumberDataPoint, 0)
+	index := map[string]int{}
+	for _, dp := range m.DataPoints {
+		key := attributesKey(dp.Attributes)
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(latest)
+			latest = append(latest, dp)
+		} else if dp.Timestamp.After(latest[i].Timestamp) {
+			latest[i] = dp
+		}
+	}
+	return latest
+}
+
+// attributesKey returns a string uniquely identifying the given attributes.
+func attributesKey(attrs map[string]string) string {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%q=%q;", k, attrs[k])
+	}
+	return b.String()
+}
@@ -0,0 +1,219 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+// Package remotewrite decodes Prometheus remote write requests.
+//
+// Only the subset of the remote write protocol needed to ingest samples is
+// decoded.  Exemplars, native histograms and metadata are ignored.
+package remotewrite
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// MetricNameLabel is the name of the label holding a series' metric name.
+const MetricNameLabel = "__name__"
+
+// ErrInvalidWriteRequest is returned if the write request cannot be decoded.
+var ErrInvalidWriteRequest = fmt.Errorf("invalid remote write request")
+
+// ErrWriteRequestTooLarge is returned if the decompressed write request would
+// be larger than the maximum size.
+var ErrWriteRequestTooLarge = fmt.Errorf("remote write request too large")
+
+// Sample is a single sample of a time series.
+type Sample struct {
+	Value float64
+	// Timestamp is the number of milliseconds since the unix epoch.
+	Timestamp int64
+}
+
+// TimeSeries is a single time series, identified by its labels, and its
+// samples.
+type TimeSeries struct {
+	Labels  map[string]string
+	Samples []Sample
+}
+
+// Name returns the metric name of the time series.
+func (ts TimeSeries) Name() string {
+	return ts.Labels[MetricNameLabel]
+}
+
+// Field numbers from Prometheus' remote.proto and types.proto.
+const (
+	writeRequestTimeseries protowire.Number = 1
+	timeSeriesLabels       protowire.Number = 1
+	timeSeriesSamples      protowire.Number = 2
+	labelName              protowire.Number = 1
+	labelValue             protowire.Number = 2
+	sampleValue            protowire.Number = 1
+	sampleTimestamp        protowire.Number = 2
+)
+
+// DecodeWriteRequest decompresses and decodes the given snappy compressed
+// protobuf encoded WriteRequest and returns its time series.  If the
+// decompressed request would be larger than maxSize bytes, an
+// ErrWriteRequestTooLarge error is returned without decompressing it.  A
+// maxSize of zero means no limit.
+func DecodeWriteRequest(compressed []byte, maxSize int) ([]TimeSeries, error) {
+	size, err := snappy.DecodedLen(compressed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidWriteRequest, errors.Wrap(err, "decompressing"))
+	}
+	if maxSize > 0 && size > maxSize {
+		return nil, fmt.Errorf("%w: %d bytes is more than the maximum of %d", ErrWriteRequestTooLarge, size, maxSize)
+	}
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidWriteRequest, errors.Wrap(err, "decompressing"))
+	}
+	series := make([]TimeSeries, 0)
+	err = walkFields(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		if num != writeRequestTimeseries || typ != protowire.BytesType {
+			return nil
+		}
+		ts, err := decodeTimeSeries(value)
+		if err != nil {
+			return err
+		}
+		series = append(series, ts)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidWriteRequest, err)
+	}
+	return series, nil
+}
+
+func decodeTimeSeries(data []byte) (TimeSeries, error) {
+	ts := TimeSeries{Labels: map[string]string{}}
+	err := walkFields(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case timeSeriesLabels:
+			name, val, err := decodeLabel(value)
+			if err != nil {
+				return err
+			}
+			ts.Labels[name] = val
+		case timeSeriesSamples:
+			sample, err := decodeSample(value)
+			if err != nil {
+				return err
+			}
+			ts.Samples = append(ts.Samples, sample)
+		}
+		return nil
+	})
+	return ts, errors.Wrap(err, "decoding time series")
+}
+
+func decodeLabel(data []byte) (string, string, error) {
+	var name, value string
+	err := walkFields(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case labelName:
+			name = string(v)
+		case labelValue:
+			value = string(v)
+		}
+		return nil
+	})
+	return name, value, errors.Wrap(err, "decoding label")
+}
+
+func decodeSample(data []byte) (Sample, error) {
+	var sample Sample
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return Sample{}, errors.Wrap(protowire.ParseError(n), "decoding sample")
+		}
+		data = data[n:]
+		switch {
+		case num == sampleValue && typ == protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(data)
+			if n < 0 {
+				return Sample{}, errors.Wrap(protowire.ParseError(n), "decoding sample value")
+			}
+			sample.Value = math.Float64frombits(v)
+			data = data[n:]
+		case num == sampleTimestamp && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return Sample{}, errors.Wrap(protowire.ParseError(n), "decoding sample timestamp")
+			}
+			sample.Timestamp = int64(v)
+			data = data[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return Sample{}, errors.Wrap(protowire.ParseError(n), "decoding sample")
+			}
+			data = data[n:]
+		}
+	}
+	return sample, nil
+}
+
+// walkFields calls f for each field in the given protobuf message.  For
+// length-delimited fields, value is the field's content.  For all other field
+// types value is nil.
+func walkFields(data []byte, f func(num protowire.Number, typ protowire.Type, value []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		var value []byte
+		if typ == protowire.BytesType {
+			value, n = protowire.ConsumeBytes(data)
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if err := f(num, typ, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package remotewrite
+
+import (
+	"math"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func Test_DecodeWriteRequest(t *testing.T) {
+	// Setup
+	body := encodeWriteRequest([]TimeSeries{
+		{
+			Labels:  map[string]string{"__name__": "node_load1", "instance": "comp10:9100"},
+			Samples: []Sample{{Value: 1.5, Timestamp: 1000}, {Value: 2.5, Timestamp: 2000}},
+		},
+		{
+			Labels:  map[string]string{"__name__": "up", "concertim_device_id": "1"},
+			Samples: []Sample{{Value: 1, Timestamp: 1000}},
+		},
+	})
+
+	// Action
+	series, err := DecodeWriteRequest(body, 0)
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.Len(t, series, 2)
+	assert.Equal(t, "node_load1", series[0].Name())
+	assert.Equal(t, "comp10:9100", series[0].Labels["instance"])
+	assert.Equal(t, []Sample{{Value: 1.5, Timestamp: 1000}, {Value: 2.5, Timestamp: 2000}}, series[0].Samples)
+	assert.Equal(t, "up", series[1].Name())
+	assert.Equal(t, "1", series[1].Labels["concertim_device_id"])
+}
+
+func Test_DecodeWriteRequestErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body []byte
+	}{
+		{name: "not snappy compressed", body: []byte("not snappy")},
+		{name: "not protobuf", body: snappy.Encode(nil, []byte{0x0a, 0xff})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeWriteRequest(tt.body, 0)
+			assert.ErrorIs(t, err, ErrInvalidWriteRequest)
+		})
+	}
+}
+
+func Test_DecodeWriteRequestTooLarge(t *testing.T) {
+	// Setup
+	body := snappy.Encode(nil, make([]byte, 1024))
+
+	// Action
+	_, err := DecodeWriteRequest(body, 512)
+
+	// Assertions
+	assert.ErrorIs(t, err, ErrWriteRequestTooLarge)
+}
+
+// encodeWriteRequest encodes the given time series as a snappy compressed
+// WriteRequest.
+func encodeWriteRequest(series []TimeSeries) []byte {
+	var req []byte
+	for _, ts := range series {
+		var tsBuf []byte
+		for name, value := range ts.Labels {
+			var label []byte
+			label = protowire.AppendTag(label, labelName, protowire.BytesType)
+			label = protowire.AppendString(label, name)
+			label = protowire.AppendTag(label, labelValue, protowire.BytesType)
+			label = protowire.AppendString(label, value)
+			tsBuf = protowire.AppendTag(tsBuf, timeSeriesLabels, protowire.BytesType)
+			tsBuf = protowire.AppendBytes(tsBuf, label)
+		}
+		for _, s := range ts.Samples {
+			var sample []byte
+			sample = protowire.AppendTag(sample, sampleValue, protowire.Fixed64Type)
+			sample = protowire.AppendFixed64(sample, math.Float64bits(s.Value))
+			sample = protowire.AppendTag(sample, sampleTimestamp, protowire.VarintType)
+			sample = protowire.AppendVarint(sample, uint64(s.Timestamp))
+			tsBuf = protowire.AppendTag(tsBuf, timeSeriesSamples, protowire.BytesType)
+			tsBuf = protowire.AppendBytes(tsBuf, sample)
+		}
+		req = protowire.AppendTag(req, writeRequestTimeseries, protowire.BytesType)
+		req = protowire.AppendBytes(req, tsBuf)
+	}
+	return snappy.Encode(nil, req)
+}
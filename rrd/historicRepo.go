@@ -28,8 +28,10 @@
 package rrd
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"math"
 	"os"
 	"os/exec"
@@ -37,6 +39,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/openflighthpc/concertim-metric-reporting-daemon/config"
@@ -68,7 +71,12 @@ var archives = []string{
 
 var _ domain.HistoricRepository = (*historicRepo)(nil)
 
+// ErrClosed is returned when updating the historic repository after it has
+// been shut down.
+var ErrClosed = errors.New("rrd: historic repository closed")
+
 type historicRepo struct {
+	archiveDir            string
 	cluster               string
 	consolidationFunction string
 	dsmRepo               domain.DataSourceMapRepository
@@ -78,14 +86,28 @@ type historicRepo struct {
 	rrdMetricName         string
 	rrdTool               string
 	step                  time.Duration
+	// The last state recorded in each state log, keyed by the log's path.
+	lastStates map[string]domain.StateChange
+	statesMux  sync.Mutex
+	// The RRD files whose data source types have been checked, see
+	// checkDataSourceTypes.
+	checkedFiles    map[string]struct{}
+	checkedFilesMux sync.Mutex
+	// The in-flight rrdtool commands that update RRD files.
+	closed  bool
+	cmds    sync.WaitGroup
+	cmdsMux sync.Mutex
 }
 
 func NewHistoricRepo(logger zerolog.Logger, config config.RRD, dsmRepo domain.DataSourceMapRepository) *historicRepo {
 	return &historicRepo{
+		archiveDir:            config.ArchiveDirectory,
+		checkedFiles:          map[string]struct{}{},
 		cluster:               config.ClusterName,
 		consolidationFunction: "AVERAGE",
 		dsmRepo:               dsmRepo,
 		grid:                  config.GridName,
+		lastStates:            map[string]domain.StateChange{},
 		logger:                logger.With().Str("component", "historic-repo").Logger(),
 		rrdDir:                config.Directory,
 		rrdMetricName:         "sum",
@@ -97,6 +119,7 @@ func NewHistoricRepo(logger zerolog.Logger, config config.RRD, dsmRepo domain.Da
 func (hr *historicRepo) GetValuesForHostAndMetric(
 	hostId domain.HostId,
 	metricName domain.MetricName,
+	labels domain.Labels,
 	fetchConfig domain.HistoricMetricDuration,
 ) (*domain.HistoricHost, error) {
 	dsm, ok := hr.dsmRepo.GetDSM(hostId)
@@ -108,25 +131,59 @@ func (hr *historicRepo) GetValuesForHostAndMetric(
 		DSM:     dsm,
 		Metrics: map[domain.MetricName][]*domain.HistoricMetric{},
 	}
-	cmd := fetchCmdArgs{
-		clusterName: dsm.ClusterName,
-		hostName:    dsm.HostName,
-		metricName:  metricName,
-		alignStart:  true,
-		resolution:  fetchConfig.Resolution,
-		startTime:   fetchConfig.Start,
-		endTime:     fetchConfig.End,
-	}
-	metrics, err := hr.runFetchCmd(cmd)
+	seriesKeys, err := hr.findSeries(filepath.Join(hr.rrdDir, dsm.ClusterName, dsm.HostName), ".rrd", metricName, labels)
 	if err != nil {
 		return nil, err
 	}
-	host.Metrics[metricName] = metrics
+	if len(seriesKeys) == 0 {
+		return nil, domain.ErrMetricNotFound
+	}
+	for _, seriesKey := range seriesKeys {
+		cmd := fetchCmdArgs{
+			clusterName: dsm.ClusterName,
+			hostName:    dsm.HostName,
+			metricName:  seriesKey,
+			alignStart:  true,
+			resolution:  fetchConfig.Resolution,
+			startTime:   fetchConfig.Start,
+			endTime:     fetchConfig.End,
+		}
+		metrics, err := hr.runFetchCmd(cmd)
+		if err != nil {
+			return nil, err
+		}
+		host.Metrics[seriesKey] = metrics
+	}
 	return &host, nil
 }
 
+// findSeries returns the series keys of the files with the given extension in
+// the given directory for the given metric with labels matching the given
+// labels.
+func (hr *historicRepo) findSeries(dir, ext string, metricName domain.MetricName, labels domain.Labels) ([]domain.MetricName, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("%s %w", "listing metric series", err)
+	}
+	seriesKeys := make([]domain.MetricName, 0)
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ext {
+			continue
+		}
+		seriesKey := domain.MetricName(strings.TrimSuffix(entry.Name(), ext))
+		name, seriesLabels := domain.ParseSeriesKey(seriesKey)
+		if name == string(metricName) && seriesLabels.Matches(labels) {
+			seriesKeys = append(seriesKeys, seriesKey)
+		}
+	}
+	return seriesKeys, nil
+}
+
 func (hr *historicRepo) GetValuesForMetric(
 	metricName domain.MetricName,
+	labels domain.Labels,
 	fetchConfig domain.HistoricMetricDuration,
 ) ([]*domain.HistoricHost, error) {
 	hosts := make([]*domain.HistoricHost, 0)
@@ -145,7 +202,7 @@ func (hr *historicRepo) GetValuesForMetric(
 			hr.logger.Debug().Stringer("dsm", dsm).Msg("unknown host")
 			continue
 		}
-		host, err := hr.GetValuesForHostAndMetric(hostId, metricName, fetchConfig)
+		host, err := hr.GetValuesForHostAndMetric(hostId, metricName, labels, fetchConfig)
 		if err != nil {
 			hr.logger.Error().Err(err).Stringer("dsm", dsm).Str("metric", string(metricName)).Msg("fetching metrics")
 			continue
@@ -169,6 +226,38 @@ func (hr *historicRepo) ListHostMetricNames(hostId domain.HostId) ([]string, err
 	return hr.getMetricNames(path)
 }
 
+// ListStoredMetricNames lists the metric names of all RRD files for all hosts,
+// including the summary files.  Each metric name is included once.  Archived
+// RRD files are not included.
+func (hr *historicRepo) ListStoredMetricNames() ([]string, error) {
+	found := map[string]struct{}{}
+	err := filepath.WalkDir(hr.rrdDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && hr.archiveDir != "" && filepath.Clean(path) == filepath.Clean(hr.archiveDir) {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || filepath.Ext(d.Name()) != ".rrd" {
+			return nil
+		}
+		name, _ := domain.ParseSeriesKey(domain.MetricName(strings.TrimSuffix(d.Name(), ".rrd")))
+		found[name] = struct{}{}
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("%s %w", "listing stored metric names", err)
+	}
+	metricNames := make([]string, 0, len(found))
+	for name := range found {
+		metricNames = append(metricNames, name)
+	}
+	slices.SortFunc(metricNames, strings.Compare)
+	return metricNames, nil
+}
+
 func (hr *historicRepo) getHosts() ([]string, error) {
 	cmd := exec.Command(hr.rrdTool, "list", filepath.Join(hr.rrdDir, hr.cluster))
 	hr.logger.Debug().Str("cmd", cmd.String()).Msg("listing historic hosts")
@@ -259,47 +348,93 @@ func (hr *historicRepo) runFetchCmd(args fetchCmdArgs) ([]*domain.HistoricMetric
 	return hr.parseMetricValues(out), nil
 }
 
+// parseMetricValues parses the output of rrdtool fetch.  The output starts
+// with a header line naming the file's data sources followed by a line for
+// each timestamp giving the value of each data source.
+//
+//	                      sum
+//
+//	1696431225: 1.2000000000e+01
+//
+// If the file has the data sources of a distribution metric, the values of
+// all of them are parsed into the metric's HistoricDistribution.
 func (hr *historicRepo) parseMetricValues(input []byte) []*domain.HistoricMetric {
 	lines := strings.Split(string(input), "\n")
-	foundStart := false
+	var columns map[string]int
 	metrics := make([]*domain.HistoricMetric, 0, len(lines))
 	for _, line := range lines {
-		if !foundStart {
-			if strings.Trim(line, " ") == hr.rrdMetricName {
-				foundStart = true
+		if columns == nil {
+			fields := strings.Fields(line)
+			if slices.Contains(fields, hr.rrdMetricName) {
+				columns = make(map[string]int, len(fields))
+				for i, field := range fields {
+					columns[field] = i
+				}
 			}
 			continue
 		}
 		if line == "" {
 			continue
 		}
-		fields := strings.Split(line, ": ")
-		timestampStr := fields[0]
-		valueStr := fields[1]
-
+		timestampStr, valuesStr, _ := strings.Cut(line, ": ")
 		timestamp, err := strconv.ParseInt(timestampStr, 10, 64)
 		if err != nil {
 			hr.logger.Error().Err(err).Msg("failed to parse timestamp")
 			continue
 		}
-		var value float64
-		if valueStr == "-nan" || valueStr == "nan" {
-			value = math.NaN()
-		} else {
-			value, err = strconv.ParseFloat(valueStr, 64)
-			if err != nil {
-				hr.logger.Error().Err(err).Msg("failed to parse value")
-				continue
-			}
+		values, err := parseFetchedValues(strings.Fields(valuesStr))
+		if err != nil {
+			hr.logger.Error().Err(err).Msg("failed to parse value")
+			continue
+		}
+		if len(values) != len(columns) {
+			hr.logger.Error().Str("line", line).Msg("unexpected number of values")
+			continue
 		}
-		metrics = append(metrics, &domain.HistoricMetric{
-			Value:     value,
+		metric := &domain.HistoricMetric{
+			Value:     values[columns[hr.rrdMetricName]],
 			Timestamp: timestamp,
-		})
+		}
+		if countCol, ok := columns["count"]; ok {
+			metric.Distribution = &domain.HistoricDistribution{
+				Count:     values[countCol],
+				Sum:       metric.Value,
+				Quantiles: make(map[string]float64, len(domain.DistributionQuantiles)),
+			}
+			for _, q := range domain.DistributionQuantiles {
+				metric.Distribution.Quantiles[q.Name] = math.NaN()
+				if col, ok := columns[q.Name]; ok {
+					metric.Distribution.Quantiles[q.Name] = values[col]
+				}
+			}
+			metric.Value = math.NaN()
+			if metric.Distribution.Count > 0 {
+				metric.Value = metric.Distribution.Sum / metric.Distribution.Count
+			}
+		}
+		metrics = append(metrics, metric)
 	}
 	return metrics
 }
 
+// parseFetchedValues parses the values of a line of rrdtool fetch output.
+// Unknown values are parsed as NaN.
+func parseFetchedValues(fields []string) ([]float64, error) {
+	values := make([]float64, 0, len(fields))
+	for _, field := range fields {
+		if field == "-nan" || field == "nan" {
+			values = append(values, math.NaN())
+			continue
+		}
+		value, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
 func (hr *historicRepo) UpdateSummaryMetrics(summaries domain.MetricSummaries) error {
 	var err error
 	for metricName, summary := range summaries.GetSummaries() {
@@ -319,7 +454,7 @@ func (hr *historicRepo) UpdateSummaryMetrics(summaries domain.MetricSummaries) e
 		}
 		values = fmt.Sprintf("%s:%d", values, summary.Num)
 		r.run(func() error { return hr.runMkdir(rrdFilePath) })
-		r.run(func() error { return hr.runCreateCmd(rrdFilePath, timestamp, true) })
+		r.run(func() error { return hr.runCreateCmd(rrdFilePath, timestamp, summaryDataSources) })
 		r.run(func() error { return hr.runUpdateCmd(rrdFilePath, timestamp, values) })
 		err = errors.Join(err, r.err)
 	}
@@ -329,14 +464,65 @@ func (hr *historicRepo) UpdateSummaryMetrics(summaries domain.MetricSummaries) e
 func (hr *historicRepo) UpdateMetric(host *domain.CurrentHost, metric *domain.CurrentMetric) error {
 	hr.logger.Debug().Stringer("host", host.DSM).Str("metric", metric.Name).Str("value", metric.Value).Int64("timestamp", metric.Timestamp.Unix()).Msg("updating metric")
 	rrdFileDir := filepath.Join(hr.rrdDir, host.DSM.ClusterName, host.DSM.HostName)
-	rrdFilePath := filepath.Join(rrdFileDir, fmt.Sprintf("%s.rrd", metric.Name))
+	// Each of the metric's series is stored in its own file.
+	rrdFilePath := filepath.Join(rrdFileDir, fmt.Sprintf("%s.rrd", metric.SeriesKey()))
+	values := metric.Value
+	if metric.Datatype == domain.MetricTypeDistribution.String() {
+		d, err := domain.DecodeDistribution(metric.Value)
+		if err != nil {
+			return err
+		}
+		values = distributionValues(d)
+	}
 	r := updateRunner{}
 	r.run(func() error { return hr.runMkdir(rrdFilePath) })
-	r.run(func() error { return hr.runCreateCmd(rrdFilePath, metric.Timestamp, false) })
-	r.run(func() error { return hr.runUpdateCmd(rrdFilePath, metric.Timestamp, metric.Value) })
+	r.run(func() error { return hr.runCreateCmd(rrdFilePath, metric.Timestamp, metricDataSources(metric)) })
+	r.run(func() error { return hr.runUpdateCmd(rrdFilePath, metric.Timestamp, values) })
 	return r.err
 }
 
+// RemoveHost removes the RRD files for the host with the given data source
+// map.  If an archive directory is configured, the host's directory is moved
+// to <archive directory>/<cluster>/<host>.<unix time> instead of being
+// deleted.
+func (hr *historicRepo) RemoveHost(dsm domain.DSM) error {
+	if !isSafePathSegment(dsm.ClusterName) || !isSafePathSegment(dsm.HostName) {
+		return fmt.Errorf("refusing to remove RRD files for %s: invalid cluster or host name", dsm)
+	}
+	hostDir := filepath.Join(hr.rrdDir, dsm.ClusterName, dsm.HostName)
+	if _, err := os.Stat(hostDir); errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("%s %w", "error checking if RRD directory exists", err)
+	}
+	if hr.archiveDir == "" {
+		hr.logger.Info().Stringer("host", dsm).Str("dir", hostDir).Msg("deleting RRD files")
+		if err := os.RemoveAll(hostDir); err != nil {
+			return fmt.Errorf("%s %w", "error deleting RRD files", err)
+		}
+		hr.forgetStates(hostDir)
+		hr.forgetCheckedFiles(hostDir)
+		return nil
+	}
+	archivePath := filepath.Join(hr.archiveDir, dsm.ClusterName, fmt.Sprintf("%s.%d", dsm.HostName, time.Now().Unix()))
+	hr.logger.Info().Stringer("host", dsm).Str("dir", hostDir).Str("archive", archivePath).Msg("archiving RRD files")
+	if err := hr.runMkdir(archivePath); err != nil {
+		return fmt.Errorf("%s %w", "error creating archive directory", err)
+	}
+	if err := os.Rename(hostDir, archivePath); err != nil {
+		return fmt.Errorf("%s %w", "error archiving RRD files", err)
+	}
+	hr.forgetStates(hostDir)
+	hr.forgetCheckedFiles(hostDir)
+	return nil
+}
+
+// isSafePathSegment returns true if name can be safely used as a single
+// segment of a file path.
+func isSafePathSegment(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsRune(name, filepath.Separator)
+}
+
 type updateRunner struct {
 	err error
 }
@@ -352,16 +538,177 @@ func (hr *historicRepo) runMkdir(rrdFilePath string) error {
 	return os.MkdirAll(dirname, 0755)
 }
 
-func (hr *historicRepo) runCreateCmd(rrdFilePath string, timestamp time.Time, summary bool) error {
+// heartbeat is the maximum number of seconds between updates before a data
+// source's value becomes unknown.
+const heartbeat = 120
+
+// summaryDataSources are the data sources used in the RRD files for metric
+// summaries.  They record the sum of the metric's values and the number of
+// hosts reporting it.
+var summaryDataSources = []string{
+	dataSource("sum", "GAUGE", "NaN"),
+	dataSource("num", "GAUGE", "NaN"),
+}
+
+func dataSource(name, dsType, min string) string {
+	return fmt.Sprintf("DS:%s:%s:%d:%s:NaN", name, dsType, heartbeat, min)
+}
+
+// metricDataSources returns the data sources used in the RRD file for the
+// given metric.  The data source type is chosen from the metric's slope.
+//
+// Metrics with a positive slope are counters, so that the historic values are
+// per-second rates.  Unsigned integer counters are recorded as COUNTER data
+// sources, which treat a decrease in the value as the counter wrapping at 32
+// or 64 bits.  Other counters are recorded as DERIVE data sources with a
+// minimum of 0, so that a reset results in a negative rate, which is recorded
+// as unknown rather than as a spike in the rate.  Metrics with a derivative
+// slope are recorded as DERIVE data sources without a minimum.  Floating point
+// metrics use DDERIVE as DERIVE only accepts integers.
+//
+// Distribution metrics are recorded with the data sources in
+// distributionDataSources.  All other metrics are recorded as GAUGE data
+// sources.
+func metricDataSources(metric *domain.CurrentMetric) []string {
+	if metric.Datatype == domain.MetricTypeDistribution.String() {
+		return distributionDataSources()
+	}
+	dsType := "GAUGE"
+	min := "NaN"
+	switch metric.Slope {
+	case domain.MetricSlopePositive:
+		dsType = "DERIVE"
+		min = "0"
+		if isUnsignedDatatype(metric.Datatype) {
+			dsType = "COUNTER"
+			min = "NaN"
+		}
+	case domain.MetricSlopeDerivative:
+		dsType = "DERIVE"
+	}
+	if dsType == "DERIVE" && (metric.Datatype == "float" || metric.Datatype == "double") {
+		dsType = "DDERIVE"
+	}
+	return []string{dataSource("sum", dsType, min)}
+}
+
+// isUnsignedDatatype returns true if the given metric datatype is an
+// unsigned integer type.
+func isUnsignedDatatype(datatype string) bool {
+	switch datatype {
+	case domain.MetricTypeUint8.String(), domain.MetricTypeUint16.String(),
+		domain.MetricTypeUint32.String(), domain.MetricTypeUint64.String():
+		return true
+	}
+	return false
+}
+
+// tuneArgs returns the arguments to rrdtool tune that would change the data
+// sources described by the given rrdtool info output to the given data
+// sources.  Only the type and minimum of data sources whose type differs are
+// changed.  If none differ, nil is returned.
+func tuneArgs(info []byte, dss []string) []string {
+	existing := map[string]string{}
+	for _, line := range strings.Split(string(info), "\n") {
+		key, value, found := strings.Cut(line, " = ")
+		name, ok := strings.CutPrefix(key, "ds[")
+		if !found || !ok {
+			continue
+		}
+		if name, ok = strings.CutSuffix(name, "].type"); ok {
+			existing[name] = strings.Trim(value, `"`)
+		}
+	}
+	var args []string
+	for _, ds := range dss {
+		// Each data source is DS:<name>:<type>:<heartbeat>:<min>:<max>.
+		fields := strings.Split(ds, ":")
+		name, dsType, min := fields[1], fields[2], fields[4]
+		if existing[name] == dsType {
+			continue
+		}
+		args = append(args, "--data-source-type", fmt.Sprintf("%s:%s", name, dsType))
+		if min != "NaN" {
+			args = append(args, "--minimum", fmt.Sprintf("%s:%s", name, min))
+		}
+	}
+	return args
+}
+
+// distributionDataSources returns the data sources used in the RRD files for
+// distribution metrics.  They record the number and sum of the observations
+// and each of the domain.DistributionQuantiles.
+func distributionDataSources() []string {
+	dss := []string{
+		dataSource("count", "GAUGE", "0"),
+		dataSource("sum", "GAUGE", "NaN"),
+	}
+	for _, q := range domain.DistributionQuantiles {
+		dss = append(dss, dataSource(q.Name, "GAUGE", "NaN"))
+	}
+	return dss
+}
+
+// distributionValues returns the values to update the data sources in
+// distributionDataSources with.  Quantiles that could not be calculated are
+// recorded as unknown.
+func distributionValues(d *domain.Distribution) string {
+	values := []string{
+		strconv.FormatUint(d.Count, 10),
+		strconv.FormatFloat(d.Sum, 'f', -1, 64),
+	}
+	for _, q := range domain.DistributionQuantiles {
+		if value, ok := d.Quantiles[q.Name]; ok {
+			values = append(values, strconv.FormatFloat(value, 'f', -1, 64))
+		} else {
+			values = append(values, "U")
+		}
+	}
+	return strings.Join(values, ":")
+}
+
+// Shutdown stops any further rrdtool commands from updating the RRD files and
+// waits for those in-flight to complete or for the context to be done.
+func (hr *historicRepo) Shutdown(ctx context.Context) error {
+	hr.cmdsMux.Lock()
+	hr.closed = true
+	hr.cmdsMux.Unlock()
+	finished := make(chan struct{})
+	go func() {
+		hr.cmds.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// startCmd records the start of an rrdtool command updating the RRD files.
+// The returned function must be called once the command has completed.
+func (hr *historicRepo) startCmd() (func(), error) {
+	hr.cmdsMux.Lock()
+	defer hr.cmdsMux.Unlock()
+	if hr.closed {
+		return nil, ErrClosed
+	}
+	hr.cmds.Add(1)
+	return hr.cmds.Done, nil
+}
+
+func (hr *historicRepo) runCreateCmd(rrdFilePath string, timestamp time.Time, dss []string) error {
+	done, err := hr.startCmd()
+	if err != nil {
+		return err
+	}
+	defer done()
 	if _, err := os.Stat(rrdFilePath); err == nil {
 		// File already exists.
+		hr.checkDataSourceTypes(rrdFilePath, dss)
 		return nil
 	} else if errors.Is(err, os.ErrNotExist) {
-		heartbeat := 120
-		dss := []string{fmt.Sprintf("DS:sum:GAUGE:%d:NaN:NaN", heartbeat)}
-		if summary {
-			dss = append(dss, fmt.Sprintf("DS:num:GAUGE:%d:NaN:NaN", heartbeat))
-		}
 		step := int64(hr.step.Seconds())
 		cmd := exec.Command(
 			hr.rrdTool, "create", rrdFilePath,
@@ -383,7 +730,50 @@ func (hr *historicRepo) runCreateCmd(rrdFilePath string, timestamp time.Time, su
 	}
 }
 
+// checkDataSourceTypes logs a warning if the data source types of the existing
+// RRD file differ from those it would now be created with, e.g., a counter
+// whose file was created before counters were recorded as rates.  Such files
+// continue to record values according to their existing types until
+// converted with the logged rrdtool tune command.  Each file is checked once.
+func (hr *historicRepo) checkDataSourceTypes(rrdFilePath string, dss []string) {
+	hr.checkedFilesMux.Lock()
+	_, checked := hr.checkedFiles[rrdFilePath]
+	hr.checkedFiles[rrdFilePath] = struct{}{}
+	hr.checkedFilesMux.Unlock()
+	if checked {
+		return
+	}
+	cmd := exec.Command(hr.rrdTool, "info", rrdFilePath)
+	out, err := cmd.Output()
+	if err != nil {
+		hr.logger.Warn().Err(augmentError(err, hr.rrdTool, "reading RRD file info")).Str("file", rrdFilePath).Msg("checking data source types")
+		return
+	}
+	if args := tuneArgs(out, dss); args != nil {
+		tune := exec.Command(hr.rrdTool, append([]string{"tune", rrdFilePath}, args...)...)
+		hr.logger.Warn().Str("file", rrdFilePath).Str("tune", tune.String()).
+			Msg("RRD file's data source types do not match the metric's slope and type")
+	}
+}
+
+// forgetCheckedFiles removes the RRD files in the given directory from those
+// whose data source types have been checked.
+func (hr *historicRepo) forgetCheckedFiles(dir string) {
+	hr.checkedFilesMux.Lock()
+	defer hr.checkedFilesMux.Unlock()
+	for rrdFilePath := range hr.checkedFiles {
+		if strings.HasPrefix(rrdFilePath, dir+string(filepath.Separator)) {
+			delete(hr.checkedFiles, rrdFilePath)
+		}
+	}
+}
+
 func (hr *historicRepo) runUpdateCmd(rrdFilePath string, timestamp time.Time, values string) error {
+	done, err := hr.startCmd()
+	if err != nil {
+		return err
+	}
+	defer done()
 	valueSpec := fmt.Sprintf("%d:%s", timestamp.Unix(), values)
 	cmd := exec.Command(
 		hr.rrdTool, "update", rrdFilePath, valueSpec,
@@ -392,7 +782,29 @@ func (hr *historicRepo) runUpdateCmd(rrdFilePath string, timestamp time.Time, va
 	out, err := cmd.Output()
 	hr.logger.Debug().Str("cmd", cmd.String()).Bytes("out", out).Msg("updated metrics")
 	if err != nil {
-		return augmentError(err, hr.rrdTool, "updating RRD file")
+		return updateError(err, hr.rrdTool, rrdFilePath, timestamp)
 	}
 	return nil
 }
+
+// updateError returns an error describing the failure of an rrdtool update
+// command.  If rrdtool rejected the update because it is not after the last
+// update to the file, the returned error wraps domain.ErrOutOfOrderUpdate.
+func updateError(err error, path, rrdFilePath string, timestamp time.Time) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && isOutOfOrderUpdate(string(exitErr.Stderr)) {
+		return fmt.Errorf(
+			"%w: updating RRD file %s for %s: %s",
+			domain.ErrOutOfOrderUpdate, rrdFilePath, timestamp.Format(time.RFC3339), strings.TrimSpace(string(exitErr.Stderr)),
+		)
+	}
+	return augmentError(err, path, "updating RRD file")
+}
+
+// isOutOfOrderUpdate returns true if the given rrdtool error output is for an
+// update that was not after the last update, e.g.,
+//
+//	ERROR: /path/to/file.rrd: illegal attempt to update using time 1696431225 when last update time is 1696431230 (minimum one second step)
+func isOutOfOrderUpdate(stderr string) bool {
+	return strings.Contains(stderr, "illegal attempt to update using time")
+}
@@ -28,11 +28,15 @@
 package rrd
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/openflighthpc/concertim-metric-reporting-daemon/config"
 	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
@@ -65,6 +69,13 @@ func (fakeDSMRepo) GetHostId(dsm domain.DSM) (domain.HostId, bool) {
 	return domain.HostId(parts[1]), true
 }
 
+func (f fakeDSMRepo) GetHostIdForHostName(hostName string) (domain.HostId, bool) {
+	if hostName == "NOPE" {
+		return "", false
+	}
+	return f.GetHostId(domain.DSM{HostName: hostName})
+}
+
 func (fakeDSMRepo) Update(_ map[domain.HostId]domain.DSM, _ map[domain.DSM]domain.HostId) (_ error) {
 	panic("not implemented") // TODO: Implement
 }
@@ -350,6 +361,7 @@ func Test_GetValuesForHostAndMetric(t *testing.T) {
 			historicHost, err := repo.GetValuesForHostAndMetric(
 				domain.HostId(tt.hostId),
 				domain.MetricName(tt.metric),
+				nil,
 				domain.HistoricMetricDuration{
 					Start: fmt.Sprint(tt.startTime),
 					End:   fmt.Sprint(tt.endTime),
@@ -380,3 +392,462 @@ func Test_GetValuesForHostAndMetric(t *testing.T) {
 		})
 	}
 }
+
+func Test_updateErrorForOutOfOrderUpdate(t *testing.T) {
+	tests := []struct {
+		name        string
+		stderr      string
+		expectedErr error
+	}{
+		{
+			name:        "out of order update",
+			stderr:      "ERROR: /tmp/foo.rrd: illegal attempt to update using time 1696431225 when last update time is 1696431230 (minimum one second step)",
+			expectedErr: domain.ErrOutOfOrderUpdate,
+		},
+		{
+			name:   "other errors",
+			stderr: "ERROR: opening '/tmp/foo.rrd': No such file or directory",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			cmd := exec.Command("sh", "-c", fmt.Sprintf("echo '%s' >&2; exit 1", tt.stderr))
+			_, cmdErr := cmd.Output()
+
+			// Action
+			err := updateError(cmdErr, "rrdtool", "/tmp/foo.rrd", time.Unix(1696431225, 0))
+
+			// Assertions
+			assert.Error(t, err)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				assert.NotErrorIs(t, err, domain.ErrOutOfOrderUpdate)
+			}
+		})
+	}
+}
+
+func Test_metricDataSources(t *testing.T) {
+	tests := []struct {
+		name     string
+		slope    domain.MetricSlope
+		datatype string
+		expected []string
+	}{
+		{name: "zero slope", slope: domain.MetricSlopeZero, datatype: "uint32", expected: []string{"DS:sum:GAUGE:120:NaN:NaN"}},
+		{name: "both slope", slope: domain.MetricSlopeBoth, datatype: "double", expected: []string{"DS:sum:GAUGE:120:NaN:NaN"}},
+		{name: "negative slope", slope: domain.MetricSlopeNegative, datatype: "int32", expected: []string{"DS:sum:GAUGE:120:NaN:NaN"}},
+		{name: "positive slope", slope: domain.MetricSlopePositive, datatype: "int32", expected: []string{"DS:sum:DERIVE:120:0:NaN"}},
+		{name: "positive slope unsigned", slope: domain.MetricSlopePositive, datatype: "uint64", expected: []string{"DS:sum:COUNTER:120:NaN:NaN"}},
+		{name: "positive slope float", slope: domain.MetricSlopePositive, datatype: "float", expected: []string{"DS:sum:DDERIVE:120:0:NaN"}},
+		{name: "derivative slope", slope: domain.MetricSlopeDerivative, datatype: "int32", expected: []string{"DS:sum:DERIVE:120:NaN:NaN"}},
+		{name: "derivative slope double", slope: domain.MetricSlopeDerivative, datatype: "double", expected: []string{"DS:sum:DDERIVE:120:NaN:NaN"}},
+		{
+			name:     "distribution",
+			slope:    domain.MetricSlopeBoth,
+			datatype: "distribution",
+			expected: []string{
+				"DS:count:GAUGE:120:0:NaN",
+				"DS:sum:GAUGE:120:NaN:NaN",
+				"DS:p50:GAUGE:120:NaN:NaN",
+				"DS:p90:GAUGE:120:NaN:NaN",
+				"DS:p99:GAUGE:120:NaN:NaN",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			metric := &domain.CurrentMetric{Name: "foo", Datatype: tt.datatype, Slope: tt.slope}
+
+			// Action
+			dss := metricDataSources(metric)
+
+			// Assertions
+			assert.Equal(t, tt.expected, dss)
+		})
+	}
+}
+
+func Test_tuneArgs(t *testing.T) {
+	info := []byte(`filename = "/var/lib/metric-reporting-daemon/rrds/unspecified/comp10/power.rrd"
+rrd_version = "0003"
+step = 15
+ds[sum].index = 0
+ds[sum].type = "GAUGE"
+ds[sum].minimal_heartbeat = 120
+ds[sum].min = NaN
+ds[sum].max = NaN
+`)
+	tests := []struct {
+		name     string
+		dss      []string
+		expected []string
+	}{
+		{name: "matching types", dss: []string{"DS:sum:GAUGE:120:NaN:NaN"}, expected: nil},
+		{name: "counter", dss: []string{"DS:sum:COUNTER:120:NaN:NaN"}, expected: []string{"--data-source-type", "sum:COUNTER"}},
+		{
+			name:     "derive with minimum",
+			dss:      []string{"DS:sum:DERIVE:120:0:NaN"},
+			expected: []string{"--data-source-type", "sum:DERIVE", "--minimum", "sum:0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Action
+			args := tuneArgs(info, tt.dss)
+
+			// Assertions
+			assert.Equal(t, tt.expected, args)
+		})
+	}
+}
+
+func Test_distributionValues(t *testing.T) {
+	// Setup
+	d := &domain.Distribution{
+		Count:     4,
+		Sum:       2.5,
+		Quantiles: map[string]float64{"p50": 0.5, "p90": 1.25},
+	}
+
+	// Action
+	values := distributionValues(d)
+
+	// Assertions
+	assert.Equal(t, "4:2.5:0.5:1.25:U", values)
+}
+
+func Test_parseMetricValues(t *testing.T) {
+	hr := NewHistoricRepo(log.Logger, config.RRD{}, dsmRepo)
+
+	t.Run("single data source", func(t *testing.T) {
+		// Setup
+		input := "                          sum\n\n1696431225: 1.2000000000e+01\n1696431240: -nan\n"
+
+		// Action
+		metrics := hr.parseMetricValues([]byte(input))
+
+		// Assertions
+		if assert.Len(t, metrics, 2) {
+			assert.Equal(t, &domain.HistoricMetric{Timestamp: 1696431225, Value: 12}, metrics[0])
+			assert.Equal(t, int64(1696431240), metrics[1].Timestamp)
+			assert.True(t, math.IsNaN(metrics[1].Value))
+		}
+	})
+
+	t.Run("distribution data sources", func(t *testing.T) {
+		// Setup
+		input := "                        count                  sum                  p50                  p90                  p99\n\n" +
+			"1696431225: 4.0000000000e+00 1.0000000000e+01 2.0000000000e+00 4.0000000000e+00 -nan\n" +
+			"1696431240: -nan -nan -nan -nan -nan\n"
+
+		// Action
+		metrics := hr.parseMetricValues([]byte(input))
+
+		// Assertions
+		if assert.Len(t, metrics, 2) {
+			assert.Equal(t, int64(1696431225), metrics[0].Timestamp)
+			assert.Equal(t, 2.5, metrics[0].Value)
+			if assert.NotNil(t, metrics[0].Distribution) {
+				assert.Equal(t, 4.0, metrics[0].Distribution.Count)
+				assert.Equal(t, 10.0, metrics[0].Distribution.Sum)
+				assert.Equal(t, 2.0, metrics[0].Distribution.Quantiles["p50"])
+				assert.Equal(t, 4.0, metrics[0].Distribution.Quantiles["p90"])
+				assert.True(t, math.IsNaN(metrics[0].Distribution.Quantiles["p99"]))
+			}
+			assert.True(t, math.IsNaN(metrics[1].Value))
+		}
+	})
+}
+
+func Test_findSeries(t *testing.T) {
+	// Setup
+	dir := t.TempDir()
+	files := []string{
+		"net.bytes;direction=rx;iface=eth0.rrd",
+		"net.bytes;direction=tx;iface=eth0.rrd",
+		"net.bytes;direction=rx;iface=eth1.rrd",
+		"net.bytes.total.rrd",
+		"power.level.rrd",
+		"not-an-rrd-file.txt",
+	}
+	for _, file := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, file), []byte{}, 0644))
+	}
+	repo := NewHistoricRepo(log.Logger, config.RRD{}, dsmRepo)
+
+	tests := []struct {
+		name     string
+		dir      string
+		metric   string
+		labels   domain.Labels
+		expected []domain.MetricName
+	}{
+		{
+			name:     "metric without labels",
+			dir:      dir,
+			metric:   "power.level",
+			expected: []domain.MetricName{"power.level"},
+		},
+		{
+			name:   "all series of metric",
+			dir:    dir,
+			metric: "net.bytes",
+			expected: []domain.MetricName{
+				"net.bytes;direction=rx;iface=eth0",
+				"net.bytes;direction=rx;iface=eth1",
+				"net.bytes;direction=tx;iface=eth0",
+			},
+		},
+		{
+			name:   "series matching labels",
+			dir:    dir,
+			metric: "net.bytes",
+			labels: domain.Labels{"iface": "eth0"},
+			expected: []domain.MetricName{
+				"net.bytes;direction=rx;iface=eth0",
+				"net.bytes;direction=tx;iface=eth0",
+			},
+		},
+		{
+			name:     "no matching series",
+			dir:      dir,
+			metric:   "net.bytes",
+			labels:   domain.Labels{"iface": "eth2"},
+			expected: []domain.MetricName{},
+		},
+		{
+			name:     "non-existent directory",
+			dir:      filepath.Join(dir, "non-existent"),
+			metric:   "power.level",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Action
+			seriesKeys, err := repo.findSeries(tt.dir, ".rrd", domain.MetricName(tt.metric), tt.labels)
+
+			// Assertions
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, tt.expected, seriesKeys)
+		})
+	}
+}
+
+func Test_RemoveHost(t *testing.T) {
+	dsm := domain.DSM{GridName: "unspecified", ClusterName: "unspecified", HostName: "comp10"}
+	setup := func(t *testing.T) string {
+		rrdDir := t.TempDir()
+		hostDir := filepath.Join(rrdDir, dsm.ClusterName, dsm.HostName)
+		assert.NoError(t, os.MkdirAll(hostDir, 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(hostDir, "power.level.rrd"), []byte{}, 0644))
+		return rrdDir
+	}
+
+	t.Run("deletes RRD files", func(t *testing.T) {
+		// Setup
+		rrdDir := setup(t)
+		repo := NewHistoricRepo(log.Logger, config.RRD{Directory: rrdDir}, dsmRepo)
+
+		// Action
+		err := repo.RemoveHost(dsm)
+
+		// Assertions
+		assert.NoError(t, err)
+		assert.NoDirExists(t, filepath.Join(rrdDir, dsm.ClusterName, dsm.HostName))
+		assert.DirExists(t, filepath.Join(rrdDir, dsm.ClusterName))
+	})
+
+	t.Run("archives RRD files", func(t *testing.T) {
+		// Setup
+		rrdDir := setup(t)
+		archiveDir := filepath.Join(rrdDir, "archive")
+		repo := NewHistoricRepo(log.Logger, config.RRD{Directory: rrdDir, ArchiveDirectory: archiveDir}, dsmRepo)
+
+		// Action
+		err := repo.RemoveHost(dsm)
+
+		// Assertions
+		assert.NoError(t, err)
+		assert.NoDirExists(t, filepath.Join(rrdDir, dsm.ClusterName, dsm.HostName))
+		archived, err := filepath.Glob(filepath.Join(archiveDir, dsm.ClusterName, "comp10.*", "power.level.rrd"))
+		assert.NoError(t, err)
+		assert.Len(t, archived, 1, "expected RRD file to be archived")
+	})
+
+	t.Run("missing host directory is ignored", func(t *testing.T) {
+		repo := NewHistoricRepo(log.Logger, config.RRD{Directory: t.TempDir()}, dsmRepo)
+		assert.NoError(t, repo.RemoveHost(dsm))
+	})
+
+	t.Run("unsafe host names are rejected", func(t *testing.T) {
+		// Setup
+		rrdDir := setup(t)
+		repo := NewHistoricRepo(log.Logger, config.RRD{Directory: rrdDir}, dsmRepo)
+
+		for _, hostName := range []string{"", ".", "..", "../unspecified"} {
+			// Action
+			err := repo.RemoveHost(domain.DSM{ClusterName: dsm.ClusterName, HostName: hostName})
+
+			// Assertions
+			assert.Error(t, err, "expected %q to be rejected", hostName)
+		}
+		assert.DirExists(t, filepath.Join(rrdDir, dsm.ClusterName, dsm.HostName))
+	})
+}
+
+func Test_ShutdownWaitsForInFlightCommands(t *testing.T) {
+	// Setup
+	repo := NewHistoricRepo(log.Logger, config.RRD{Directory: t.TempDir(), Step: 15 * time.Second}, dsmRepo)
+	done, err := repo.startCmd()
+	assert.NoError(t, err)
+
+	// Action
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = repo.Shutdown(ctx)
+
+	// Assertions
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "expected shutdown to wait for in-flight command")
+	done()
+	assert.NoError(t, repo.Shutdown(context.Background()))
+	dsm, _ := dsmRepo.GetDSM("10")
+	host := &domain.CurrentHost{Id: "10", DSM: dsm}
+	metric := &domain.CurrentMetric{Name: "power.level", Datatype: "double", Value: "1", Slope: domain.MetricSlopeBoth, Timestamp: time.Now()}
+	assert.ErrorIs(t, repo.UpdateMetric(host, metric), ErrClosed, "expected updates to be rejected after shutdown")
+}
+
+func Test_ListStoredMetricNames(t *testing.T) {
+	// Setup
+	rrdDir := t.TempDir()
+	archiveDir := filepath.Join(rrdDir, "archive")
+	files := []string{
+		"unspecified/comp10/power.level.rrd",
+		"unspecified/comp10/net.bytes;iface=eth0.rrd",
+		"unspecified/comp11/net.bytes;iface=eth1.rrd",
+		"unspecified/comp11/not-an-rrd-file.txt",
+		"unspecified/__SummaryInfo__/power.level.rrd",
+		"archive/unspecified/comp9.1700000000/Old Metric.rrd",
+	}
+	for _, file := range files {
+		path := filepath.Join(rrdDir, file)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte{}, 0644))
+	}
+	repo := NewHistoricRepo(log.Logger, config.RRD{Directory: rrdDir, ArchiveDirectory: archiveDir}, dsmRepo)
+
+	// Action
+	names, err := repo.ListStoredMetricNames()
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"net.bytes", "power.level"}, names)
+}
+
+func Test_UpdateStateRecordsStateChanges(t *testing.T) {
+	// Setup
+	repo := NewHistoricRepo(log.Logger, config.RRD{Directory: t.TempDir()}, dsmRepo)
+	dsm, _ := dsmRepo.GetDSM("1")
+	host := &domain.CurrentHost{Id: "1", DSM: dsm}
+	reports := []struct {
+		state     string
+		timestamp int64
+	}{
+		{"on", 1696431000},
+		{"on", 1696431015},
+		{"off", 1696431030},
+		{"off", 1696431045},
+		{"on", 1696431060},
+	}
+
+	// Action
+	for _, report := range reports {
+		metric := &domain.CurrentMetric{Name: "power.state", Datatype: "enum", Value: report.state, Timestamp: time.Unix(report.timestamp, 0)}
+		assert.NoError(t, repo.UpdateState(host, metric))
+	}
+
+	// Assertions
+	tests := []struct {
+		name     string
+		start    int64
+		end      int64
+		expected []*domain.StateChange
+	}{
+		{
+			name:  "all changes",
+			start: 1696430000,
+			end:   1696432000,
+			expected: []*domain.StateChange{
+				{State: "on", Timestamp: 1696431000},
+				{State: "off", Timestamp: 1696431030},
+				{State: "on", Timestamp: 1696431060},
+			},
+		},
+		{
+			name:  "state in effect at start is included",
+			start: 1696431040,
+			end:   1696432000,
+			expected: []*domain.StateChange{
+				{State: "off", Timestamp: 1696431030},
+				{State: "on", Timestamp: 1696431060},
+			},
+		},
+		{
+			name:     "state at a given time",
+			start:    1696431045,
+			end:      1696431045,
+			expected: []*domain.StateChange{{State: "off", Timestamp: 1696431030}},
+		},
+		{
+			name:     "no state before the first change",
+			start:    1696430000,
+			end:      1696430000,
+			expected: []*domain.StateChange{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			states, err := repo.GetStatesForHostAndMetric("1", "power.state", domain.Labels{}, time.Unix(tt.start, 0), time.Unix(tt.end, 0))
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.expected, states.Metrics["power.state"])
+			}
+		})
+	}
+}
+
+func Test_UpdateStateRejectsOutOfOrderChanges(t *testing.T) {
+	// Setup
+	rrdDir := t.TempDir()
+	dsm, _ := dsmRepo.GetDSM("1")
+	host := &domain.CurrentHost{Id: "1", DSM: dsm}
+	repo := NewHistoricRepo(log.Logger, config.RRD{Directory: rrdDir}, dsmRepo)
+	metric := &domain.CurrentMetric{Name: "power.state", Datatype: "enum", Value: "on", Timestamp: time.Unix(1696431030, 0)}
+	assert.NoError(t, repo.UpdateState(host, metric))
+	// A new repo reads the last state from the state log.
+	repo = NewHistoricRepo(log.Logger, config.RRD{Directory: rrdDir}, dsmRepo)
+
+	// Action
+	metric = &domain.CurrentMetric{Name: "power.state", Datatype: "enum", Value: "off", Timestamp: time.Unix(1696431000, 0)}
+	err := repo.UpdateState(host, metric)
+
+	// Assertions
+	assert.ErrorIs(t, err, domain.ErrOutOfOrderUpdate)
+}
+
+func Test_GetStatesForHostAndMetricErrors(t *testing.T) {
+	repo := NewHistoricRepo(log.Logger, config.RRD{Directory: t.TempDir()}, dsmRepo)
+
+	_, err := repo.GetStatesForHostAndMetric("NOPE", "power.state", domain.Labels{}, time.Now(), time.Now())
+	assert.ErrorIs(t, err, domain.ErrHostNotFound)
+
+	_, err = repo.GetStatesForHostAndMetric("1", "power.state", domain.Labels{}, time.Now(), time.Now())
+	assert.ErrorIs(t, err, domain.ErrMetricNotFound)
+}
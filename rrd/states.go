@@ -0,0 +1,203 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package rrd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+)
+
+// State metrics are not stored in RRD files.  Averaging states makes no
+// sense, so instead each change of state is appended to a state log stored
+// alongside the host's RRD files.  Each line of a state log is a JSON
+// encoded stateLogEntry, e.g.,
+//
+//	{"timestamp":1696431225,"state":"on"}
+const stateLogExt = ".states"
+
+type stateLogEntry struct {
+	Timestamp int64  `json:"timestamp"`
+	State     string `json:"state"`
+}
+
+// UpdateState implements the domain.HistoricRepository interface.
+func (hr *historicRepo) UpdateState(host *domain.CurrentHost, metric *domain.CurrentMetric) error {
+	logPath := filepath.Join(hr.rrdDir, host.DSM.ClusterName, host.DSM.HostName, fmt.Sprintf("%s%s", metric.SeriesKey(), stateLogExt))
+	hr.statesMux.Lock()
+	defer hr.statesMux.Unlock()
+
+	last, ok := hr.lastStates[logPath]
+	if !ok {
+		changes, err := readStateLog(logPath)
+		if err != nil {
+			return err
+		}
+		if len(changes) > 0 {
+			last = *changes[len(changes)-1]
+			ok = true
+		}
+	}
+	if ok && last.State == metric.Value {
+		return nil
+	}
+	change := domain.StateChange{State: metric.Value, Timestamp: metric.Timestamp.Unix()}
+	if ok && change.Timestamp <= last.Timestamp {
+		return fmt.Errorf(
+			"%w: updating state log %s for %s: last state change is at %s",
+			domain.ErrOutOfOrderUpdate, logPath, metric.Timestamp.Format(time.RFC3339), time.Unix(last.Timestamp, 0).Format(time.RFC3339),
+		)
+	}
+	hr.logger.Debug().Stringer("host", host.DSM).Str("metric", metric.Name).Str("state", metric.Value).Int64("timestamp", change.Timestamp).Msg("recording state change")
+	if err := hr.runMkdir(logPath); err != nil {
+		return err
+	}
+	if err := appendStateLog(logPath, change); err != nil {
+		return err
+	}
+	hr.lastStates[logPath] = change
+	return nil
+}
+
+// GetStatesForHostAndMetric implements the domain.HistoricRepository
+// interface.
+func (hr *historicRepo) GetStatesForHostAndMetric(
+	hostId domain.HostId,
+	metricName domain.MetricName,
+	labels domain.Labels,
+	start, end time.Time,
+) (*domain.HistoricHostStates, error) {
+	dsm, ok := hr.dsmRepo.GetDSM(hostId)
+	if !ok {
+		return nil, domain.ErrHostNotFound
+	}
+	host := domain.HistoricHostStates{
+		Id:      hostId,
+		DSM:     dsm,
+		Metrics: map[domain.MetricName][]*domain.StateChange{},
+	}
+	hostDir := filepath.Join(hr.rrdDir, dsm.ClusterName, dsm.HostName)
+	seriesKeys, err := hr.findSeries(hostDir, stateLogExt, metricName, labels)
+	if err != nil {
+		return nil, err
+	}
+	if len(seriesKeys) == 0 {
+		return nil, domain.ErrMetricNotFound
+	}
+	hr.statesMux.Lock()
+	defer hr.statesMux.Unlock()
+	for _, seriesKey := range seriesKeys {
+		changes, err := readStateLog(filepath.Join(hostDir, fmt.Sprintf("%s%s", seriesKey, stateLogExt)))
+		if err != nil {
+			return nil, err
+		}
+		host.Metrics[seriesKey] = statesBetween(changes, start.Unix(), end.Unix())
+	}
+	return &host, nil
+}
+
+// statesBetween returns the state changes between start and end inclusive,
+// preceded by the state in effect at start, if any.  The given changes must
+// be ordered oldest first.
+func statesBetween(changes []*domain.StateChange, start, end int64) []*domain.StateChange {
+	states := make([]*domain.StateChange, 0)
+	for _, change := range changes {
+		if change.Timestamp > end {
+			break
+		}
+		if change.Timestamp <= start {
+			// Only the most recent change at or before start is in effect.
+			states = states[:0]
+		}
+		states = append(states, change)
+	}
+	return states
+}
+
+// forgetStates removes the cached last states of all state logs in the given
+// directory.
+func (hr *historicRepo) forgetStates(dir string) {
+	hr.statesMux.Lock()
+	defer hr.statesMux.Unlock()
+	for logPath := range hr.lastStates {
+		if strings.HasPrefix(logPath, dir+string(filepath.Separator)) {
+			delete(hr.lastStates, logPath)
+		}
+	}
+}
+
+// readStateLog returns the state changes recorded in the given state log,
+// oldest first.  A missing state log has no state changes.
+func readStateLog(logPath string) ([]*domain.StateChange, error) {
+	file, err := os.Open(logPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("%s %w", "opening state log", err)
+	}
+	defer file.Close()
+	changes := make([]*domain.StateChange, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry stateLogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", "parsing state log", logPath, err)
+		}
+		changes = append(changes, &domain.StateChange{State: entry.State, Timestamp: entry.Timestamp})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s %w", "reading state log", err)
+	}
+	return changes, nil
+}
+
+func appendStateLog(logPath string, change domain.StateChange) error {
+	line, err := json.Marshal(stateLogEntry{Timestamp: change.Timestamp, State: change.State})
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("%s %w", "opening state log", err)
+	}
+	_, err = file.Write(append(line, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("%s %w", "writing state log", err)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package statsd
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+)
+
+type key struct {
+	hostId domain.HostId
+	name   string
+}
+
+type gauge struct {
+	value   float64
+	updated bool
+}
+
+type timer struct {
+	values []float64
+	count  float64
+}
+
+// Aggregator aggregates statsd metrics over a single step.
+//
+// Counters are summed, gauges keep their latest value, sets count their
+// unique members and timers keep each reported value.  Flush converts the
+// aggregated values to pending metrics and resets the aggregator for the next
+// step.
+type Aggregator struct {
+	mux      sync.Mutex
+	counters map[key]float64
+	gauges   map[key]*gauge
+	sets     map[key]map[string]struct{}
+	timers   map[key]*timer
+}
+
+func NewAggregator() *Aggregator {
+	return &Aggregator{
+		counters: map[key]float64{},
+		gauges:   map[key]*gauge{},
+		sets:     map[key]map[string]struct{}{},
+		timers:   map[key]*timer{},
+	}
+}
+
+// Add adds the given line for the given host and metric name to the
+// aggregator.
+func (a *Aggregator) Add(hostId domain.HostId, metricName string, line Line) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	k := key{hostId: hostId, name: metricName}
+	switch line.Kind {
+	case Counter:
+		a.counters[k] += line.Value / line.SampleRate
+	case Gauge:
+		g, ok := a.gauges[k]
+		if !ok {
+			g = &gauge{}
+			a.gauges[k] = g
+		}
+		if line.Delta {
+			g.value += line.Value
+		} else {
+			g.value = line.Value
+		}
+		g.updated = true
+	case Set:
+		members, ok := a.sets[k]
+		if !ok {
+			members = map[string]struct{}{}
+			a.sets[k] = members
+		}
+		members[line.SetMember] = struct{}{}
+	case Timer:
+		t, ok := a.timers[k]
+		if !ok {
+			t = &timer{}
+			a.timers[k] = t
+		}
+		t.values = append(t.values, line.Value)
+		t.count += 1 / line.SampleRate
+	}
+}
+
+// Flush returns the metrics aggregated since the last flush, grouped by host,
+// and resets the aggregator.  step is the duration over which the metrics
+// were aggregated and is used to calculate counter rates.
+//
+// Each counter produces a metric holding the count for the step and a
+// `.rate` metric holding the per-second rate.  Each gauge updated during the
+// step produces a metric holding its latest value.  Each set produces a
+// metric holding the number of unique members.  Each timer produces `.count`,
+// `.mean`, `.min`, `.max` and `.p95` metrics.
+//
+// All metrics are given a slope of `both`.  The counts are per step rather
+// than cumulative totals, so they may decrease.
+func (a *Aggregator) Flush(reported time.Time, step time.Duration, ttl time.Duration) map[domain.HostId][]domain.PendingMetric {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	metrics := map[domain.HostId][]domain.PendingMetric{}
+	add := func(k key, suffix string, value float64, metricType domain.MetricType) {
+		val, err := domain.ParseMetricVal(value, metricType)
+		if err != nil {
+			return
+		}
+		metrics[k.hostId] = append(metrics[k.hostId], domain.PendingMetric{
+			Name:     k.name + suffix,
+			Value:    val,
+			Slope:    domain.MetricSlopeBoth,
+			Reported: reported,
+			TTL:      ttl,
+			Type:     metricType,
+		})
+	}
+
+	for k, count := range a.counters {
+		add(k, "", count, domain.MetricTypeDouble)
+		if step > 0 {
+			add(k, ".rate", count/step.Seconds(), domain.MetricTypeDouble)
+		}
+	}
+	for k, g := range a.gauges {
+		if g.updated {
+			add(k, "", g.value, domain.MetricTypeDouble)
+			g.updated = false
+		}
+	}
+	for k, members := range a.sets {
+		add(k, "", float64(len(members)), domain.MetricTypeUint32)
+	}
+	for k, t := range a.timers {
+		sort.Float64s(t.values)
+		sum := 0.0
+		for _, v := range t.values {
+			sum += v
+		}
+		add(k, ".count", math.Round(t.count), domain.MetricTypeUint32)
+		add(k, ".mean", sum/float64(len(t.values)), domain.MetricTypeDouble)
+		add(k, ".min", t.values[0], domain.MetricTypeDouble)
+		add(k, ".max", t.values[len(t.values)-1], domain.MetricTypeDouble)
+		add(k, ".p95", percentile(t.values, 95), domain.MetricTypeDouble)
+	}
+
+	a.counters = map[key]float64{}
+	a.sets = map[key]map[string]struct{}{}
+	a.timers = map[key]*timer{}
+	return metrics
+}
+
+// percentile returns the nearest-rank percentile p of the given sorted
+// values.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
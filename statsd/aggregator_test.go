@@ -0,0 +1,118 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package statsd
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func metricsByName(metrics []domain.PendingMetric) map[string]domain.PendingMetric {
+	byName := map[string]domain.PendingMetric{}
+	for _, m := range metrics {
+		byName[m.Name] = m
+	}
+	return byName
+}
+
+func Test_AggregatorFlush(t *testing.T) {
+	// Setup
+	aggregator := NewAggregator()
+	add := func(text string) {
+		line, err := ParseLine(text)
+		assert.NoError(t, err)
+		aggregator.Add("10", line.Name, line)
+	}
+	add("requests:3|c")
+	add("requests:1|c|@0.5")
+	add("queue:10|g")
+	add("queue:+5|g")
+	add("users:alice|s")
+	add("users:bob|s")
+	add("users:alice|s")
+	for i := 1; i <= 20; i++ {
+		add(fmt.Sprintf("response:%d|ms", i))
+	}
+
+	// Action
+	reported := time.Now()
+	flushed := aggregator.Flush(reported, 10*time.Second, time.Minute)
+
+	// Assertions
+	assert.Len(t, flushed, 1)
+	metrics := metricsByName(flushed["10"])
+	expected := map[string]struct {
+		value string
+		typ   domain.MetricType
+		slope domain.MetricSlope
+	}{
+		"requests":       {"5.000000", domain.MetricTypeDouble, domain.MetricSlopeBoth},
+		"requests.rate":  {"0.500000", domain.MetricTypeDouble, domain.MetricSlopeBoth},
+		"queue":          {"15.000000", domain.MetricTypeDouble, domain.MetricSlopeBoth},
+		"users":          {"2", domain.MetricTypeUint32, domain.MetricSlopeBoth},
+		"response.count": {"20", domain.MetricTypeUint32, domain.MetricSlopeBoth},
+		"response.mean":  {"10.500000", domain.MetricTypeDouble, domain.MetricSlopeBoth},
+		"response.min":   {"1.000000", domain.MetricTypeDouble, domain.MetricSlopeBoth},
+		"response.max":   {"20.000000", domain.MetricTypeDouble, domain.MetricSlopeBoth},
+		"response.p95":   {"19.000000", domain.MetricTypeDouble, domain.MetricSlopeBoth},
+	}
+	assert.Len(t, metrics, len(expected))
+	for name, e := range expected {
+		metric, ok := metrics[name]
+		if assert.True(t, ok, "missing metric %s", name) {
+			assert.Equal(t, e.value, metric.Value, name)
+			assert.Equal(t, e.typ, metric.Type, name)
+			assert.Equal(t, e.slope, metric.Slope, name)
+			assert.Equal(t, time.Minute, metric.TTL, name)
+			assert.Equal(t, reported, metric.Reported, name)
+		}
+	}
+}
+
+func Test_AggregatorFlushResetsForNextStep(t *testing.T) {
+	// Setup
+	aggregator := NewAggregator()
+	aggregator.Add("10", "requests", Line{Kind: Counter, Value: 1, SampleRate: 1})
+	aggregator.Add("10", "queue", Line{Kind: Gauge, Value: 10, SampleRate: 1})
+	aggregator.Flush(time.Now(), 10*time.Second, time.Minute)
+
+	// Action
+	empty := aggregator.Flush(time.Now(), 10*time.Second, time.Minute)
+	aggregator.Add("10", "queue", Line{Kind: Gauge, Value: 2, SampleRate: 1, Delta: true})
+	flushed := aggregator.Flush(time.Now(), 10*time.Second, time.Minute)
+
+	// Assertions
+	assert.Empty(t, empty)
+	metrics := metricsByName(flushed["10"])
+	assert.Len(t, metrics, 1)
+	assert.Equal(t, "12.000000", metrics["queue"].Value)
+}
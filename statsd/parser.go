@@ -0,0 +1,116 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package statsd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidLine is returned if a line cannot be parsed.
+var ErrInvalidLine = fmt.Errorf("invalid statsd line")
+
+// MetricKind is the kind of a statsd metric, e.g., counter or gauge.
+type MetricKind string
+
+const (
+	Counter MetricKind = "c"
+	Gauge   MetricKind = "g"
+	Set     MetricKind = "s"
+	Timer   MetricKind = "ms"
+)
+
+// Line is a single parsed statsd line.
+type Line struct {
+	Name string
+	Kind MetricKind
+	// Value is the numeric value of counters, gauges and timers.
+	Value float64
+	// SetMember is the raw value of set metrics.
+	SetMember string
+	// SampleRate is the rate at which counters and timers were sampled.  It
+	// is 1 unless given in the line.
+	SampleRate float64
+	// Delta is true for gauges whose value is prefixed with a sign.  The
+	// value is added to the gauge's current value instead of replacing it.
+	Delta bool
+}
+
+// ParseLine parses a single statsd line.  The line has the format
+// `<name>:<value>|<type>[|@<sample rate>][|#<tags>]` where type is one of
+// `c`, `g`, `s`, `ms` or `h`.  Histograms (`h`) are treated as timers.  Any
+// tags are discarded.
+func ParseLine(line string) (Line, error) {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return Line{}, fmt.Errorf("%w: missing name: %q", ErrInvalidLine, line)
+	}
+	fields := strings.Split(rest, "|")
+	if len(fields) < 2 {
+		return Line{}, fmt.Errorf("%w: missing type: %q", ErrInvalidLine, line)
+	}
+	rawValue := fields[0]
+	parsed := Line{Name: name, SampleRate: 1}
+	switch fields[1] {
+	case "c":
+		parsed.Kind = Counter
+	case "g":
+		parsed.Kind = Gauge
+		parsed.Delta = strings.HasPrefix(rawValue, "+") || strings.HasPrefix(rawValue, "-")
+	case "s":
+		parsed.Kind = Set
+	case "ms", "h":
+		parsed.Kind = Timer
+	default:
+		return Line{}, fmt.Errorf("%w: unknown type %q: %q", ErrInvalidLine, fields[1], line)
+	}
+	for _, field := range fields[2:] {
+		if !strings.HasPrefix(field, "@") {
+			continue
+		}
+		rate, err := strconv.ParseFloat(field[1:], 64)
+		if err != nil || rate <= 0 || rate > 1 {
+			return Line{}, fmt.Errorf("%w: invalid sample rate: %q", ErrInvalidLine, field)
+		}
+		parsed.SampleRate = rate
+	}
+	if parsed.Kind == Set {
+		if rawValue == "" {
+			return Line{}, fmt.Errorf("%w: missing value: %q", ErrInvalidLine, line)
+		}
+		parsed.SetMember = rawValue
+		return parsed, nil
+	}
+	value, err := strconv.ParseFloat(rawValue, 64)
+	if err != nil {
+		return Line{}, fmt.Errorf("%w: invalid value: %q", ErrInvalidLine, rawValue)
+	}
+	parsed.Value = value
+	return parsed, nil
+}
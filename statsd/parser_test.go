@@ -0,0 +1,112 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package statsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		expected Line
+	}{
+		{
+			name:     "counter",
+			line:     "comp10.requests:1|c",
+			expected: Line{Name: "comp10.requests", Kind: Counter, Value: 1, SampleRate: 1},
+		},
+		{
+			name:     "sampled counter",
+			line:     "comp10.requests:2|c|@0.5",
+			expected: Line{Name: "comp10.requests", Kind: Counter, Value: 2, SampleRate: 0.5},
+		},
+		{
+			name:     "gauge",
+			line:     "comp10.queue.size:42|g",
+			expected: Line{Name: "comp10.queue.size", Kind: Gauge, Value: 42, SampleRate: 1},
+		},
+		{
+			name:     "gauge delta",
+			line:     "comp10.queue.size:-3|g",
+			expected: Line{Name: "comp10.queue.size", Kind: Gauge, Value: -3, SampleRate: 1, Delta: true},
+		},
+		{
+			name:     "set",
+			line:     "comp10.users:alice|s",
+			expected: Line{Name: "comp10.users", Kind: Set, SetMember: "alice", SampleRate: 1},
+		},
+		{
+			name:     "timer",
+			line:     "comp10.response:320|ms",
+			expected: Line{Name: "comp10.response", Kind: Timer, Value: 320, SampleRate: 1},
+		},
+		{
+			name:     "histogram is treated as timer",
+			line:     "comp10.response:320|h",
+			expected: Line{Name: "comp10.response", Kind: Timer, Value: 320, SampleRate: 1},
+		},
+		{
+			name:     "tags are discarded",
+			line:     "comp10.requests:1|c|#env:prod",
+			expected: Line{Name: "comp10.requests", Kind: Counter, Value: 1, SampleRate: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line, err := ParseLine(tt.line)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, line)
+		})
+	}
+}
+
+func Test_ParseLineErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{name: "missing name", line: ":1|c"},
+		{name: "missing type", line: "comp10.requests:1"},
+		{name: "unknown type", line: "comp10.requests:1|x"},
+		{name: "invalid value", line: "comp10.requests:many|c"},
+		{name: "invalid sample rate", line: "comp10.requests:1|c|@2"},
+		{name: "empty set member", line: "comp10.users:|s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseLine(tt.line)
+			assert.ErrorIs(t, err, ErrInvalidLine)
+		})
+	}
+}
@@ -0,0 +1,227 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+// Package statsd provides a listener for metrics sent using the statsd
+// protocol.  Metrics are aggregated over each processing step before being
+// added to the pending repository.
+package statsd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/config"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/graphite"
+	"github.com/rs/zerolog"
+)
+
+// ErrServerClosed is returned by ListenAndServe after a call to Shutdown.
+var ErrServerClosed = errors.New("statsd: Server closed")
+
+// maxPacketSize is the maximum size of a UDP packet that will be read.
+const maxPacketSize = 65536
+
+// Server listens for statsd metrics over UDP, aggregates them and adds the
+// aggregated metrics to the pending repository at the end of each step.
+type Server struct {
+	aggregator *Aggregator
+	app        *domain.Application
+	config     config.StatsD
+	logger     zerolog.Logger
+	step       time.Duration
+	mux        sync.Mutex
+	conn       net.PacketConn
+	closed     bool
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// NewServer returns a new Server.  Received metrics are aggregated over the
+// given step, which should be the step used by the historic repository.
+func NewServer(logger zerolog.Logger, app *domain.Application, config config.StatsD, step time.Duration) *Server {
+	return &Server{
+		aggregator: NewAggregator(),
+		app:        app,
+		config:     config,
+		logger:     logger.With().Str("component", "statsd").Logger(),
+		step:       step,
+		done:       make(chan struct{}),
+	}
+}
+
+// ListenAndServe listens on the configured UDP address and handles the
+// received metrics.  It blocks until Shutdown is called, after which it
+// returns ErrServerClosed.
+func (s *Server) ListenAndServe() error {
+	if s.step <= 0 {
+		return fmt.Errorf("statsd: invalid step %s", s.step)
+	}
+	addr := fmt.Sprintf("%s:%d", s.config.IP, s.config.Port)
+	s.mux.Lock()
+	if s.closed {
+		s.mux.Unlock()
+		return ErrServerClosed
+	}
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		s.mux.Unlock()
+		return err
+	}
+	s.conn = conn
+	s.logger.Info().Str("address", addr).Msg("Listening on UDP")
+	s.wg.Add(2)
+	go s.serveUDP(conn)
+	go s.runFlushLoop()
+	s.mux.Unlock()
+	s.wg.Wait()
+	return ErrServerClosed
+}
+
+// Shutdown stops listening for packets, flushes any aggregated metrics to the
+// pending repository and waits for that to complete or for the context to be
+// done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mux.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+		if s.conn != nil {
+			s.conn.Close() //nolint:errcheck
+		}
+	}
+	s.mux.Unlock()
+	finished := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Server) isClosed() bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.closed
+}
+
+func (s *Server) serveUDP(conn net.PacketConn) {
+	defer s.wg.Done()
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if s.isClosed() {
+				return
+			}
+			s.logger.Warn().Err(err).Msg("reading packet")
+			continue
+		}
+		logger := s.logger.With().Stringer("remote", addr).Logger()
+		scanner := bufio.NewScanner(bytes.NewReader(buf[:n]))
+		for scanner.Scan() {
+			s.handleLine(logger, scanner.Text())
+		}
+	}
+}
+
+// runFlushLoop flushes the aggregated metrics at the end of each step until
+// the server is shutdown.  A final flush is made on shutdown.
+func (s *Server) runFlushLoop() {
+	defer s.wg.Done()
+	for {
+		now := time.Now()
+		next := now.Truncate(s.step).Add(s.step)
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-timer.C:
+			s.flush()
+		case <-s.done:
+			timer.Stop()
+			s.flush()
+			return
+		}
+	}
+}
+
+// flush adds the metrics aggregated during the last step to the pending
+// repository.
+func (s *Server) flush() {
+	metricsByHost := s.aggregator.Flush(time.Now(), s.step, s.config.TTL)
+	count := 0
+	for hostId, metrics := range metricsByHost {
+		for _, metric := range metrics {
+			err := s.app.AddPendingMetric(metric, hostId, "")
+			if err != nil {
+				s.logger.Debug().Err(err).Str("host", string(hostId)).Str("metric", metric.Name).Msg("adding metric")
+				continue
+			}
+			count++
+		}
+	}
+	s.logger.Debug().Int("count", count).Msg("flushed metrics")
+}
+
+// handleLine parses the given line and adds it to the aggregator.  Errors are
+// logged and otherwise ignored; the statsd protocol has no way of reporting
+// them to the client.
+func (s *Server) handleLine(logger zerolog.Logger, text string) {
+	if text == "" {
+		return
+	}
+	line, err := ParseLine(text)
+	if err != nil {
+		logger.Debug().Err(err).Msg("parsing line")
+		return
+	}
+	hostName, metricName, err := graphite.SplitPath(line.Name, s.config.HostSegment)
+	if err != nil {
+		logger.Debug().Err(err).Msg("parsing metric name")
+		return
+	}
+	if err := domain.ValidateMetricName(metricName); err != nil {
+		logger.Debug().Err(err).Msg("parsing metric name")
+		return
+	}
+	hostId, err := s.app.HostIdForHostName(hostName)
+	if err != nil {
+		logger.Debug().Err(err).Str("metric", metricName).Msg("looking up host")
+		return
+	}
+	s.aggregator.Add(hostId, metricName, line)
+}
@@ -0,0 +1,120 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package statsd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/config"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/inmem"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	consoleWriter := zerolog.ConsoleWriter{Out: os.Stderr}
+	log.Logger = zerolog.New(consoleWriter).With().Timestamp().Logger()
+}
+
+// newTestDSMRepo returns a data source map repository containing the host
+// comp10.
+func newTestDSMRepo() *inmem.DSMRepo {
+	dsmConfig := config.DSM{GridName: "unspecified", ClusterName: "unspecified"}
+	repo := inmem.NewDSMRepo(log.Logger, dsmConfig)
+	dsm := domain.DSM{GridName: "unspecified", ClusterName: "unspecified", HostName: "comp10"}
+	repo.Update(map[domain.HostId]domain.DSM{"10": dsm}, map[domain.DSM]domain.HostId{dsm: "10"}) //nolint:errcheck
+	return repo
+}
+
+type fakeDSMUpdater struct{}
+
+func (fakeDSMUpdater) RunPeriodicUpdateLoop() {}
+
+func (fakeDSMUpdater) UpdateNow() {}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func Test_ServerFlushesAggregatedMetricsOnShutdown(t *testing.T) {
+	// Setup
+	pendingRepo := inmem.NewPendingRepository(log.Logger)
+	app := domain.NewApp(pendingRepo, newTestDSMRepo(), fakeDSMUpdater{}, nil, nil, nil)
+	statsdConfig := config.StatsD{
+		IP:          "127.0.0.1",
+		Port:        freePort(t),
+		HostSegment: 0,
+		TTL:         time.Minute,
+	}
+	server := NewServer(log.Logger, app, statsdConfig, time.Hour)
+	served := make(chan error, 1)
+	go func() { served <- server.ListenAndServe() }()
+
+	// Action
+	addr := fmt.Sprintf("127.0.0.1:%d", statsdConfig.Port)
+	conn, err := net.Dial("udp", addr)
+	assert.NoError(t, err)
+	defer conn.Close()
+	assert.Eventually(t, func() bool {
+		_, err = fmt.Fprint(conn, "comp10.x/../../requests:1|c\nunknown.requests:1|c\ninvalid\ncomp10.requests:1|c\n")
+		if err != nil {
+			return false
+		}
+		return server.aggregator.hasCounter("10", "requests")
+	}, time.Second, 10*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, server.Shutdown(ctx))
+	assert.ErrorIs(t, <-served, ErrServerClosed)
+
+	// Assertions
+	host, ok := pendingRepo.GetHost("10")
+	assert.True(t, ok)
+	assert.Contains(t, host.Metrics, domain.MetricName("requests"))
+	assert.Contains(t, host.Metrics, domain.MetricName("requests.rate"))
+	assert.Len(t, host.Metrics, 2)
+	assert.Len(t, pendingRepo.GetAll(), 1)
+}
+
+func (a *Aggregator) hasCounter(hostId domain.HostId, name string) bool {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	_, ok := a.counters[key{hostId: hostId, name: name}]
+	return ok
+}
@@ -0,0 +1,497 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+// Package wal provides a durable pending repository.  The repository is held
+// in memory, as inmem.PendingRepository is, and each change to it is first
+// appended to a write-ahead log on local disk.  The log is periodically
+// compacted into a snapshot of the repository.  On startup the snapshot is
+// loaded and the log replayed, so that pending metrics survive a restart.
+package wal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/config"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/inmem"
+	"github.com/rs/zerolog"
+)
+
+const (
+	logFileName      = "pending.log"
+	snapshotFileName = "pending.snapshot"
+)
+
+// ErrClosed is returned when changing a repository that has been closed.
+var ErrClosed = fmt.Errorf("pending repository is closed")
+
+// The operations recorded in the log.
+const (
+	opPutHost             = "put_host"
+	opPutMetric           = "put_metric"
+	opUpdateLastProcessed = "update_last_processed"
+	opDeleteMetric        = "delete_metric"
+	opDeleteHost          = "delete_host"
+)
+
+// logEntry is a single change to the repository recorded in the log.
+// Applying an entry more than once has the same effect as applying it once.
+// This allows the log to be replayed on top of a snapshot already containing
+// some of its changes.
+type logEntry struct {
+	Op        string                `json:"op"`
+	HostId    domain.HostId         `json:"host_id"`
+	Host      *domain.PendingHost   `json:"host,omitempty"`
+	Metric    *domain.PendingMetric `json:"metric,omitempty"`
+	SeriesKey domain.MetricName     `json:"series_key,omitempty"`
+	Time      *time.Time            `json:"time,omitempty"`
+}
+
+// snapshot is the contents of the repository at the time it was taken.
+type snapshot struct {
+	Taken time.Time            `json:"taken"`
+	Hosts []domain.PendingHost `json:"hosts"`
+}
+
+var _ domain.PendingRepository = (*PendingRepository)(nil)
+
+// PendingRepository implements the domain.PendingRepository interface.  It
+// stores the reported hosts and their metrics pending their processing and
+// records every change to them in a write-ahead log.
+type PendingRepository struct {
+	dir              string
+	logger           zerolog.Logger
+	pending          *inmem.PendingRepository
+	snapshotInterval time.Duration
+	sync             bool
+	// mux serialises changes so that they are applied in the order that they
+	// are logged.
+	mux     sync.Mutex
+	logFile *os.File
+	// The number of entries appended to the log since the last snapshot.
+	entries int
+}
+
+// NewPendingRepository returns a pending repository stored in the configured
+// directory.  The repository is loaded from the snapshot and log left by a
+// previous run, if any, and a new snapshot taken.
+func NewPendingRepository(logger zerolog.Logger, config config.Pending) (*PendingRepository, error) {
+	if config.Directory == "" {
+		return nil, fmt.Errorf("pending repository directory is not configured")
+	}
+	pr := &PendingRepository{
+		dir:              config.Directory,
+		logger:           logger.With().Str("component", "pending-repo").Logger(),
+		pending:          inmem.NewPendingRepository(logger),
+		snapshotInterval: config.SnapshotInterval,
+		sync:             config.Sync,
+	}
+	if err := os.MkdirAll(pr.dir, 0755); err != nil {
+		return nil, fmt.Errorf("%s %w", "creating pending repository directory", err)
+	}
+	if err := pr.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := pr.replayLog(); err != nil {
+		return nil, err
+	}
+	pr.mux.Lock()
+	defer pr.mux.Unlock()
+	if err := pr.snapshot(); err != nil {
+		return nil, err
+	}
+	return pr, nil
+}
+
+// PutHost adds a Host to the repository.  If the Host has already been added
+// its data source map and reported time are updated.  Its metrics are
+// changed with PutMetric, UpdateLastProcessed and DeleteMetric.
+func (pr *PendingRepository) PutHost(host domain.PendingHost) error {
+	pr.mux.Lock()
+	defer pr.mux.Unlock()
+	logged := host
+	if _, ok := pr.pending.GetHost(host.Id); ok {
+		logged.Metrics = nil
+	}
+	return pr.record(logEntry{Op: opPutHost, HostId: host.Id, Host: &logged})
+}
+
+// PutMetric adds a Metric to the repository for a previously added Host.
+//
+// If the Metric has already been added it will be updated.
+//
+// If the Host has not been previously added an UnknownHost error is
+// returned.
+func (pr *PendingRepository) PutMetric(host domain.PendingHost, metric domain.PendingMetric) error {
+	pr.mux.Lock()
+	defer pr.mux.Unlock()
+	if _, ok := pr.pending.GetHost(host.Id); !ok {
+		return fmt.Errorf("%w: %s", domain.ErrUnknownHost, host.Id)
+	}
+	return pr.record(logEntry{Op: opPutMetric, HostId: host.Id, Metric: &metric})
+}
+
+// MergeMetric adds a metric to the repository for the given Host as a single
+// operation.  If the Host has not been added it is added, otherwise its
+// reported time is updated.
+//
+// merge is called, with the repository locked, with the Host as stored and
+// returns the Metric to store.  If merge returns an error, the repository is
+// not changed.  The change is logged as a put_host and a put_metric entry.
+func (pr *PendingRepository) MergeMetric(host domain.PendingHost, merge func(domain.PendingHost) (domain.PendingMetric, error)) error {
+	pr.mux.Lock()
+	defer pr.mux.Unlock()
+	if pr.logFile == nil {
+		return ErrClosed
+	}
+	stored, ok := pr.pending.GetHost(host.Id)
+	if !ok {
+		stored = host
+		stored.Metrics = map[domain.MetricName]domain.PendingMetric{}
+	}
+	metric, err := merge(stored)
+	if err != nil {
+		return err
+	}
+	logged := stored
+	logged.Reported = host.Reported
+	logged.Metrics = nil
+	if err := pr.record(logEntry{Op: opPutHost, HostId: host.Id, Host: &logged}); err != nil {
+		return err
+	}
+	return pr.record(logEntry{Op: opPutMetric, HostId: host.Id, Metric: &metric})
+}
+
+// GetAll returns a slice of all Hosts added to the repository, populated
+// with all of their Metrics.
+func (pr *PendingRepository) GetAll() []domain.PendingHost {
+	return pr.pending.GetAll()
+}
+
+// GetHost returns the host identified by HostId if present.
+func (pr *PendingRepository) GetHost(hostId domain.HostId) (domain.PendingHost, bool) {
+	return pr.pending.GetHost(hostId)
+}
+
+// UpdateLastProcessed updates the metric's LastProcessed field and discards
+// any backfill values reported at or before that time.
+func (pr *PendingRepository) UpdateLastProcessed(hostId domain.HostId, metricName domain.MetricName, t time.Time) error {
+	pr.mux.Lock()
+	defer pr.mux.Unlock()
+	host, ok := pr.pending.GetHost(hostId)
+	if !ok {
+		return fmt.Errorf("%w: %s", domain.ErrUnknownHost, hostId)
+	}
+	if _, ok := host.Metrics[metricName]; !ok {
+		return fmt.Errorf("%w: %s", domain.ErrMetricNotFound, metricName)
+	}
+	return pr.record(logEntry{Op: opUpdateLastProcessed, HostId: hostId, SeriesKey: metricName, Time: &t})
+}
+
+// DeleteMetric removes the metric, identified by its series key, from the
+// given host.
+func (pr *PendingRepository) DeleteMetric(hostId domain.HostId, metricName domain.MetricName) error {
+	pr.mux.Lock()
+	defer pr.mux.Unlock()
+	host, ok := pr.pending.GetHost(hostId)
+	if !ok {
+		return fmt.Errorf("%w: %s", domain.ErrUnknownHost, hostId)
+	}
+	if _, ok := host.Metrics[metricName]; !ok {
+		return fmt.Errorf("%w: %s", domain.ErrMetricNotFound, metricName)
+	}
+	return pr.record(logEntry{Op: opDeleteMetric, HostId: hostId, SeriesKey: metricName})
+}
+
+// DeleteMatchingMetrics removes the metrics of the given host for which match
+// returns true and returns their series keys.  A deletion is logged for each
+// of them.
+func (pr *PendingRepository) DeleteMatchingMetrics(hostId domain.HostId, match func(domain.PendingMetric) bool) ([]domain.MetricName, error) {
+	pr.mux.Lock()
+	defer pr.mux.Unlock()
+	host, ok := pr.pending.GetHost(hostId)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", domain.ErrUnknownHost, hostId)
+	}
+	matched := make([]domain.MetricName, 0)
+	for key, metric := range host.Metrics {
+		if match(metric) {
+			matched = append(matched, key)
+		}
+	}
+	deleted := make([]domain.MetricName, 0, len(matched))
+	for _, key := range matched {
+		if err := pr.record(logEntry{Op: opDeleteMetric, HostId: hostId, SeriesKey: key}); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, key)
+	}
+	return deleted, nil
+}
+
+// DeleteHost removes the host and its metrics from the repository.
+func (pr *PendingRepository) DeleteHost(hostId domain.HostId) error {
+	pr.mux.Lock()
+	defer pr.mux.Unlock()
+	if _, ok := pr.pending.GetHost(hostId); !ok {
+		return fmt.Errorf("%w: %s", domain.ErrUnknownHost, hostId)
+	}
+	return pr.record(logEntry{Op: opDeleteHost, HostId: hostId})
+}
+
+// RunPeriodicSnapshotLoop takes a snapshot of the repository every
+// configured snapshot interval.  Taking a snapshot truncates the log, so the
+// interval bounds the size of the log and the time taken to replay it.  A
+// snapshot is only taken if the repository has changed.  If the interval is
+// zero, snapshots are only taken at startup and when the repository is
+// closed.  The loop returns once done is closed, which should happen before
+// the repository is closed.
+func (pr *PendingRepository) RunPeriodicSnapshotLoop(done <-chan struct{}) {
+	if pr.snapshotInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(pr.snapshotInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+		pr.mux.Lock()
+		if pr.logFile == nil {
+			pr.mux.Unlock()
+			return
+		}
+		if pr.entries > 0 {
+			if err := pr.snapshot(); err != nil {
+				pr.logger.Error().Err(err).Msg("taking snapshot")
+			}
+		}
+		pr.mux.Unlock()
+	}
+}
+
+// Close takes a final snapshot of the repository and closes its log.  Any
+// further changes to the repository fail with ErrClosed.
+func (pr *PendingRepository) Close() error {
+	pr.mux.Lock()
+	defer pr.mux.Unlock()
+	if pr.logFile == nil {
+		return nil
+	}
+	err := pr.snapshot()
+	if closeErr := pr.logFile.Close(); closeErr != nil {
+		err = errors.Join(err, fmt.Errorf("%s %w", "closing log", closeErr))
+	}
+	pr.logFile = nil
+	return err
+}
+
+// record appends the given entry to the log and then applies it to the
+// repository.  If the entry cannot be logged, it is not applied.  The caller
+// must hold pr.mux.
+func (pr *PendingRepository) record(entry logEntry) error {
+	if pr.logFile == nil {
+		return ErrClosed
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("%s %w", "encoding log entry", err)
+	}
+	data = append(data, '\n')
+	if _, err := pr.logFile.Write(data); err != nil {
+		return fmt.Errorf("%s %w", "writing log entry", err)
+	}
+	if pr.sync {
+		if err := pr.logFile.Sync(); err != nil {
+			return fmt.Errorf("%s %w", "syncing log", err)
+		}
+	}
+	pr.entries++
+	return pr.apply(entry)
+}
+
+// apply applies the given log entry to the in-memory repository.
+func (pr *PendingRepository) apply(entry logEntry) error {
+	switch entry.Op {
+	case opPutHost:
+		if entry.Host == nil {
+			return fmt.Errorf("%s entry without a host", entry.Op)
+		}
+		host := *entry.Host
+		if existing, ok := pr.pending.GetHost(host.Id); ok {
+			host.Metrics = existing.Metrics
+		} else if host.Metrics == nil {
+			host.Metrics = map[domain.MetricName]domain.PendingMetric{}
+		}
+		return pr.pending.PutHost(host)
+	case opPutMetric:
+		if entry.Metric == nil {
+			return fmt.Errorf("%s entry without a metric", entry.Op)
+		}
+		host, ok := pr.pending.GetHost(entry.HostId)
+		if !ok {
+			return fmt.Errorf("%w: %s", domain.ErrUnknownHost, entry.HostId)
+		}
+		return pr.pending.PutMetric(host, *entry.Metric)
+	case opUpdateLastProcessed:
+		if entry.Time == nil {
+			return fmt.Errorf("%s entry without a time", entry.Op)
+		}
+		return pr.pending.UpdateLastProcessed(entry.HostId, entry.SeriesKey, *entry.Time)
+	case opDeleteMetric:
+		return pr.pending.DeleteMetric(entry.HostId, entry.SeriesKey)
+	case opDeleteHost:
+		return pr.pending.DeleteHost(entry.HostId)
+	default:
+		return fmt.Errorf("unknown log entry operation %q", entry.Op)
+	}
+}
+
+// snapshot writes the contents of the repository to the snapshot file and
+// starts a new, empty, log.  The snapshot is written to a temporary file
+// which then replaces the previous snapshot, so that a crash leaves either
+// the previous or the new snapshot in place.  If a crash leaves the previous
+// log in place too, replaying it on top of the new snapshot is harmless.
+// The caller must hold pr.mux.
+func (pr *PendingRepository) snapshot() error {
+	start := time.Now()
+	hosts := pr.pending.GetAll()
+	data, err := json.Marshal(snapshot{Taken: start, Hosts: hosts})
+	if err != nil {
+		return fmt.Errorf("%s %w", "encoding snapshot", err)
+	}
+	path := filepath.Join(pr.dir, snapshotFileName)
+	if err := writeFileAtomically(path, data); err != nil {
+		return fmt.Errorf("%s %w", "writing snapshot", err)
+	}
+	if pr.logFile != nil {
+		if err := pr.logFile.Close(); err != nil {
+			pr.logger.Warn().Err(err).Msg("closing log")
+		}
+	}
+	pr.logFile, err = os.OpenFile(filepath.Join(pr.dir, logFileName), os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		pr.logFile = nil
+		return fmt.Errorf("%s %w", "truncating log", err)
+	}
+	pr.entries = 0
+	pr.logger.Info().Int("hosts", len(hosts)).Dur("duration", time.Since(start)).Msg("took snapshot")
+	return nil
+}
+
+// writeFileAtomically writes data to a temporary file and renames it to the
+// given path.
+func writeFileAtomically(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close() //nolint:errcheck
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close() //nolint:errcheck
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// loadSnapshot loads the repository from the snapshot file, if there is one.
+func (pr *PendingRepository) loadSnapshot() error {
+	data, err := os.ReadFile(filepath.Join(pr.dir, snapshotFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("%s %w", "reading snapshot", err)
+	}
+	var s snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("%s %w", "decoding snapshot", err)
+	}
+	for _, host := range s.Hosts {
+		if host.Metrics == nil {
+			host.Metrics = map[domain.MetricName]domain.PendingMetric{}
+		}
+		if err := pr.pending.PutHost(host); err != nil {
+			return fmt.Errorf("%s %w", "loading snapshot", err)
+		}
+	}
+	pr.logger.Info().Int("hosts", len(s.Hosts)).Time("taken", s.Taken).Msg("loaded snapshot")
+	return nil
+}
+
+// replayLog applies each entry in the log, if there is one, to the
+// repository.  An entry that cannot be decoded is skipped.  A final entry
+// without a trailing newline was only partially written and is ignored.
+func (pr *PendingRepository) replayLog() error {
+	f, err := os.Open(filepath.Join(pr.dir, logFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("%s %w", "opening log", err)
+	}
+	defer f.Close() //nolint:errcheck
+	reader := bufio.NewReader(f)
+	replayed := 0
+	for lineNum := 1; ; lineNum++ {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				pr.logger.Warn().Int("line", lineNum).Msg("ignoring partially written log entry")
+			}
+			break
+		} else if err != nil {
+			return fmt.Errorf("%s %w", "reading log", err)
+		}
+		var entry logEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			pr.logger.Warn().Err(err).Int("line", lineNum).Msg("skipping invalid log entry")
+			continue
+		}
+		if err := pr.apply(entry); err != nil {
+			pr.logger.Debug().Err(err).Int("line", lineNum).Str("op", entry.Op).Msg("replaying log entry")
+		}
+		replayed++
+	}
+	pr.logger.Info().Int("entries", replayed).Msg("replayed log")
+	return nil
+}
@@ -0,0 +1,260 @@
+//==============================================================================
+// Copyright (C) 2024-present Alces Flight Ltd.
+//
+// This file is part of Concertim Metric Reporting Daemon.
+//
+// This program and the accompanying materials are made available under
+// the terms of the Eclipse Public License 2.0 which is available at
+// <https://www.eclipse.org/legal/epl-2.0>, or alternative license
+// terms made available by Alces Flight Ltd - please direct inquiries
+// about licensing to licensing@alces-flight.com.
+//
+// Concertim Metric Reporting Daemon is distributed in the hope that it will be useful, but
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED INCLUDING, WITHOUT LIMITATION, ANY WARRANTIES OR CONDITIONS
+// OF TITLE, NON-INFRINGEMENT, MERCHANTABILITY OR FITNESS FOR A
+// PARTICULAR PURPOSE. See the Eclipse Public License 2.0 for more
+// details.
+//
+// You should have received a copy of the Eclipse Public License 2.0
+// along with Concertim Metric Reporting Daemon. If not, see:
+//
+//  https://opensource.org/licenses/EPL-2.0
+//
+// For more information on Concertim Metric Reporting Daemon, please visit:
+// https://github.com/openflighthpc/concertim-metric-reporting-daemon
+//==============================================================================
+
+package wal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/config"
+	"github.com/openflighthpc/concertim-metric-reporting-daemon/domain"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	consoleWriter := zerolog.ConsoleWriter{Out: os.Stderr}
+	log.Logger = zerolog.New(consoleWriter).With().Timestamp().Logger()
+}
+
+func newTestRepo(t *testing.T, dir string) *PendingRepository {
+	t.Helper()
+	repo, err := NewPendingRepository(log.Logger, config.Pending{Store: "wal", Directory: dir})
+	if !assert.NoError(t, err, "unexpected failure opening repository") {
+		t.FailNow()
+	}
+	return repo
+}
+
+// populate adds a host with two metrics to the repository, processes one of
+// them and deletes the other.
+func populate(t *testing.T, repo *PendingRepository, reported time.Time) {
+	t.Helper()
+	host := domain.PendingHost{
+		Id:       "1",
+		DSM:      domain.DSM{GridName: "unspecified", ClusterName: "unspecified", HostName: "comp10"},
+		Reported: reported,
+		Metrics:  map[domain.MetricName]domain.PendingMetric{},
+	}
+	assert.NoError(t, repo.PutHost(host))
+	metric := domain.PendingMetric{
+		Name:     "net.bytes",
+		Value:    "1024",
+		Units:    "B",
+		Slope:    domain.MetricSlopePositive,
+		Reported: reported,
+		TTL:      time.Minute,
+		Type:     domain.MetricTypeUint64,
+		Labels:   domain.Labels{"iface": "eth0"},
+		Backfill: []domain.PendingValue{{Value: "512", Reported: reported.Add(-time.Minute)}},
+	}
+	assert.NoError(t, repo.PutMetric(host, metric))
+	assert.NoError(t, repo.PutMetric(host, domain.PendingMetric{Name: "power.level", Value: "12", Type: domain.MetricTypeUint32, Reported: reported}))
+	assert.NoError(t, repo.UpdateLastProcessed("1", metric.SeriesKey(), reported))
+	assert.NoError(t, repo.DeleteMetric("1", "power.level"))
+	assert.NoError(t, repo.PutMetric(host, domain.PendingMetric{Name: "power.state", Value: "on", Type: domain.MetricTypeString, Reported: reported}))
+	deleted, err := repo.DeleteMatchingMetrics("1", func(m domain.PendingMetric) bool { return m.Name == "power.state" })
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.MetricName{"power.state"}, deleted)
+}
+
+func assertPopulated(t *testing.T, repo *PendingRepository, reported time.Time) {
+	t.Helper()
+	host, ok := repo.GetHost("1")
+	if !assert.True(t, ok, "expected host to be restored") {
+		return
+	}
+	assert.Equal(t, "comp10", host.DSM.HostName)
+	assert.True(t, host.Reported.Equal(reported), "unexpected reported time")
+	assert.Len(t, host.Metrics, 1)
+	metric, ok := host.Metrics["net.bytes;iface=eth0"]
+	if assert.True(t, ok, "expected metric to be restored") {
+		assert.Equal(t, "1024", metric.Value)
+		assert.Equal(t, time.Minute, metric.TTL)
+		assert.Equal(t, domain.MetricTypeUint64, metric.Type)
+		assert.Equal(t, domain.Labels{"iface": "eth0"}, metric.Labels)
+		if assert.NotNil(t, metric.LastProcessed) {
+			assert.True(t, metric.LastProcessed.Equal(reported), "unexpected last processed time")
+		}
+		assert.Empty(t, metric.Backfill, "expected processed backfill to be discarded")
+	}
+}
+
+func Test_RepositoryIsRestoredFromLog(t *testing.T) {
+	// Setup
+	dir := t.TempDir()
+	reported := time.Unix(1696431225, 0)
+	repo := newTestRepo(t, dir)
+	populate(t, repo, reported)
+
+	// Action
+	// The repository is not closed, as if the daemon crashed.
+	restored := newTestRepo(t, dir)
+
+	// Assertions
+	assertPopulated(t, restored, reported)
+}
+
+func Test_RepositoryIsRestoredFromSnapshot(t *testing.T) {
+	// Setup
+	dir := t.TempDir()
+	reported := time.Unix(1696431225, 0)
+	repo := newTestRepo(t, dir)
+	populate(t, repo, reported)
+	assert.NoError(t, repo.Close())
+
+	// Action
+	restored := newTestRepo(t, dir)
+
+	// Assertions
+	logData, err := os.ReadFile(filepath.Join(dir, logFileName))
+	assert.NoError(t, err)
+	assert.Empty(t, logData, "expected log to be truncated by snapshot")
+	assertPopulated(t, restored, reported)
+}
+
+func Test_DeletedHostIsNotRestored(t *testing.T) {
+	// Setup
+	dir := t.TempDir()
+	repo := newTestRepo(t, dir)
+	populate(t, repo, time.Now())
+	assert.NoError(t, repo.DeleteHost("1"))
+
+	// Action
+	restored := newTestRepo(t, dir)
+
+	// Assertions
+	assert.Empty(t, restored.GetAll())
+}
+
+func Test_PartiallyWrittenLogEntryIsIgnored(t *testing.T) {
+	// Setup
+	dir := t.TempDir()
+	reported := time.Unix(1696431225, 0)
+	repo := newTestRepo(t, dir)
+	populate(t, repo, reported)
+	f, err := os.OpenFile(filepath.Join(dir, logFileName), os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = f.WriteString(`{"op":"delete_host","host_id":`)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	// Action
+	restored := newTestRepo(t, dir)
+
+	// Assertions
+	assertPopulated(t, restored, reported)
+}
+
+func Test_ChangesToUnknownHostsAreNotLogged(t *testing.T) {
+	// Setup
+	dir := t.TempDir()
+	repo := newTestRepo(t, dir)
+	host := domain.PendingHost{Id: "NOPE", Metrics: map[domain.MetricName]domain.PendingMetric{}}
+
+	// Action
+	putErr := repo.PutMetric(host, domain.PendingMetric{Name: "power.level", Value: "12", Type: domain.MetricTypeUint32})
+	deleteErr := repo.DeleteHost("NOPE")
+
+	// Assertions
+	assert.ErrorIs(t, putErr, domain.ErrUnknownHost)
+	assert.ErrorIs(t, deleteErr, domain.ErrUnknownHost)
+	logData, err := os.ReadFile(filepath.Join(dir, logFileName))
+	assert.NoError(t, err)
+	assert.Empty(t, logData)
+}
+
+func Test_ClosedRepositoryRejectsChanges(t *testing.T) {
+	// Setup
+	repo := newTestRepo(t, t.TempDir())
+	assert.NoError(t, repo.Close())
+
+	// Action
+	err := repo.PutHost(domain.PendingHost{Id: "1", Metrics: map[domain.MetricName]domain.PendingMetric{}})
+
+	// Assertions
+	assert.ErrorIs(t, err, ErrClosed)
+	assert.Empty(t, repo.GetAll())
+}
+
+func Test_MergedMetricIsRestored(t *testing.T) {
+	// Setup
+	dir := t.TempDir()
+	reported := time.Unix(1696431225, 0)
+	repo := newTestRepo(t, dir)
+	host := domain.PendingHost{
+		Id:       "1",
+		DSM:      domain.DSM{GridName: "unspecified", ClusterName: "unspecified", HostName: "comp10"},
+		Reported: reported,
+	}
+	merge := func(value string) func(domain.PendingHost) (domain.PendingMetric, error) {
+		return func(domain.PendingHost) (domain.PendingMetric, error) {
+			return domain.PendingMetric{Name: "power.level", Value: value, Slope: domain.MetricSlopeBoth, Type: domain.MetricTypeUint32, Reported: reported}, nil
+		}
+	}
+
+	// Action
+	assert.NoError(t, repo.MergeMetric(host, merge("12")))
+	assert.NoError(t, repo.MergeMetric(host, merge("13")))
+	restored := newTestRepo(t, dir)
+
+	// Assertions
+	stored, ok := restored.GetHost("1")
+	if assert.True(t, ok, "expected host to be restored") {
+		assert.Equal(t, "comp10", stored.DSM.HostName)
+		assert.True(t, stored.Reported.Equal(reported), "unexpected reported time")
+		assert.Len(t, stored.Metrics, 1)
+		assert.Equal(t, "13", stored.Metrics["power.level"].Value)
+	}
+}
+
+func Test_PeriodicSnapshotLoopStopsWhenDone(t *testing.T) {
+	// Setup
+	repo, err := NewPendingRepository(log.Logger, config.Pending{Store: "wal", Directory: t.TempDir(), SnapshotInterval: time.Hour})
+	assert.NoError(t, err)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		repo.RunPeriodicSnapshotLoop(done)
+		close(stopped)
+	}()
+
+	// Action
+	close(done)
+
+	// Assertions
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("expected snapshot loop to stop")
+	}
+	assert.NoError(t, repo.Close())
+}